@@ -228,14 +228,15 @@ func main() {
 
 		// Create user
 		_, err := queries.CreateUser(ctx, pgstore.CreateUserParams{
-			ID:        userID,
-			Name:      student.name,
-			Email:     student.email,
-			Phone:     student.phone,
-			Password:  string(passwordHash),
-			Role:      pgstore.RoleStudent,
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:              userID,
+			Name:            student.name,
+			Email:           student.email,
+			Phone:           student.phone,
+			Password:        string(passwordHash),
+			Role:            pgstore.RoleStudent,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			EmailVerifiedAt: &now,
 		})
 		if err != nil {
 			log.Printf("Failed to create student user %s: %v", student.name, err)
@@ -288,14 +289,15 @@ func main() {
 
 		// Create user
 		_, err := queries.CreateUser(ctx, pgstore.CreateUserParams{
-			ID:        userID,
-			Name:      randomName,
-			Email:     fmt.Sprintf("trainer%d@pandoragym.com", i),
-			Phone:     fmt.Sprintf("11%09d", rand.Intn(1000000000)),
-			Password:  string(passwordHash),
-			Role:      pgstore.RolePersonal,
-			CreatedAt: now,
-			UpdatedAt: now,
+			ID:              userID,
+			Name:            randomName,
+			Email:           fmt.Sprintf("trainer%d@pandoragym.com", i),
+			Phone:           fmt.Sprintf("11%09d", rand.Intn(1000000000)),
+			Password:        string(passwordHash),
+			Role:            pgstore.RolePersonal,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			EmailVerifiedAt: &now,
 		})
 		if err != nil {
 			log.Printf("Failed to create personal trainer user: %v", err)
@@ -324,14 +326,15 @@ func main() {
 	personalIDs = append(personalIDs, featuredUserID)
 
 	_, err = queries.CreateUser(ctx, pgstore.CreateUserParams{
-		ID:        featuredUserID,
-		Name:      "Bianca Andrade",
-		Email:     "bianca@pandoragym.com",
-		Phone:     "11987654321",
-		Password:  string(passwordHash),
-		Role:      pgstore.RolePersonal,
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:              featuredUserID,
+		Name:            "Bianca Andrade",
+		Email:           "bianca@pandoragym.com",
+		Phone:           "11987654321",
+		Password:        string(passwordHash),
+		Role:            pgstore.RolePersonal,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		EmailVerifiedAt: &now,
 	})
 	if err != nil {
 		log.Printf("Failed to create featured personal trainer user: %v", err)
@@ -491,6 +494,12 @@ func clearExistingData(ctx context.Context, pool *pgxpool.Pool) {
 		log.Printf("Failed to clear workouts_history: %v", err)
 	}
 	
+	fmt.Println("Clearing workout_session...")
+	_, err = pool.Exec(ctx, "DELETE FROM workout_session")
+	if err != nil {
+		log.Printf("Failed to clear workout_session: %v", err)
+	}
+	
 	fmt.Println("Clearing exercises_setup...")
 	_, err = pool.Exec(ctx, "DELETE FROM exercises_setup")
 	if err != nil {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"fmt"
 	"log"
@@ -39,6 +40,11 @@ func main() {
 	// Bind routes
 	api.BindRoutes()
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	core.StartBackgroundJobs(ctx, &api)
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "3333"
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
@@ -28,7 +29,7 @@ func (api *API) GetReports(w http.ResponseWriter, r *http.Request) {
 	reports, err := api.AnalyticsService.GetReports(r.Context(), reportType, startDate, endDate)
 	if err != nil {
 		api.Logger.Error("Failed to get reports", "error", err, "type", reportType)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get reports")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get reports")
 		return
 	}
 
@@ -48,6 +49,40 @@ func (api *API) GetSystemHealth(w http.ResponseWriter, r *http.Request) {
 	utils.WriteJSONResponse(w, http.StatusOK, health)
 }
 
+// Sign in lockouts (admin only)
+
+func (api *API) GetLoginLockouts(w http.ResponseWriter, r *http.Request) {
+	page := r.URL.Query().Get("page")
+	limit := r.URL.Query().Get("limit")
+
+	lockouts, err := api.AuthService.GetLoginLockouts(r.Context(), page, limit)
+	if err != nil {
+		api.Logger.Error("Failed to get login lockouts", "error", err)
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get lockouts")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, lockouts)
+}
+
+func (api *API) ClearLoginLockout(w http.ResponseWriter, r *http.Request) {
+	lockoutID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid lockout ID")
+		return
+	}
+
+	if err := api.AuthService.ClearLoginLockout(r.Context(), lockoutID); err != nil {
+		api.Logger.Error("Failed to clear login lockout", "error", err, "lockout_id", lockoutID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to clear lockout")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Lockout cleared successfully",
+	})
+}
+
 // Template management (admin only) - now using workout service
 
 // Exercise templates
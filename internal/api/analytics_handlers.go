@@ -21,7 +21,7 @@ func (api *API) GetWorkoutFrequency(w http.ResponseWriter, r *http.Request) {
 	frequency, err := api.AnalyticsService.GetWorkoutFrequency(r.Context(), userID, startDate, endDate)
 	if err != nil {
 		api.Logger.Error("Failed to get workout frequency", "error", err, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get workout frequency")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get workout frequency")
 		return
 	}
 
@@ -35,10 +35,13 @@ func (api *API) GetWorkoutHistoryExercises(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	history, err := api.AnalyticsService.GetWorkoutHistoryExercises(r.Context(), userID)
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
+
+	history, err := api.AnalyticsService.GetWorkoutHistoryExercises(r.Context(), userID, startDate, endDate)
 	if err != nil {
 		api.Logger.Error("Failed to get workout history exercises", "error", err, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get workout history")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get workout history")
 		return
 	}
 
@@ -64,16 +67,49 @@ func (api *API) GetWorkoutExercisePerformanceComparison(w http.ResponseWriter, r
 		return
 	}
 
-	comparison, err := api.AnalyticsService.GetExercisePerformanceComparison(r.Context(), userID, exerciseID)
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
+	formula := r.URL.Query().Get("formula")
+
+	comparison, err := api.AnalyticsService.GetExercisePerformanceComparison(r.Context(), userID, exerciseID, startDate, endDate, formula)
 	if err != nil {
 		api.Logger.Error("Failed to get exercise performance comparison", "error", err, "user_id", userID, "exercise_id", exerciseID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get performance comparison")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get performance comparison")
 		return
 	}
 
 	utils.WriteJSONResponse(w, http.StatusOK, comparison)
 }
 
+func (api *API) GetPersonalRecords(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	var exerciseID *uuid.UUID
+	if exerciseIDStr := r.URL.Query().Get("exercise_id"); exerciseIDStr != "" {
+		parsed, err := uuid.Parse(exerciseIDStr)
+		if err != nil {
+			utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid exercise ID format")
+			return
+		}
+		exerciseID = &parsed
+	}
+
+	formula := r.URL.Query().Get("formula")
+
+	records, err := api.AnalyticsService.GetPersonalRecords(r.Context(), userID, exerciseID, formula)
+	if err != nil {
+		api.Logger.Error("Failed to get personal records", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get personal records")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, records)
+}
+
 func (api *API) GetWorkoutFrequencyForUser(w http.ResponseWriter, r *http.Request) {
 	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
 	if !ok {
@@ -101,7 +137,7 @@ func (api *API) GetWorkoutFrequencyForUser(w http.ResponseWriter, r *http.Reques
 	frequency, err := api.AnalyticsService.GetWorkoutFrequency(r.Context(), userID, startDate, endDate)
 	if err != nil {
 		api.Logger.Error("Failed to get workout frequency for user", "error", err, "trainer_id", trainerID, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get workout frequency")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get workout frequency")
 		return
 	}
 
@@ -129,10 +165,13 @@ func (api *API) GetWorkoutHistoryForUser(w http.ResponseWriter, r *http.Request)
 	//     return
 	// }
 
-	history, err := api.AnalyticsService.GetWorkoutHistoryExercises(r.Context(), userID)
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
+
+	history, err := api.AnalyticsService.GetWorkoutHistoryExercises(r.Context(), userID, startDate, endDate)
 	if err != nil {
 		api.Logger.Error("Failed to get workout history for user", "error", err, "trainer_id", trainerID, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get workout history")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get workout history")
 		return
 	}
 
@@ -172,10 +211,14 @@ func (api *API) GetWorkoutPerformanceForUser(w http.ResponseWriter, r *http.Requ
 	//     return
 	// }
 
-	performance, err := api.AnalyticsService.GetExercisePerformanceComparison(r.Context(), userID, exerciseID)
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
+	formula := r.URL.Query().Get("formula")
+
+	performance, err := api.AnalyticsService.GetExercisePerformanceComparison(r.Context(), userID, exerciseID, startDate, endDate, formula)
 	if err != nil {
 		api.Logger.Error("Failed to get workout performance for user", "error", err, "trainer_id", trainerID, "user_id", userID, "exercise_id", exerciseID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get performance data")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get performance data")
 		return
 	}
 
@@ -2,6 +2,7 @@ package api
 
 import (
 	"log/slog"
+	"net/netip"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/go-chi/chi/v5"
@@ -15,9 +16,15 @@ type API struct {
 	UserService       *services.UserService
 	WorkoutService    *services.WorkoutService
 	SchedulingService *services.SchedulingService
+	CalendarService   *services.CalendarService
 	AuthService       *services.AuthService
 	AnalyticsService  *services.AnalyticsService
 	PlanService       *services.PlanService
 	SystemService     services.SystemService
 	FileService       *services.FileService
+	// BaseURL is the public URL of the API, without a trailing slash, that
+	// links handed out to clients point to
+	BaseURL string
+	// TrustedProxies are the only peers whose forwarding headers are believed
+	TrustedProxies []netip.Prefix
 }
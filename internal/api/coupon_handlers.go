@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+func (api *API) GetTrainerCoupons(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	coupons, err := api.PlanService.GetTrainerCoupons(r.Context(), trainerID)
+	if err != nil {
+		api.Logger.Error("Failed to get trainer coupons", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get coupons")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"coupons": coupons,
+	})
+}
+
+func (api *API) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := utils.DecodeValidJSON[pgstore.CouponRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	coupon, err := api.PlanService.CreateCoupon(r.Context(), trainerID, req)
+	if err != nil {
+		api.Logger.Error("Failed to create coupon", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to create coupon")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, coupon)
+}
+
+func (api *API) UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	couponID := chi.URLParam(r, "id")
+
+	req, err := utils.DecodeValidJSON[pgstore.CouponRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	coupon, err := api.PlanService.UpdateCoupon(r.Context(), trainerID, couponID, req)
+	if err != nil {
+		api.Logger.Error("Failed to update coupon", "error", err, "trainer_id", trainerID, "coupon_id", couponID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to update coupon")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, coupon)
+}
+
+func (api *API) DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	couponID := chi.URLParam(r, "id")
+
+	deactivated, err := api.PlanService.DeleteCoupon(r.Context(), trainerID, couponID)
+	if err != nil {
+		api.Logger.Error("Failed to delete coupon", "error", err, "trainer_id", trainerID, "coupon_id", couponID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to delete coupon")
+		return
+	}
+
+	if deactivated {
+		utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+			"message": "Coupon was already redeemed and was deactivated instead",
+		})
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Coupon deleted successfully",
+	})
+}
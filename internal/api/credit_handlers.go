@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+func (api *API) GetCredits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	credits, err := api.PlanService.GetUserCredits(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to get session credits", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get session credits")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, credits)
+}
+
+func (api *API) GetStudentCredits(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	studentID := chi.URLParam(r, "id")
+
+	credits, err := api.PlanService.GetStudentCredits(r.Context(), trainerID, studentID)
+	if err != nil {
+		api.Logger.Error("Failed to get student session credits", "error", err, "trainer_id", trainerID, "student_id", studentID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get session credits")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, credits)
+}
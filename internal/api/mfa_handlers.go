@@ -0,0 +1,180 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// CompleteMFA finishes a sign in that is waiting for a two-factor code. Token
+// clients send the MFA token they got from /session, browsers rely on their
+// session cookie.
+func (api *API) CompleteMFA(w http.ResponseWriter, r *http.Request) {
+	req, err := utils.DecodeValidJSON[pgstore.CompleteMFARequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.MFAToken != "" {
+		tokens, err := api.AuthService.CompleteMFAForTokens(r.Context(), req.MFAToken, req.Code, clientInfo(r, nil))
+		if err != nil {
+			api.Logger.Error("Two-factor authentication failed", "error", err)
+			utils.WriteServiceErrorResponse(w, err, "Failed to authenticate")
+			return
+		}
+
+		utils.WriteJSONResponse(w, http.StatusOK, tokens)
+		return
+	}
+
+	user, err := api.AuthService.CompleteMFA(r.Context(), req.Code, clientInfo(r, nil))
+	if err != nil {
+		api.Logger.Error("Two-factor authentication failed", "error", err)
+		utils.WriteServiceErrorResponse(w, err, "Failed to authenticate")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]any{
+		"message": "Authentication successful",
+		"user":    user,
+	})
+}
+
+func (api *API) GetMFAStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	role, _ := r.Context().Value(utils.UserRoleKey).(pgstore.Role)
+
+	status, err := api.AuthService.GetMFAStatus(r.Context(), userID, role)
+	if err != nil {
+		api.Logger.Error("Failed to get two-factor authentication status", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get two-factor authentication status")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, status)
+}
+
+func (api *API) StartTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	enrollment, err := api.AuthService.StartTOTPEnrollment(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to start TOTP enrollment", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to start two-factor authentication setup")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, enrollment)
+}
+
+func (api *API) ConfirmTOTPEnrollment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := utils.DecodeValidJSON[pgstore.MFACodeRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := api.AuthService.ConfirmTOTPEnrollment(r.Context(), userID, req.Code)
+	if err != nil {
+		api.Logger.Error("Failed to confirm TOTP enrollment", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, codes)
+}
+
+func (api *API) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	role, _ := r.Context().Value(utils.UserRoleKey).(pgstore.Role)
+
+	req, err := utils.DecodeValidJSON[pgstore.MFACodeRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := api.AuthService.DisableTOTP(r.Context(), userID, role, req.Code); err != nil {
+		api.Logger.Error("Failed to disable TOTP", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+func (api *API) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := utils.DecodeValidJSON[pgstore.MFACodeRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	codes, err := api.AuthService.RegenerateRecoveryCodes(r.Context(), userID, req.Code)
+	if err != nil {
+		api.Logger.Error("Failed to regenerate recovery codes", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, codes)
+}
+
+// Two-factor authentication policies (admin only)
+
+func (api *API) GetMFARolePolicies(w http.ResponseWriter, r *http.Request) {
+	policies, err := api.AuthService.GetMFARolePolicies(r.Context())
+	if err != nil {
+		api.Logger.Error("Failed to get two-factor authentication policies", "error", err)
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get two-factor authentication policies")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, policies)
+}
+
+func (api *API) SetMFARolePolicy(w http.ResponseWriter, r *http.Request) {
+	req, err := utils.DecodeValidJSON[pgstore.SetMFARolePolicyRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policy, err := api.AuthService.SetMFARolePolicy(r.Context(), req.Role, req.Required)
+	if err != nil {
+		api.Logger.Error("Failed to set two-factor authentication policy", "error", err, "role", req.Role)
+		utils.WriteServiceErrorResponse(w, err, "Failed to set two-factor authentication policy")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, policy)
+}
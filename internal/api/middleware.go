@@ -2,14 +2,41 @@ package api
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 
+	"github.com/google/uuid"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
 	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
+// AuthMiddleware accepts a bearer access token or the session cookie, and
+// puts the user ID, role and session ID in the request context
 func (api *API) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token, ok := bearerToken(r); ok {
+			claims, err := api.AuthService.VerifyAccessToken(token)
+			if err != nil {
+				utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid access token")
+				return
+			}
+
+			userID, err := claims.UserID()
+			if err != nil {
+				api.Logger.Error("Failed to get user ID from access token", "error", err)
+				utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid access token")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), utils.UserIDKey, userID)
+			ctx = context.WithValue(ctx, utils.UserRoleKey, claims.Role)
+			ctx = context.WithValue(ctx, utils.SessionIDKey, claims.SessionID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		if !api.AuthService.IsAuthenticated(r.Context()) {
 			utils.WriteErrorResponse(w, http.StatusUnauthorized, "Authentication required")
 			return
@@ -22,22 +49,42 @@ func (api *API) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		userRole, err := api.AuthService.GetUserRoleFromSession(r.Context())
+		if err != nil {
+			api.Logger.Error("Failed to get user role from session", "error", err)
+			utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid session")
+			return
+		}
+
+		api.AuthService.TouchSession(r.Context())
+
 		ctx := context.WithValue(r.Context(), utils.UserIDKey, userID)
+		ctx = context.WithValue(ctx, utils.UserRoleKey, pgstore.Role(userRole))
+		ctx = context.WithValue(ctx, utils.SessionIDKey, api.AuthService.CurrentSessionID(r.Context()))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// bearerToken returns the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// RequireRole must run after AuthMiddleware, which resolves the role
 func (api *API) RequireRole(roles ...pgstore.Role) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			userRole, err := api.AuthService.GetUserRoleFromSession(r.Context())
-			if err != nil {
-				api.Logger.Error("Failed to get user role from session", "error", err)
-				utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid session")
+			role, ok := r.Context().Value(utils.UserRoleKey).(pgstore.Role)
+			if !ok {
+				utils.WriteErrorResponse(w, http.StatusUnauthorized, "Authentication required")
 				return
 			}
 
-			role := pgstore.Role(userRole)
 			hasPermission := false
 			for _, allowedRole := range roles {
 				if role == allowedRole {
@@ -56,6 +103,57 @@ func (api *API) RequireRole(roles ...pgstore.Role) func(http.Handler) http.Handl
 	}
 }
 
+// RequireVerifiedEmail keeps users who haven't verified their email away from
+// actions that reach other people, such as subscribing to plans and messaging
+func (api *API) RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+		if !ok {
+			utils.WriteErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+
+		verified, err := api.AuthService.IsEmailVerified(r.Context(), userID)
+		if err != nil {
+			api.Logger.Error("Failed to check email verification", "error", err, "user_id", userID)
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to check email verification")
+			return
+		}
+		if !verified {
+			utils.WriteErrorResponse(w, http.StatusForbidden, "Email verification required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireMFAEnrollment keeps users whose role requires two-factor
+// authentication away until they enable it. It must run after AuthMiddleware.
+func (api *API) RequireMFAEnrollment(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+		if !ok {
+			utils.WriteErrorResponse(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
+		role, _ := r.Context().Value(utils.UserRoleKey).(pgstore.Role)
+
+		required, err := api.AuthService.IsMFASetupRequired(r.Context(), userID, role)
+		if err != nil {
+			api.Logger.Error("Failed to check two-factor authentication", "error", err, "user_id", userID)
+			utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to check two-factor authentication")
+			return
+		}
+		if required {
+			utils.WriteErrorResponse(w, http.StatusForbidden, "Two-factor authentication setup required")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (api *API) RequireStudent(next http.Handler) http.Handler {
 	return api.RequireRole(pgstore.RoleStudent)(next)
 }
@@ -76,6 +174,67 @@ func (api *API) RequirePersonalOrAdmin(next http.Handler) http.Handler {
 	return api.RequireRole(pgstore.RolePersonal, pgstore.RoleAdmin)(next)
 }
 
+// RealIP sets the remote address of requests that come through one of the
+// trusted proxies to the client address they forwarded. Forwarding headers
+// from anyone else are ignored, as clients could set them to whatever they
+// like and dodge the per-IP sign in throttle.
+func (api *API) RealIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := api.forwardedIP(r); ok {
+			r.RemoteAddr = ip.String()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP walks X-Forwarded-For from the closest hop back, skipping the
+// trusted proxies, and returns the first address it can't vouch for. A lone
+// X-Real-IP is used when X-Forwarded-For is absent.
+func (api *API) forwardedIP(r *http.Request) (netip.Addr, bool) {
+	remote, ok := parseIP(r.RemoteAddr)
+	if !ok || !api.isTrustedProxy(remote) {
+		return netip.Addr{}, false
+	}
+
+	forwardedFor := r.Header.Values("X-Forwarded-For")
+	if len(forwardedFor) == 0 {
+		return parseIP(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	}
+
+	hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := parseIP(strings.TrimSpace(hops[i]))
+		if !ok {
+			return netip.Addr{}, false
+		}
+		if !api.isTrustedProxy(hop) {
+			return hop, true
+		}
+	}
+	return netip.Addr{}, false
+}
+
+func (api *API) isTrustedProxy(ip netip.Addr) bool {
+	for _, prefix := range api.TrustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIP parses an address with or without a port
+func parseIP(address string) (netip.Addr, bool) {
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	ip, err := netip.ParseAddr(address)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
 func (api *API) CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:5173")
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedIP(t *testing.T) {
+	api := &API{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{"untrusted peer", "203.0.113.7:4000", []string{"198.51.100.1"}, "", ""},
+		{"untrusted peer with X-Real-IP", "203.0.113.7:4000", nil, "198.51.100.1", ""},
+		{"trusted peer without headers", "10.0.0.1:4000", nil, "", ""},
+		{"trusted peer with X-Real-IP", "10.0.0.1:4000", nil, "198.51.100.1", "198.51.100.1"},
+		{"single hop", "10.0.0.1:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"X-Forwarded-For wins over X-Real-IP", "10.0.0.1:4000", []string{"198.51.100.1"}, "198.51.100.2", "198.51.100.1"},
+		{"skips trusted hops", "10.0.0.1:4000", []string{"198.51.100.1, 10.0.0.3, 10.0.0.2"}, "", "198.51.100.1"},
+		{"closest untrusted hop", "10.0.0.1:4000", []string{"192.0.2.9, 198.51.100.1, 10.0.0.2"}, "", "198.51.100.1"},
+		{"spoofed first hop is ignored", "10.0.0.1:4000", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"only trusted hops", "10.0.0.1:4000", []string{"10.0.0.3, 10.0.0.2"}, "", ""},
+		{"malformed hop", "10.0.0.1:4000", []string{"198.51.100.1, not-an-ip"}, "", ""},
+		{"IPv6 trusted peer", "[fd00::1]:4000", []string{"2001:db8::1"}, "", "2001:db8::1"},
+		{"IPv4-mapped peer", "[::ffff:10.0.0.1]:4000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			ip, ok := api.forwardedIP(r)
+			got := ""
+			if ok {
+				got = ip.String()
+			}
+			if got != tt.want {
+				t.Errorf("forwardedIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
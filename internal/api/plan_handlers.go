@@ -5,6 +5,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
 	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
@@ -18,7 +19,7 @@ func (api *API) GetTrainerPlans(w http.ResponseWriter, r *http.Request) {
 	plans, err := api.PlanService.GetTrainerPlans(r.Context(), trainerID)
 	if err != nil {
 		api.Logger.Error("Failed to get trainer plans", "error", err, "trainer_id", trainerID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get plans")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get plans")
 		return
 	}
 
@@ -34,22 +35,16 @@ func (api *API) CreatePlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req, err := utils.DecodeValidJSON[struct {
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		Price       float64  `json:"price"`
-		Duration    int      `json:"duration"` // in days
-		Features    []string `json:"features"`
-	}](r)
+	req, err := utils.DecodeValidJSON[pgstore.PlanRequest](r)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	plan, err := api.PlanService.CreatePlan(r.Context(), trainerID, req.Name, req.Description, req.Price, req.Duration, req.Features)
+	plan, err := api.PlanService.CreatePlan(r.Context(), trainerID, req)
 	if err != nil {
 		api.Logger.Error("Failed to create plan", "error", err, "trainer_id", trainerID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create plan")
+		utils.WriteServiceErrorResponse(w, err, "Failed to create plan")
 		return
 	}
 
@@ -65,22 +60,16 @@ func (api *API) UpdatePlan(w http.ResponseWriter, r *http.Request) {
 
 	planID := chi.URLParam(r, "id")
 
-	req, err := utils.DecodeValidJSON[struct {
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		Price       float64  `json:"price"`
-		Duration    int      `json:"duration"`
-		Features    []string `json:"features"`
-	}](r)
+	req, err := utils.DecodeValidJSON[pgstore.PlanRequest](r)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	plan, err := api.PlanService.UpdatePlan(r.Context(), trainerID, planID, req.Name, req.Description, req.Price, req.Duration, req.Features)
+	plan, err := api.PlanService.UpdatePlan(r.Context(), trainerID, planID, req)
 	if err != nil {
 		api.Logger.Error("Failed to update plan", "error", err, "trainer_id", trainerID, "plan_id", planID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update plan")
+		utils.WriteServiceErrorResponse(w, err, "Failed to update plan")
 		return
 	}
 
@@ -96,10 +85,17 @@ func (api *API) DeletePlan(w http.ResponseWriter, r *http.Request) {
 
 	planID := chi.URLParam(r, "id")
 
-	err := api.PlanService.DeletePlan(r.Context(), trainerID, planID)
+	deactivated, err := api.PlanService.DeletePlan(r.Context(), trainerID, planID)
 	if err != nil {
 		api.Logger.Error("Failed to delete plan", "error", err, "trainer_id", trainerID, "plan_id", planID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete plan")
+		utils.WriteServiceErrorResponse(w, err, "Failed to delete plan")
+		return
+	}
+
+	if deactivated {
+		utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+			"message": "Plan has active subscribers and was deactivated instead",
+		})
 		return
 	}
 
@@ -108,42 +104,53 @@ func (api *API) DeletePlan(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (api *API) SubscribeToTrainerPlan(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+func (api *API) GetPlanRevenue(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
 	if !ok {
 		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	req, err := utils.DecodeValidJSON[struct {
-		PlanID string `json:"plan_id"`
-	}](r)
+	planID := chi.URLParam(r, "id")
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
+
+	revenue, err := api.PlanService.GetPlanRevenue(r.Context(), trainerID, planID, startDate, endDate)
 	if err != nil {
-		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		api.Logger.Error("Failed to get plan revenue", "error", err, "trainer_id", trainerID, "plan_id", planID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get plan revenue")
 		return
 	}
 
-	// For now, just return success
-	// TODO: Implement actual subscription logic
-	api.Logger.Info("Plan subscription requested", "user_id", userID, "plan_id", req.PlanID)
-
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Subscribed to plan successfully",
-	})
+	utils.WriteJSONResponse(w, http.StatusOK, revenue)
 }
 
-func (api *API) CancelTrainerPlan(w http.ResponseWriter, r *http.Request) {
-	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+func (api *API) GetTrainerRevenue(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
 	if !ok {
 		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
 		return
 	}
 
-	// For now, just return success
-	// TODO: Implement actual plan cancellation logic
-	api.Logger.Info("Plan cancellation requested", "user_id", userID)
+	startDate := r.URL.Query().Get("start_date")
+	endDate := r.URL.Query().Get("end_date")
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Plan cancelled successfully",
-	})
+	revenue, err := api.PlanService.GetTrainerRevenue(r.Context(), trainerID, startDate, endDate)
+	if err != nil {
+		api.Logger.Error("Failed to get trainer revenue", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get revenue")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, revenue)
+}
+
+// SubscribeToTrainerPlan is the student-only entry point to SubscribeToPlan
+func (api *API) SubscribeToTrainerPlan(w http.ResponseWriter, r *http.Request) {
+	api.SubscribeToPlan(w, r)
+}
+
+// CancelTrainerPlan is the student-only entry point to CancelPlan
+func (api *API) CancelTrainerPlan(w http.ResponseWriter, r *http.Request) {
+	api.CancelPlan(w, r)
 }
@@ -14,7 +14,7 @@ func (api *API) BindRoutes() {
 		r.Use(middleware.Logger)
 		r.Use(middleware.Recoverer)
 		r.Use(middleware.RequestID)
-		r.Use(middleware.RealIP)
+		r.Use(api.RealIP)
 		r.Use(api.CORSMiddleware)
 		r.Use(api.SessionManager.LoadAndSave)
 
@@ -30,6 +30,7 @@ func (api *API) BindRoutes() {
 		r.Post("/upload", api.UploadFile)
 
 		r.Post("/session", api.AuthenticateWithPassword)
+		r.Post("/session/mfa", api.CompleteMFA)
 		r.Post("/register/student", api.CreateStudentAccount)
 		r.Post("/register/personal", api.CreateTrainerAccount)
 		r.Post("/password/recover", api.PasswordRecover)
@@ -37,14 +38,41 @@ func (api *API) BindRoutes() {
 		r.Post("/refresh", api.RefreshSession)
 		r.Post("/revoke", api.RevokeToken)
 		r.Post("/session/data", api.GetSessionData)
+		r.Post("/email/verify", api.VerifyEmail)
+
+		// Calendar apps poll the feed with its token instead of a session
+		r.Get("/schedulings/calendar.ics", api.GetSchedulingsCalendar)
+
+		// Payment providers authenticate with a signature instead of a session
+		r.Post("/webhooks/payments/{provider}", api.HandlePaymentWebhook)
 
 		r.Group(func(r chi.Router) {
 			r.Use(api.AuthMiddleware)
 
+			r.Post("/email/resend", api.ResendEmailVerification)
+
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/profile", api.GetProfile)
 				r.Put("/profile", api.UpdateProfile)
 				r.Post("/avatar", api.UploadAvatar)
+
+				r.Put("/password", api.ChangePassword)
+
+				r.Route("/sessions", func(r chi.Router) {
+					r.Get("/", api.GetSessions)
+					r.Delete("/", api.RevokeOtherSessions)
+					r.Delete("/{id}", api.RevokeSession)
+				})
+
+				r.Route("/mfa", func(r chi.Router) {
+					r.Use(api.RequirePersonalOrAdmin)
+
+					r.Get("/", api.GetMFAStatus)
+					r.Post("/totp", api.StartTOTPEnrollment)
+					r.Post("/totp/confirm", api.ConfirmTOTPEnrollment)
+					r.Delete("/totp", api.DisableTOTP)
+					r.Post("/recovery-codes", api.RegenerateRecoveryCodes)
+				})
 			})
 
 			r.Route("/workouts", func(r chi.Router) {
@@ -84,17 +112,19 @@ func (api *API) BindRoutes() {
 				r.Get("/{id}", api.GetTrainerByID)
 				r.Post("/{id}/comments", api.AddPersonalTrainerComment)
 				r.Get("/{id}/comments", api.GetPersonalTrainerComments)
+				r.Get("/{id}/availability", api.GetTrainerAvailability)
 
 				r.Get("/plans", api.GetTrainerPlans)
 				r.Group(func(r chi.Router) {
 					r.Use(api.RequireStudent)
 
-					r.Post("/", api.SubscribeToTrainerPlan)
+					r.With(api.RequireVerifiedEmail).Post("/", api.SubscribeToTrainerPlan)
 					r.Delete("/", api.CancelTrainerPlan)
 				})
 
 				r.Group(func(r chi.Router) {
 					r.Use(api.RequirePersonal)
+					r.Use(api.RequireMFAEnrollment)
 
 					r.Get("/profile", api.GetTrainerProfile)
 					r.Put("/profile", api.UpdateTrainerProfile)
@@ -104,39 +134,67 @@ func (api *API) BindRoutes() {
 					r.Get("/students/{id}", api.GetStudentByID)
 					r.Get("/students/{id}/workouts", api.GetStudentWorkouts)
 					r.Get("/students/{id}/evolution", api.GetStudentEvolution)
+					r.Get("/students/{id}/credits", api.GetStudentCredits)
 					r.Delete("/students/{id}", api.RemoveStudent)
 
 					r.Post("/plans", api.CreatePlan)
 					r.Put("/plans/{id}", api.UpdatePlan)
 					r.Delete("/plans/{id}", api.DeletePlan)
+					r.Get("/plans/{id}/revenue", api.GetPlanRevenue)
+					r.Get("/revenue", api.GetTrainerRevenue)
+
+					r.Get("/coupons", api.GetTrainerCoupons)
+					r.Post("/coupons", api.CreateCoupon)
+					r.Put("/coupons/{id}", api.UpdateCoupon)
+					r.Delete("/coupons/{id}", api.DeleteCoupon)
 
-					r.Post("/messages", api.SendMessage)
+					r.With(api.RequireVerifiedEmail).Post("/messages", api.SendMessage)
 					r.Get("/schedule", api.GetTrainerSchedule)
 					r.Post("/schedule", api.CreateTrainerSchedule)
+					r.Put("/schedule/{id}", api.UpdateTrainerSchedule)
+					r.Delete("/schedule/{id}", api.DeleteTrainerSchedule)
+					r.Post("/schedule/exceptions", api.CreateTrainerScheduleException)
+					r.Delete("/schedule/exceptions/{id}", api.DeleteTrainerScheduleException)
 				})
 			})
 
 			r.Route("/subscriptions", func(r chi.Router) {
-				r.Post("/", api.SubscribeToPlan)
-				r.Put("/", api.UpdateSubscription)
+				r.Get("/", api.GetSubscription)
+				r.Get("/history", api.GetSubscriptionHistory)
+				r.With(api.RequireVerifiedEmail).Post("/", api.SubscribeToPlan)
+				r.With(api.RequireVerifiedEmail).Put("/", api.UpdateSubscription)
 				r.Delete("/", api.CancelPlan)
+				r.Get("/payments", api.GetPayments)
+				r.Get("/payments/{id}", api.GetPayment)
+				r.Get("/payments/{id}/pix.png", api.GetPaymentPixQRCode)
+				r.Post("/{id}/payments", api.ProcessSubscriptionPayment)
 			})
 
+			r.Get("/credits", api.GetCredits)
+
 			r.Route("/schedulings", func(r chi.Router) {
 				r.Get("/", api.GetSchedulings)
 				r.Post("/", api.CreateScheduling)
+				r.Post("/calendar/token", api.CreateCalendarFeedToken)
+				r.Delete("/calendar/token", api.RevokeCalendarFeedToken)
 				r.Get("/{id}", api.GetScheduling)
 				r.Put("/{id}", api.UpdateScheduling)
 				r.Delete("/{id}", api.CancelScheduling)
+				r.Post("/{id}/confirm", api.ConfirmScheduling)
+				r.Post("/{id}/start", api.StartScheduling)
+				r.Post("/{id}/complete", api.CompleteScheduling)
+				r.Get("/{id}/history", api.GetSchedulingHistory)
 			})
 
 			r.Route("/analytics", func(r chi.Router) {
 				r.Get("/workout-frequency", api.GetWorkoutFrequency)
 				r.Get("/workout-history", api.GetWorkoutHistoryExercises)
 				r.Get("/workout-performance", api.GetWorkoutExercisePerformanceComparison)
+				r.Get("/records", api.GetPersonalRecords)
 
 				r.Group(func(r chi.Router) {
 					r.Use(api.RequirePersonal)
+					r.Use(api.RequireMFAEnrollment)
 					r.Get("/users/{userId}/workout-frequency", api.GetWorkoutFrequencyForUser)
 					r.Get("/users/{userId}/workout-history", api.GetWorkoutHistoryForUser)
 					r.Get("/users/{userId}/workout-performance", api.GetWorkoutPerformanceForUser)
@@ -147,6 +205,7 @@ func (api *API) BindRoutes() {
 		r.Route("/admin", func(r chi.Router) {
 			r.Use(api.AuthMiddleware)
 			r.Use(api.RequireAdmin)
+			r.Use(api.RequireMFAEnrollment)
 
 			r.Route("/users", func(r chi.Router) {
 				r.Get("/", api.GetAllUsers)
@@ -157,8 +216,16 @@ func (api *API) BindRoutes() {
 
 			r.Get("/statistics", api.GetStatistics)
 			r.Get("/reports", api.GetReports)
+			r.Get("/payments/refund-due", api.GetRefundDuePayments)
+			r.Post("/payments/{id}/refund", api.RefundPayment)
 			r.Get("/system/health", api.GetSystemHealth)
 
+			r.Get("/mfa/policies", api.GetMFARolePolicies)
+			r.Put("/mfa/policies", api.SetMFARolePolicy)
+
+			r.Get("/lockouts", api.GetLoginLockouts)
+			r.Delete("/lockouts/{id}", api.ClearLoginLockout)
+
 			r.Route("/templates", func(r chi.Router) {
 				r.Route("/exercises", func(r chi.Router) {
 					r.Get("/", api.GetExerciseTemplatesAdmin)
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"net/url"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -70,14 +71,26 @@ func (api *API) CreateScheduling(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, return mock response
-	// TODO: Implement actual scheduling creation
-	api.Logger.Info("Scheduling creation requested", "user_id", userID, "personal_id", req.PersonalID)
+	if req.Recurrence != nil {
+		series, err := api.SchedulingService.CreateSchedulingSeries(r.Context(), req, userID)
+		if err != nil {
+			api.Logger.Error("Failed to create scheduling series", "error", err, "user_id", userID, "personal_id", req.PersonalID)
+			utils.WriteServiceErrorResponse(w, err, "Failed to create scheduling series")
+			return
+		}
 
-	utils.WriteJSONResponse(w, http.StatusCreated, map[string]string{
-		"message": "Scheduling created successfully",
-		"id":      uuid.New().String(),
-	})
+		utils.WriteJSONResponse(w, http.StatusCreated, series)
+		return
+	}
+
+	scheduling, err := api.SchedulingService.CreateScheduling(r.Context(), req, userID)
+	if err != nil {
+		api.Logger.Error("Failed to create scheduling", "error", err, "user_id", userID, "personal_id", req.PersonalID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to create scheduling")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, scheduling)
 }
 
 func (api *API) UpdateScheduling(w http.ResponseWriter, r *http.Request) {
@@ -100,13 +113,14 @@ func (api *API) UpdateScheduling(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, return mock response
-	// TODO: Implement actual scheduling update
-	api.Logger.Info("Scheduling update requested", "scheduling_id", schedulingID, "user_id", userID, "status", req.Status)
+	scheduling, err := api.SchedulingService.UpdateScheduling(r.Context(), schedulingID, req, userID)
+	if err != nil {
+		api.Logger.Error("Failed to update scheduling", "error", err, "scheduling_id", schedulingID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to update scheduling")
+		return
+	}
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Scheduling updated successfully",
-	})
+	utils.WriteJSONResponse(w, http.StatusOK, scheduling)
 }
 
 func (api *API) CancelScheduling(w http.ResponseWriter, r *http.Request) {
@@ -123,11 +137,183 @@ func (api *API) CancelScheduling(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, return mock response
-	// TODO: Implement actual scheduling cancellation
-	api.Logger.Info("Scheduling cancellation requested", "scheduling_id", schedulingID, "user_id", userID)
+	req, err := utils.DecodeValidJSON[pgstore.CancelSchedulingRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The series scope can also be given in the query, and defaults to THIS
+	if scope := r.URL.Query().Get("scope"); req.Scope == nil && scope != "" {
+		seriesScope := pgstore.SchedulingSeriesScope(scope)
+		req.Scope = &seriesScope
+	}
+
+	scheduling, err := api.SchedulingService.CancelScheduling(r.Context(), schedulingID, req.Reason, req.Scope, userID)
+	if err != nil {
+		api.Logger.Error("Failed to cancel scheduling", "error", err, "scheduling_id", schedulingID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to cancel scheduling")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, scheduling)
+}
+
+func (api *API) ConfirmScheduling(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	schedulingIDStr := chi.URLParam(r, "id")
+	schedulingID, err := uuid.Parse(schedulingIDStr)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid scheduling ID")
+		return
+	}
+
+	scheduling, err := api.SchedulingService.ConfirmScheduling(r.Context(), schedulingID, userID)
+	if err != nil {
+		api.Logger.Error("Failed to confirm scheduling", "error", err, "scheduling_id", schedulingID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to confirm scheduling")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, scheduling)
+}
+
+func (api *API) StartScheduling(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	schedulingIDStr := chi.URLParam(r, "id")
+	schedulingID, err := uuid.Parse(schedulingIDStr)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid scheduling ID")
+		return
+	}
+
+	scheduling, err := api.SchedulingService.StartScheduling(r.Context(), schedulingID, userID)
+	if err != nil {
+		api.Logger.Error("Failed to start scheduling", "error", err, "scheduling_id", schedulingID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to start scheduling")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, scheduling)
+}
+
+func (api *API) CompleteScheduling(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	schedulingIDStr := chi.URLParam(r, "id")
+	schedulingID, err := uuid.Parse(schedulingIDStr)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid scheduling ID")
+		return
+	}
+
+	req, _, err := utils.DecodeOptionalValidJSON[pgstore.CompleteSchedulingRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	scheduling, err := api.SchedulingService.CompleteScheduling(r.Context(), schedulingID, userID, req.Notes)
+	if err != nil {
+		api.Logger.Error("Failed to complete scheduling", "error", err, "scheduling_id", schedulingID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to complete scheduling")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, scheduling)
+}
+
+func (api *API) GetSchedulingHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	schedulingIDStr := chi.URLParam(r, "id")
+	schedulingID, err := uuid.Parse(schedulingIDStr)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid scheduling ID")
+		return
+	}
+
+	history, err := api.SchedulingService.GetSchedulingStatusHistory(r.Context(), schedulingID, userID)
+	if err != nil {
+		api.Logger.Error("Failed to get scheduling history", "error", err, "scheduling_id", schedulingID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get scheduling history")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]any{
+		"history": history,
+	})
+}
+
+// GetSchedulingsCalendar serves the iCalendar feed of the feed token's owner.
+// It is polled by calendar apps, so it authenticates with the token alone.
+func (api *API) GetSchedulingsCalendar(w http.ResponseWriter, r *http.Request) {
+	calendar, err := api.CalendarService.GetFeed(r.Context(), r.URL.Query().Get("token"))
+	if err != nil {
+		api.Logger.Error("Failed to get schedulings calendar", "error", err)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get schedulings calendar")
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="pandoragym.ics"`)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	w.Write(calendar)
+}
+
+func (api *API) CreateCalendarFeedToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	feed, err := api.CalendarService.CreateFeedToken(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to create calendar feed token", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to create calendar feed")
+		return
+	}
+
+	// Built from the configured base URL rather than the request's Host, which
+	// the client controls
+	feed.URL = api.BaseURL + "/schedulings/calendar.ics?" + url.Values{"token": {feed.Token}}.Encode()
+
+	utils.WriteJSONResponse(w, http.StatusCreated, feed)
+}
+
+func (api *API) RevokeCalendarFeedToken(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	if err := api.CalendarService.RevokeFeedToken(r.Context(), userID); err != nil {
+		api.Logger.Error("Failed to revoke calendar feed token", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to revoke calendar feed")
+		return
+	}
 
 	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Scheduling cancelled successfully",
+		"message": "Calendar feed revoked successfully",
 	})
 }
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// GetSessions lists the browser sessions and app sign ins of the user
+func (api *API) GetSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	sessionID, _ := r.Context().Value(utils.SessionIDKey).(string)
+
+	sessions, err := api.AuthService.ListSessions(r.Context(), userID, sessionID)
+	if err != nil {
+		api.Logger.Error("Failed to get sessions", "error", err, "user_id", userID)
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get sessions")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, sessions)
+}
+
+func (api *API) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	sessionID, _ := r.Context().Value(utils.SessionIDKey).(string)
+
+	if err := api.AuthService.RevokeSession(r.Context(), userID, chi.URLParam(r, "id"), sessionID); err != nil {
+		api.Logger.Error("Failed to revoke session", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to revoke session")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Session revoked successfully",
+	})
+}
+
+// RevokeOtherSessions signs the user out everywhere but the current session
+func (api *API) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	sessionID, _ := r.Context().Value(utils.SessionIDKey).(string)
+
+	if err := api.AuthService.RevokeOtherSessions(r.Context(), userID, sessionID); err != nil {
+		api.Logger.Error("Failed to revoke other sessions", "error", err, "user_id", userID)
+		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to revoke other sessions")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Signed out of all other sessions",
+	})
+}
+
+func (api *API) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	sessionID, _ := r.Context().Value(utils.SessionIDKey).(string)
+
+	req, err := utils.DecodeValidJSON[pgstore.ChangePasswordRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = api.AuthService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword, sessionID)
+	if err != nil {
+		api.Logger.Error("Failed to change password", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to change password")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Password changed successfully",
+	})
+}
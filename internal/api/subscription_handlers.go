@@ -1,12 +1,55 @@
 package api
 
 import (
+	"io"
 	"net/http"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/services"
 	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
+// maxPaymentWebhookBody bounds the size of a provider notification
+const maxPaymentWebhookBody = 1 << 20
+
+func (api *API) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	subscription, err := api.PlanService.GetUserSubscription(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to get subscription", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get subscription")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, subscription)
+}
+
+func (api *API) GetSubscriptionHistory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	history, err := api.PlanService.GetSubscriptionHistory(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to get subscription history", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get subscription history")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"history": history,
+	})
+}
+
 func (api *API) SubscribeToPlan(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
 	if !ok {
@@ -14,21 +57,23 @@ func (api *API) SubscribeToPlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req, err := utils.DecodeValidJSON[struct {
-		PlanID string `json:"plan_id"`
-	}](r)
+	req, err := utils.DecodeValidJSON[pgstore.SubscriptionRequest](r)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// For now, just return success
-	// TODO: Implement actual subscription logic
-	api.Logger.Info("Plan subscription requested", "user_id", userID, "plan_id", req.PlanID)
+	subscription, err := api.PlanService.SubscribeToPlan(r.Context(), userID, req)
+	if err != nil {
+		api.Logger.Error("Failed to subscribe to plan", "error", err, "user_id", userID, "plan_id", req.PlanID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to subscribe to plan")
+		return
+	}
+	if subscription.PaymentError != "" {
+		api.Logger.Warn("Subscription payment failed", "error", subscription.PaymentError, "user_id", userID, "subscription_id", subscription.ID)
+	}
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Subscribed to plan successfully",
-	})
+	utils.WriteJSONResponse(w, http.StatusCreated, subscription)
 }
 
 func (api *API) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
@@ -38,21 +83,20 @@ func (api *API) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req, err := utils.DecodeValidJSON[struct {
-		PlanID string `json:"plan_id"`
-	}](r)
+	req, err := utils.DecodeValidJSON[pgstore.SubscriptionRequest](r)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// For now, just return success
-	// TODO: Implement actual subscription logic
-	api.Logger.Info("Plan subscription requested", "user_id", userID, "plan_id", req.PlanID)
+	subscription, err := api.PlanService.UpdateSubscription(r.Context(), userID, req.PlanID)
+	if err != nil {
+		api.Logger.Error("Failed to update subscription", "error", err, "user_id", userID, "plan_id", req.PlanID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to update subscription")
+		return
+	}
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Subscribed to plan successfully",
-	})
+	utils.WriteJSONResponse(w, http.StatusOK, subscription)
 }
 
 func (api *API) CancelPlan(w http.ResponseWriter, r *http.Request) {
@@ -62,11 +106,158 @@ func (api *API) CancelPlan(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// For now, just return success
-	// TODO: Implement actual plan cancellation logic
-	api.Logger.Info("Plan cancellation requested", "user_id", userID)
+	subscription, err := api.PlanService.CancelSubscription(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to cancel subscription", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to cancel subscription")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, subscription)
+}
+
+func (api *API) ProcessSubscriptionPayment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid subscription ID")
+		return
+	}
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Plan cancelled successfully",
+	req, err := utils.DecodeValidJSON[pgstore.ProcessPaymentRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	payment, err := api.PlanService.ProcessPayment(r.Context(), userID, subscriptionID, req.PaymentMethod, req.PaymentToken)
+	if err != nil {
+		api.Logger.Error("Failed to process payment", "error", err, "user_id", userID, "subscription_id", subscriptionID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to process payment")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, payment)
+}
+
+func (api *API) GetPayments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	payments, err := api.PlanService.GetUserPayments(r.Context(), userID)
+	if err != nil {
+		api.Logger.Error("Failed to get payments", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get payments")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"payments": payments,
 	})
 }
+
+func (api *API) GetPayment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	paymentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid payment ID")
+		return
+	}
+
+	payment, err := api.PlanService.GetPayment(r.Context(), userID, paymentID)
+	if err != nil {
+		api.Logger.Error("Failed to get payment", "error", err, "user_id", userID, "payment_id", paymentID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get payment")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, payment)
+}
+
+func (api *API) GetPaymentPixQRCode(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	paymentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid payment ID")
+		return
+	}
+
+	png, err := api.PlanService.GetPaymentPixQRCode(r.Context(), userID, paymentID)
+	if err != nil {
+		api.Logger.Error("Failed to get pix qr code", "error", err, "user_id", userID, "payment_id", paymentID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get pix qr code")
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(png)
+}
+
+func (api *API) GetRefundDuePayments(w http.ResponseWriter, r *http.Request) {
+	payments, err := api.PlanService.GetRefundDuePayments(r.Context())
+	if err != nil {
+		api.Logger.Error("Failed to get refund due payments", "error", err)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get refund due payments")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"payments": payments,
+	})
+}
+
+func (api *API) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	paymentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid payment ID")
+		return
+	}
+
+	payment, err := api.PlanService.RefundPayment(r.Context(), paymentID)
+	if err != nil {
+		api.Logger.Error("Failed to refund payment", "error", err, "payment_id", paymentID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to refund payment")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, payment)
+}
+
+func (api *API) HandlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	provider := chi.URLParam(r, "provider")
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPaymentWebhookBody))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	result, err := api.PlanService.HandlePaymentWebhook(r.Context(), provider, r.Header.Get(services.PaymentWebhookSignatureHeader), payload)
+	if err != nil {
+		api.Logger.Error("Failed to handle payment webhook", "error", err, "provider", provider)
+		utils.WriteServiceErrorResponse(w, err, "Failed to handle payment webhook")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, result)
+}
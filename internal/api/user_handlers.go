@@ -1,11 +1,16 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/services"
 	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
@@ -16,10 +21,28 @@ func (api *API) AuthenticateWithPassword(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	user, err := api.AuthService.AuthenticateWithPassword(r.Context(), req.Email, req.Password)
+	if req.IssueTokens {
+		tokens, challenge, err := api.AuthService.AuthenticateForTokens(r.Context(), req.Email, req.Password, clientInfo(r, req.DeviceInfo))
+		if err != nil {
+			api.writeAuthenticationError(w, err, req.Email)
+			return
+		}
+		if challenge != nil {
+			utils.WriteJSONResponse(w, http.StatusOK, challenge)
+			return
+		}
+
+		utils.WriteJSONResponse(w, http.StatusOK, tokens)
+		return
+	}
+
+	user, challenge, err := api.AuthService.AuthenticateWithPassword(r.Context(), req.Email, req.Password, clientInfo(r, req.DeviceInfo))
 	if err != nil {
-		api.Logger.Error("Authentication failed", "error", err, "email", req.Email)
-		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
+		api.writeAuthenticationError(w, err, req.Email)
+		return
+	}
+	if challenge != nil {
+		utils.WriteJSONResponse(w, http.StatusOK, challenge)
 		return
 	}
 
@@ -29,6 +52,21 @@ func (api *API) AuthenticateWithPassword(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// writeAuthenticationError answers every rejected sign in the same way,
+// whether or not the email has an account
+func (api *API) writeAuthenticationError(w http.ResponseWriter, err error, email string) {
+	api.Logger.Error("Authentication failed", "error", err, "email", email)
+	if errors.Is(err, utils.ErrUnauthorized) {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+	if errors.Is(err, utils.ErrTooManyRequests) {
+		utils.WriteErrorResponse(w, http.StatusTooManyRequests, "Too many failed sign in attempts, try again later")
+		return
+	}
+	utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to authenticate")
+}
+
 func (api *API) GetSessionData(w http.ResponseWriter, r *http.Request) {
 	sessionData, err := api.AuthService.GetSessionData(r.Context())
 	if err != nil {
@@ -40,6 +78,10 @@ func (api *API) GetSessionData(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// mailTimeout bounds sending an email, as the mailer only gives up on a slow
+// mail server once its context is done
+const mailTimeout = 30 * time.Second
+
 func (api *API) CreateStudentAccount(w http.ResponseWriter, r *http.Request) {
 	req, err := utils.DecodeValidJSON[pgstore.CreateStudentWithUserRequest](r)
 	if err != nil {
@@ -54,6 +96,8 @@ func (api *API) CreateStudentAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	api.sendEmailVerification(r, user.ID)
+
 	utils.WriteJSONResponse(w, http.StatusCreated, user)
 }
 
@@ -71,9 +115,64 @@ func (api *API) CreateTrainerAccount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	api.sendEmailVerification(r, user.ID)
+
 	utils.WriteJSONResponse(w, http.StatusCreated, user)
 }
 
+// sendEmailVerification emails a new account its verification link after
+// responding, so a slow mail server doesn't hold up signing up. The account
+// exists either way, so a failure is only logged; the user can ask for the
+// link again.
+func (api *API) sendEmailVerification(r *http.Request, userID uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), mailTimeout)
+	go func() {
+		defer cancel()
+		if err := api.AuthService.SendEmailVerification(ctx, userID); err != nil {
+			api.Logger.Error("Failed to send email verification", "error", err, "user_id", userID)
+		}
+	}()
+}
+
+func (api *API) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	req, err := utils.DecodeValidJSON[pgstore.VerifyEmailRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := api.AuthService.VerifyEmail(r.Context(), req.Token); err != nil {
+		api.Logger.Error("Email verification failed", "error", err)
+		utils.WriteServiceErrorResponse(w, err, "Failed to verify email")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Email verified successfully",
+	})
+}
+
+func (api *API) ResendEmailVerification(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mailTimeout)
+	defer cancel()
+
+	if err := api.AuthService.SendEmailVerification(ctx, userID); err != nil {
+		api.Logger.Error("Failed to resend email verification", "error", err, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to send verification email")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+		"message": "Verification email sent",
+	})
+}
+
 func (api *API) PasswordRecover(w http.ResponseWriter, r *http.Request) {
 	req, err := utils.DecodeValidJSON[struct {
 		Email string `json:"email" validate:"required,email"`
@@ -83,15 +182,19 @@ func (api *API) PasswordRecover(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = api.AuthService.InitiatePasswordRecovery(r.Context(), req.Email)
-	if err != nil {
-		api.Logger.Error("Password recovery failed", "error", err, "email", req.Email)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to initiate password recovery")
-		return
-	}
+	// Looking the account up and mailing it happen after responding, so
+	// neither the response time nor its status tell whether the email has an
+	// account
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), mailTimeout)
+	go func() {
+		defer cancel()
+		if err := api.AuthService.InitiatePasswordRecovery(ctx, req.Email); err != nil {
+			api.Logger.Error("Password recovery failed", "error", err, "email", req.Email)
+		}
+	}()
 
 	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Password recovery email sent",
+		"message": "If the email has an account, a password recovery email was sent",
 	})
 }
 
@@ -108,7 +211,7 @@ func (api *API) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	err = api.AuthService.ResetPassword(r.Context(), req.Token, req.NewPassword)
 	if err != nil {
 		api.Logger.Error("Password reset failed", "error", err)
-		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid or expired reset token")
+		utils.WriteServiceErrorResponse(w, err, "Failed to reset password")
 		return
 	}
 
@@ -117,8 +220,28 @@ func (api *API) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RefreshSession renews the session cookie, or swaps the refresh token in the
+// body for a new access/refresh token pair
 func (api *API) RefreshSession(w http.ResponseWriter, r *http.Request) {
-	err := api.AuthService.RefreshSession(r.Context())
+	req, hasBody, err := utils.DecodeOptionalValidJSON[pgstore.RefreshTokenRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if hasBody {
+		tokens, err := api.AuthService.RefreshTokens(r.Context(), req.RefreshToken, clientInfo(r, nil))
+		if err != nil {
+			api.Logger.Error("Token refresh failed", "error", err)
+			utils.WriteServiceErrorResponse(w, err, "Failed to refresh tokens")
+			return
+		}
+
+		utils.WriteJSONResponse(w, http.StatusOK, tokens)
+		return
+	}
+
+	err = api.AuthService.RefreshSession(r.Context())
 	if err != nil {
 		api.Logger.Error("Session refresh failed", "error", err)
 		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Failed to refresh session")
@@ -130,8 +253,24 @@ func (api *API) RefreshSession(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// RevokeToken ends the session, and the token family of the refresh token in
+// the body if there is one
 func (api *API) RevokeToken(w http.ResponseWriter, r *http.Request) {
-	err := api.AuthService.Logout(r.Context())
+	req, hasBody, err := utils.DecodeOptionalValidJSON[pgstore.RefreshTokenRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if hasBody {
+		if err := api.AuthService.RevokeRefreshToken(r.Context(), req.RefreshToken); err != nil {
+			api.Logger.Error("Failed to revoke refresh token", "error", err)
+			utils.WriteServiceErrorResponse(w, err, "Failed to revoke refresh token")
+			return
+		}
+	}
+
+	err = api.AuthService.Logout(r.Context())
 	if err != nil {
 		api.Logger.Error("Logout failed", "error", err)
 		utils.WriteErrorResponse(w, http.StatusBadRequest, "Failed to logout")
@@ -143,6 +282,26 @@ func (api *API) RevokeToken(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// clientInfo describes the device behind a request, from the device info the
+// client sent or else its user agent
+func clientInfo(r *http.Request, deviceInfo *string) services.ClientInfo {
+	if deviceInfo == nil {
+		if userAgent := r.UserAgent(); userAgent != "" {
+			deviceInfo = &userAgent
+		}
+	}
+
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	return services.ClientInfo{
+		DeviceInfo: deviceInfo,
+		IPAddress:  &ip,
+	}
+}
+
 func (api *API) GetProfile(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
 	if !ok {
@@ -477,14 +636,163 @@ func (api *API) SendMessage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (api *API) GetTrainerSchedule(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	schedule, err := api.SchedulingService.GetTrainerSchedule(r.Context(), trainerID)
+	if err != nil {
+		api.Logger.Error("Failed to get trainer schedule", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get trainer schedule")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, schedule)
+}
+
+func (api *API) CreateTrainerSchedule(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := utils.DecodeValidJSON[pgstore.PersonalScheduleRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := api.SchedulingService.CreateTrainerScheduleWindow(r.Context(), trainerID, req)
+	if err != nil {
+		api.Logger.Error("Failed to create trainer schedule window", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to create schedule window")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, window)
+}
+
+func (api *API) UpdateTrainerSchedule(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	windowID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid schedule window ID")
+		return
+	}
+
+	req, err := utils.DecodeValidJSON[pgstore.PersonalScheduleRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	window, err := api.SchedulingService.UpdateTrainerScheduleWindow(r.Context(), trainerID, windowID, req)
+	if err != nil {
+		api.Logger.Error("Failed to update trainer schedule window", "error", err, "trainer_id", trainerID, "window_id", windowID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to update schedule window")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, window)
+}
+
+func (api *API) DeleteTrainerSchedule(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	windowID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid schedule window ID")
+		return
+	}
+
+	if err := api.SchedulingService.DeleteTrainerScheduleWindow(r.Context(), trainerID, windowID); err != nil {
+		api.Logger.Error("Failed to delete trainer schedule window", "error", err, "trainer_id", trainerID, "window_id", windowID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to delete schedule window")
+		return
+	}
+
 	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Personal trainer schedule not implemented yet",
+		"message": "Schedule window deleted successfully",
 	})
 }
 
-func (api *API) CreateTrainerSchedule(w http.ResponseWriter, r *http.Request) {
+func (api *API) CreateTrainerScheduleException(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	req, err := utils.DecodeValidJSON[pgstore.CreateScheduleExceptionRequest](r)
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	exception, err := api.SchedulingService.CreateTrainerScheduleException(r.Context(), trainerID, req)
+	if err != nil {
+		api.Logger.Error("Failed to create trainer schedule exception", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to create schedule exception")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusCreated, exception)
+}
+
+func (api *API) DeleteTrainerScheduleException(w http.ResponseWriter, r *http.Request) {
+	trainerID, ok := r.Context().Value(utils.UserIDKey).(uuid.UUID)
+	if !ok {
+		utils.WriteErrorResponse(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	exceptionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid schedule exception ID")
+		return
+	}
+
+	if err := api.SchedulingService.DeleteTrainerScheduleException(r.Context(), trainerID, exceptionID); err != nil {
+		api.Logger.Error("Failed to delete trainer schedule exception", "error", err, "trainer_id", trainerID, "exception_id", exceptionID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to delete schedule exception")
+		return
+	}
+
 	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
-		"message": "Personal trainer schedule creation not implemented yet",
+		"message": "Schedule exception deleted successfully",
+	})
+}
+
+func (api *API) GetTrainerAvailability(w http.ResponseWriter, r *http.Request) {
+	trainerID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid trainer ID")
+		return
+	}
+
+	query := r.URL.Query()
+	slots, err := api.SchedulingService.GetTrainerAvailability(r.Context(), trainerID,
+		query.Get("from"), query.Get("to"), query.Get("duration"), query.Get("timezone"))
+	if err != nil {
+		api.Logger.Error("Failed to get trainer availability", "error", err, "trainer_id", trainerID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to get trainer availability")
+		return
+	}
+
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]any{
+		"slots": slots,
 	})
 }
 
@@ -496,11 +804,12 @@ func (api *API) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	limit := r.URL.Query().Get("limit")
 	role := r.URL.Query().Get("role")
 	search := r.URL.Query().Get("search")
+	emailVerified := r.URL.Query().Get("email_verified")
 
-	users, total, err := api.UserService.GetAllUsers(page, limit, role, search)
+	users, total, err := api.UserService.GetAllUsers(r.Context(), page, limit, role, search, emailVerified)
 	if err != nil {
 		api.Logger.Error("Failed to get all users", "error", err)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get users")
+		utils.WriteServiceErrorResponse(w, err, "Failed to get users")
 		return
 	}
 
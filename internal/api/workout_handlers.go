@@ -105,7 +105,7 @@ func (api *API) UpdateWorkout(w http.ResponseWriter, r *http.Request) {
 	workout, err := api.WorkoutService.UpdateWorkout(r.Context(), workoutID, req, userID)
 	if err != nil {
 		api.Logger.Error("Failed to update workout", "error", err, "workout_id", workoutID, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update workout")
+		utils.WriteServiceErrorResponse(w, err, "Failed to update workout")
 		return
 	}
 
@@ -129,7 +129,7 @@ func (api *API) DeleteWorkout(w http.ResponseWriter, r *http.Request) {
 	err = api.WorkoutService.DeleteWorkout(r.Context(), workoutID, userID)
 	if err != nil {
 		api.Logger.Error("Failed to delete workout", "error", err, "workout_id", workoutID, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete workout")
+		utils.WriteServiceErrorResponse(w, err, "Failed to delete workout")
 		return
 	}
 
@@ -276,27 +276,28 @@ func (api *API) FinishWorkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workoutIDStr := chi.URLParam(r, "id")
+	workoutID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid workout ID")
+		return
+	}
 
-	req, err := utils.DecodeValidJSON[struct {
-		Duration  int                      `json:"duration"`
-		Exercises []map[string]interface{} `json:"exercises"`
-		Notes     string                   `json:"notes,omitempty"`
-	}](r)
+	req, err := utils.DecodeValidJSON[pgstore.FinishWorkoutRequest](r)
 	if err != nil {
 		utils.WriteErrorResponse(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	err = api.WorkoutService.FinishWorkout(r.Context(), userID.String(), workoutIDStr, req.Duration, req.Exercises, req.Notes)
+	session, err := api.WorkoutService.FinishWorkout(r.Context(), userID, workoutID, req)
 	if err != nil {
-		api.Logger.Error("Failed to finish workout", "error", err, "workout_id", workoutIDStr, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to finish workout")
+		api.Logger.Error("Failed to finish workout", "error", err, "workout_id", workoutID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to finish workout")
 		return
 	}
 
-	utils.WriteJSONResponse(w, http.StatusOK, map[string]string{
+	utils.WriteJSONResponse(w, http.StatusOK, map[string]any{
 		"message": "Workout completed successfully",
+		"session": session,
 	})
 }
 
@@ -307,16 +308,20 @@ func (api *API) ExecuteWorkout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	workoutIDStr := chi.URLParam(r, "id")
+	workoutID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteErrorResponse(w, http.StatusBadRequest, "Invalid workout ID")
+		return
+	}
 
-	result, err := api.WorkoutService.ExecuteWorkout(r.Context(), userID.String(), workoutIDStr)
+	session, err := api.WorkoutService.ExecuteWorkout(r.Context(), userID, workoutID)
 	if err != nil {
-		api.Logger.Error("Failed to execute workout", "error", err, "workout_id", workoutIDStr, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to execute workout")
+		api.Logger.Error("Failed to execute workout", "error", err, "workout_id", workoutID, "user_id", userID)
+		utils.WriteServiceErrorResponse(w, err, "Failed to execute workout")
 		return
 	}
 
-	utils.WriteJSONResponse(w, http.StatusOK, result)
+	utils.WriteJSONResponse(w, http.StatusOK, session)
 }
 
 func (api *API) RateWorkout(w http.ResponseWriter, r *http.Request) {
@@ -356,7 +361,7 @@ func (api *API) GetWorkoutHistory(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	history, err := api.WorkoutService.GetWorkoutHistory(r.Context(), userID.String())
+	history, err := api.WorkoutService.GetWorkoutHistory(r.Context(), userID)
 	if err != nil {
 		api.Logger.Error("Failed to get workout history", "error", err, "user_id", userID)
 		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to get workout history")
@@ -404,7 +409,7 @@ func (api *API) AddExerciseToWorkout(w http.ResponseWriter, r *http.Request) {
 	err = api.WorkoutService.AddExerciseToWorkout(r.Context(), workoutID, exerciseID, userID, req.Sets, req.Reps, req.RestTime)
 	if err != nil {
 		api.Logger.Error("Failed to add exercise to workout", "error", err, "workout_id", workoutID, "exercise_id", exerciseID, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to add exercise to workout")
+		utils.WriteServiceErrorResponse(w, err, "Failed to add exercise to workout")
 		return
 	}
 
@@ -437,7 +442,7 @@ func (api *API) RemoveExerciseFromWorkout(w http.ResponseWriter, r *http.Request
 	err = api.WorkoutService.RemoveExerciseFromWorkout(r.Context(), workoutID, exerciseID, userID)
 	if err != nil {
 		api.Logger.Error("Failed to remove exercise from workout", "error", err, "workout_id", workoutID, "exercise_id", exerciseID, "user_id", userID)
-		utils.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to remove exercise from workout")
+		utils.WriteServiceErrorResponse(w, err, "Failed to remove exercise from workout")
 		return
 	}
 
@@ -1,7 +1,16 @@
 package core
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"log/slog"
 	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexedwards/scs/pgxstore"
@@ -24,12 +33,22 @@ func InjectDependencies(queries *pgstore.Queries, pool *pgxpool.Pool) api.API {
 	sessionManager.Cookie.SameSite = http.SameSiteLaxMode
 	// sessionManager.Cookie.Secure = os.Getenv("ENV") == "production"
 
-	userService := services.NewUserService(queries, sessionManager)
-	workoutService := services.NewWorkoutService(queries, pool)
-	schedulingService := services.NewSchedulingService(queries)
-	authService := services.NewAuthService(queries, sessionManager)
-	analyticsService := services.NewAnalyticsService(queries)
-	planService := services.NewPlanService(queries)
+	mailService := services.NewMailService(mailerFromEnv(logger), services.MailConfig{
+		From:        envOrDefault("MAIL_FROM", defaultMailFrom),
+		FrontendURL: strings.TrimSuffix(envOrDefault("FRONTEND_URL", defaultFrontendURL), "/"),
+	})
+	authService := services.NewAuthService(queries, pool, sessionManager, mailService, services.AuthConfig{
+		AccessTokens: accessTokensFromEnv(logger),
+		TokenKey:     authTokenKeyFromEnv(logger),
+		MFAKey:       mfaKeyFromEnv(),
+	})
+	appLocation := appLocationFromEnv()
+	userService := services.NewUserService(queries, authService)
+	workoutService := services.NewWorkoutService(queries, pool, logger)
+	schedulingService := services.NewSchedulingService(queries, pool, appLocation)
+	calendarService := services.NewCalendarService(queries, pool)
+	analyticsService := services.NewAnalyticsService(queries, appLocation)
+	planService := services.NewPlanService(queries, pool, services.NewFakePaymentGateway(), paymentConfigFromEnv())
 	fileService := services.NewFileService(queries)
 	systemService := services.NewSystemService()
 
@@ -39,11 +58,216 @@ func InjectDependencies(queries *pgstore.Queries, pool *pgxpool.Pool) api.API {
 		UserService:       userService,
 		WorkoutService:    workoutService,
 		SchedulingService: schedulingService,
+		CalendarService:   calendarService,
 		AuthService:       authService,
 		AnalyticsService:  analyticsService,
 		PlanService:       planService,
 		SystemService:     systemService,
 		SessionManager:    sessionManager,
 		FileService:       fileService,
+		BaseURL:           strings.TrimSuffix(envOrDefault("BASE_URL", defaultBaseURL), "/"),
+		TrustedProxies:    trustedProxiesFromEnv(),
+	}
+}
+
+// trustedProxiesFromEnv parses TRUSTED_PROXIES, a comma separated list of the
+// addresses or CIDR ranges of the reverse proxies in front of the API. Unset,
+// the address requests come from is taken as the client's.
+func trustedProxiesFromEnv() []netip.Prefix {
+	var proxies []netip.Prefix
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if ip, err := netip.ParseAddr(entry); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies
+}
+
+// defaultAppTimezone applies when APP_TIMEZONE is unset
+const defaultAppTimezone = "America/Sao_Paulo"
+
+// appLocationFromEnv loads APP_TIMEZONE, the IANA timezone whose calendar days
+// workout analytics are counted in and trainer hours are read in
+func appLocationFromEnv() *time.Location {
+	name := envOrDefault("APP_TIMEZONE", defaultAppTimezone)
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		log.Fatalf("Invalid APP_TIMEZONE %q: %v", name, err)
+	}
+	return location
+}
+
+const (
+	defaultBaseURL     = "http://localhost:3333"
+	defaultMailFrom    = "PandoraGym <no-reply@pandoragym.com>"
+	defaultFrontendURL = "http://localhost:5173"
+	defaultMailDir     = "tmp/mail"
+)
+
+// mailerFromEnv picks the mail transport named by MAIL_TRANSPORT: "smtp",
+// "file" to write .eml files to MAIL_DIR, or "log", the default, which only
+// logs the bodies of the emails when MAIL_LOG_BODY is true
+func mailerFromEnv(logger *slog.Logger) services.Mailer {
+	switch transport := os.Getenv("MAIL_TRANSPORT"); transport {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			log.Fatal("SMTP_HOST is required for the smtp mail transport")
+		}
+		return &services.SMTPMailer{
+			Host:     host,
+			Port:     envOrDefault("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "file":
+		return &services.FileMailer{Dir: envOrDefault("MAIL_DIR", defaultMailDir)}
+	case "", "log":
+		logBody, _ := strconv.ParseBool(os.Getenv("MAIL_LOG_BODY"))
+		return &services.LogMailer{Logger: logger, IncludeBody: logBody}
+	default:
+		log.Fatalf("Unknown MAIL_TRANSPORT %q", transport)
+		return nil
+	}
+}
+
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// defaultAccessTokenLifetime applies when ACCESS_TOKEN_LIFETIME is unset or
+// not a valid duration
+const defaultAccessTokenLifetime = 15 * time.Minute
+
+const accessTokenIssuer = "pandoragym-api"
+
+// accessTokensFromEnv loads the access token keys from ACCESS_TOKEN_KEYS, a
+// list of kid:algorithm:base64-key entries signed with the
+// ACCESS_TOKEN_SIGNING_KEY one (the first by default). Without it JWT_SECRET
+// is used as a single HS256 key, and as a last resort a random key that only
+// lasts until the process exits.
+func accessTokensFromEnv(logger *slog.Logger) *services.AccessTokens {
+	lifetime, err := time.ParseDuration(os.Getenv("ACCESS_TOKEN_LIFETIME"))
+	if err != nil || lifetime <= 0 {
+		lifetime = defaultAccessTokenLifetime
+	}
+
+	keys, err := services.ParseAccessTokenKeys(os.Getenv("ACCESS_TOKEN_KEYS"))
+	if err != nil {
+		log.Fatalf("Invalid ACCESS_TOKEN_KEYS: %v", err)
+	}
+
+	if len(keys) == 0 {
+		secret := []byte(os.Getenv("JWT_SECRET"))
+		if len(secret) == 0 {
+			logger.Warn("ACCESS_TOKEN_KEYS and JWT_SECRET are unset, access tokens will not survive a restart")
+			secret = make([]byte, 32)
+			rand.Read(secret)
+		}
+		keys = []services.AccessTokenKey{{ID: "default", Algorithm: services.AccessTokenHS256, Secret: secret}}
+	}
+
+	signingKeyID := os.Getenv("ACCESS_TOKEN_SIGNING_KEY")
+	if signingKeyID == "" {
+		signingKeyID = keys[0].ID
+	}
+
+	accessTokens, err := services.NewAccessTokens(services.AccessTokenConfig{
+		Issuer:       accessTokenIssuer,
+		Lifetime:     lifetime,
+		SigningKeyID: signingKeyID,
+		Keys:         keys,
+	})
+	if err != nil {
+		log.Fatalf("Invalid access token configuration: %v", err)
+	}
+	return accessTokens
+}
+
+// authTokenKeyFromEnv returns the AUTH_TOKEN_SECRET key that signs email
+// verification links and pending two-factor sign ins, falling back to
+// JWT_SECRET and then to a random key that only lasts until the process exits
+func authTokenKeyFromEnv(logger *slog.Logger) []byte {
+	if secret := os.Getenv("AUTH_TOKEN_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	logger.Warn("AUTH_TOKEN_SECRET and JWT_SECRET are unset, verification links will not survive a restart")
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+// mfaKeyFromEnv returns the MFA_ENCRYPTION_KEY, 32 base64 encoded bytes that
+// TOTP secrets are encrypted with. Without it the key is derived from
+// JWT_SECRET. Startup fails without either, as a random key would leave every
+// enrolled authenticator unusable after a restart.
+func mfaKeyFromEnv() []byte {
+	if encoded := os.Getenv("MFA_ENCRYPTION_KEY"); encoded != "" {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			log.Fatal("MFA_ENCRYPTION_KEY must be 32 base64 encoded bytes")
+		}
+		return key
+	}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		key := sha256.Sum256([]byte(secret))
+		return key[:]
+	}
+
+	log.Fatal("MFA_ENCRYPTION_KEY or JWT_SECRET is required to encrypt two-factor secrets")
+	return nil
+}
+
+// defaultPixPaymentExpiration applies when PIX_PAYMENT_EXPIRATION is unset or
+// not a valid duration
+const defaultPixPaymentExpiration = 30 * time.Minute
+
+// defaultPlatformFeePercent applies when PLATFORM_FEE_PERCENT is unset or not
+// a percentage
+const defaultPlatformFeePercent = 10.0
+
+func paymentConfigFromEnv() services.PaymentConfig {
+	expiration, err := time.ParseDuration(os.Getenv("PIX_PAYMENT_EXPIRATION"))
+	if err != nil || expiration <= 0 {
+		expiration = defaultPixPaymentExpiration
+	}
+
+	feePercent, err := strconv.ParseFloat(os.Getenv("PLATFORM_FEE_PERCENT"), 64)
+	if err != nil || feePercent < 0 || feePercent > 100 {
+		feePercent = defaultPlatformFeePercent
+	}
+
+	pix := services.PixConfig{
+		Key:               os.Getenv("PIX_KEY"),
+		MerchantName:      os.Getenv("PIX_MERCHANT_NAME"),
+		MerchantCity:      os.Getenv("PIX_MERCHANT_CITY"),
+		PaymentExpiration: expiration,
+	}
+	if err := pix.Validate(); err != nil {
+		log.Fatalf("Invalid PIX configuration: %v", err)
+	}
+
+	return services.PaymentConfig{
+		WebhookSecret:      os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		PlatformFeePercent: feePercent,
+		Pix:                pix,
 	}
 }
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/othavioBF/pandoragym-go-api/internal/api"
+)
+
+const (
+	missedSchedulingsInterval   = 5 * time.Minute
+	subscriptionRenewalInterval = 10 * time.Minute
+	paymentExpirationInterval   = time.Minute
+)
+
+// StartBackgroundJobs indexes the cookie sessions missing from the session
+// index once and runs the periodic jobs until ctx is canceled
+func StartBackgroundJobs(ctx context.Context, api *api.API) {
+	go func() {
+		indexed, err := api.AuthService.IndexCookieSessions(ctx)
+		if err != nil {
+			api.Logger.Error("Failed to index sessions", "error", err)
+			return
+		}
+		if indexed > 0 {
+			api.Logger.Info("Indexed sessions", "count", indexed)
+		}
+	}()
+
+	go runPeriodically(ctx, missedSchedulingsInterval, func() {
+		marked, err := api.SchedulingService.MarkMissedSchedulings(ctx)
+		if err != nil {
+			api.Logger.Error("Failed to mark missed schedulings", "error", err)
+			return
+		}
+		if marked > 0 {
+			api.Logger.Info("Marked missed schedulings", "count", marked)
+		}
+	})
+
+	go runPeriodically(ctx, subscriptionRenewalInterval, func() {
+		renewed, ended, err := api.PlanService.ProcessDueSubscriptions(ctx)
+		if err != nil {
+			api.Logger.Error("Failed to process due subscriptions", "error", err)
+			return
+		}
+		if renewed > 0 || ended > 0 {
+			api.Logger.Info("Processed due subscriptions", "renewed", renewed, "ended", ended)
+		}
+	})
+
+	go runPeriodically(ctx, paymentExpirationInterval, func() {
+		expired, err := api.PlanService.ExpirePendingPayments(ctx)
+		if err != nil {
+			api.Logger.Error("Failed to expire pending payments", "error", err)
+			return
+		}
+		if expired > 0 {
+			api.Logger.Info("Expired pending payments", "count", expired)
+		}
+	})
+}
+
+func runPeriodically(ctx context.Context, interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	job()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job()
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+// Date bounds are optional: a nil From or To leaves that side of the range open.
+// To is exclusive.
+type GetWorkoutDaysParams struct {
+	StudentID uuid.UUID  `json:"studentId" db:"student_id"`
+	From      *time.Time `json:"from,omitempty" db:"from"`
+	To        *time.Time `json:"to,omitempty" db:"to"`
+	// TimeZone is the IANA timezone whose days the sessions are bucketed by
+	TimeZone string `json:"timeZone" db:"time_zone"`
+}
+
+type GetWorkoutDaysRow struct {
+	Day           time.Time `json:"day" db:"day"`
+	WorkoutCount  int64     `json:"workoutCount" db:"workout_count"`
+	TotalDuration int64     `json:"totalDuration" db:"total_duration"`
+}
+
+type GetExerciseHistoryParams struct {
+	StudentID uuid.UUID  `json:"studentId" db:"student_id"`
+	From      *time.Time `json:"from,omitempty" db:"from"`
+	To        *time.Time `json:"to,omitempty" db:"to"`
+}
+
+type GetExerciseHistoryRow struct {
+	WorkoutHistoryID uuid.UUID `json:"workoutHistoryId" db:"workout_history_id"`
+	ExerciseID       uuid.UUID `json:"exerciseId" db:"exercise_id"`
+	WorkoutName      string    `json:"workoutName" db:"workout_name"`
+	ExerciseName     string    `json:"exerciseName" db:"exercise_name"`
+	Sets             int64     `json:"sets" db:"sets"`
+	Reps             int64     `json:"reps" db:"reps"`
+	MaxLoad          *float64  `json:"maxLoad,omitempty" db:"max_load"`
+	Duration         int32     `json:"duration" db:"duration"`
+	RestTime         *int32    `json:"restTime,omitempty" db:"rest_time"`
+	CompletedAt      time.Time `json:"completedAt" db:"completed_at"`
+}
+
+type GetWorkingSetsParams struct {
+	StudentID  uuid.UUID  `json:"studentId" db:"student_id"`
+	ExerciseID *uuid.UUID `json:"exerciseId,omitempty" db:"exercise_id"`
+	From       *time.Time `json:"from,omitempty" db:"from"`
+	To         *time.Time `json:"to,omitempty" db:"to"`
+	// ExerciseIDs restricts the sets to several exercises at once
+	ExerciseIDs []uuid.UUID `json:"exerciseIds,omitempty" db:"exercise_ids"`
+}
+
+type GetWorkingSetsRow struct {
+	SessionID    uuid.UUID `json:"sessionId" db:"session_id"`
+	ExerciseID   uuid.UUID `json:"exerciseId" db:"exercise_id"`
+	ExerciseName string    `json:"exerciseName" db:"exercise_name"`
+	SetIndex     int32     `json:"setIndex" db:"set_index"`
+	Reps         int32     `json:"reps" db:"reps"`
+	LoadKg       float64   `json:"loadKg" db:"load_kg"`
+	PerformedAt  time.Time `json:"performedAt" db:"performed_at"`
+}
+
+const getWorkoutDays = `-- name: GetWorkoutDays :many
+SELECT
+  date_trunc('day', finished_at, $4) AS day,
+  COUNT(*) AS workout_count,
+  COALESCE(SUM(duration), 0) AS total_duration
+FROM workout_session
+WHERE student_id = $1
+  AND finished_at IS NOT NULL
+  AND ($2::timestamptz IS NULL OR finished_at >= $2)
+  AND ($3::timestamptz IS NULL OR finished_at < $3)
+GROUP BY date_trunc('day', finished_at, $4)
+ORDER BY day ASC`
+
+// GetWorkoutDays returns the finished sessions of a student bucketed by day
+func (q *Queries) GetWorkoutDays(ctx context.Context, arg GetWorkoutDaysParams) ([]GetWorkoutDaysRow, error) {
+	var items []GetWorkoutDaysRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getWorkoutDays, arg.StudentID, arg.From, arg.To, arg.TimeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getExerciseHistory = `-- name: GetExerciseHistory :many
+SELECT
+  h.id AS workout_history_id,
+  h.exercise_id,
+  w.name AS workout_name,
+  h.exercise_title AS exercise_name,
+  COUNT(s.id) AS sets,
+  COALESCE(ROUND(AVG(s.reps)), 0)::BIGINT AS reps,
+  MAX(s.load_kg)::FLOAT8 AS max_load,
+  COALESCE(ws.duration, h.time_total_workout) AS duration,
+  h.rest_time,
+  ws.finished_at AS completed_at
+FROM workouts_history h
+JOIN workout_session ws ON ws.id = h.session_id
+JOIN workout w ON w.id = h.workout_id
+LEFT JOIN workout_set s ON s.history_id = h.id AND NOT s.is_warmup
+WHERE h.student_id = $1
+  AND ws.finished_at IS NOT NULL
+  AND ($2::timestamptz IS NULL OR ws.finished_at >= $2)
+  AND ($3::timestamptz IS NULL OR ws.finished_at < $3)
+GROUP BY h.id, w.name, ws.duration, ws.finished_at
+ORDER BY ws.finished_at DESC, h.exercise_title ASC`
+
+// GetExerciseHistory returns one row per performed exercise, summarising its
+// working sets. Reps is the average per working set.
+func (q *Queries) GetExerciseHistory(ctx context.Context, arg GetExerciseHistoryParams) ([]GetExerciseHistoryRow, error) {
+	var items []GetExerciseHistoryRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getExerciseHistory, arg.StudentID, arg.From, arg.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getWorkingSets = `-- name: GetWorkingSets :many
+SELECT
+  s.session_id,
+  s.exercise_id,
+  h.exercise_title AS exercise_name,
+  s.set_index,
+  s.reps,
+  s.load_kg::FLOAT8 AS load_kg,
+  ws.finished_at AS performed_at
+FROM workout_set s
+JOIN workouts_history h ON h.id = s.history_id
+JOIN workout_session ws ON ws.id = s.session_id
+WHERE ws.student_id = $1
+  AND ($2::uuid IS NULL OR s.exercise_id = $2)
+  AND NOT s.is_warmup
+  AND ws.finished_at IS NOT NULL
+  AND ($3::timestamptz IS NULL OR ws.finished_at >= $3)
+  AND ($4::timestamptz IS NULL OR ws.finished_at < $4)
+  AND ($5::uuid[] IS NULL OR s.exercise_id = ANY($5))
+ORDER BY ws.finished_at ASC, s.session_id, s.exercise_id, s.set_index ASC`
+
+// GetWorkingSets returns the non-warmup sets of a student in the order they
+// were performed, optionally restricted to some exercises
+func (q *Queries) GetWorkingSets(ctx context.Context, arg GetWorkingSetsParams) ([]GetWorkingSetsRow, error) {
+	var items []GetWorkingSetsRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getWorkingSets, arg.StudentID, arg.ExerciseID, arg.From, arg.To, arg.ExerciseIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
@@ -32,6 +32,28 @@ type ResetPasswordRequest struct {
 	Password string `json:"password" validate:"required,min=6"`
 }
 
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=6"`
+}
+
+// ActiveSession is a place the user is signed in: a browser session or the
+// refresh token family of an app
+type ActiveSession struct {
+	ID         string            `json:"id"`
+	Type       ActiveSessionType `json:"type"`
+	DeviceInfo *string           `json:"deviceInfo,omitempty"`
+	IPAddress  *string           `json:"ipAddress,omitempty"`
+	CreatedAt  *time.Time        `json:"createdAt,omitempty"`
+	LastUsedAt *time.Time        `json:"lastUsedAt,omitempty"`
+	ExpiresAt  time.Time         `json:"expiresAt"`
+	Current    bool              `json:"current"`
+}
+
 type CreatePasswordResetTokenParams struct {
 	UserID    uuid.UUID `json:"userId"`
 	Token     string    `json:"token"`
@@ -72,10 +94,15 @@ func (q *Queries) GetPasswordResetToken(ctx context.Context, token string) (*Pas
 	return &i, nil
 }
 
-const markPasswordResetTokenAsUsed = `-- name: MarkPasswordResetTokenAsUsed :exec
-UPDATE password_reset_tokens SET used_at = NOW() WHERE token = $1`
+const markPasswordResetTokenAsUsed = `-- name: MarkPasswordResetTokenAsUsed :execrows
+UPDATE password_reset_tokens SET used_at = NOW() WHERE token = $1 AND used_at IS NULL`
 
-func (q *Queries) MarkPasswordResetTokenAsUsed(ctx context.Context, token string) error {
-	_, err := q.db.Exec(ctx, markPasswordResetTokenAsUsed, token)
-	return err
+// MarkPasswordResetTokenAsUsed reports whether the token was still unused, so
+// of two concurrent resets with the same token only one goes through
+func (q *Queries) MarkPasswordResetTokenAsUsed(ctx context.Context, token string) (bool, error) {
+	result, err := q.db.Exec(ctx, markPasswordResetTokenAsUsed, token)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
@@ -0,0 +1,131 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CalendarFeedToken struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	UserID     uuid.UUID  `json:"userId" db:"user_id"`
+	TokenHash  string     `json:"-" db:"token_hash"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+}
+
+type CalendarFeedTokenResponse struct {
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type CreateCalendarFeedTokenParams struct {
+	UserID    uuid.UUID `json:"userId" db:"user_id"`
+	TokenHash string    `json:"tokenHash" db:"token_hash"`
+}
+
+type GetCalendarSchedulingsParams struct {
+	UserID uuid.UUID `json:"userId" db:"user_id"`
+	From   time.Time `json:"from" db:"from"`
+}
+
+type GetCalendarSchedulingsRow struct {
+	ID           uuid.UUID        `json:"id" db:"id"`
+	PersonalID   uuid.UUID        `json:"personalId" db:"personal_id"`
+	StudentID    uuid.UUID        `json:"studentId" db:"student_id"`
+	Date         time.Time        `json:"date" db:"date"`
+	EndTime      time.Time        `json:"endTime" db:"end_time"`
+	Type         SchedulingType   `json:"type" db:"type"`
+	Status       SchedulingStatus `json:"status" db:"status"`
+	Notes        *string          `json:"notes,omitempty" db:"notes"`
+	CreatedAt    time.Time        `json:"createdAt" db:"created_at"`
+	WorkoutName  *string          `json:"workoutName,omitempty" db:"workout_name"`
+	PersonalName string           `json:"personalName" db:"personal_name"`
+	StudentName  string           `json:"studentName" db:"student_name"`
+}
+
+const createCalendarFeedToken = `-- name: CreateCalendarFeedToken :one
+INSERT INTO calendar_feed_tokens (user_id, token_hash)
+VALUES ($1, $2)
+RETURNING id, user_id, token_hash, created_at, last_used_at, revoked_at`
+
+func (q *Queries) CreateCalendarFeedToken(ctx context.Context, arg CreateCalendarFeedTokenParams) (*CalendarFeedToken, error) {
+	var i CalendarFeedToken
+	err := pgxscan.Get(ctx, q.db, &i, createCalendarFeedToken, arg.UserID, arg.TokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getActiveCalendarFeedToken = `-- name: GetActiveCalendarFeedToken :one
+SELECT id, user_id, token_hash, created_at, last_used_at, revoked_at
+FROM calendar_feed_tokens
+WHERE token_hash = $1 AND revoked_at IS NULL`
+
+func (q *Queries) GetActiveCalendarFeedToken(ctx context.Context, tokenHash string) (*CalendarFeedToken, error) {
+	var i CalendarFeedToken
+	err := pgxscan.Get(ctx, q.db, &i, getActiveCalendarFeedToken, tokenHash)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const touchCalendarFeedToken = `-- name: TouchCalendarFeedToken :exec
+UPDATE calendar_feed_tokens
+SET last_used_at = NOW()
+WHERE id = $1`
+
+func (q *Queries) TouchCalendarFeedToken(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, touchCalendarFeedToken, id)
+	return err
+}
+
+const revokeCalendarFeedTokens = `-- name: RevokeCalendarFeedTokens :execrows
+UPDATE calendar_feed_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL`
+
+// RevokeCalendarFeedTokens reports whether the user had an active feed token
+func (q *Queries) RevokeCalendarFeedTokens(ctx context.Context, userID uuid.UUID) (bool, error) {
+	result, err := q.db.Exec(ctx, revokeCalendarFeedTokens, userID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const getCalendarSchedulings = `-- name: GetCalendarSchedulings :many
+SELECT
+  s.id, s.personal_id, s.student_id, s.date, s.end_time, s.type, s.status, s.notes, s.created_at,
+  w.name AS workout_name,
+  pu.name AS personal_name,
+  su.name AS student_name
+FROM scheduling s
+LEFT JOIN workout w ON w.id = s.workout_id
+JOIN users pu ON pu.id = s.personal_id
+JOIN users su ON su.id = s.student_id
+WHERE (s.personal_id = $1 OR s.student_id = $1)
+  AND s.end_time >= $2
+ORDER BY s.date ASC`
+
+// GetCalendarSchedulings returns the schedulings of a user ending at or after
+// the given time, with the workout and both participants' names
+func (q *Queries) GetCalendarSchedulings(ctx context.Context, arg GetCalendarSchedulingsParams) ([]GetCalendarSchedulingsRow, error) {
+	var items []GetCalendarSchedulingsRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getCalendarSchedulings, arg.UserID, arg.From)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
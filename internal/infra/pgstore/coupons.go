@@ -0,0 +1,357 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CreateCouponParams struct {
+	PersonalID            uuid.UUID          `json:"personalId" db:"personal_id"`
+	Code                  string             `json:"code" db:"code"`
+	DiscountType          CouponDiscountType `json:"discountType" db:"discount_type"`
+	DiscountPercent       *float64           `json:"discountPercent,omitempty" db:"discount_percent"`
+	DiscountAmount        *Money             `json:"discountAmount,omitempty" db:"discount_amount"`
+	MaxRedemptions        *int32             `json:"maxRedemptions,omitempty" db:"max_redemptions"`
+	MaxRedemptionsPerUser *int32             `json:"maxRedemptionsPerUser,omitempty" db:"max_redemptions_per_user"`
+	ValidFrom             *time.Time         `json:"validFrom,omitempty" db:"valid_from"`
+	ValidUntil            *time.Time         `json:"validUntil,omitempty" db:"valid_until"`
+}
+
+// A nil IsActive keeps the coupon's current state
+type UpdateCouponParams struct {
+	ID                    uuid.UUID          `json:"id" db:"id"`
+	PersonalID            uuid.UUID          `json:"personalId" db:"personal_id"`
+	Code                  string             `json:"code" db:"code"`
+	DiscountType          CouponDiscountType `json:"discountType" db:"discount_type"`
+	DiscountPercent       *float64           `json:"discountPercent,omitempty" db:"discount_percent"`
+	DiscountAmount        *Money             `json:"discountAmount,omitempty" db:"discount_amount"`
+	MaxRedemptions        *int32             `json:"maxRedemptions,omitempty" db:"max_redemptions"`
+	MaxRedemptionsPerUser *int32             `json:"maxRedemptionsPerUser,omitempty" db:"max_redemptions_per_user"`
+	ValidFrom             *time.Time         `json:"validFrom,omitempty" db:"valid_from"`
+	ValidUntil            *time.Time         `json:"validUntil,omitempty" db:"valid_until"`
+	IsActive              *bool              `json:"isActive,omitempty" db:"is_active"`
+}
+
+type GetCouponByIdParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type GetCouponForUpdateParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type GetCouponByCodeForUpdateParams struct {
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+	Code       string    `json:"code" db:"code"`
+}
+
+type DeleteCouponParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type AddCouponPlansParams struct {
+	CouponID   uuid.UUID   `json:"couponId" db:"coupon_id"`
+	PersonalID uuid.UUID   `json:"personalId" db:"personal_id"`
+	PlanIDs    []uuid.UUID `json:"planIds" db:"plan_ids"`
+}
+
+type CouponAppliesToPlanParams struct {
+	CouponID uuid.UUID `json:"couponId" db:"coupon_id"`
+	PlanID   uuid.UUID `json:"planId" db:"plan_id"`
+}
+
+type CountCouponRedemptionsByUserParams struct {
+	CouponID uuid.UUID `json:"couponId" db:"coupon_id"`
+	UserID   uuid.UUID `json:"userId" db:"user_id"`
+}
+
+type CreateCouponRedemptionParams struct {
+	CouponID       uuid.UUID `json:"couponId" db:"coupon_id"`
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	SubscriptionID uuid.UUID `json:"subscriptionId" db:"subscription_id"`
+	Discount       Money     `json:"discount" db:"discount"`
+}
+
+type GetCouponsRow struct {
+	ID                    uuid.UUID          `json:"id" db:"id"`
+	PersonalID            uuid.UUID          `json:"personalId" db:"personal_id"`
+	Code                  string             `json:"code" db:"code"`
+	DiscountType          CouponDiscountType `json:"discountType" db:"discount_type"`
+	DiscountPercent       *float64           `json:"discountPercent,omitempty" db:"discount_percent"`
+	DiscountAmount        *Money             `json:"discountAmount,omitempty" db:"discount_amount"`
+	MaxRedemptions        *int32             `json:"maxRedemptions,omitempty" db:"max_redemptions"`
+	MaxRedemptionsPerUser *int32             `json:"maxRedemptionsPerUser,omitempty" db:"max_redemptions_per_user"`
+	RedemptionCount       int32              `json:"redemptionCount" db:"redemption_count"`
+	ValidFrom             *time.Time         `json:"validFrom,omitempty" db:"valid_from"`
+	ValidUntil            *time.Time         `json:"validUntil,omitempty" db:"valid_until"`
+	IsActive              bool               `json:"isActive" db:"is_active"`
+	PlanIDs               []uuid.UUID        `json:"planIds" db:"plan_ids"`
+	CreatedAt             time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt             time.Time          `json:"updatedAt" db:"updated_at"`
+}
+
+const createCoupon = `-- name: CreateCoupon :one
+INSERT INTO coupon (personal_id, code, discount_type, discount_percent, discount_amount, max_redemptions, max_redemptions_per_user, valid_from, valid_until)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id, personal_id, code, discount_type, discount_percent, discount_amount, max_redemptions, max_redemptions_per_user, redemption_count, valid_from, valid_until, is_active, created_at, updated_at`
+
+func (q *Queries) CreateCoupon(ctx context.Context, arg CreateCouponParams) (*Coupon, error) {
+	var i Coupon
+	err := pgxscan.Get(ctx, q.db, &i, createCoupon,
+		arg.PersonalID,
+		arg.Code,
+		arg.DiscountType,
+		arg.DiscountPercent,
+		arg.DiscountAmount,
+		arg.MaxRedemptions,
+		arg.MaxRedemptionsPerUser,
+		arg.ValidFrom,
+		arg.ValidUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const updateCoupon = `-- name: UpdateCoupon :one
+UPDATE coupon
+SET code = $3, discount_type = $4, discount_percent = $5, discount_amount = $6, max_redemptions = $7,
+    max_redemptions_per_user = $8, valid_from = $9, valid_until = $10,
+    is_active = COALESCE($11, is_active), updated_at = NOW()
+WHERE id = $1 AND personal_id = $2
+RETURNING id, personal_id, code, discount_type, discount_percent, discount_amount, max_redemptions, max_redemptions_per_user, redemption_count, valid_from, valid_until, is_active, created_at, updated_at`
+
+// UpdateCoupon replaces a coupon of the trainer, returning nil when the
+// trainer does not own it
+func (q *Queries) UpdateCoupon(ctx context.Context, arg UpdateCouponParams) (*Coupon, error) {
+	var i Coupon
+	err := pgxscan.Get(ctx, q.db, &i, updateCoupon,
+		arg.ID,
+		arg.PersonalID,
+		arg.Code,
+		arg.DiscountType,
+		arg.DiscountPercent,
+		arg.DiscountAmount,
+		arg.MaxRedemptions,
+		arg.MaxRedemptionsPerUser,
+		arg.ValidFrom,
+		arg.ValidUntil,
+		arg.IsActive,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getCoupons = `-- name: GetCoupons :many
+SELECT
+  c.id, c.personal_id, c.code, c.discount_type, c.discount_percent, discount_amount, c.max_redemptions,
+  c.max_redemptions_per_user, c.redemption_count, c.valid_from, c.valid_until, c.is_active,
+  ARRAY(SELECT cp.plan_id FROM coupon_plan cp WHERE cp.coupon_id = c.id) AS plan_ids,
+  c.created_at, c.updated_at
+FROM coupon c
+WHERE c.personal_id = $1
+ORDER BY c.created_at DESC`
+
+func (q *Queries) GetCoupons(ctx context.Context, personalID uuid.UUID) ([]GetCouponsRow, error) {
+	var items []GetCouponsRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getCoupons, personalID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getCouponById = `-- name: GetCouponById :one
+SELECT
+  c.id, c.personal_id, c.code, c.discount_type, c.discount_percent, discount_amount, c.max_redemptions,
+  c.max_redemptions_per_user, c.redemption_count, c.valid_from, c.valid_until, c.is_active,
+  ARRAY(SELECT cp.plan_id FROM coupon_plan cp WHERE cp.coupon_id = c.id) AS plan_ids,
+  c.created_at, c.updated_at
+FROM coupon c
+WHERE c.id = $1 AND c.personal_id = $2`
+
+func (q *Queries) GetCouponById(ctx context.Context, arg GetCouponByIdParams) (*GetCouponsRow, error) {
+	var i GetCouponsRow
+	err := pgxscan.Get(ctx, q.db, &i, getCouponById, arg.ID, arg.PersonalID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getCouponForUpdate = `-- name: GetCouponForUpdate :one
+SELECT id, personal_id, code, discount_type, discount_percent, discount_amount, max_redemptions, max_redemptions_per_user, redemption_count, valid_from, valid_until, is_active, created_at, updated_at
+FROM coupon
+WHERE id = $1 AND personal_id = $2
+FOR UPDATE`
+
+func (q *Queries) GetCouponForUpdate(ctx context.Context, arg GetCouponForUpdateParams) (*Coupon, error) {
+	var i Coupon
+	err := pgxscan.Get(ctx, q.db, &i, getCouponForUpdate, arg.ID, arg.PersonalID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getCouponByCodeForUpdate = `-- name: GetCouponByCodeForUpdate :one
+SELECT id, personal_id, code, discount_type, discount_percent, discount_amount, max_redemptions, max_redemptions_per_user, redemption_count, valid_from, valid_until, is_active, created_at, updated_at
+FROM coupon
+WHERE personal_id = $1 AND code = $2
+FOR UPDATE`
+
+// GetCouponByCodeForUpdate locks the trainer's coupon with the code, so
+// concurrent redemptions of it are checked one at a time
+func (q *Queries) GetCouponByCodeForUpdate(ctx context.Context, arg GetCouponByCodeForUpdateParams) (*Coupon, error) {
+	var i Coupon
+	err := pgxscan.Get(ctx, q.db, &i, getCouponByCodeForUpdate, arg.PersonalID, arg.Code)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const deleteCouponPlans = `-- name: DeleteCouponPlans :exec
+DELETE FROM coupon_plan WHERE coupon_id = $1`
+
+func (q *Queries) DeleteCouponPlans(ctx context.Context, couponID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteCouponPlans, couponID)
+	return err
+}
+
+const addCouponPlans = `-- name: AddCouponPlans :execrows
+INSERT INTO coupon_plan (coupon_id, plan_id)
+SELECT $1, p.id
+FROM plan p
+WHERE p.id = ANY($3::uuid[]) AND p.personal_id = $2
+ON CONFLICT DO NOTHING`
+
+// AddCouponPlans restricts a coupon to plans of its trainer. Plans the trainer
+// does not own are skipped; the count of plans added is returned.
+func (q *Queries) AddCouponPlans(ctx context.Context, arg AddCouponPlansParams) (int64, error) {
+	result, err := q.db.Exec(ctx, addCouponPlans, arg.CouponID, arg.PersonalID, arg.PlanIDs)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const couponAppliesToPlan = `-- name: CouponAppliesToPlan :one
+SELECT NOT EXISTS (SELECT 1 FROM coupon_plan WHERE coupon_id = $1)
+    OR EXISTS (SELECT 1 FROM coupon_plan WHERE coupon_id = $1 AND plan_id = $2)`
+
+// CouponAppliesToPlan reports whether the coupon is valid for the plan: it is
+// either restricted to it or not restricted at all
+func (q *Queries) CouponAppliesToPlan(ctx context.Context, arg CouponAppliesToPlanParams) (bool, error) {
+	var applies bool
+	err := q.db.QueryRow(ctx, couponAppliesToPlan, arg.CouponID, arg.PlanID).Scan(&applies)
+	return applies, err
+}
+
+const countCouponRedemptionsByUser = `-- name: CountCouponRedemptionsByUser :one
+SELECT COUNT(*)::int FROM coupon_redemption WHERE coupon_id = $1 AND user_id = $2`
+
+func (q *Queries) CountCouponRedemptionsByUser(ctx context.Context, arg CountCouponRedemptionsByUserParams) (int32, error) {
+	var count int32
+	err := q.db.QueryRow(ctx, countCouponRedemptionsByUser, arg.CouponID, arg.UserID).Scan(&count)
+	return count, err
+}
+
+const redeemCoupon = `-- name: RedeemCoupon :execrows
+UPDATE coupon
+SET redemption_count = redemption_count + 1, updated_at = NOW()
+WHERE id = $1 AND (max_redemptions IS NULL OR redemption_count < max_redemptions)`
+
+// RedeemCoupon counts a redemption of the coupon. It reports false when the
+// coupon has no redemptions left.
+func (q *Queries) RedeemCoupon(ctx context.Context, id uuid.UUID) (bool, error) {
+	result, err := q.db.Exec(ctx, redeemCoupon, id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const createCouponRedemption = `-- name: CreateCouponRedemption :exec
+INSERT INTO coupon_redemption (coupon_id, user_id, subscription_id, discount)
+VALUES ($1, $2, $3, $4)`
+
+func (q *Queries) CreateCouponRedemption(ctx context.Context, arg CreateCouponRedemptionParams) error {
+	_, err := q.db.Exec(ctx, createCouponRedemption,
+		arg.CouponID,
+		arg.UserID,
+		arg.SubscriptionID,
+		arg.Discount,
+	)
+	return err
+}
+
+const releaseCouponRedemption = `-- name: ReleaseCouponRedemption :execrows
+WITH released AS (
+  DELETE FROM coupon_redemption
+  WHERE subscription_id = $1
+    AND NOT EXISTS (
+      SELECT 1 FROM subscription_history
+      WHERE subscription_id = $1 AND status = 'ACTIVE'
+    )
+  RETURNING coupon_id
+)
+UPDATE coupon
+SET redemption_count = coupon.redemption_count - 1, updated_at = NOW()
+FROM released
+WHERE coupon.id = released.coupon_id`
+
+// ReleaseCouponRedemption gives back the coupon redeemed by a subscription
+// that was never active, removing its redemption and uncounting it. It
+// reports whether a redemption was released.
+func (q *Queries) ReleaseCouponRedemption(ctx context.Context, subscriptionID uuid.UUID) (bool, error) {
+	result, err := q.db.Exec(ctx, releaseCouponRedemption, subscriptionID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const deactivateCoupon = `-- name: DeactivateCoupon :exec
+UPDATE coupon SET is_active = FALSE, updated_at = NOW() WHERE id = $1`
+
+func (q *Queries) DeactivateCoupon(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deactivateCoupon, id)
+	return err
+}
+
+const deleteCoupon = `-- name: DeleteCoupon :execrows
+DELETE FROM coupon
+WHERE id = $1 AND personal_id = $2`
+
+// DeleteCoupon reports whether a coupon of the trainer was deleted
+func (q *Queries) DeleteCoupon(ctx context.Context, arg DeleteCouponParams) (bool, error) {
+	result, err := q.db.Exec(ctx, deleteCoupon, arg.ID, arg.PersonalID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
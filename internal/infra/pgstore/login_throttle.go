@@ -0,0 +1,147 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+// LoginThrottle counts the failed sign ins of a client IP or an account email
+type LoginThrottle struct {
+	ID             uuid.UUID          `json:"id" db:"id"`
+	Scope          LoginThrottleScope `json:"scope" db:"scope"`
+	Key            string             `json:"key" db:"key"`
+	FailedAttempts int32              `json:"failedAttempts" db:"failed_attempts"`
+	LastFailedAt   time.Time          `json:"lastFailedAt" db:"last_failed_at"`
+	LockedUntil    *time.Time         `json:"lockedUntil,omitempty" db:"locked_until"`
+	CreatedAt      time.Time          `json:"createdAt" db:"created_at"`
+}
+
+type GetLoginLockParams struct {
+	IPAddress *string   `json:"ipAddress" db:"ip_address"`
+	Account   string    `json:"account" db:"account"`
+	Now       time.Time `json:"now" db:"now"`
+}
+
+type RecordLoginFailureParams struct {
+	Scope LoginThrottleScope `json:"scope" db:"scope"`
+	Key   string             `json:"key" db:"key"`
+	Now   time.Time          `json:"now" db:"now"`
+	// Failures before WindowStart are forgotten
+	WindowStart time.Time `json:"windowStart" db:"window_start"`
+}
+
+type LockLoginParams struct {
+	Scope       LoginThrottleScope `json:"scope" db:"scope"`
+	Key         string             `json:"key" db:"key"`
+	LockedUntil time.Time          `json:"lockedUntil" db:"locked_until"`
+}
+
+type DeleteLoginThrottleParams struct {
+	Scope LoginThrottleScope `json:"scope" db:"scope"`
+	Key   string             `json:"key" db:"key"`
+}
+
+type DeleteStaleLoginThrottlesParams struct {
+	Now         time.Time `json:"now" db:"now"`
+	WindowStart time.Time `json:"windowStart" db:"window_start"`
+}
+
+type GetLoginLockoutsParams struct {
+	Now    time.Time `json:"now" db:"now"`
+	Limit  int32     `json:"limit" db:"limit"`
+	Offset int32     `json:"offset" db:"offset"`
+}
+
+const getLoginLock = `-- name: GetLoginLock :one
+SELECT MAX(locked_until)
+FROM login_throttle
+WHERE ((scope = 'IP' AND key = $1) OR (scope = 'ACCOUNT' AND key = $2))
+  AND locked_until > $3`
+
+// GetLoginLock returns until when sign ins from the IP or to the account are
+// refused, or nil if they aren't
+func (q *Queries) GetLoginLock(ctx context.Context, arg GetLoginLockParams) (*time.Time, error) {
+	var lockedUntil *time.Time
+	err := q.db.QueryRow(ctx, getLoginLock, arg.IPAddress, arg.Account, arg.Now).Scan(&lockedUntil)
+	return lockedUntil, err
+}
+
+const recordLoginFailure = `-- name: RecordLoginFailure :one
+INSERT INTO login_throttle (scope, key, failed_attempts, last_failed_at)
+VALUES ($1, $2, 1, $3)
+ON CONFLICT (scope, key) DO UPDATE
+SET failed_attempts = CASE
+        WHEN login_throttle.last_failed_at < $4 THEN 1
+        ELSE login_throttle.failed_attempts + 1
+    END,
+    last_failed_at = EXCLUDED.last_failed_at
+RETURNING failed_attempts`
+
+// RecordLoginFailure counts a failed sign in and returns the failures so far
+func (q *Queries) RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error) {
+	var failedAttempts int32
+	err := q.db.QueryRow(ctx, recordLoginFailure, arg.Scope, arg.Key, arg.Now, arg.WindowStart).Scan(&failedAttempts)
+	return failedAttempts, err
+}
+
+const lockLogin = `-- name: LockLogin :exec
+UPDATE login_throttle
+SET locked_until = GREATEST(locked_until, $3)
+WHERE scope = $1 AND key = $2`
+
+func (q *Queries) LockLogin(ctx context.Context, arg LockLoginParams) error {
+	_, err := q.db.Exec(ctx, lockLogin, arg.Scope, arg.Key, arg.LockedUntil)
+	return err
+}
+
+const deleteLoginThrottle = `-- name: DeleteLoginThrottle :exec
+DELETE FROM login_throttle WHERE scope = $1 AND key = $2`
+
+func (q *Queries) DeleteLoginThrottle(ctx context.Context, arg DeleteLoginThrottleParams) error {
+	_, err := q.db.Exec(ctx, deleteLoginThrottle, arg.Scope, arg.Key)
+	return err
+}
+
+const deleteLoginThrottleByID = `-- name: DeleteLoginThrottleByID :execrows
+DELETE FROM login_throttle WHERE id = $1`
+
+func (q *Queries) DeleteLoginThrottleByID(ctx context.Context, id uuid.UUID) (bool, error) {
+	result, err := q.db.Exec(ctx, deleteLoginThrottleByID, id)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const deleteStaleLoginThrottles = `-- name: DeleteStaleLoginThrottles :exec
+DELETE FROM login_throttle
+WHERE last_failed_at < $2 AND (locked_until IS NULL OR locked_until <= $1)`
+
+// DeleteStaleLoginThrottles forgets the failures that no longer count, so
+// sign ins to made up emails don't pile up
+func (q *Queries) DeleteStaleLoginThrottles(ctx context.Context, arg DeleteStaleLoginThrottlesParams) error {
+	_, err := q.db.Exec(ctx, deleteStaleLoginThrottles, arg.Now, arg.WindowStart)
+	return err
+}
+
+const getLoginLockouts = `-- name: GetLoginLockouts :many
+SELECT id, scope, key, failed_attempts, last_failed_at, locked_until, created_at
+FROM login_throttle
+WHERE locked_until > $1
+ORDER BY locked_until DESC
+LIMIT $2 OFFSET $3`
+
+// GetLoginLockouts lists the IPs and accounts whose sign ins are refused
+func (q *Queries) GetLoginLockouts(ctx context.Context, arg GetLoginLockoutsParams) ([]LoginThrottle, error) {
+	var items []LoginThrottle
+
+	err := pgxscan.Select(ctx, q.db, &items, getLoginLockouts, arg.Now, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
@@ -0,0 +1,300 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+// UserTOTP is the authenticator of a user. Secret is encrypted, and the TOTP
+// is only in use once EnabledAt is set.
+type UserTOTP struct {
+	UserID         uuid.UUID  `json:"userId" db:"user_id"`
+	Secret         []byte     `json:"-" db:"secret"`
+	EnabledAt      *time.Time `json:"enabledAt,omitempty" db:"enabled_at"`
+	LastUsedStep   *int64     `json:"-" db:"last_used_step"`
+	FailedAttempts int32      `json:"failedAttempts" db:"failed_attempts"`
+	LockedUntil    *time.Time `json:"lockedUntil,omitempty" db:"locked_until"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+}
+
+type MFARolePolicy struct {
+	Role      Role      `json:"role" db:"role"`
+	Required  bool      `json:"required" db:"required"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type CreatePendingTOTPParams struct {
+	UserID uuid.UUID `json:"userId" db:"user_id"`
+	Secret []byte    `json:"-" db:"secret"`
+}
+
+type UseTOTPStepParams struct {
+	UserID uuid.UUID `json:"userId" db:"user_id"`
+	Step   int64     `json:"step" db:"step"`
+}
+
+type RecordTOTPFailureParams struct {
+	UserID      uuid.UUID `json:"userId" db:"user_id"`
+	MaxAttempts int32     `json:"maxAttempts" db:"max_attempts"`
+	LockedUntil time.Time `json:"lockedUntil" db:"locked_until"`
+}
+
+type CreateRecoveryCodesParams struct {
+	UserID     uuid.UUID `json:"userId" db:"user_id"`
+	CodeHashes []string  `json:"-" db:"code_hashes"`
+}
+
+type UseRecoveryCodeParams struct {
+	UserID   uuid.UUID `json:"userId" db:"user_id"`
+	CodeHash string    `json:"-" db:"code_hash"`
+}
+
+type SetMFARolePolicyParams struct {
+	Role     Role `json:"role" db:"role"`
+	Required bool `json:"required" db:"required"`
+}
+
+type IsMFASetupRequiredParams struct {
+	UserID uuid.UUID `json:"userId" db:"user_id"`
+	Role   Role      `json:"role" db:"role"`
+}
+
+// Two-factor authentication request/response types
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// CompleteMFARequest finishes a sign in with a TOTP code or a recovery code.
+// Token clients send back the MFAToken they got from /session.
+type CompleteMFARequest struct {
+	Code     string `json:"code" validate:"required"`
+	MFAToken string `json:"mfaToken,omitempty"`
+}
+
+type MFAChallengeResponse struct {
+	MFARequired bool   `json:"mfaRequired"`
+	MFAToken    string `json:"mfaToken,omitempty"`
+	ExpiresIn   int64  `json:"expiresIn"`
+}
+
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+	// QRCode is the otpauth URI as a PNG data URI
+	QRCode string `json:"qrCode"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+type MFAStatusResponse struct {
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabledAt,omitempty"`
+	Required          bool       `json:"required"`
+	RecoveryCodesLeft int64      `json:"recoveryCodesLeft"`
+}
+
+type SetMFARolePolicyRequest struct {
+	Role     Role `json:"role" validate:"required"`
+	Required bool `json:"required"`
+}
+
+const createPendingTOTP = `-- name: CreatePendingTOTP :execrows
+INSERT INTO user_totp (user_id, secret)
+VALUES ($1, $2)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = EXCLUDED.secret, last_used_step = NULL, failed_attempts = 0, locked_until = NULL, created_at = NOW()
+WHERE user_totp.enabled_at IS NULL`
+
+// CreatePendingTOTP stores a new secret to enroll, replacing an enrollment
+// that was never confirmed. It reports false if the user already has an
+// enabled TOTP.
+func (q *Queries) CreatePendingTOTP(ctx context.Context, arg CreatePendingTOTPParams) (bool, error) {
+	result, err := q.db.Exec(ctx, createPendingTOTP, arg.UserID, arg.Secret)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const getUserTOTP = `-- name: GetUserTOTP :one
+SELECT user_id, secret, enabled_at, last_used_step, failed_attempts, locked_until, created_at
+FROM user_totp
+WHERE user_id = $1`
+
+func (q *Queries) GetUserTOTP(ctx context.Context, userID uuid.UUID) (*UserTOTP, error) {
+	var i UserTOTP
+	err := pgxscan.Get(ctx, q.db, &i, getUserTOTP, userID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getUserTOTPForUpdate = getUserTOTP + `
+FOR UPDATE`
+
+// GetUserTOTPForUpdate locks the authenticator of the user, so concurrent
+// codes are counted and consumed one at a time
+func (q *Queries) GetUserTOTPForUpdate(ctx context.Context, userID uuid.UUID) (*UserTOTP, error) {
+	var i UserTOTP
+	err := pgxscan.Get(ctx, q.db, &i, getUserTOTPForUpdate, userID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :exec
+UPDATE user_totp
+SET last_used_step = $2, failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1`
+
+// UseTOTPStep records the time step of an accepted code, so it can't be
+// accepted again
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) error {
+	_, err := q.db.Exec(ctx, useTOTPStep, arg.UserID, arg.Step)
+	return err
+}
+
+const resetTOTPFailures = `-- name: ResetTOTPFailures :exec
+UPDATE user_totp
+SET failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1`
+
+func (q *Queries) ResetTOTPFailures(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, resetTOTPFailures, userID)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :exec
+UPDATE user_totp
+SET enabled_at = NOW(), last_used_step = $2, failed_attempts = 0, locked_until = NULL
+WHERE user_id = $1`
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg UseTOTPStepParams) error {
+	_, err := q.db.Exec(ctx, enableTOTP, arg.UserID, arg.Step)
+	return err
+}
+
+const recordTOTPFailure = `-- name: RecordTOTPFailure :exec
+UPDATE user_totp
+SET failed_attempts = failed_attempts + 1,
+    locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END
+WHERE user_id = $1`
+
+// RecordTOTPFailure counts a wrong code, locking verification until
+// LockedUntil once MaxAttempts are reached
+func (q *Queries) RecordTOTPFailure(ctx context.Context, arg RecordTOTPFailureParams) error {
+	_, err := q.db.Exec(ctx, recordTOTPFailure, arg.UserID, arg.MaxAttempts, arg.LockedUntil)
+	return err
+}
+
+const deleteUserTOTP = `-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1`
+
+func (q *Queries) DeleteUserTOTP(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUserTOTP, userID)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM mfa_recovery_codes WHERE user_id = $1`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const createRecoveryCodes = `-- name: CreateRecoveryCodes :exec
+INSERT INTO mfa_recovery_codes (user_id, code_hash)
+SELECT $1, unnest($2::text[])`
+
+func (q *Queries) CreateRecoveryCodes(ctx context.Context, arg CreateRecoveryCodesParams) error {
+	_, err := q.db.Exec(ctx, createRecoveryCodes, arg.UserID, arg.CodeHashes)
+	return err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE mfa_recovery_codes
+SET used_at = NOW()
+WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`
+
+// UseRecoveryCode reports whether the code was one of the user's unused
+// recovery codes, using it up
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (bool, error) {
+	result, err := q.db.Exec(ctx, useRecoveryCode, arg.UserID, arg.CodeHash)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const countUnusedRecoveryCodes = `-- name: CountUnusedRecoveryCodes :one
+SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+func (q *Queries) CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	err := q.db.QueryRow(ctx, countUnusedRecoveryCodes, userID).Scan(&count)
+	return count, err
+}
+
+const getMFARolePolicies = `-- name: GetMFARolePolicies :many
+SELECT role, required, updated_at FROM mfa_role_policy ORDER BY role`
+
+func (q *Queries) GetMFARolePolicies(ctx context.Context) ([]MFARolePolicy, error) {
+	var items []MFARolePolicy
+
+	err := pgxscan.Select(ctx, q.db, &items, getMFARolePolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const setMFARolePolicy = `-- name: SetMFARolePolicy :one
+INSERT INTO mfa_role_policy (role, required, updated_at)
+VALUES ($1, $2, NOW())
+ON CONFLICT (role) DO UPDATE SET required = EXCLUDED.required, updated_at = NOW()
+RETURNING role, required, updated_at`
+
+func (q *Queries) SetMFARolePolicy(ctx context.Context, arg SetMFARolePolicyParams) (*MFARolePolicy, error) {
+	var i MFARolePolicy
+	err := pgxscan.Get(ctx, q.db, &i, setMFARolePolicy, arg.Role, arg.Required)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const isMFARequiredForRole = `-- name: IsMFARequiredForRole :one
+SELECT EXISTS (SELECT 1 FROM mfa_role_policy WHERE role = $1 AND required)`
+
+func (q *Queries) IsMFARequiredForRole(ctx context.Context, role Role) (bool, error) {
+	var required bool
+	err := q.db.QueryRow(ctx, isMFARequiredForRole, role).Scan(&required)
+	return required, err
+}
+
+const isMFASetupRequired = `-- name: IsMFASetupRequired :one
+SELECT EXISTS (SELECT 1 FROM mfa_role_policy WHERE role = $2 AND required)
+  AND NOT EXISTS (SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)`
+
+// IsMFASetupRequired reports whether the user's role requires two-factor
+// authentication and the user hasn't enabled it yet
+func (q *Queries) IsMFASetupRequired(ctx context.Context, arg IsMFASetupRequiredParams) (bool, error) {
+	var required bool
+	err := q.db.QueryRow(ctx, isMFASetupRequired, arg.UserID, arg.Role).Scan(&required)
+	return required, err
+}
@@ -0,0 +1,37 @@
+-- Workout sessions table (one row per execution of a workout by a student)
+CREATE TABLE workout_session (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    student_id UUID NOT NULL REFERENCES student(id) ON DELETE CASCADE,
+    workout_id UUID NOT NULL REFERENCES workout(id),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMP WITH TIME ZONE,
+    duration INTEGER,
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Create indexes for better performance
+CREATE INDEX idx_workout_session_student_id ON workout_session(student_id);
+CREATE INDEX idx_workout_session_workout_id ON workout_session(workout_id);
+
+-- A student can only have one open session per workout
+CREATE UNIQUE INDEX idx_workout_session_open ON workout_session(student_id, workout_id) WHERE finished_at IS NULL;
+
+-- Link history rows to the session that produced them
+ALTER TABLE workouts_history ADD COLUMN session_id UUID REFERENCES workout_session(id) ON DELETE CASCADE;
+CREATE INDEX idx_workouts_history_session_id ON workouts_history(session_id);
+
+---- create above / drop below ----
+
+-- Drop history link
+DROP INDEX IF EXISTS idx_workouts_history_session_id;
+ALTER TABLE workouts_history DROP COLUMN IF EXISTS session_id;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_workout_session_open;
+DROP INDEX IF EXISTS idx_workout_session_workout_id;
+DROP INDEX IF EXISTS idx_workout_session_student_id;
+
+-- Drop table
+DROP TABLE IF EXISTS workout_session;
@@ -0,0 +1,152 @@
+-- Workout sets table (one row per performed set of an exercise in a session)
+CREATE TABLE workout_set (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    session_id UUID NOT NULL REFERENCES workout_session(id) ON DELETE CASCADE,
+    history_id UUID NOT NULL REFERENCES workouts_history(id) ON DELETE CASCADE,
+    exercise_id UUID NOT NULL,
+    set_index INTEGER NOT NULL CHECK (set_index >= 1),
+    reps INTEGER NOT NULL CHECK (reps >= 0),
+    load_kg DECIMAL(6,2) NOT NULL DEFAULT 0 CHECK (load_kg >= 0),
+    rpe DECIMAL(3,1) CHECK (rpe >= 1 AND rpe <= 10),
+    rir INTEGER CHECK (rir >= 0),
+    to_failure BOOLEAN NOT NULL DEFAULT FALSE,
+    is_warmup BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (history_id, set_index)
+);
+
+-- Create indexes for better performance
+CREATE INDEX idx_workout_set_session_id ON workout_set(session_id);
+CREATE INDEX idx_workout_set_exercise_id ON workout_set(exercise_id);
+
+-- Legacy history rows have no session: the rows of a student's workout are
+-- grouped into one session while each was recorded at most 2 hours after the
+-- previous one, and a longer gap starts a new session
+CREATE TEMP TABLE legacy_workout_history ON COMMIT DROP AS
+SELECT
+    id,
+    student_id,
+    workout_id,
+    recorded_at,
+    time_total_workout,
+    SUM(CASE WHEN previous_at IS NULL OR recorded_at - previous_at > INTERVAL '2 hours' THEN 1 ELSE 0 END)
+        OVER (PARTITION BY student_id, workout_id ORDER BY recorded_at, id) AS session_number
+FROM (
+    SELECT
+        id,
+        student_id,
+        workout_id,
+        COALESCE(created_at, NOW()) AS recorded_at,
+        time_total_workout,
+        lag(COALESCE(created_at, NOW())) OVER (PARTITION BY student_id, workout_id ORDER BY COALESCE(created_at, NOW()), id) AS previous_at
+    FROM workouts_history
+    WHERE session_id IS NULL
+) r;
+
+CREATE TEMP TABLE legacy_workout_session ON COMMIT DROP AS
+SELECT
+    gen_random_uuid() AS id,
+    student_id,
+    workout_id,
+    session_number,
+    MIN(recorded_at) AS first_recorded_at,
+    MAX(recorded_at) AS finished_at,
+    MAX(time_total_workout) AS duration
+FROM legacy_workout_history
+GROUP BY student_id, workout_id, session_number;
+
+-- A session started when its first row was recorded, or earlier when the
+-- recorded duration says so
+INSERT INTO workout_session (id, student_id, workout_id, started_at, finished_at, duration, created_at, updated_at)
+SELECT
+    id,
+    student_id,
+    workout_id,
+    LEAST(first_recorded_at, finished_at - make_interval(mins => duration)),
+    finished_at,
+    duration,
+    finished_at,
+    finished_at
+FROM legacy_workout_session;
+
+UPDATE workouts_history h
+SET session_id = l.id
+FROM legacy_workout_history r
+JOIN legacy_workout_session l
+  ON l.student_id = r.student_id
+ AND l.workout_id = r.workout_id
+ AND l.session_number = r.session_number
+WHERE h.id = r.id;
+
+-- Expand the TEXT sets/reps columns into one row per set. sets holds a count
+-- and reps either a single value or a comma separated value per set.
+INSERT INTO workout_set (session_id, history_id, exercise_id, set_index, reps, load_kg, created_at)
+SELECT
+    p.session_id,
+    p.id,
+    p.exercise_id,
+    gs.set_index,
+    CASE
+        WHEN COALESCE(p.reps_list[gs.set_index], p.reps_list[1]) ~ '^\d+$'
+        THEN COALESCE(p.reps_list[gs.set_index], p.reps_list[1])::INTEGER
+        ELSE 0
+    END,
+    GREATEST(p.weight, 0),
+    p.created_at
+FROM (
+    SELECT
+        id,
+        session_id,
+        exercise_id,
+        weight,
+        created_at,
+        string_to_array(regexp_replace(reps, '\s', '', 'g'), ',') AS reps_list,
+        CASE
+            WHEN sets ~ '^\s*\d+\s*$' THEN trim(sets)::INTEGER
+            ELSE array_length(string_to_array(sets, ','), 1)
+        END AS set_count
+    FROM workouts_history
+) p
+CROSS JOIN LATERAL generate_series(1, GREATEST(COALESCE(p.set_count, 1), 1)) AS gs(set_index);
+
+-- Sets, reps and weight now live in workout_set
+ALTER TABLE workouts_history ALTER COLUMN session_id SET NOT NULL;
+ALTER TABLE workouts_history DROP COLUMN weight;
+ALTER TABLE workouts_history DROP COLUMN sets;
+ALTER TABLE workouts_history DROP COLUMN reps;
+
+---- create above / drop below ----
+
+-- Restore the summary columns from the set rows
+ALTER TABLE workouts_history ADD COLUMN weight INTEGER;
+ALTER TABLE workouts_history ADD COLUMN sets TEXT;
+ALTER TABLE workouts_history ADD COLUMN reps TEXT;
+
+UPDATE workouts_history h
+SET weight = s.weight, sets = s.sets, reps = s.reps
+FROM (
+    SELECT
+        history_id,
+        ROUND(MAX(load_kg))::INTEGER AS weight,
+        COUNT(*)::TEXT AS sets,
+        string_agg(reps::TEXT, ',' ORDER BY set_index) AS reps
+    FROM workout_set
+    GROUP BY history_id
+) s
+WHERE h.id = s.history_id;
+
+UPDATE workouts_history SET weight = 0 WHERE weight IS NULL;
+UPDATE workouts_history SET sets = '0' WHERE sets IS NULL;
+UPDATE workouts_history SET reps = '0' WHERE reps IS NULL;
+
+ALTER TABLE workouts_history ALTER COLUMN weight SET NOT NULL;
+ALTER TABLE workouts_history ALTER COLUMN sets SET NOT NULL;
+ALTER TABLE workouts_history ALTER COLUMN reps SET NOT NULL;
+ALTER TABLE workouts_history ALTER COLUMN session_id DROP NOT NULL;
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_workout_set_exercise_id;
+DROP INDEX IF EXISTS idx_workout_set_session_id;
+
+-- Drop table
+DROP TABLE IF EXISTS workout_set;
@@ -0,0 +1,22 @@
+-- Schedulings span from date to end_time
+ALTER TABLE scheduling ADD COLUMN end_time TIMESTAMP WITH TIME ZONE;
+ALTER TABLE scheduling ADD COLUMN notes TEXT;
+
+-- Existing schedulings default to one hour sessions
+UPDATE scheduling SET end_time = date + INTERVAL '1 hour' WHERE end_time IS NULL;
+
+ALTER TABLE scheduling ALTER COLUMN end_time SET NOT NULL;
+ALTER TABLE scheduling ADD CONSTRAINT scheduling_end_time_after_date CHECK (end_time > date);
+
+-- Create index for better performance
+CREATE INDEX idx_scheduling_end_time ON scheduling(end_time);
+
+---- create above / drop below ----
+
+-- Drop index
+DROP INDEX IF EXISTS idx_scheduling_end_time;
+
+-- Drop columns
+ALTER TABLE scheduling DROP CONSTRAINT IF EXISTS scheduling_end_time_after_date;
+ALTER TABLE scheduling DROP COLUMN IF EXISTS notes;
+ALTER TABLE scheduling DROP COLUMN IF EXISTS end_time;
@@ -0,0 +1,16 @@
+-- Transitions made by the system (e.g. marking sessions as missed) have no user
+ALTER TABLE schedulings_history ALTER COLUMN user_id DROP NOT NULL;
+
+-- Create index for better performance
+CREATE INDEX idx_schedulings_history_schedule_id ON schedulings_history(schedule_id);
+CREATE INDEX idx_scheduling_status_end_time ON scheduling(status, end_time);
+
+---- create above / drop below ----
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_scheduling_status_end_time;
+DROP INDEX IF EXISTS idx_schedulings_history_schedule_id;
+
+-- Restore user requirement
+DELETE FROM schedulings_history WHERE user_id IS NULL;
+ALTER TABLE schedulings_history ALTER COLUMN user_id SET NOT NULL;
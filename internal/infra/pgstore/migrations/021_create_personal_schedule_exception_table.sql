@@ -0,0 +1,39 @@
+-- Weekly windows must be valid ranges within a single day
+ALTER TABLE personal_schedule ADD CONSTRAINT personal_schedule_week_day_check CHECK (week_day BETWEEN 0 AND 6);
+ALTER TABLE personal_schedule ADD CONSTRAINT personal_schedule_time_range_check
+    CHECK (time_start_in_minutes >= 0 AND time_start_in_minutes < time_end_in_minutes AND time_end_in_minutes <= 1440);
+
+CREATE INDEX idx_personal_schedule_personal_id ON personal_schedule(personal_id, week_day);
+
+-- Date-specific changes to the weekly schedule: UNAVAILABLE removes hours
+-- (the whole day when no time range is given), AVAILABLE adds extra hours
+CREATE TYPE schedule_exception_type AS ENUM ('UNAVAILABLE', 'AVAILABLE');
+
+CREATE TABLE personal_schedule_exception (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    personal_id UUID NOT NULL REFERENCES personal(id) ON DELETE CASCADE,
+    date DATE NOT NULL,
+    type schedule_exception_type NOT NULL,
+    time_start_in_minutes INTEGER,
+    time_end_in_minutes INTEGER,
+    reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT personal_schedule_exception_time_range_check CHECK (
+        (time_start_in_minutes IS NULL AND time_end_in_minutes IS NULL AND type = 'UNAVAILABLE')
+        OR (time_start_in_minutes >= 0 AND time_start_in_minutes < time_end_in_minutes AND time_end_in_minutes <= 1440)
+    )
+);
+
+-- Create index for better performance
+CREATE INDEX idx_personal_schedule_exception_personal_date ON personal_schedule_exception(personal_id, date);
+
+---- create above / drop below ----
+
+-- Drop table
+DROP TABLE IF EXISTS personal_schedule_exception;
+DROP TYPE IF EXISTS schedule_exception_type;
+
+-- Drop constraints
+DROP INDEX IF EXISTS idx_personal_schedule_personal_id;
+ALTER TABLE personal_schedule DROP CONSTRAINT IF EXISTS personal_schedule_time_range_check;
+ALTER TABLE personal_schedule DROP CONSTRAINT IF EXISTS personal_schedule_week_day_check;
@@ -0,0 +1,22 @@
+-- Recurring sessions: occurrences are stored as scheduling rows linked to their series
+CREATE TABLE scheduling_series (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    personal_id UUID NOT NULL REFERENCES personal(id),
+    student_id UUID NOT NULL REFERENCES student(id),
+    recurrence TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+ALTER TABLE scheduling ADD COLUMN series_id UUID REFERENCES scheduling_series(id) ON DELETE SET NULL;
+
+-- Create index for better performance
+CREATE INDEX idx_scheduling_series_id ON scheduling(series_id, date);
+
+---- create above / drop below ----
+
+-- Drop index
+DROP INDEX IF EXISTS idx_scheduling_series_id;
+
+-- Drop column and table
+ALTER TABLE scheduling DROP COLUMN IF EXISTS series_id;
+DROP TABLE IF EXISTS scheduling_series;
@@ -0,0 +1,21 @@
+-- Calendar feed tokens let calendar apps poll a user's schedulings without a
+-- session. Only the SHA-256 hash of the token is stored.
+CREATE TABLE calendar_feed_tokens (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A user has at most one active feed token
+CREATE UNIQUE INDEX idx_calendar_feed_tokens_active_user ON calendar_feed_tokens(user_id) WHERE revoked_at IS NULL;
+
+---- create above / drop below ----
+
+-- Drop index
+DROP INDEX IF EXISTS idx_calendar_feed_tokens_active_user;
+
+-- Drop table
+DROP TABLE IF EXISTS calendar_feed_tokens;
@@ -0,0 +1,34 @@
+-- The text array holds the plan's feature list; the description becomes free text
+ALTER TABLE plan RENAME COLUMN description TO features;
+UPDATE plan SET features = '{}' WHERE features IS NULL;
+ALTER TABLE plan ALTER COLUMN features SET NOT NULL;
+
+ALTER TABLE plan ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE plan ADD COLUMN duration INTEGER NOT NULL DEFAULT 30;
+ALTER TABLE plan ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT TRUE;
+ALTER TABLE plan ADD COLUMN created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL;
+ALTER TABLE plan ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL;
+
+ALTER TABLE plan ADD CONSTRAINT plan_duration_check CHECK (duration > 0);
+ALTER TABLE plan ADD CONSTRAINT plan_price_check CHECK (price >= 0);
+
+-- Create index for better performance
+CREATE INDEX idx_plan_personal_id ON plan(personal_id);
+
+---- create above / drop below ----
+
+-- Drop index
+DROP INDEX IF EXISTS idx_plan_personal_id;
+
+-- Drop columns
+ALTER TABLE plan DROP CONSTRAINT IF EXISTS plan_price_check;
+ALTER TABLE plan DROP CONSTRAINT IF EXISTS plan_duration_check;
+ALTER TABLE plan DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE plan DROP COLUMN IF EXISTS created_at;
+ALTER TABLE plan DROP COLUMN IF EXISTS is_active;
+ALTER TABLE plan DROP COLUMN IF EXISTS duration;
+ALTER TABLE plan DROP COLUMN IF EXISTS description;
+
+-- Restore the text array as description
+ALTER TABLE plan ALTER COLUMN features DROP NOT NULL;
+ALTER TABLE plan RENAME COLUMN features TO description;
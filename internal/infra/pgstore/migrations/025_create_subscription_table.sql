@@ -0,0 +1,47 @@
+-- Subscriptions of users to trainer plans. A subscription covers the period
+-- [start_date, end_date) and is renewed in place at end_date unless it was
+-- cancelled, in which case it ends with the period.
+CREATE TYPE subscription_status AS ENUM ('PENDING', 'ACTIVE', 'CANCELLED', 'EXPIRED');
+
+CREATE TABLE subscription (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan_id UUID NOT NULL REFERENCES plan(id),
+    next_plan_id UUID REFERENCES plan(id),
+    status subscription_status NOT NULL DEFAULT 'PENDING',
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
+    cancelled_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT subscription_period_check CHECK (start_date < end_date)
+);
+
+-- A user holds at most one live subscription
+CREATE UNIQUE INDEX idx_subscription_user_live ON subscription(user_id) WHERE status IN ('PENDING', 'ACTIVE');
+CREATE INDEX idx_subscription_plan_id ON subscription(plan_id);
+CREATE INDEX idx_subscription_status_end_date ON subscription(status, end_date);
+
+-- Every status change and renewal, with the period and amount it applies to
+CREATE TABLE subscription_history (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscription(id) ON DELETE CASCADE,
+    plan_id UUID NOT NULL REFERENCES plan(id),
+    event VARCHAR(32) NOT NULL,
+    status subscription_status NOT NULL,
+    start_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    end_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_subscription_history_subscription_id ON subscription_history(subscription_id, created_at);
+
+---- create above / drop below ----
+
+-- Drop tables
+DROP TABLE IF EXISTS subscription_history;
+DROP TABLE IF EXISTS subscription;
+DROP TYPE IF EXISTS subscription_status;
@@ -0,0 +1,28 @@
+-- Every charge attempt made through a payment gateway
+CREATE TYPE payment_status AS ENUM ('PENDING', 'COMPLETED', 'FAILED', 'REFUNDED');
+
+CREATE TABLE payment (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscription(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    method VARCHAR(32) NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    provider_payment_id VARCHAR(255),
+    status payment_status NOT NULL DEFAULT 'PENDING',
+    failure_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+-- A subscription has at most one payment in flight
+CREATE UNIQUE INDEX idx_payment_subscription_pending ON payment(subscription_id) WHERE status = 'PENDING';
+CREATE UNIQUE INDEX idx_payment_provider_payment_id ON payment(provider, provider_payment_id);
+CREATE INDEX idx_payment_subscription_id ON payment(subscription_id, created_at);
+CREATE INDEX idx_payment_user_id ON payment(user_id, created_at);
+
+---- create above / drop below ----
+
+-- Drop table
+DROP TABLE IF EXISTS payment;
+DROP TYPE IF EXISTS payment_status;
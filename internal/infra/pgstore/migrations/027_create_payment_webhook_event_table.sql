@@ -0,0 +1,21 @@
+-- Notifications received from payment providers. The unique event ID makes
+-- redelivered notifications no-ops.
+CREATE TABLE payment_webhook_event (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    provider VARCHAR(32) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    payment_id UUID REFERENCES payment(id) ON DELETE SET NULL,
+    payload JSONB NOT NULL,
+    outcome VARCHAR(32) NOT NULL,
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT payment_webhook_event_provider_event_id_key UNIQUE (provider, event_id)
+);
+
+-- Create index for better performance
+CREATE INDEX idx_payment_webhook_event_payment_id ON payment_webhook_event(payment_id);
+
+---- create above / drop below ----
+
+-- Drop table
+DROP TABLE IF EXISTS payment_webhook_event;
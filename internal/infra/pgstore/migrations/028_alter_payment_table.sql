@@ -0,0 +1,15 @@
+-- PIX payments carry the BR Code to pay and expire when left unpaid
+ALTER TABLE payment ADD COLUMN pix_code TEXT;
+ALTER TABLE payment ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+
+-- Create index for better performance
+CREATE INDEX idx_payment_pending_expires_at ON payment(expires_at) WHERE status = 'PENDING';
+
+---- create above / drop below ----
+
+-- Drop index
+DROP INDEX IF EXISTS idx_payment_pending_expires_at;
+
+-- Drop columns
+ALTER TABLE payment DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE payment DROP COLUMN IF EXISTS pix_code;
@@ -0,0 +1,68 @@
+-- Discount codes trainers offer on their plans. A coupon discounts the first
+-- period of a subscription, either by a percentage of the plan price or by a
+-- fixed amount.
+CREATE TYPE coupon_discount_type AS ENUM ('PERCENT', 'FIXED');
+
+CREATE TABLE coupon (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    personal_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code VARCHAR(32) NOT NULL,
+    discount_type coupon_discount_type NOT NULL,
+    discount_value DECIMAL(10,2) NOT NULL,
+    max_redemptions INTEGER,
+    max_redemptions_per_user INTEGER,
+    redemption_count INTEGER NOT NULL DEFAULT 0,
+    valid_from TIMESTAMP WITH TIME ZONE,
+    valid_until TIMESTAMP WITH TIME ZONE,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT coupon_discount_value_check CHECK (
+        discount_value > 0 AND (discount_type <> 'PERCENT' OR discount_value <= 100)
+    ),
+    CONSTRAINT coupon_max_redemptions_check CHECK (max_redemptions IS NULL OR max_redemptions > 0),
+    CONSTRAINT coupon_max_redemptions_per_user_check CHECK (max_redemptions_per_user IS NULL OR max_redemptions_per_user > 0),
+    CONSTRAINT coupon_redemption_count_check CHECK (
+        redemption_count >= 0 AND (max_redemptions IS NULL OR redemption_count <= max_redemptions)
+    ),
+    CONSTRAINT coupon_validity_check CHECK (valid_from IS NULL OR valid_until IS NULL OR valid_from < valid_until)
+);
+
+-- Codes are stored uppercase and are unique per trainer
+CREATE UNIQUE INDEX idx_coupon_personal_id_code ON coupon(personal_id, code);
+
+-- Plans a coupon is restricted to; a coupon without rows applies to every
+-- plan of its trainer
+CREATE TABLE coupon_plan (
+    coupon_id UUID NOT NULL REFERENCES coupon(id) ON DELETE CASCADE,
+    plan_id UUID NOT NULL REFERENCES plan(id) ON DELETE CASCADE,
+    PRIMARY KEY (coupon_id, plan_id)
+);
+
+CREATE TABLE coupon_redemption (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    coupon_id UUID NOT NULL REFERENCES coupon(id),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    subscription_id UUID NOT NULL REFERENCES subscription(id) ON DELETE CASCADE,
+    discount DECIMAL(10,2) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_coupon_redemption_coupon_user ON coupon_redemption(coupon_id, user_id);
+
+-- The amount of a history entry is what was charged; discount is what the
+-- coupon took off the plan price
+ALTER TABLE subscription_history ADD COLUMN coupon_id UUID REFERENCES coupon(id);
+ALTER TABLE subscription_history ADD COLUMN discount DECIMAL(10,2) NOT NULL DEFAULT 0;
+
+---- create above / drop below ----
+
+-- Drop columns
+ALTER TABLE subscription_history DROP COLUMN IF EXISTS discount;
+ALTER TABLE subscription_history DROP COLUMN IF EXISTS coupon_id;
+
+-- Drop tables
+DROP TABLE IF EXISTS coupon_redemption;
+DROP TABLE IF EXISTS coupon_plan;
+DROP TABLE IF EXISTS coupon;
+DROP TYPE IF EXISTS coupon_discount_type;
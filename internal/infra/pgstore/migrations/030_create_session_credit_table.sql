@@ -0,0 +1,67 @@
+-- Plans are either recurring subscriptions or one-off packages of session
+-- credits. A package is valid for duration days after its purchase.
+CREATE TYPE plan_type AS ENUM ('SUBSCRIPTION', 'PACKAGE');
+
+ALTER TABLE plan ADD COLUMN type plan_type NOT NULL DEFAULT 'SUBSCRIPTION';
+ALTER TABLE plan ADD COLUMN session_credits INTEGER;
+ALTER TABLE plan ADD CONSTRAINT plan_session_credits_check CHECK (
+    (type = 'PACKAGE') = (session_credits IS NOT NULL) AND (session_credits IS NULL OR session_credits > 0)
+);
+
+-- A purchased package is a subscription that is never renewed. The type and
+-- credits are copied from the plan, so editing the plan does not change
+-- packages already sold.
+ALTER TABLE subscription ADD COLUMN plan_type plan_type NOT NULL DEFAULT 'SUBSCRIPTION';
+ALTER TABLE subscription ADD COLUMN session_credits INTEGER;
+
+-- A user holds at most one live recurring subscription, and any number of
+-- packages
+DROP INDEX IF EXISTS idx_subscription_user_live;
+CREATE UNIQUE INDEX idx_subscription_user_live ON subscription(user_id) WHERE status IN ('PENDING', 'ACTIVE') AND plan_type = 'SUBSCRIPTION';
+
+-- Append-only ledger of the session credits of each package. The balance of a
+-- package is the sum of its deltas: credits are GRANTED when the package is
+-- paid, CONSUMED by a booked session, REFUNDED when that session is cancelled
+-- in time, and EXPIRED or REVOKED when the package ends.
+CREATE TABLE session_credit (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id UUID NOT NULL REFERENCES subscription(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    personal_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    scheduling_id UUID REFERENCES scheduling(id) ON DELETE SET NULL,
+    delta INTEGER NOT NULL,
+    reason VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT session_credit_delta_check CHECK (delta <> 0)
+);
+
+CREATE INDEX idx_session_credit_subscription_id ON session_credit(subscription_id);
+CREATE INDEX idx_session_credit_user_personal ON session_credit(user_id, personal_id, created_at);
+CREATE INDEX idx_session_credit_scheduling_id ON session_credit(scheduling_id) WHERE scheduling_id IS NOT NULL;
+
+---- create above / drop below ----
+
+-- Packages sold have payments, coupon redemptions and history that must not
+-- be deleted along with them, so the rollback stops until they are removed
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM plan WHERE type = 'PACKAGE')
+        OR EXISTS (SELECT 1 FROM subscription WHERE plan_type = 'PACKAGE') THEN
+        RAISE EXCEPTION 'package plans or subscriptions exist, remove them before rolling back';
+    END IF;
+END $$;
+
+-- Drop tables
+DROP TABLE IF EXISTS session_credit;
+
+-- Restore the single live subscription index
+DROP INDEX IF EXISTS idx_subscription_user_live;
+CREATE UNIQUE INDEX idx_subscription_user_live ON subscription(user_id) WHERE status IN ('PENDING', 'ACTIVE');
+
+-- Drop columns
+ALTER TABLE subscription DROP COLUMN IF EXISTS session_credits;
+ALTER TABLE subscription DROP COLUMN IF EXISTS plan_type;
+ALTER TABLE plan DROP CONSTRAINT IF EXISTS plan_session_credits_check;
+ALTER TABLE plan DROP COLUMN IF EXISTS session_credits;
+ALTER TABLE plan DROP COLUMN IF EXISTS type;
+DROP TYPE IF EXISTS plan_type;
@@ -0,0 +1,45 @@
+-- Append-only ledger of the money each trainer earns. Amounts are signed from
+-- the trainer's point of view: a completed payment adds a CHARGE and takes a
+-- PLATFORM_FEE, and refunding it adds a REFUND and a FEE_REFUND that reverse
+-- both.
+CREATE TYPE revenue_entry_type AS ENUM ('CHARGE', 'REFUND', 'PLATFORM_FEE', 'FEE_REFUND');
+
+CREATE TABLE revenue_entry (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    personal_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    plan_id UUID NOT NULL REFERENCES plan(id),
+    subscription_id UUID NOT NULL REFERENCES subscription(id) ON DELETE CASCADE,
+    payment_id UUID NOT NULL REFERENCES payment(id) ON DELETE CASCADE,
+    type revenue_entry_type NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT revenue_entry_amount_check CHECK (amount <> 0)
+);
+
+-- A payment is charged and refunded at most once
+CREATE UNIQUE INDEX idx_revenue_entry_payment_type ON revenue_entry(payment_id, type);
+CREATE INDEX idx_revenue_entry_personal_id ON revenue_entry(personal_id, occurred_at);
+CREATE INDEX idx_revenue_entry_plan_id ON revenue_entry(plan_id, occurred_at);
+CREATE INDEX idx_revenue_entry_occurred_at ON revenue_entry(occurred_at);
+
+-- Payments completed before the ledger existed, without platform fees
+INSERT INTO revenue_entry (personal_id, plan_id, subscription_id, payment_id, type, amount, occurred_at)
+SELECT p.personal_id, s.plan_id, s.id, pay.id, 'CHARGE', pay.amount, pay.updated_at
+FROM payment pay
+JOIN subscription s ON s.id = pay.subscription_id
+JOIN plan p ON p.id = s.plan_id
+WHERE pay.status IN ('COMPLETED', 'REFUNDED');
+
+INSERT INTO revenue_entry (personal_id, plan_id, subscription_id, payment_id, type, amount, occurred_at)
+SELECT p.personal_id, s.plan_id, s.id, pay.id, 'REFUND', -pay.amount, pay.updated_at
+FROM payment pay
+JOIN subscription s ON s.id = pay.subscription_id
+JOIN plan p ON p.id = s.plan_id
+WHERE pay.status = 'REFUNDED';
+
+---- create above / drop below ----
+
+-- Drop table
+DROP TABLE IF EXISTS revenue_entry;
+DROP TYPE IF EXISTS revenue_entry_type;
@@ -0,0 +1,28 @@
+-- Percent coupons keep a percentage and fixed ones an amount of money, each
+-- in its own column
+ALTER TABLE coupon ADD COLUMN discount_percent DECIMAL(5,2);
+ALTER TABLE coupon ADD COLUMN discount_amount DECIMAL(10,2);
+
+UPDATE coupon SET discount_percent = discount_value WHERE discount_type = 'PERCENT';
+UPDATE coupon SET discount_amount = discount_value WHERE discount_type = 'FIXED';
+
+ALTER TABLE coupon DROP CONSTRAINT IF EXISTS coupon_discount_value_check;
+ALTER TABLE coupon DROP COLUMN discount_value;
+ALTER TABLE coupon ADD CONSTRAINT coupon_discount_check CHECK (
+    (discount_type = 'PERCENT' AND discount_percent > 0 AND discount_percent <= 100 AND discount_amount IS NULL)
+    OR (discount_type = 'FIXED' AND discount_amount > 0 AND discount_percent IS NULL)
+);
+
+---- create above / drop below ----
+
+-- Restore the single discount value
+ALTER TABLE coupon ADD COLUMN discount_value DECIMAL(10,2);
+UPDATE coupon SET discount_value = COALESCE(discount_percent, discount_amount);
+ALTER TABLE coupon ALTER COLUMN discount_value SET NOT NULL;
+
+ALTER TABLE coupon DROP CONSTRAINT IF EXISTS coupon_discount_check;
+ALTER TABLE coupon DROP COLUMN IF EXISTS discount_amount;
+ALTER TABLE coupon DROP COLUMN IF EXISTS discount_percent;
+ALTER TABLE coupon ADD CONSTRAINT coupon_discount_value_check CHECK (
+    discount_value > 0 AND (discount_type <> 'PERCENT' OR discount_value <= 100)
+);
@@ -0,0 +1,10 @@
+-- New accounts stay unverified until the user opens the link emailed to them.
+-- Accounts created before verification existed are trusted as verified.
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE users SET email_verified_at = created_at;
+
+---- create above / drop below ----
+
+-- Drop column
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
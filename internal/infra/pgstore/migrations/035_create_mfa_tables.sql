@@ -0,0 +1,38 @@
+-- TOTP two-factor authentication. The secret is stored encrypted and is only
+-- enabled once the user proves their authenticator app produces its codes.
+-- last_used_step keeps a code from being replayed within its time window, and
+-- too many wrong codes lock verification until locked_until.
+CREATE TABLE user_totp (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret BYTEA NOT NULL,
+    enabled_at TIMESTAMP WITH TIME ZONE,
+    last_used_step BIGINT,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+-- Single-use codes that stand in for a TOTP code when the authenticator is
+-- lost. Only their SHA-256 hash is stored.
+CREATE TABLE mfa_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT mfa_recovery_codes_user_code_unique UNIQUE (user_id, code_hash)
+);
+
+-- Roles whose users must enable two-factor authentication
+CREATE TABLE mfa_role_policy (
+    role role PRIMARY KEY,
+    required BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+---- create above / drop below ----
+
+-- Drop tables
+DROP TABLE IF EXISTS mfa_role_policy;
+DROP TABLE IF EXISTS mfa_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
@@ -0,0 +1,22 @@
+-- Failed sign ins per client IP and per account email, shared by every API
+-- replica. Failures older than the attempt window no longer count, and past
+-- a few of them sign ins are refused until locked_until, twice as long after
+-- each further failure.
+CREATE TABLE login_throttle (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    scope VARCHAR(16) NOT NULL,
+    key TEXT NOT NULL,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL,
+    CONSTRAINT login_throttle_scope_key_unique UNIQUE (scope, key)
+);
+
+CREATE INDEX idx_login_throttle_locked_until ON login_throttle(locked_until) WHERE locked_until IS NOT NULL;
+CREATE INDEX idx_login_throttle_last_failed_at ON login_throttle(last_failed_at);
+
+---- create above / drop below ----
+
+-- Drop tables
+DROP TABLE IF EXISTS login_throttle;
@@ -0,0 +1,8 @@
+-- The redemption of a subscription that ends without ever being paid is
+-- looked up by subscription to give the coupon back
+CREATE INDEX idx_coupon_redemption_subscription_id ON coupon_redemption(subscription_id);
+
+---- create above / drop below ----
+
+-- Drop indexes
+DROP INDEX IF EXISTS idx_coupon_redemption_subscription_id;
@@ -0,0 +1,16 @@
+-- Tokens of the cookie sessions of each user. The session store only knows
+-- sessions by token, so this is how the sessions of a user are found to list
+-- or revoke them. Sessions started before the index existed are indexed when
+-- the server starts, see AuthService.IndexCookieSessions.
+CREATE TABLE user_session (
+    token TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW() NOT NULL
+);
+
+CREATE INDEX idx_user_session_user_id ON user_session(user_id);
+
+---- create above / drop below ----
+
+-- Drop tables
+DROP TABLE IF EXISTS user_session;
@@ -0,0 +1,14 @@
+-- A payment confirmed after its period was already paid, or after its
+-- subscription ended, is never booked as revenue; it is flagged so it can be
+-- paid back to the student
+ALTER TABLE payment ADD COLUMN refund_due BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX idx_payment_refund_due ON payment(updated_at) WHERE refund_due;
+
+---- create above / drop below ----
+
+-- Drop index
+DROP INDEX IF EXISTS idx_payment_refund_due;
+
+-- Drop column
+ALTER TABLE payment DROP COLUMN IF EXISTS refund_due;
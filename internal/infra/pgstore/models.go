@@ -77,6 +77,21 @@ const (
 	SchedulingTypeInPerson SchedulingType = "IN_PERSON"
 )
 
+type SchedulingSeriesScope string
+
+const (
+	SchedulingSeriesScopeThis      SchedulingSeriesScope = "THIS"
+	SchedulingSeriesScopeFollowing SchedulingSeriesScope = "FOLLOWING"
+	SchedulingSeriesScopeAll       SchedulingSeriesScope = "ALL"
+)
+
+type ScheduleExceptionType string
+
+const (
+	ScheduleExceptionTypeUnavailable ScheduleExceptionType = "UNAVAILABLE"
+	ScheduleExceptionTypeAvailable   ScheduleExceptionType = "AVAILABLE"
+)
+
 type Level string
 
 const (
@@ -226,12 +241,151 @@ type PersonalSchedule struct {
 	PersonalID         uuid.UUID `json:"personalId" db:"personal_id"`
 }
 
+type PersonalScheduleException struct {
+	ID                 uuid.UUID             `json:"id" db:"id"`
+	PersonalID         uuid.UUID             `json:"personalId" db:"personal_id"`
+	Date               time.Time             `json:"date" db:"date"`
+	Type               ScheduleExceptionType `json:"type" db:"type"`
+	TimeStartInMinutes *int32                `json:"timeStartInMinutes,omitempty" db:"time_start_in_minutes"`
+	TimeEndInMinutes   *int32                `json:"timeEndInMinutes,omitempty" db:"time_end_in_minutes"`
+	Reason             *string               `json:"reason,omitempty" db:"reason"`
+	CreatedAt          time.Time             `json:"createdAt" db:"created_at"`
+}
+
 type Plan struct {
-	ID          uuid.UUID  `json:"id" db:"id"`
-	Name        string     `json:"name" db:"name"`
-	Description []string   `json:"description" db:"description"`
-	Price       float64    `json:"price" db:"price"`
-	PersonalID  *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	ID             uuid.UUID  `json:"id" db:"id"`
+	Name           string     `json:"name" db:"name"`
+	Description    string     `json:"description" db:"description"`
+	Features       []string   `json:"features" db:"features"`
+	Price          Money      `json:"price" db:"price"`
+	Duration       int32      `json:"duration" db:"duration"`
+	Type           PlanType   `json:"type" db:"type"`
+	SessionCredits *int32     `json:"sessionCredits,omitempty" db:"session_credits"`
+	IsActive       bool       `json:"isActive" db:"is_active"`
+	PersonalID     *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	CreatedAt      time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+type Subscription struct {
+	ID                uuid.UUID          `json:"id" db:"id"`
+	UserID            uuid.UUID          `json:"userId" db:"user_id"`
+	PlanID            uuid.UUID          `json:"planId" db:"plan_id"`
+	NextPlanID        *uuid.UUID         `json:"nextPlanId,omitempty" db:"next_plan_id"`
+	Status            SubscriptionStatus `json:"status" db:"status"`
+	StartDate         time.Time          `json:"startDate" db:"start_date"`
+	EndDate           time.Time          `json:"endDate" db:"end_date"`
+	Amount            Money              `json:"amount" db:"amount"`
+	CancelAtPeriodEnd bool               `json:"cancelAtPeriodEnd" db:"cancel_at_period_end"`
+	CancelledAt       *time.Time         `json:"cancelledAt,omitempty" db:"cancelled_at"`
+	PlanType          PlanType           `json:"planType" db:"plan_type"`
+	SessionCredits    *int32             `json:"sessionCredits,omitempty" db:"session_credits"`
+	CreatedAt         time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time          `json:"updatedAt" db:"updated_at"`
+}
+
+type SubscriptionEvent string
+
+const (
+	SubscriptionEventCreated         SubscriptionEvent = "CREATED"
+	SubscriptionEventActivated       SubscriptionEvent = "ACTIVATED"
+	SubscriptionEventRenewed         SubscriptionEvent = "RENEWED"
+	SubscriptionEventPlanChanged     SubscriptionEvent = "PLAN_CHANGED"
+	SubscriptionEventCancelRequested SubscriptionEvent = "CANCEL_REQUESTED"
+	SubscriptionEventResumed         SubscriptionEvent = "RESUMED"
+	SubscriptionEventCancelled       SubscriptionEvent = "CANCELLED"
+	SubscriptionEventExpired         SubscriptionEvent = "EXPIRED"
+)
+
+type Payment struct {
+	ID                uuid.UUID     `json:"id" db:"id"`
+	SubscriptionID    uuid.UUID     `json:"subscriptionId" db:"subscription_id"`
+	UserID            uuid.UUID     `json:"userId" db:"user_id"`
+	Amount            Money         `json:"amount" db:"amount"`
+	Method            PaymentMethod `json:"method" db:"method"`
+	Provider          string        `json:"provider" db:"provider"`
+	ProviderPaymentID *string       `json:"providerPaymentId,omitempty" db:"provider_payment_id"`
+	Status            PaymentStatus `json:"status" db:"status"`
+	FailureReason     *string       `json:"failureReason,omitempty" db:"failure_reason"`
+	PixCode           *string       `json:"pixCode,omitempty" db:"pix_code"`
+	ExpiresAt         *time.Time    `json:"expiresAt,omitempty" db:"expires_at"`
+	RefundDue         bool          `json:"refundDue" db:"refund_due"`
+	CreatedAt         time.Time     `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time     `json:"updatedAt" db:"updated_at"`
+}
+
+type PaymentWebhookEvent struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	Provider   string     `json:"provider" db:"provider"`
+	EventID    string     `json:"eventId" db:"event_id"`
+	EventType  string     `json:"eventType" db:"event_type"`
+	PaymentID  *uuid.UUID `json:"paymentId,omitempty" db:"payment_id"`
+	Payload    []byte     `json:"payload" db:"payload"`
+	Outcome    string     `json:"outcome" db:"outcome"`
+	ReceivedAt time.Time  `json:"receivedAt" db:"received_at"`
+}
+
+type SubscriptionHistory struct {
+	ID             uuid.UUID          `json:"id" db:"id"`
+	SubscriptionID uuid.UUID          `json:"subscriptionId" db:"subscription_id"`
+	PlanID         uuid.UUID          `json:"planId" db:"plan_id"`
+	Event          SubscriptionEvent  `json:"event" db:"event"`
+	Status         SubscriptionStatus `json:"status" db:"status"`
+	StartDate      time.Time          `json:"startDate" db:"start_date"`
+	EndDate        time.Time          `json:"endDate" db:"end_date"`
+	Amount         Money              `json:"amount" db:"amount"`
+	CouponID       *uuid.UUID         `json:"couponId,omitempty" db:"coupon_id"`
+	Discount       Money              `json:"discount" db:"discount"`
+	CreatedAt      time.Time          `json:"createdAt" db:"created_at"`
+}
+
+type SessionCredit struct {
+	ID             uuid.UUID           `json:"id" db:"id"`
+	SubscriptionID uuid.UUID           `json:"subscriptionId" db:"subscription_id"`
+	UserID         uuid.UUID           `json:"userId" db:"user_id"`
+	PersonalID     uuid.UUID           `json:"personalId" db:"personal_id"`
+	SchedulingID   *uuid.UUID          `json:"schedulingId,omitempty" db:"scheduling_id"`
+	Delta          int32               `json:"delta" db:"delta"`
+	Reason         SessionCreditReason `json:"reason" db:"reason"`
+	CreatedAt      time.Time           `json:"createdAt" db:"created_at"`
+}
+
+type Coupon struct {
+	ID                    uuid.UUID          `json:"id" db:"id"`
+	PersonalID            uuid.UUID          `json:"personalId" db:"personal_id"`
+	Code                  string             `json:"code" db:"code"`
+	DiscountType          CouponDiscountType `json:"discountType" db:"discount_type"`
+	DiscountPercent       *float64           `json:"discountPercent,omitempty" db:"discount_percent"`
+	DiscountAmount        *Money             `json:"discountAmount,omitempty" db:"discount_amount"`
+	MaxRedemptions        *int32             `json:"maxRedemptions,omitempty" db:"max_redemptions"`
+	MaxRedemptionsPerUser *int32             `json:"maxRedemptionsPerUser,omitempty" db:"max_redemptions_per_user"`
+	RedemptionCount       int32              `json:"redemptionCount" db:"redemption_count"`
+	ValidFrom             *time.Time         `json:"validFrom,omitempty" db:"valid_from"`
+	ValidUntil            *time.Time         `json:"validUntil,omitempty" db:"valid_until"`
+	IsActive              bool               `json:"isActive" db:"is_active"`
+	CreatedAt             time.Time          `json:"createdAt" db:"created_at"`
+	UpdatedAt             time.Time          `json:"updatedAt" db:"updated_at"`
+}
+
+type CouponRedemption struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	CouponID       uuid.UUID `json:"couponId" db:"coupon_id"`
+	UserID         uuid.UUID `json:"userId" db:"user_id"`
+	SubscriptionID uuid.UUID `json:"subscriptionId" db:"subscription_id"`
+	Discount       Money     `json:"discount" db:"discount"`
+	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
+}
+
+type RevenueEntry struct {
+	ID             uuid.UUID        `json:"id" db:"id"`
+	PersonalID     uuid.UUID        `json:"personalId" db:"personal_id"`
+	PlanID         uuid.UUID        `json:"planId" db:"plan_id"`
+	SubscriptionID uuid.UUID        `json:"subscriptionId" db:"subscription_id"`
+	PaymentID      uuid.UUID        `json:"paymentId" db:"payment_id"`
+	Type           RevenueEntryType `json:"type" db:"type"`
+	Amount         Money            `json:"amount" db:"amount"`
+	OccurredAt     time.Time        `json:"occurredAt" db:"occurred_at"`
+	CreatedAt      time.Time        `json:"createdAt" db:"created_at"`
 }
 
 type Workout struct {
@@ -288,19 +442,30 @@ type Scheduling struct {
 	StudentID   uuid.UUID        `json:"studentId" db:"student_id"`
 	WorkoutID   *uuid.UUID       `json:"workoutId,omitempty" db:"workout_id"`
 	Date        time.Time        `json:"date" db:"date"`
+	EndTime     time.Time        `json:"endTime" db:"end_time"`
 	Type        SchedulingType   `json:"type" db:"type"`
 	Status      SchedulingStatus `json:"status" db:"status"`
+	Notes       *string          `json:"notes,omitempty" db:"notes"`
 	StartedAt   *time.Time       `json:"startedAt,omitempty" db:"started_at"`
 	CompletedAt *time.Time       `json:"completedAt,omitempty" db:"completed_at"`
 	StardAt     *time.Time       `json:"stardAt,omitempty" db:"stard_at"` // Note: keeping original typo for compatibility
 	CreatedAt   time.Time        `json:"createdAt" db:"created_at"`
 	UserID      *uuid.UUID       `json:"userId,omitempty" db:"user_id"`
+	SeriesID    *uuid.UUID       `json:"seriesId,omitempty" db:"series_id"`
+}
+
+type SchedulingSeries struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+	StudentID  uuid.UUID `json:"studentId" db:"student_id"`
+	Recurrence string    `json:"recurrence" db:"recurrence"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
 }
 
 type SchedulingsHistory struct {
 	ID         uuid.UUID        `json:"id" db:"id"`
 	ScheduleID uuid.UUID        `json:"scheduleId" db:"schedule_id"`
-	UserID     uuid.UUID        `json:"userId" db:"user_id"`
+	UserID     *uuid.UUID       `json:"userId,omitempty" db:"user_id"`
 	Status     SchedulingStatus `json:"status" db:"status"`
 	ChangedAt  *time.Time       `json:"changedAt,omitempty" db:"changed_at"`
 	ChangedBy  string           `json:"changedBy" db:"changed_by"`
@@ -317,21 +482,47 @@ type Message struct {
 	SentAt     time.Time `json:"sentAt" db:"sent_at"`
 }
 
+type WorkoutSession struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	StudentID  uuid.UUID  `json:"studentId" db:"student_id"`
+	WorkoutID  uuid.UUID  `json:"workoutId" db:"workout_id"`
+	StartedAt  time.Time  `json:"startedAt" db:"started_at"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty" db:"finished_at"`
+	Duration   *int32     `json:"duration,omitempty" db:"duration"`
+	Notes      *string    `json:"notes,omitempty" db:"notes"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
 type WorkoutsHistory struct {
-	ID               uuid.UUID `json:"id" db:"id"`
-	StudentID        uuid.UUID `json:"studentId" db:"student_id"`
-	WorkoutID        uuid.UUID `json:"workoutId" db:"workout_id"`
-	ExecutionTime    *string   `json:"executionTime,omitempty" db:"execution_time"`
-	Weight           int32     `json:"weight" db:"weight"`
-	Sets             string    `json:"sets" db:"sets"`
-	Reps             string    `json:"reps" db:"reps"`
-	RestTime         *int32    `json:"restTime,omitempty" db:"rest_time"`
-	Thumbnail        *string   `json:"thumbnail,omitempty" db:"thumbnail"`
-	TimeTotalWorkout int32     `json:"timeTotalWorkout" db:"time_total_workout"`
-	ExerciseTitle    string    `json:"exerciseTitle" db:"exercise_title"`
-	ExerciseID       uuid.UUID `json:"exerciseId" db:"exercise_id"`
-	CreatedAt        time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`
+	ID               uuid.UUID    `json:"id" db:"id"`
+	StudentID        uuid.UUID    `json:"studentId" db:"student_id"`
+	WorkoutID        uuid.UUID    `json:"workoutId" db:"workout_id"`
+	SessionID        uuid.UUID    `json:"sessionId" db:"session_id"`
+	ExecutionTime    *string      `json:"executionTime,omitempty" db:"execution_time"`
+	RestTime         *int32       `json:"restTime,omitempty" db:"rest_time"`
+	Thumbnail        *string      `json:"thumbnail,omitempty" db:"thumbnail"`
+	TimeTotalWorkout int32        `json:"timeTotalWorkout" db:"time_total_workout"`
+	ExerciseTitle    string       `json:"exerciseTitle" db:"exercise_title"`
+	ExerciseID       uuid.UUID    `json:"exerciseId" db:"exercise_id"`
+	CreatedAt        time.Time    `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time    `json:"updatedAt" db:"updated_at"`
+	Sets             []WorkoutSet `json:"sets" db:"-"`
+}
+
+type WorkoutSet struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	SessionID  uuid.UUID `json:"sessionId" db:"session_id"`
+	HistoryID  uuid.UUID `json:"historyId" db:"history_id"`
+	ExerciseID uuid.UUID `json:"exerciseId" db:"exercise_id"`
+	SetIndex   int32     `json:"setIndex" db:"set_index"`
+	Reps       int32     `json:"reps" db:"reps"`
+	LoadKg     float64   `json:"loadKg" db:"load_kg"`
+	RPE        *float64  `json:"rpe,omitempty" db:"rpe"`
+	RIR        *int32    `json:"rir,omitempty" db:"rir"`
+	ToFailure  bool      `json:"toFailure" db:"to_failure"`
+	IsWarmup   bool      `json:"isWarmup" db:"is_warmup"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
 }
 
 type Comment struct {
@@ -367,6 +558,7 @@ type PasswordResetToken struct {
 type RefreshToken struct {
 	ID         uuid.UUID  `json:"id" db:"id"`
 	UserID     uuid.UUID  `json:"userId" db:"user_id"`
+	FamilyID   uuid.UUID  `json:"familyId" db:"family_id"`
 	Token      string     `json:"token" db:"token"`
 	ExpiresAt  time.Time  `json:"expiresAt" db:"expires_at"`
 	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
@@ -394,9 +586,13 @@ type MessageResponse struct {
 }
 
 // Request/Response types
+// Mobile clients set IssueTokens to get an access/refresh token pair instead
+// of the session cookie
 type AuthenticateWithPasswordRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email       string  `json:"email" validate:"required,email"`
+	Password    string  `json:"password" validate:"required"`
+	IssueTokens bool    `json:"issueTokens,omitempty"`
+	DeviceInfo  *string `json:"deviceInfo,omitempty"`
 }
 
 type CreateStudentWithUserRequest struct {
@@ -494,6 +690,8 @@ type UpdateExerciseRequest struct {
 	RestTimeBetweenSets *int32  `json:"restTimeBetweenSets,omitempty"`
 }
 
+// CreateSchedulingRequest books a single session, or a weekly series when
+// Recurrence holds an RRULE such as "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=12"
 type CreateSchedulingRequest struct {
 	Date       time.Time      `json:"date" validate:"required"`
 	StartTime  time.Time      `json:"startTime" validate:"required"`
@@ -501,16 +699,36 @@ type CreateSchedulingRequest struct {
 	Type       SchedulingType `json:"type" validate:"required"`
 	Notes      *string        `json:"notes,omitempty"`
 	PersonalID uuid.UUID      `json:"personalId" validate:"required"`
+	Recurrence *string        `json:"recurrence,omitempty"`
 }
 
+// UpdateSchedulingRequest changes a session. For occurrences of a series,
+// Scope selects whether the change applies to this occurrence only (default),
+// to this and the following ones, or to the whole series.
 type UpdateSchedulingRequest struct {
-	Date      *time.Time        `json:"date,omitempty"`
-	StartTime *time.Time        `json:"startTime,omitempty"`
-	EndTime   *time.Time        `json:"endTime,omitempty"`
-	Status    *SchedulingStatus `json:"status,omitempty"`
-	Type      *SchedulingType   `json:"type,omitempty"`
-	Notes     *string           `json:"notes,omitempty"`
+	Date      *time.Time             `json:"date,omitempty"`
+	StartTime *time.Time             `json:"startTime,omitempty"`
+	EndTime   *time.Time             `json:"endTime,omitempty"`
+	Status    *SchedulingStatus      `json:"status,omitempty"`
+	Type      *SchedulingType        `json:"type,omitempty"`
+	Notes     *string                `json:"notes,omitempty"`
+	Scope     *SchedulingSeriesScope `json:"scope,omitempty"`
 }
+
+type PersonalScheduleRequest struct {
+	WeekDay            int32 `json:"weekDay" validate:"min=0,max=6"`
+	TimeStartInMinutes int32 `json:"timeStartInMinutes" validate:"min=0,max=1439"`
+	TimeEndInMinutes   int32 `json:"timeEndInMinutes" validate:"required,min=1,max=1440"`
+}
+
+type CreateScheduleExceptionRequest struct {
+	Date               string                `json:"date" validate:"required"`
+	Type               ScheduleExceptionType `json:"type" validate:"required,oneof=UNAVAILABLE AVAILABLE"`
+	TimeStartInMinutes *int32                `json:"timeStartInMinutes,omitempty"`
+	TimeEndInMinutes   *int32                `json:"timeEndInMinutes,omitempty"`
+	Reason             *string               `json:"reason,omitempty" validate:"max=500"`
+}
+
 type WorkoutFrequencyResponse struct {
 	TotalWorkouts   int32   `json:"total_workouts"`
 	AveragePerWeek  float64 `json:"average_per_week"`
@@ -523,6 +741,7 @@ type WorkoutFrequencyResponse struct {
 
 type WorkoutHistoryExerciseResponse struct {
 	WorkoutHistoryID uuid.UUID `json:"workout_history_id"`
+	ExerciseID       uuid.UUID `json:"exercise_id"`
 	WorkoutName      string    `json:"workout_name"`
 	ExerciseName     string    `json:"exercise_name"`
 	Sets             int32     `json:"sets"`
@@ -534,10 +753,11 @@ type WorkoutHistoryExerciseResponse struct {
 }
 
 type ExerciseProgressPoint struct {
-	Date   time.Time `json:"date"`
-	Weight *float64  `json:"weight,omitempty"`
-	Reps   int32     `json:"reps"`
-	Volume float64   `json:"volume"`
+	Date               time.Time `json:"date"`
+	Weight             *float64  `json:"weight,omitempty"`
+	Reps               int32     `json:"reps"`
+	Volume             float64   `json:"volume"`
+	EstimatedOneRepMax *float64  `json:"estimated_one_rep_max,omitempty"`
 }
 
 type ExercisePerformanceResponse struct {
@@ -552,6 +772,46 @@ type ExercisePerformanceResponse struct {
 	FirstRecorded time.Time               `json:"first_recorded"`
 	LastRecorded  time.Time               `json:"last_recorded"`
 	ProgressData  []ExerciseProgressPoint `json:"progress_data"`
+
+	Formula               OneRepMaxFormula `json:"formula"`
+	MaxEstimatedOneRepMax *float64         `json:"max_estimated_one_rep_max,omitempty"`
+}
+
+type OneRepMaxFormula string
+
+const (
+	OneRepMaxFormulaEpley   OneRepMaxFormula = "EPLEY"
+	OneRepMaxFormulaBrzycki OneRepMaxFormula = "BRZYCKI"
+)
+
+type PersonalRecordType string
+
+const (
+	PersonalRecordWeight             PersonalRecordType = "WEIGHT"
+	PersonalRecordRepsAtWeight       PersonalRecordType = "REPS_AT_WEIGHT"
+	PersonalRecordVolume             PersonalRecordType = "VOLUME"
+	PersonalRecordEstimatedOneRepMax PersonalRecordType = "E1RM"
+)
+
+// PersonalRecordResponse describes the best mark of an exercise. Value holds
+// the load for WEIGHT, the reps for REPS_AT_WEIGHT, the session volume for
+// VOLUME and the estimated one-rep max for E1RM.
+type PersonalRecordResponse struct {
+	ExerciseID    uuid.UUID          `json:"exercise_id"`
+	ExerciseName  string             `json:"exercise_name"`
+	Type          PersonalRecordType `json:"type"`
+	Value         float64            `json:"value"`
+	LoadKg        *float64           `json:"load_kg,omitempty"`
+	Reps          *int32             `json:"reps,omitempty"`
+	PreviousValue *float64           `json:"previous_value,omitempty"`
+	SessionID     uuid.UUID          `json:"session_id"`
+	AchievedAt    time.Time          `json:"achieved_at"`
+}
+
+type ExerciseRecordsResponse struct {
+	ExerciseID   uuid.UUID                `json:"exercise_id"`
+	ExerciseName string                   `json:"exercise_name"`
+	Records      []PersonalRecordResponse `json:"records"`
 }
 
 type UserStatisticsResponse struct {
@@ -569,19 +829,19 @@ type UserStatisticsResponse struct {
 }
 
 type PlatformStatisticsResponse struct {
-	TotalUsers           int32   `json:"total_users"`
-	TotalStudents        int32   `json:"total_students"`
-	TotalTrainers        int32   `json:"total_trainers"`
-	ActiveUsers          int32   `json:"active_users"`
-	NewUsersThisMonth    int32   `json:"new_users_this_month"`
-	TotalWorkouts        int32   `json:"total_workouts"`
-	TotalExercises       int32   `json:"total_exercises"`
-	WorkoutsThisMonth    int32   `json:"workouts_this_month"`
-	TotalSchedulings     int32   `json:"total_schedulings"`
-	CompletedSchedulings int32   `json:"completed_schedulings"`
-	SchedulingsThisMonth int32   `json:"schedulings_this_month"`
-	Revenue              float64 `json:"revenue"`
-	RevenueThisMonth     float64 `json:"revenue_this_month"`
+	TotalUsers           int32 `json:"total_users"`
+	TotalStudents        int32 `json:"total_students"`
+	TotalTrainers        int32 `json:"total_trainers"`
+	ActiveUsers          int32 `json:"active_users"`
+	NewUsersThisMonth    int32 `json:"new_users_this_month"`
+	TotalWorkouts        int32 `json:"total_workouts"`
+	TotalExercises       int32 `json:"total_exercises"`
+	WorkoutsThisMonth    int32 `json:"workouts_this_month"`
+	TotalSchedulings     int32 `json:"total_schedulings"`
+	CompletedSchedulings int32 `json:"completed_schedulings"`
+	SchedulingsThisMonth int32 `json:"schedulings_this_month"`
+	Revenue              Money `json:"revenue"`
+	RevenueThisMonth     Money `json:"revenue_this_month"`
 }
 
 type DailySignupData struct {
@@ -625,13 +885,19 @@ type SchedulingReportResponse struct {
 }
 
 type DailyRevenueData struct {
-	Date    time.Time `json:"date"`
-	Revenue float64   `json:"revenue"`
+	Date         time.Time `json:"date"`
+	Revenue      Money     `json:"revenue"`
+	Refunds      Money     `json:"refunds"`
+	PlatformFees Money     `json:"platform_fees"`
 }
 
 type RevenueReportResponse struct {
-	TotalRevenue     float64            `json:"total_revenue"`
-	AverageRevenue   float64            `json:"average_revenue"`
+	StartDate        time.Time          `json:"start_date"`
+	EndDate          time.Time          `json:"end_date"`
+	TotalRevenue     Money              `json:"total_revenue"`
+	Refunds          Money              `json:"refunds"`
+	PlatformFees     Money              `json:"platform_fees"`
+	AverageRevenue   Money              `json:"average_revenue"`
 	RevenueGrowth    float64            `json:"revenue_growth"`
 	DailyRevenueData []DailyRevenueData `json:"daily_revenue_data"`
 }
@@ -641,7 +907,7 @@ type TopTrainerData struct {
 	TotalSchedulings  int32   `json:"total_schedulings"`
 	CompletedSessions int32   `json:"completed_sessions"`
 	Rating            float64 `json:"rating"`
-	Revenue           float64 `json:"revenue"`
+	Revenue           Money   `json:"revenue"`
 }
 
 type TrainerReportResponse struct {
@@ -735,6 +1001,47 @@ const (
 	PaymentStatusRefunded  PaymentStatus = "REFUNDED"
 )
 
+type PaymentMethod string
+
+const (
+	PaymentMethodCreditCard PaymentMethod = "CREDIT_CARD"
+	PaymentMethodDebitCard  PaymentMethod = "DEBIT_CARD"
+	PaymentMethodPix        PaymentMethod = "PIX"
+)
+
+type PlanType string
+
+const (
+	PlanTypeSubscription PlanType = "SUBSCRIPTION"
+	PlanTypePackage      PlanType = "PACKAGE"
+)
+
+type SessionCreditReason string
+
+const (
+	SessionCreditGranted  SessionCreditReason = "GRANTED"
+	SessionCreditConsumed SessionCreditReason = "CONSUMED"
+	SessionCreditRefunded SessionCreditReason = "REFUNDED"
+	SessionCreditExpired  SessionCreditReason = "EXPIRED"
+	SessionCreditRevoked  SessionCreditReason = "REVOKED"
+)
+
+type CouponDiscountType string
+
+const (
+	CouponDiscountPercent CouponDiscountType = "PERCENT"
+	CouponDiscountFixed   CouponDiscountType = "FIXED"
+)
+
+type RevenueEntryType string
+
+const (
+	RevenueEntryCharge      RevenueEntryType = "CHARGE"
+	RevenueEntryRefund      RevenueEntryType = "REFUND"
+	RevenueEntryPlatformFee RevenueEntryType = "PLATFORM_FEE"
+	RevenueEntryFeeRefund   RevenueEntryType = "FEE_REFUND"
+)
+
 type UserStatus string
 
 const (
@@ -743,12 +1050,47 @@ const (
 	UserStatusBanned    UserStatus = "BANNED"
 )
 
+type LoginThrottleScope string
+
+const (
+	LoginThrottleIP      LoginThrottleScope = "IP"
+	LoginThrottleAccount LoginThrottleScope = "ACCOUNT"
+)
+
+type ActiveSessionType string
+
+const (
+	ActiveSessionCookie ActiveSessionType = "COOKIE"
+	ActiveSessionToken  ActiveSessionType = "TOKEN"
+)
+
 type WorkoutHistoryResponse struct {
-	ID          uuid.UUID `json:"id"`
-	WorkoutName string    `json:"workout_name"`
-	Duration    int32     `json:"duration"`
-	Notes       *string   `json:"notes,omitempty"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          uuid.UUID                            `json:"id"`
+	WorkoutID   uuid.UUID                            `json:"workout_id"`
+	WorkoutName string                               `json:"workout_name"`
+	Duration    int32                                `json:"duration"`
+	Notes       *string                              `json:"notes,omitempty"`
+	Exercises   []WorkoutHistoryExerciseSetsResponse `json:"exercises"`
+	CreatedAt   time.Time                            `json:"created_at"`
+}
+
+type WorkoutHistoryExerciseSetsResponse struct {
+	ExerciseID    uuid.UUID                   `json:"exercise_id"`
+	ExerciseName  string                      `json:"exercise_name"`
+	Thumbnail     *string                     `json:"thumbnail,omitempty"`
+	RestTime      *int32                      `json:"rest_time,omitempty"`
+	ExecutionTime *string                     `json:"execution_time,omitempty"`
+	Sets          []WorkoutHistorySetResponse `json:"sets"`
+}
+
+type WorkoutHistorySetResponse struct {
+	SetIndex  int32    `json:"set_index"`
+	Reps      int32    `json:"reps"`
+	LoadKg    float64  `json:"load_kg"`
+	RPE       *float64 `json:"rpe,omitempty"`
+	RIR       *int32   `json:"rir,omitempty"`
+	ToFailure bool     `json:"to_failure"`
+	IsWarmup  bool     `json:"is_warmup"`
 }
 
 type ExerciseTemplateResponse struct {
@@ -784,7 +1126,7 @@ type TrainingProgramResponse struct {
 	Difficulty  string    `json:"difficulty"`
 	Duration    int32     `json:"duration"`
 	IsFree      bool      `json:"is_free"`
-	Price       *float64  `json:"price,omitempty"`
+	Price       *Money    `json:"price,omitempty"`
 }
 
 type AvailabilitySlot struct {
@@ -793,6 +1135,11 @@ type AvailabilitySlot struct {
 	Available bool      `json:"available"`
 }
 
+type TrainerScheduleResponse struct {
+	Windows    []PersonalSchedule          `json:"windows"`
+	Exceptions []PersonalScheduleException `json:"exceptions"`
+}
+
 type SchedulingHistoryResponse struct {
 	ID          uuid.UUID        `json:"id"`
 	Date        time.Time        `json:"date"`
@@ -803,41 +1150,113 @@ type SchedulingHistoryResponse struct {
 	CompletedAt *time.Time       `json:"completed_at,omitempty"`
 }
 
+// PlanRequest creates or replaces a plan. Duration is the billing period in
+// days, or how long the credits of a PACKAGE plan stay valid. The type is
+// SUBSCRIPTION unless set and cannot change once the plan exists.
+type PlanRequest struct {
+	Name           string    `json:"name" validate:"required"`
+	Description    string    `json:"description"`
+	Price          Money     `json:"price"`
+	Duration       int32     `json:"duration" validate:"required"`
+	Features       []string  `json:"features"`
+	Type           *PlanType `json:"type,omitempty"`
+	SessionCredits *int32    `json:"session_credits,omitempty"`
+	IsActive       *bool     `json:"is_active,omitempty"`
+}
+
 type PlanResponse struct {
 	ID              uuid.UUID `json:"id"`
 	TrainerID       uuid.UUID `json:"trainer_id"`
 	TrainerName     string    `json:"trainer_name,omitempty"`
 	Name            string    `json:"name"`
 	Description     string    `json:"description"`
-	Price           float64   `json:"price"`
+	Price           Money     `json:"price"`
 	Duration        int32     `json:"duration"`
 	Features        []string  `json:"features"`
+	Type            PlanType  `json:"type"`
+	SessionCredits  *int32    `json:"session_credits,omitempty"`
 	IsActive        bool      `json:"is_active"`
 	SubscriberCount int32     `json:"subscriber_count"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 }
 
+// SubscriptionRequest subscribes to a plan. A payment method pays the first
+// period right away, as ProcessPaymentRequest does, and a coupon code of the
+// plan's trainer discounts it.
+type SubscriptionRequest struct {
+	PlanID        string         `json:"plan_id" validate:"required"`
+	PaymentMethod *PaymentMethod `json:"payment_method,omitempty"`
+	PaymentToken  string         `json:"payment_token,omitempty"`
+	CouponCode    string         `json:"coupon_code,omitempty"`
+}
+
 type SubscriptionResponse struct {
-	ID        uuid.UUID          `json:"id"`
-	UserID    uuid.UUID          `json:"user_id"`
-	PlanID    uuid.UUID          `json:"plan_id"`
-	PlanName  string             `json:"plan_name"`
-	StartDate time.Time          `json:"start_date"`
-	EndDate   time.Time          `json:"end_date"`
-	Status    SubscriptionStatus `json:"status"`
-	CreatedAt time.Time          `json:"created_at"`
-	UpdatedAt time.Time          `json:"updated_at"`
+	ID                uuid.UUID          `json:"id"`
+	UserID            uuid.UUID          `json:"user_id"`
+	PlanID            uuid.UUID          `json:"plan_id"`
+	PlanName          string             `json:"plan_name"`
+	NextPlanID        *uuid.UUID         `json:"next_plan_id,omitempty"`
+	StartDate         time.Time          `json:"start_date"`
+	EndDate           time.Time          `json:"end_date"`
+	Status            SubscriptionStatus `json:"status"`
+	Amount            Money              `json:"amount"`
+	Discount          *Money             `json:"discount,omitempty"`
+	CancelAtPeriodEnd bool               `json:"cancel_at_period_end"`
+	CancelledAt       *time.Time         `json:"cancelled_at,omitempty"`
+	Payment           *PaymentResponse   `json:"payment,omitempty"`
+	PaymentError      string             `json:"payment_error,omitempty"`
+	CreatedAt         time.Time          `json:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at"`
+}
+
+// ProcessPaymentRequest pays a subscription. Card payments need the token
+// of the card; PIX payments return a code to pay instead.
+type ProcessPaymentRequest struct {
+	PaymentMethod PaymentMethod `json:"payment_method" validate:"required,oneof=CREDIT_CARD DEBIT_CARD PIX"`
+	PaymentToken  string        `json:"payment_token"`
+}
+
+type PaymentResponse struct {
+	ID             uuid.UUID          `json:"id"`
+	SubscriptionID uuid.UUID          `json:"subscription_id"`
+	Amount         Money              `json:"amount"`
+	Method         PaymentMethod      `json:"method"`
+	Provider       string             `json:"provider"`
+	Status         PaymentStatus      `json:"status"`
+	FailureReason  *string            `json:"failure_reason,omitempty"`
+	PixCode        *string            `json:"pix_code,omitempty"`
+	ExpiresAt      *time.Time         `json:"expires_at,omitempty"`
+	RefundDue      bool               `json:"refund_due"`
+	Subscription   SubscriptionStatus `json:"subscription_status"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// PaymentWebhookRequest is the notification a payment provider posts about
+// one of its payments, identified by the provider's payment ID
+type PaymentWebhookRequest struct {
+	ID        string  `json:"id" validate:"required"`
+	Type      string  `json:"type" validate:"required"`
+	PaymentID string  `json:"payment_id" validate:"required"`
+	Reason    *string `json:"reason,omitempty"`
+}
+
+type PaymentWebhookResponse struct {
+	Outcome string `json:"outcome"`
 }
 
 type SubscriptionHistoryResponse struct {
 	ID          uuid.UUID          `json:"id"`
 	PlanName    string             `json:"plan_name"`
 	TrainerName string             `json:"trainer_name"`
+	Event       SubscriptionEvent  `json:"event"`
 	StartDate   time.Time          `json:"start_date"`
 	EndDate     time.Time          `json:"end_date"`
 	Status      SubscriptionStatus `json:"status"`
-	Amount      float64            `json:"amount"`
+	Amount      Money              `json:"amount"`
+	Discount    Money              `json:"discount"`
+	CouponCode  *string            `json:"coupon_code,omitempty"`
 	CreatedAt   time.Time          `json:"created_at"`
 }
 
@@ -851,12 +1270,97 @@ type SubscriberResponse struct {
 	SubscribedAt time.Time          `json:"subscribed_at"`
 }
 
+// CouponRequest creates or replaces a coupon. PERCENT coupons take
+// DiscountPercent of the plan price and FIXED ones DiscountAmount. Empty
+// PlanIDs make the coupon valid for every plan of the trainer, and nil limits
+// or validity bounds leave it unbounded.
+type CouponRequest struct {
+	Code                  string             `json:"code" validate:"required"`
+	DiscountType          CouponDiscountType `json:"discount_type" validate:"required,oneof=PERCENT FIXED"`
+	DiscountPercent       *float64           `json:"discount_percent,omitempty"`
+	DiscountAmount        *Money             `json:"discount_amount,omitempty"`
+	MaxRedemptions        *int32             `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser *int32             `json:"max_redemptions_per_user,omitempty"`
+	ValidFrom             *time.Time         `json:"valid_from,omitempty"`
+	ValidUntil            *time.Time         `json:"valid_until,omitempty"`
+	PlanIDs               []string           `json:"plan_ids"`
+	IsActive              *bool              `json:"is_active,omitempty"`
+}
+
+type CouponResponse struct {
+	ID                    uuid.UUID          `json:"id"`
+	Code                  string             `json:"code"`
+	DiscountType          CouponDiscountType `json:"discount_type"`
+	DiscountPercent       *float64           `json:"discount_percent,omitempty"`
+	DiscountAmount        *Money             `json:"discount_amount,omitempty"`
+	MaxRedemptions        *int32             `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser *int32             `json:"max_redemptions_per_user,omitempty"`
+	RedemptionCount       int32              `json:"redemption_count"`
+	ValidFrom             *time.Time         `json:"valid_from,omitempty"`
+	ValidUntil            *time.Time         `json:"valid_until,omitempty"`
+	PlanIDs               []uuid.UUID        `json:"plan_ids"`
+	IsActive              bool               `json:"is_active"`
+	CreatedAt             time.Time          `json:"created_at"`
+	UpdatedAt             time.Time          `json:"updated_at"`
+}
+
+// CreditPackageResponse is a package purchased by a student. Its ID is the
+// ID of the subscription that bought it.
+type CreditPackageResponse struct {
+	ID               uuid.UUID          `json:"id"`
+	PlanID           uuid.UUID          `json:"plan_id"`
+	PlanName         string             `json:"plan_name"`
+	TrainerID        uuid.UUID          `json:"trainer_id"`
+	TrainerName      string             `json:"trainer_name"`
+	Status           SubscriptionStatus `json:"status"`
+	CreditsTotal     int32              `json:"credits_total"`
+	CreditsRemaining int32              `json:"credits_remaining"`
+	ExpiresAt        time.Time          `json:"expires_at"`
+}
+
+type SessionCreditResponse struct {
+	ID           uuid.UUID           `json:"id"`
+	PackageID    uuid.UUID           `json:"package_id"`
+	PlanName     string              `json:"plan_name"`
+	SchedulingID *uuid.UUID          `json:"scheduling_id,omitempty"`
+	Delta        int32               `json:"delta"`
+	Reason       SessionCreditReason `json:"reason"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
+
+// CreditsResponse sums the credits left in the usable packages
+type CreditsResponse struct {
+	Credits  int32                   `json:"credits"`
+	Packages []CreditPackageResponse `json:"packages"`
+	Ledger   []SessionCreditResponse `json:"ledger,omitempty"`
+}
+
 type PlanRevenueResponse struct {
-	PlanID            uuid.UUID `json:"plan_id"`
-	PlanName          string    `json:"plan_name"`
-	TotalRevenue      float64   `json:"total_revenue"`
-	MonthlyRevenue    float64   `json:"monthly_revenue"`
-	ActiveSubscribers int32     `json:"active_subscribers"`
-	TotalSubscribers  int32     `json:"total_subscribers"`
-	AverageRevenue    float64   `json:"average_revenue"`
+	PlanID            uuid.UUID  `json:"plan_id"`
+	PlanName          string     `json:"plan_name"`
+	StartDate         *time.Time `json:"start_date,omitempty"`
+	EndDate           *time.Time `json:"end_date,omitempty"`
+	TotalRevenue      Money      `json:"total_revenue"`
+	Refunds           Money      `json:"refunds"`
+	PlatformFees      Money      `json:"platform_fees"`
+	NetRevenue        Money      `json:"net_revenue"`
+	MonthlyRevenue    Money      `json:"monthly_revenue"`
+	ActiveSubscribers int32      `json:"active_subscribers"`
+	TotalSubscribers  int32      `json:"total_subscribers"`
+	AverageRevenue    Money      `json:"average_revenue"`
+}
+
+type TrainerRevenueResponse struct {
+	StartDate          time.Time          `json:"start_date"`
+	EndDate            time.Time          `json:"end_date"`
+	TotalRevenue       Money              `json:"total_revenue"`
+	Refunds            Money              `json:"refunds"`
+	PlatformFees       Money              `json:"platform_fees"`
+	NetRevenue         Money              `json:"net_revenue"`
+	MRR                Money              `json:"mrr"`
+	ActiveSubscribers  int32              `json:"active_subscribers"`
+	NewSubscribers     int32              `json:"new_subscribers"`
+	ChurnedSubscribers int32              `json:"churned_subscribers"`
+	ChurnRate          float64            `json:"churn_rate"`
+	DailyRevenueData   []DailyRevenueData `json:"daily_revenue_data"`
 }
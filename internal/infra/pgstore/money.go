@@ -0,0 +1,290 @@
+package pgstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+const CurrencyBRL Currency = "BRL"
+
+// DefaultCurrency is the currency every price is charged in. Amounts are
+// stored in DECIMAL(10,2) columns of this currency.
+const DefaultCurrency = CurrencyBRL
+
+// moneyIntegerDigits is how many digits the whole part of an amount can have
+// to fit the DECIMAL(10,2) columns, i.e. up to 99,999,999.99
+const moneyIntegerDigits = 8
+
+// currencyMinorUnits holds the number of decimal places of each supported
+// currency
+var currencyMinorUnits = map[Currency]int32{
+	CurrencyBRL: 2,
+}
+
+// Money is an exact amount in the minor unit of its currency, e.g. cents. It
+// is read from and written to NUMERIC columns, and travels in JSON as
+// {"amount": "79.99", "currency": "BRL"}. The zero value is zero in the
+// DefaultCurrency.
+type Money struct {
+	Amount   int64
+	Currency Currency
+}
+
+// NewMoney returns an amount of minor units of the DefaultCurrency
+func NewMoney(minorUnits int64) Money {
+	return Money{Amount: minorUnits, Currency: DefaultCurrency}
+}
+
+// ParseMoney parses a decimal amount such as "79.99" or "-5" in the given
+// currency. It rejects amounts with more decimal places than the currency
+// has, or too large for the database columns.
+func ParseMoney(amount string, currency Currency) (Money, error) {
+	digits, ok := currencyMinorUnits[currency]
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	negative := strings.HasPrefix(amount, "-")
+	whole, fraction, hasFraction := strings.Cut(strings.TrimPrefix(amount, "-"), ".")
+	if whole == "" || !isDigits(whole) || (hasFraction && (fraction == "" || !isDigits(fraction))) {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if int32(len(fraction)) > digits {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places", amount, digits)
+	}
+	if len(strings.TrimLeft(whole, "0")) > moneyIntegerDigits {
+		return Money{}, fmt.Errorf("amount %q is too large", amount)
+	}
+
+	var minor int64
+	for _, c := range whole + fraction + strings.Repeat("0", int(digits)-len(fraction)) {
+		minor = minor*10 + int64(c-'0')
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// currency returns the currency of m, the DefaultCurrency for the zero value
+func (m Money) currency() Currency {
+	if m.Currency == "" {
+		return DefaultCurrency
+	}
+	return m.Currency
+}
+
+func (m Money) digits() int32 {
+	if digits, ok := currencyMinorUnits[m.currency()]; ok {
+		return digits
+	}
+	return 2
+}
+
+// String formats the amount as a decimal, e.g. "79.99"
+func (m Money) String() string {
+	digits := m.digits()
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	s := fmt.Sprintf("%0*d", digits+1, amount)
+	if digits == 0 {
+		return sign + s
+	}
+	return sign + s[:len(s)-int(digits)] + "." + s[len(s)-int(digits):]
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currency()}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currency()}
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.currency()}
+}
+
+// Percent returns the given percentage of m, e.g. 12.5 for 12.5% of it,
+// rounded half away from zero to the minor unit
+func (m Money) Percent(percent float64) Money {
+	// Percentages are kept with two decimal places, as in the database
+	basisPoints := big.NewInt(int64(percent*100 + copySign(0.5, percent)))
+	product := new(big.Int).Mul(big.NewInt(m.Amount), basisPoints)
+	return Money{Amount: divRound(product, big.NewInt(10000)).Int64(), Currency: m.currency()}
+}
+
+// Div splits m in n parts, rounded half away from zero to the minor unit
+func (m Money) Div(n int64) Money {
+	if n == 0 {
+		return Money{Currency: m.currency()}
+	}
+	return Money{Amount: divRound(big.NewInt(m.Amount), big.NewInt(n)).Int64(), Currency: m.currency()}
+}
+
+// Cmp compares the amounts of m and other, returning -1, 0 or +1
+func (m Money) Cmp(other Money) int {
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func copySign(value, sign float64) float64 {
+	if sign < 0 {
+		return -value
+	}
+	return value
+}
+
+// divRound divides a by b, rounding half away from zero
+func divRound(a, b *big.Int) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(a, b, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(remainder), big.NewInt(2)).Cmp(new(big.Int).Abs(b)) >= 0 {
+		if (a.Sign() < 0) != (b.Sign() < 0) {
+			quotient.Sub(quotient, big.NewInt(1))
+		} else {
+			quotient.Add(quotient, big.NewInt(1))
+		}
+	}
+	return quotient
+}
+
+type moneyJSON struct {
+	Amount   json.RawMessage `json:"amount"`
+	Currency Currency        `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"amount":   m.String(),
+		"currency": string(m.currency()),
+	})
+}
+
+// UnmarshalJSON accepts {"amount": "79.99", "currency": "BRL"}, or a bare
+// amount in the DefaultCurrency. Amounts may be strings or JSON numbers, which
+// are read from their literal digits rather than as floats.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	currency := DefaultCurrency
+	raw := data
+
+	if len(data) > 0 && data[0] == '{' {
+		var value moneyJSON
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+		if value.Amount == nil {
+			return errors.New("money amount is required")
+		}
+		if value.Currency != "" {
+			currency = Currency(strings.ToUpper(string(value.Currency)))
+		}
+		raw = bytes.TrimSpace(value.Amount)
+	}
+
+	var amount string
+	if len(raw) > 0 && raw[0] == '"' {
+		if err := json.Unmarshal(raw, &amount); err != nil {
+			return err
+		}
+	} else {
+		var number json.Number
+		if err := json.Unmarshal(raw, &number); err != nil {
+			return fmt.Errorf("invalid money amount %s", raw)
+		}
+		amount = number.String()
+	}
+
+	if currency != DefaultCurrency {
+		return fmt.Errorf("unsupported currency %q, amounts must be in %s", currency, DefaultCurrency)
+	}
+
+	parsed, err := ParseMoney(strings.TrimSpace(amount), currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// ScanNumeric implements pgtype.NumericScanner. Values with more decimal
+// places than the DefaultCurrency, e.g. computed averages, are rounded half
+// away from zero.
+func (m *Money) ScanNumeric(v pgtype.Numeric) error {
+	if !v.Valid {
+		return errors.New("cannot scan NULL into Money")
+	}
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return errors.New("cannot scan non-finite numeric into Money")
+	}
+
+	currency := DefaultCurrency
+	exp := v.Exp + currencyMinorUnits[currency]
+	amount := new(big.Int).Set(v.Int)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs32(exp))), nil)
+	if exp >= 0 {
+		amount.Mul(amount, scale)
+	} else {
+		amount = divRound(amount, scale)
+	}
+	if !amount.IsInt64() {
+		return errors.New("numeric is out of range for Money")
+	}
+
+	*m = Money{Amount: amount.Int64(), Currency: currency}
+	return nil
+}
+
+// NumericValue implements pgtype.NumericValuer
+func (m Money) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{
+		Int:   big.NewInt(m.Amount),
+		Exp:   -m.digits(),
+		Valid: true,
+	}, nil
+}
+
+func abs32(n int32) int32 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,145 @@
+package pgstore
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		amount  string
+		want    int64
+		wantErr bool
+	}{
+		{"79.99", 7999, false},
+		{"5", 500, false},
+		{"0.5", 50, false},
+		{"-0.5", -50, false},
+		{"-5", -500, false},
+		{"0", 0, false},
+		{"007.10", 710, false},
+		{"99999999.99", 9999999999, false},
+		{"00000000099999999.99", 9999999999, false},
+		{"100000000", 0, true},
+		{"1234567890123456", 0, true},
+		{"1.234", 0, true},
+		{"1.", 0, true},
+		{".5", 0, true},
+		{"", 0, true},
+		{"-", 0, true},
+		{"+1", 0, true},
+		{"1e3", 0, true},
+		{"1,50", 0, true},
+		{" 1", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := ParseMoney(tt.amount, CurrencyBRL)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMoney(%q) = %v, want an error", tt.amount, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMoney(%q) error = %v", tt.amount, err)
+			}
+			if got.Amount != tt.want || got.Currency != CurrencyBRL {
+				t.Errorf("ParseMoney(%q) = %+v, want %d BRL", tt.amount, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMoneyUnsupportedCurrency(t *testing.T) {
+	if _, err := ParseMoney("1.00", "USD"); err == nil {
+		t.Error("ParseMoney() error = nil, want an error")
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		amount int64
+		want   string
+	}{
+		{7999, "79.99"},
+		{5, "0.05"},
+		{-50, "-0.50"},
+		{0, "0.00"},
+		{9999999999, "99999999.99"},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.amount).String(); got != tt.want {
+			t.Errorf("NewMoney(%d).String() = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    int64
+		wantErr bool
+	}{
+		{`{"amount": "79.99", "currency": "BRL"}`, 7999, false},
+		{`{"amount": 79.99, "currency": "brl"}`, 7999, false},
+		{`{"amount": "10"}`, 1000, false},
+		{`"0.10"`, 10, false},
+		{`0.1`, 10, false},
+		{`-2.5`, -250, false},
+		{`{"amount": "1.00", "currency": "USD"}`, 0, true},
+		{`{"currency": "BRL"}`, 0, true},
+		{`1e2`, 0, true},
+		{`0.001`, 0, true},
+		{`"abc"`, 0, true},
+		{`100000000`, 0, true},
+		{`null`, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var got Money
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) = %+v, want an error", tt.data, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unmarshal(%s) error = %v", tt.data, err)
+			}
+			if got.Amount != tt.want || got.Currency != CurrencyBRL {
+				t.Errorf("Unmarshal(%s) = %+v, want %d BRL", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		percent float64
+		want    int64
+	}{
+		{1000, 12.5, 125},
+		{999, 10, 100},
+		{5, 10, 1},
+		{4, 10, 0},
+		{-5, 10, -1},
+		{-4, 10, 0},
+		{1999, 33.33, 666},
+		{2999, 0.07, 2},
+		{7999, 100, 7999},
+		{7999, 0, 0},
+		{9999999999, 99.99, 9998999999},
+	}
+
+	for _, tt := range tests {
+		if got := NewMoney(tt.amount).Percent(tt.percent); got.Amount != tt.want {
+			t.Errorf("NewMoney(%d).Percent(%v) = %d, want %d", tt.amount, tt.percent, got.Amount, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CreatePaymentParams struct {
+	SubscriptionID    uuid.UUID     `json:"subscriptionId" db:"subscription_id"`
+	UserID            uuid.UUID     `json:"userId" db:"user_id"`
+	Amount            Money         `json:"amount" db:"amount"`
+	Method            PaymentMethod `json:"method" db:"method"`
+	Provider          string        `json:"provider" db:"provider"`
+	ProviderPaymentID *string       `json:"providerPaymentId,omitempty" db:"provider_payment_id"`
+	PixCode           *string       `json:"pixCode,omitempty" db:"pix_code"`
+	ExpiresAt         *time.Time    `json:"expiresAt,omitempty" db:"expires_at"`
+}
+
+type GetExpiredPaymentsForUpdateParams struct {
+	Now   time.Time `json:"now" db:"now"`
+	Limit int32     `json:"limit" db:"limit"`
+}
+
+// A nil ProviderPaymentID or FailureReason keeps the stored value
+type UpdatePaymentStatusParams struct {
+	ID                uuid.UUID     `json:"id" db:"id"`
+	Status            PaymentStatus `json:"status" db:"status"`
+	ProviderPaymentID *string       `json:"providerPaymentId,omitempty" db:"provider_payment_id"`
+	FailureReason     *string       `json:"failureReason,omitempty" db:"failure_reason"`
+}
+
+type GetPaymentByProviderIdParams struct {
+	Provider          string `json:"provider" db:"provider"`
+	ProviderPaymentID string `json:"providerPaymentId" db:"provider_payment_id"`
+}
+
+type CreatePaymentWebhookEventParams struct {
+	Provider  string     `json:"provider" db:"provider"`
+	EventID   string     `json:"eventId" db:"event_id"`
+	EventType string     `json:"eventType" db:"event_type"`
+	PaymentID *uuid.UUID `json:"paymentId,omitempty" db:"payment_id"`
+	Payload   []byte     `json:"payload" db:"payload"`
+	Outcome   string     `json:"outcome" db:"outcome"`
+}
+
+const createPayment = `-- name: CreatePayment :one
+INSERT INTO payment (subscription_id, user_id, amount, method, provider, provider_payment_id, pix_code, expires_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at`
+
+func (q *Queries) CreatePayment(ctx context.Context, arg CreatePaymentParams) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, createPayment,
+		arg.SubscriptionID,
+		arg.UserID,
+		arg.Amount,
+		arg.Method,
+		arg.Provider,
+		arg.ProviderPaymentID,
+		arg.PixCode,
+		arg.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPaymentById = `-- name: GetPaymentById :one
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE id = $1`
+
+func (q *Queries) GetPaymentById(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, getPaymentById, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPaymentForUpdate = `-- name: GetPaymentForUpdate :one
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE id = $1
+FOR UPDATE`
+
+func (q *Queries) GetPaymentForUpdate(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, getPaymentForUpdate, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPendingPaymentBySubscriptionId = `-- name: GetPendingPaymentBySubscriptionId :one
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE subscription_id = $1 AND status = 'PENDING'`
+
+// GetPendingPaymentBySubscriptionId returns the payment of the subscription
+// still waiting for an outcome, if any
+func (q *Queries) GetPendingPaymentBySubscriptionId(ctx context.Context, subscriptionID uuid.UUID) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, getPendingPaymentBySubscriptionId, subscriptionID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getLastCompletedPaymentBySubscriptionId = `-- name: GetLastCompletedPaymentBySubscriptionId :one
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE subscription_id = $1 AND status = 'COMPLETED'
+ORDER BY created_at DESC
+LIMIT 1`
+
+// GetLastCompletedPaymentBySubscriptionId returns the latest payment that
+// paid a period of the subscription, if any
+func (q *Queries) GetLastCompletedPaymentBySubscriptionId(ctx context.Context, subscriptionID uuid.UUID) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, getLastCompletedPaymentBySubscriptionId, subscriptionID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPaymentsByUserId = `-- name: GetPaymentsByUserId :many
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE user_id = $1
+ORDER BY created_at DESC`
+
+func (q *Queries) GetPaymentsByUserId(ctx context.Context, userID uuid.UUID) ([]Payment, error) {
+	var items []Payment
+
+	err := pgxscan.Select(ctx, q.db, &items, getPaymentsByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const updatePaymentStatus = `-- name: UpdatePaymentStatus :one
+UPDATE payment
+SET status = $2,
+    provider_payment_id = COALESCE($3, provider_payment_id),
+    failure_reason = COALESCE($4, failure_reason),
+    refund_due = refund_due AND $2 <> 'REFUNDED',
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at`
+
+func (q *Queries) UpdatePaymentStatus(ctx context.Context, arg UpdatePaymentStatusParams) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, updatePaymentStatus,
+		arg.ID,
+		arg.Status,
+		arg.ProviderPaymentID,
+		arg.FailureReason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const markPaymentRefundDue = `-- name: MarkPaymentRefundDue :one
+UPDATE payment
+SET refund_due = TRUE, updated_at = NOW()
+WHERE id = $1
+RETURNING id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at`
+
+// MarkPaymentRefundDue flags a payment that has to be paid back. A refund
+// clears the flag.
+func (q *Queries) MarkPaymentRefundDue(ctx context.Context, id uuid.UUID) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, markPaymentRefundDue, id)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getRefundDuePayments = `-- name: GetRefundDuePayments :many
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE refund_due
+ORDER BY updated_at ASC`
+
+func (q *Queries) GetRefundDuePayments(ctx context.Context) ([]Payment, error) {
+	var items []Payment
+
+	err := pgxscan.Select(ctx, q.db, &items, getRefundDuePayments)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getPaymentByProviderIdForUpdate = `-- name: GetPaymentByProviderIdForUpdate :one
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE provider = $1 AND provider_payment_id = $2
+FOR UPDATE`
+
+func (q *Queries) GetPaymentByProviderIdForUpdate(ctx context.Context, arg GetPaymentByProviderIdParams) (*Payment, error) {
+	var i Payment
+	err := pgxscan.Get(ctx, q.db, &i, getPaymentByProviderIdForUpdate, arg.Provider, arg.ProviderPaymentID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const createPaymentWebhookEvent = `-- name: CreatePaymentWebhookEvent :execrows
+INSERT INTO payment_webhook_event (provider, event_id, event_type, payment_id, payload, outcome)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (provider, event_id) DO NOTHING`
+
+// CreatePaymentWebhookEvent records a provider notification. It reports false
+// when the event was already recorded.
+func (q *Queries) CreatePaymentWebhookEvent(ctx context.Context, arg CreatePaymentWebhookEventParams) (bool, error) {
+	result, err := q.db.Exec(ctx, createPaymentWebhookEvent,
+		arg.Provider,
+		arg.EventID,
+		arg.EventType,
+		arg.PaymentID,
+		arg.Payload,
+		arg.Outcome,
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const getExpiredPaymentsForUpdate = `-- name: GetExpiredPaymentsForUpdate :many
+SELECT id, subscription_id, user_id, amount, method, provider, provider_payment_id, status, failure_reason, pix_code, expires_at, refund_due, created_at, updated_at
+FROM payment
+WHERE status = 'PENDING' AND expires_at <= $1
+ORDER BY expires_at ASC
+LIMIT $2
+FOR UPDATE SKIP LOCKED`
+
+// GetExpiredPaymentsForUpdate locks pending payments past their expiration,
+// skipping those another transaction is already handling
+func (q *Queries) GetExpiredPaymentsForUpdate(ctx context.Context, arg GetExpiredPaymentsForUpdateParams) ([]Payment, error) {
+	var items []Payment
+
+	err := pgxscan.Select(ctx, q.db, &items, getExpiredPaymentsForUpdate, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
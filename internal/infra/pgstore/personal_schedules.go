@@ -0,0 +1,199 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CreatePersonalScheduleParams struct {
+	PersonalID         uuid.UUID `json:"personalId" db:"personal_id"`
+	WeekDay            int32     `json:"weekDay" db:"week_day"`
+	TimeStartInMinutes int32     `json:"timeStartInMinutes" db:"time_start_in_minutes"`
+	TimeEndInMinutes   int32     `json:"timeEndInMinutes" db:"time_end_in_minutes"`
+}
+
+type UpdatePersonalScheduleParams struct {
+	ID                 uuid.UUID `json:"id" db:"id"`
+	PersonalID         uuid.UUID `json:"personalId" db:"personal_id"`
+	WeekDay            int32     `json:"weekDay" db:"week_day"`
+	TimeStartInMinutes int32     `json:"timeStartInMinutes" db:"time_start_in_minutes"`
+	TimeEndInMinutes   int32     `json:"timeEndInMinutes" db:"time_end_in_minutes"`
+}
+
+type DeletePersonalScheduleParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type GetOverlappingPersonalScheduleParams struct {
+	PersonalID         uuid.UUID  `json:"personalId" db:"personal_id"`
+	WeekDay            int32      `json:"weekDay" db:"week_day"`
+	TimeStartInMinutes int32      `json:"timeStartInMinutes" db:"time_start_in_minutes"`
+	TimeEndInMinutes   int32      `json:"timeEndInMinutes" db:"time_end_in_minutes"`
+	ExcludeID          *uuid.UUID `json:"excludeId,omitempty" db:"exclude_id"`
+}
+
+type CreatePersonalScheduleExceptionParams struct {
+	PersonalID         uuid.UUID             `json:"personalId" db:"personal_id"`
+	Date               time.Time             `json:"date" db:"date"`
+	Type               ScheduleExceptionType `json:"type" db:"type"`
+	TimeStartInMinutes *int32                `json:"timeStartInMinutes,omitempty" db:"time_start_in_minutes"`
+	TimeEndInMinutes   *int32                `json:"timeEndInMinutes,omitempty" db:"time_end_in_minutes"`
+	Reason             *string               `json:"reason,omitempty" db:"reason"`
+}
+
+// Date bounds are optional: a nil From or To leaves that side of the range open.
+// Both are inclusive dates.
+type GetPersonalScheduleExceptionsParams struct {
+	PersonalID uuid.UUID  `json:"personalId" db:"personal_id"`
+	From       *time.Time `json:"from,omitempty" db:"from"`
+	To         *time.Time `json:"to,omitempty" db:"to"`
+}
+
+type DeletePersonalScheduleExceptionParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+const createPersonalSchedule = `-- name: CreatePersonalSchedule :one
+INSERT INTO personal_schedule (personal_id, week_day, time_start_in_minutes, time_end_in_minutes)
+VALUES ($1, $2, $3, $4)
+RETURNING id, week_day, time_start_in_minutes, time_end_in_minutes, personal_id`
+
+func (q *Queries) CreatePersonalSchedule(ctx context.Context, arg CreatePersonalScheduleParams) (*PersonalSchedule, error) {
+	var i PersonalSchedule
+	err := pgxscan.Get(ctx, q.db, &i, createPersonalSchedule,
+		arg.PersonalID,
+		arg.WeekDay,
+		arg.TimeStartInMinutes,
+		arg.TimeEndInMinutes,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const updatePersonalSchedule = `-- name: UpdatePersonalSchedule :one
+UPDATE personal_schedule
+SET week_day = $3, time_start_in_minutes = $4, time_end_in_minutes = $5
+WHERE id = $1 AND personal_id = $2
+RETURNING id, week_day, time_start_in_minutes, time_end_in_minutes, personal_id`
+
+// UpdatePersonalSchedule returns nil when the window does not belong to the trainer
+func (q *Queries) UpdatePersonalSchedule(ctx context.Context, arg UpdatePersonalScheduleParams) (*PersonalSchedule, error) {
+	var i PersonalSchedule
+	err := pgxscan.Get(ctx, q.db, &i, updatePersonalSchedule,
+		arg.ID,
+		arg.PersonalID,
+		arg.WeekDay,
+		arg.TimeStartInMinutes,
+		arg.TimeEndInMinutes,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const deletePersonalSchedule = `-- name: DeletePersonalSchedule :execrows
+DELETE FROM personal_schedule
+WHERE id = $1 AND personal_id = $2`
+
+// DeletePersonalSchedule reports whether a window of the trainer was deleted
+func (q *Queries) DeletePersonalSchedule(ctx context.Context, arg DeletePersonalScheduleParams) (bool, error) {
+	result, err := q.db.Exec(ctx, deletePersonalSchedule, arg.ID, arg.PersonalID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const getOverlappingPersonalSchedule = `-- name: GetOverlappingPersonalSchedule :one
+SELECT id, week_day, time_start_in_minutes, time_end_in_minutes, personal_id
+FROM personal_schedule
+WHERE personal_id = $1
+  AND week_day = $2
+  AND time_start_in_minutes < $4
+  AND time_end_in_minutes > $3
+  AND ($5::uuid IS NULL OR id <> $5)
+LIMIT 1`
+
+// GetOverlappingPersonalSchedule returns a weekly window of the trainer that
+// overlaps the given one on the same week day, if any
+func (q *Queries) GetOverlappingPersonalSchedule(ctx context.Context, arg GetOverlappingPersonalScheduleParams) (*PersonalSchedule, error) {
+	var i PersonalSchedule
+	err := pgxscan.Get(ctx, q.db, &i, getOverlappingPersonalSchedule,
+		arg.PersonalID,
+		arg.WeekDay,
+		arg.TimeStartInMinutes,
+		arg.TimeEndInMinutes,
+		arg.ExcludeID,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const createPersonalScheduleException = `-- name: CreatePersonalScheduleException :one
+INSERT INTO personal_schedule_exception (personal_id, date, type, time_start_in_minutes, time_end_in_minutes, reason)
+VALUES ($1, $2::date, $3, $4, $5, $6)
+RETURNING id, personal_id, date, type, time_start_in_minutes, time_end_in_minutes, reason, created_at`
+
+func (q *Queries) CreatePersonalScheduleException(ctx context.Context, arg CreatePersonalScheduleExceptionParams) (*PersonalScheduleException, error) {
+	var i PersonalScheduleException
+	err := pgxscan.Get(ctx, q.db, &i, createPersonalScheduleException,
+		arg.PersonalID,
+		arg.Date,
+		arg.Type,
+		arg.TimeStartInMinutes,
+		arg.TimeEndInMinutes,
+		arg.Reason,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPersonalScheduleExceptions = `-- name: GetPersonalScheduleExceptions :many
+SELECT id, personal_id, date, type, time_start_in_minutes, time_end_in_minutes, reason, created_at
+FROM personal_schedule_exception
+WHERE personal_id = $1
+  AND ($2::date IS NULL OR date >= $2::date)
+  AND ($3::date IS NULL OR date <= $3::date)
+ORDER BY date ASC, time_start_in_minutes ASC NULLS FIRST`
+
+func (q *Queries) GetPersonalScheduleExceptions(ctx context.Context, arg GetPersonalScheduleExceptionsParams) ([]PersonalScheduleException, error) {
+	var items []PersonalScheduleException
+
+	err := pgxscan.Select(ctx, q.db, &items, getPersonalScheduleExceptions, arg.PersonalID, arg.From, arg.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const deletePersonalScheduleException = `-- name: DeletePersonalScheduleException :execrows
+DELETE FROM personal_schedule_exception
+WHERE id = $1 AND personal_id = $2`
+
+// DeletePersonalScheduleException reports whether an exception of the trainer was deleted
+func (q *Queries) DeletePersonalScheduleException(ctx context.Context, arg DeletePersonalScheduleExceptionParams) (bool, error) {
+	result, err := q.db.Exec(ctx, deletePersonalScheduleException, arg.ID, arg.PersonalID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
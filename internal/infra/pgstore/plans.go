@@ -0,0 +1,218 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CreatePlanParams struct {
+	PersonalID     uuid.UUID `json:"personalId" db:"personal_id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	Features       []string  `json:"features" db:"features"`
+	Price          Money     `json:"price" db:"price"`
+	Duration       int32     `json:"duration" db:"duration"`
+	Type           PlanType  `json:"type" db:"type"`
+	SessionCredits *int32    `json:"sessionCredits,omitempty" db:"session_credits"`
+}
+
+// A nil IsActive keeps the plan's current state. SessionCredits only applies
+// to PACKAGE plans, where a nil value keeps the current credits.
+type UpdatePlanParams struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	PersonalID     uuid.UUID `json:"personalId" db:"personal_id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	Features       []string  `json:"features" db:"features"`
+	Price          Money     `json:"price" db:"price"`
+	Duration       int32     `json:"duration" db:"duration"`
+	SessionCredits *int32    `json:"sessionCredits,omitempty" db:"session_credits"`
+	IsActive       *bool     `json:"isActive,omitempty" db:"is_active"`
+}
+
+// A nil PersonalID lists plans of every trainer
+type GetPlansParams struct {
+	PersonalID *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	ActiveOnly bool       `json:"activeOnly" db:"active_only"`
+}
+
+type GetPlanForUpdateParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type DeletePlanParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type GetPlansRow struct {
+	ID              uuid.UUID `json:"id" db:"id"`
+	PersonalID      uuid.UUID `json:"personalId" db:"personal_id"`
+	PersonalName    string    `json:"personalName" db:"personal_name"`
+	Name            string    `json:"name" db:"name"`
+	Description     string    `json:"description" db:"description"`
+	Features        []string  `json:"features" db:"features"`
+	Price           Money     `json:"price" db:"price"`
+	Duration        int32     `json:"duration" db:"duration"`
+	Type            PlanType  `json:"type" db:"type"`
+	SessionCredits  *int32    `json:"sessionCredits,omitempty" db:"session_credits"`
+	IsActive        bool      `json:"isActive" db:"is_active"`
+	SubscriberCount int32     `json:"subscriberCount" db:"subscriber_count"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+const createPlan = `-- name: CreatePlan :one
+INSERT INTO plan (personal_id, name, description, features, price, duration, type, session_credits)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, name, description, features, price, duration, type, session_credits, is_active, personal_id, created_at, updated_at`
+
+func (q *Queries) CreatePlan(ctx context.Context, arg CreatePlanParams) (*Plan, error) {
+	var i Plan
+	err := pgxscan.Get(ctx, q.db, &i, createPlan,
+		arg.PersonalID,
+		arg.Name,
+		arg.Description,
+		arg.Features,
+		arg.Price,
+		arg.Duration,
+		arg.Type,
+		arg.SessionCredits,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPlans = `-- name: GetPlans :many
+SELECT
+  p.id, p.personal_id, u.name AS personal_name, p.name, p.description, p.features,
+  p.price, p.duration, p.type, p.session_credits, p.is_active, p.created_at, p.updated_at,
+  (SELECT COUNT(*) FROM subscription s WHERE s.plan_id = p.id AND s.status IN ('PENDING', 'ACTIVE'))::int AS subscriber_count
+FROM plan p
+JOIN users u ON u.id = p.personal_id
+WHERE ($1::uuid IS NULL OR p.personal_id = $1)
+  AND (NOT $2::boolean OR p.is_active)
+ORDER BY p.created_at DESC`
+
+func (q *Queries) GetPlans(ctx context.Context, arg GetPlansParams) ([]GetPlansRow, error) {
+	var items []GetPlansRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getPlans, arg.PersonalID, arg.ActiveOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getPlanById = `-- name: GetPlanById :one
+SELECT
+  p.id, p.personal_id, u.name AS personal_name, p.name, p.description, p.features,
+  p.price, p.duration, p.type, p.session_credits, p.is_active, p.created_at, p.updated_at,
+  (SELECT COUNT(*) FROM subscription s WHERE s.plan_id = p.id AND s.status IN ('PENDING', 'ACTIVE'))::int AS subscriber_count
+FROM plan p
+JOIN users u ON u.id = p.personal_id
+WHERE p.id = $1`
+
+func (q *Queries) GetPlanById(ctx context.Context, id uuid.UUID) (*GetPlansRow, error) {
+	var i GetPlansRow
+	err := pgxscan.Get(ctx, q.db, &i, getPlanById, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getPlanForUpdate = `-- name: GetPlanForUpdate :one
+SELECT id, name, description, features, price, duration, type, session_credits, is_active, personal_id, created_at, updated_at
+FROM plan
+WHERE id = $1 AND personal_id = $2
+FOR UPDATE`
+
+// GetPlanForUpdate locks a plan of the trainer, returning nil when the trainer
+// does not own it
+func (q *Queries) GetPlanForUpdate(ctx context.Context, arg GetPlanForUpdateParams) (*Plan, error) {
+	var i Plan
+	err := pgxscan.Get(ctx, q.db, &i, getPlanForUpdate, arg.ID, arg.PersonalID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const updatePlan = `-- name: UpdatePlan :one
+UPDATE plan
+SET name = $3, description = $4, features = $5, price = $6, duration = $7,
+    session_credits = CASE WHEN type = 'PACKAGE' THEN COALESCE($8, session_credits) END,
+    is_active = COALESCE($9, is_active), updated_at = NOW()
+WHERE id = $1 AND personal_id = $2
+RETURNING id, name, description, features, price, duration, type, session_credits, is_active, personal_id, created_at, updated_at`
+
+// UpdatePlan returns nil when the plan does not belong to the trainer
+func (q *Queries) UpdatePlan(ctx context.Context, arg UpdatePlanParams) (*Plan, error) {
+	var i Plan
+	err := pgxscan.Get(ctx, q.db, &i, updatePlan,
+		arg.ID,
+		arg.PersonalID,
+		arg.Name,
+		arg.Description,
+		arg.Features,
+		arg.Price,
+		arg.Duration,
+		arg.SessionCredits,
+		arg.IsActive,
+	)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const deactivatePlan = `-- name: DeactivatePlan :exec
+UPDATE plan
+SET is_active = FALSE, updated_at = NOW()
+WHERE id = $1`
+
+func (q *Queries) DeactivatePlan(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deactivatePlan, id)
+	return err
+}
+
+const deletePlan = `-- name: DeletePlan :execrows
+DELETE FROM plan
+WHERE id = $1 AND personal_id = $2`
+
+// DeletePlan reports whether a plan of the trainer was deleted
+func (q *Queries) DeletePlan(ctx context.Context, arg DeletePlanParams) (bool, error) {
+	result, err := q.db.Exec(ctx, deletePlan, arg.ID, arg.PersonalID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const planHasSubscriptions = `-- name: PlanHasSubscriptions :one
+SELECT EXISTS (SELECT 1 FROM subscription WHERE plan_id = $1 OR next_plan_id = $1)`
+
+// PlanHasSubscriptions reports whether any subscription, live or past,
+// references the plan
+func (q *Queries) PlanHasSubscriptions(ctx context.Context, planID uuid.UUID) (bool, error) {
+	var exists bool
+	err := q.db.QueryRow(ctx, planHasSubscriptions, planID).Scan(&exists)
+	return exists, err
+}
@@ -2,6 +2,7 @@ package pgstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -14,16 +15,63 @@ type Querier interface {
 	GetUserById(ctx context.Context, arg GetUserByIdParams) (*GetUserByIdRow, error)
 	GetUserByEmail(ctx context.Context, email string) (*GetUserByEmailRow, error)
 	GetUserForAuth(ctx context.Context, email string) (*GetUserForAuthRow, error)
-	GetAllUsers(ctx context.Context) ([]GetAllUsersRow, error)
+	GetAllUsers(ctx context.Context, arg GetAllUsersParams) ([]GetAllUsersRow, error)
+	GetUserEmailVerification(ctx context.Context, id uuid.UUID) (*GetUserEmailVerificationRow, error)
+	IsEmailVerified(ctx context.Context, id uuid.UUID) (bool, error)
+	MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) error
 	UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) error
 	UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarParams) error
+	GetUserPasswordHash(ctx context.Context, id uuid.UUID) (string, error)
 	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
 	GetUserRole(ctx context.Context, id uuid.UUID) (Role, error)
+	GetStudentById(ctx context.Context, id uuid.UUID) (*Student, error)
 
 	CreatePasswordResetToken(ctx context.Context, arg CreatePasswordResetTokenParams) error
 	GetPasswordResetToken(ctx context.Context, token string) (*PasswordResetToken, error)
-	MarkPasswordResetTokenAsUsed(ctx context.Context, token string) error
+	MarkPasswordResetTokenAsUsed(ctx context.Context, token string) (bool, error)
+
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (*RefreshToken, error)
+	GetRefreshToken(ctx context.Context, token string) (*RefreshToken, error)
+	GetRefreshTokenForUpdate(ctx context.Context, token string) (*RefreshToken, error)
+	GetRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) ([]GetRefreshTokensByUserIDRow, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAllUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	RevokeUserRefreshTokenFamily(ctx context.Context, arg RevokeUserRefreshTokenFamilyParams) (bool, error)
+	RevokeOtherUserRefreshTokens(ctx context.Context, arg RevokeOtherUserRefreshTokensParams) error
+
+	CreatePendingTOTP(ctx context.Context, arg CreatePendingTOTPParams) (bool, error)
+	GetUserTOTP(ctx context.Context, userID uuid.UUID) (*UserTOTP, error)
+	GetUserTOTPForUpdate(ctx context.Context, userID uuid.UUID) (*UserTOTP, error)
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) error
+	ResetTOTPFailures(ctx context.Context, userID uuid.UUID) error
+	EnableTOTP(ctx context.Context, arg UseTOTPStepParams) error
+	RecordTOTPFailure(ctx context.Context, arg RecordTOTPFailureParams) error
+	DeleteUserTOTP(ctx context.Context, userID uuid.UUID) error
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	CreateRecoveryCodes(ctx context.Context, arg CreateRecoveryCodesParams) error
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (bool, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID uuid.UUID) (int64, error)
+	GetMFARolePolicies(ctx context.Context) ([]MFARolePolicy, error)
+	SetMFARolePolicy(ctx context.Context, arg SetMFARolePolicyParams) (*MFARolePolicy, error)
+	IsMFARequiredForRole(ctx context.Context, role Role) (bool, error)
+	IsMFASetupRequired(ctx context.Context, arg IsMFASetupRequiredParams) (bool, error)
+
+	GetLoginLock(ctx context.Context, arg GetLoginLockParams) (*time.Time, error)
+	RecordLoginFailure(ctx context.Context, arg RecordLoginFailureParams) (int32, error)
+	LockLogin(ctx context.Context, arg LockLoginParams) error
+	DeleteLoginThrottle(ctx context.Context, arg DeleteLoginThrottleParams) error
+	DeleteLoginThrottleByID(ctx context.Context, id uuid.UUID) (bool, error)
+	DeleteStaleLoginThrottles(ctx context.Context, arg DeleteStaleLoginThrottlesParams) error
+	GetLoginLockouts(ctx context.Context, arg GetLoginLockoutsParams) ([]LoginThrottle, error)
+
+	CreateUserSession(ctx context.Context, arg CreateUserSessionParams) error
+	BackfillUserSession(ctx context.Context, arg CreateUserSessionParams) (bool, error)
+	GetUserSessionTokens(ctx context.Context, userID uuid.UUID) ([]string, error)
+	RenameUserSession(ctx context.Context, arg RenameUserSessionParams) error
+	DeleteUserSession(ctx context.Context, token string) error
+	DeleteStaleUserSessions(ctx context.Context, userID uuid.UUID) error
 
 	CreateWorkout(ctx context.Context, arg CreateWorkoutParams) (uuid.UUID, error)
 	GetWorkouts(ctx context.Context, userID uuid.UUID) ([]GetWorkoutsRow, error)
@@ -39,15 +87,122 @@ type Querier interface {
 	DeleteExercise(ctx context.Context, arg DeleteExerciseParams) error
 	AddExerciseToWorkout(ctx context.Context, arg AddExerciseToWorkoutParams) (uuid.UUID, error)
 	RemoveExerciseFromWorkout(ctx context.Context, arg RemoveExerciseFromWorkoutParams) error
+	GetExercisesByWorkoutId(ctx context.Context, workoutID uuid.UUID) ([]ExercisesSetup, error)
+
+	CreateWorkoutSession(ctx context.Context, arg CreateWorkoutSessionParams) (*WorkoutSession, error)
+	GetOpenWorkoutSession(ctx context.Context, arg GetOpenWorkoutSessionParams) (*WorkoutSession, error)
+	FinishWorkoutSession(ctx context.Context, arg FinishWorkoutSessionParams) (*WorkoutSession, error)
+	CreateWorkoutHistory(ctx context.Context, arg CreateWorkoutHistoryParams) (*WorkoutsHistory, error)
+	CreateWorkoutSet(ctx context.Context, arg CreateWorkoutSetParams) (*WorkoutSet, error)
+	GetFinishedWorkoutSessions(ctx context.Context, studentID uuid.UUID) ([]GetFinishedWorkoutSessionsRow, error)
+	GetWorkoutHistoryByStudent(ctx context.Context, studentID uuid.UUID) ([]WorkoutsHistory, error)
+	GetWorkoutSetsByStudent(ctx context.Context, studentID uuid.UUID) ([]WorkoutSet, error)
+
+	GetWorkoutDays(ctx context.Context, arg GetWorkoutDaysParams) ([]GetWorkoutDaysRow, error)
+	GetExerciseHistory(ctx context.Context, arg GetExerciseHistoryParams) ([]GetExerciseHistoryRow, error)
+	GetWorkingSets(ctx context.Context, arg GetWorkingSetsParams) ([]GetWorkingSetsRow, error)
 
 	CreateScheduling(ctx context.Context, arg CreateSchedulingParams) (uuid.UUID, error)
-	GetSchedulings(ctx context.Context, personalID uuid.UUID) ([]Scheduling, error)
+	GetSchedulings(ctx context.Context, userID uuid.UUID) ([]Scheduling, error)
 	GetSchedulingById(ctx context.Context, arg GetSchedulingByIdParams) (*Scheduling, error)
+	UpdateScheduling(ctx context.Context, arg UpdateSchedulingParams) (*Scheduling, error)
+	GetOverlappingScheduling(ctx context.Context, arg GetOverlappingSchedulingParams) (*Scheduling, error)
+	LockPersonal(ctx context.Context, id uuid.UUID) (bool, error)
+	LockStudent(ctx context.Context, id uuid.UUID) (bool, error)
+	GetPersonalSchedules(ctx context.Context, personalID uuid.UUID) ([]PersonalSchedule, error)
+	GetPersonalBusySchedulings(ctx context.Context, arg GetPersonalBusySchedulingsParams) ([]Scheduling, error)
 	UpdateSchedulingStatus(ctx context.Context, arg UpdateSchedulingStatusParams) error
 	UpdateSchedulingWithStartTime(ctx context.Context, arg UpdateSchedulingWithStartTimeParams) error
 	UpdateSchedulingWithCompletedTime(ctx context.Context, arg UpdateSchedulingWithCompletedTimeParams) error
 	UpdateSchedulingWithCanceledTime(ctx context.Context, arg UpdateSchedulingWithCanceledTimeParams) error
 	CreateSchedulingHistory(ctx context.Context, arg CreateSchedulingHistoryParams) (uuid.UUID, error)
+	GetSchedulingForUpdate(ctx context.Context, id uuid.UUID) (*Scheduling, error)
+	GetSchedulingsToMarkMissed(ctx context.Context, cutoff time.Time) ([]Scheduling, error)
+	GetSchedulingsHistoryByScheduleId(ctx context.Context, scheduleID uuid.UUID) ([]SchedulingsHistory, error)
+	CreateSchedulingSeries(ctx context.Context, arg CreateSchedulingSeriesParams) (*SchedulingSeries, error)
+	GetSeriesSchedulingsForUpdate(ctx context.Context, arg GetSeriesSchedulingsForUpdateParams) ([]Scheduling, error)
+
+	CreatePersonalSchedule(ctx context.Context, arg CreatePersonalScheduleParams) (*PersonalSchedule, error)
+	UpdatePersonalSchedule(ctx context.Context, arg UpdatePersonalScheduleParams) (*PersonalSchedule, error)
+	DeletePersonalSchedule(ctx context.Context, arg DeletePersonalScheduleParams) (bool, error)
+	GetOverlappingPersonalSchedule(ctx context.Context, arg GetOverlappingPersonalScheduleParams) (*PersonalSchedule, error)
+	CreatePersonalScheduleException(ctx context.Context, arg CreatePersonalScheduleExceptionParams) (*PersonalScheduleException, error)
+	GetPersonalScheduleExceptions(ctx context.Context, arg GetPersonalScheduleExceptionsParams) ([]PersonalScheduleException, error)
+	DeletePersonalScheduleException(ctx context.Context, arg DeletePersonalScheduleExceptionParams) (bool, error)
+
+	CreateCalendarFeedToken(ctx context.Context, arg CreateCalendarFeedTokenParams) (*CalendarFeedToken, error)
+	GetActiveCalendarFeedToken(ctx context.Context, tokenHash string) (*CalendarFeedToken, error)
+	TouchCalendarFeedToken(ctx context.Context, id uuid.UUID) error
+	RevokeCalendarFeedTokens(ctx context.Context, userID uuid.UUID) (bool, error)
+	GetCalendarSchedulings(ctx context.Context, arg GetCalendarSchedulingsParams) ([]GetCalendarSchedulingsRow, error)
+
+	CreatePlan(ctx context.Context, arg CreatePlanParams) (*Plan, error)
+	GetPlans(ctx context.Context, arg GetPlansParams) ([]GetPlansRow, error)
+	GetPlanById(ctx context.Context, id uuid.UUID) (*GetPlansRow, error)
+	GetPlanForUpdate(ctx context.Context, arg GetPlanForUpdateParams) (*Plan, error)
+	UpdatePlan(ctx context.Context, arg UpdatePlanParams) (*Plan, error)
+	DeactivatePlan(ctx context.Context, id uuid.UUID) error
+	DeletePlan(ctx context.Context, arg DeletePlanParams) (bool, error)
+	PlanHasSubscriptions(ctx context.Context, planID uuid.UUID) (bool, error)
+
+	CreateCoupon(ctx context.Context, arg CreateCouponParams) (*Coupon, error)
+	UpdateCoupon(ctx context.Context, arg UpdateCouponParams) (*Coupon, error)
+	GetCoupons(ctx context.Context, personalID uuid.UUID) ([]GetCouponsRow, error)
+	GetCouponById(ctx context.Context, arg GetCouponByIdParams) (*GetCouponsRow, error)
+	GetCouponForUpdate(ctx context.Context, arg GetCouponForUpdateParams) (*Coupon, error)
+	GetCouponByCodeForUpdate(ctx context.Context, arg GetCouponByCodeForUpdateParams) (*Coupon, error)
+	DeleteCouponPlans(ctx context.Context, couponID uuid.UUID) error
+	AddCouponPlans(ctx context.Context, arg AddCouponPlansParams) (int64, error)
+	CouponAppliesToPlan(ctx context.Context, arg CouponAppliesToPlanParams) (bool, error)
+	CountCouponRedemptionsByUser(ctx context.Context, arg CountCouponRedemptionsByUserParams) (int32, error)
+	RedeemCoupon(ctx context.Context, id uuid.UUID) (bool, error)
+	CreateCouponRedemption(ctx context.Context, arg CreateCouponRedemptionParams) error
+	ReleaseCouponRedemption(ctx context.Context, subscriptionID uuid.UUID) (bool, error)
+	DeactivateCoupon(ctx context.Context, id uuid.UUID) error
+	DeleteCoupon(ctx context.Context, arg DeleteCouponParams) (bool, error)
+
+	LockUser(ctx context.Context, id uuid.UUID) (bool, error)
+	CreateSubscription(ctx context.Context, arg CreateSubscriptionParams) (*Subscription, error)
+	GetLiveSubscriptionByUserId(ctx context.Context, userID uuid.UUID) (*Subscription, error)
+	GetSubscriptionById(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	GetSubscriptionForUpdate(ctx context.Context, id uuid.UUID) (*Subscription, error)
+	UpdateSubscriptionStatus(ctx context.Context, arg UpdateSubscriptionStatusParams) (*Subscription, error)
+	UpdateSubscriptionRenewal(ctx context.Context, arg UpdateSubscriptionRenewalParams) (*Subscription, error)
+	RenewSubscription(ctx context.Context, arg RenewSubscriptionParams) (*Subscription, error)
+	GetDueSubscriptionsForUpdate(ctx context.Context, arg GetDueSubscriptionsForUpdateParams) ([]Subscription, error)
+	CreateSubscriptionHistory(ctx context.Context, arg CreateSubscriptionHistoryParams) error
+	GetSubscriptionHistoryByUserId(ctx context.Context, userID uuid.UUID) ([]GetSubscriptionHistoryByUserIdRow, error)
+	GetPlanSubscribers(ctx context.Context, planID uuid.UUID) ([]GetPlanSubscribersRow, error)
+
+	CreateSessionCredit(ctx context.Context, arg CreateSessionCreditParams) error
+	GetSessionCreditBalance(ctx context.Context, subscriptionID uuid.UUID) (int32, error)
+	GetUsableCreditPackageId(ctx context.Context, arg GetUsableCreditPackageIdParams) (*uuid.UUID, error)
+	HasActiveTrainerSubscription(ctx context.Context, arg HasActiveTrainerSubscriptionParams) (bool, error)
+	TrainerSellsPackages(ctx context.Context, personalID uuid.UUID) (bool, error)
+	GetSchedulingCredit(ctx context.Context, schedulingID uuid.UUID) (*GetSchedulingCreditRow, error)
+	GetCreditPackages(ctx context.Context, arg GetCreditPackagesParams) ([]GetCreditPackagesRow, error)
+	GetSessionCreditLedger(ctx context.Context, arg GetSessionCreditLedgerParams) ([]GetSessionCreditLedgerRow, error)
+
+	CreatePaymentChargeEntries(ctx context.Context, arg CreatePaymentChargeEntriesParams) error
+	CreatePaymentRefundEntries(ctx context.Context, arg CreatePaymentRefundEntriesParams) error
+	GetRevenueTotals(ctx context.Context, arg GetRevenueTotalsParams) (*GetRevenueTotalsRow, error)
+	GetDailyRevenue(ctx context.Context, arg GetDailyRevenueParams) ([]GetDailyRevenueRow, error)
+	GetPlanSubscriberCounts(ctx context.Context, planID uuid.UUID) (*GetPlanSubscriberCountsRow, error)
+	GetTrainerRecurringRevenue(ctx context.Context, personalID uuid.UUID) (*GetTrainerRecurringRevenueRow, error)
+	GetTrainerChurn(ctx context.Context, arg GetTrainerChurnParams) (*GetTrainerChurnRow, error)
+
+	CreatePayment(ctx context.Context, arg CreatePaymentParams) (*Payment, error)
+	GetPaymentById(ctx context.Context, id uuid.UUID) (*Payment, error)
+	GetPaymentForUpdate(ctx context.Context, id uuid.UUID) (*Payment, error)
+	GetPendingPaymentBySubscriptionId(ctx context.Context, subscriptionID uuid.UUID) (*Payment, error)
+	GetLastCompletedPaymentBySubscriptionId(ctx context.Context, subscriptionID uuid.UUID) (*Payment, error)
+	GetPaymentsByUserId(ctx context.Context, userID uuid.UUID) ([]Payment, error)
+	UpdatePaymentStatus(ctx context.Context, arg UpdatePaymentStatusParams) (*Payment, error)
+	MarkPaymentRefundDue(ctx context.Context, id uuid.UUID) (*Payment, error)
+	GetRefundDuePayments(ctx context.Context) ([]Payment, error)
+	GetPaymentByProviderIdForUpdate(ctx context.Context, arg GetPaymentByProviderIdParams) (*Payment, error)
+	CreatePaymentWebhookEvent(ctx context.Context, arg CreatePaymentWebhookEventParams) (bool, error)
+	GetExpiredPaymentsForUpdate(ctx context.Context, arg GetExpiredPaymentsForUpdateParams) ([]Payment, error)
 
 	WithTx(tx pgx.Tx) *Queries
 }
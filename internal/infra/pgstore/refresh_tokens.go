@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
@@ -27,6 +28,7 @@ type CreateRefreshTokenRequest struct {
 
 type CreateRefreshTokenParams struct {
 	UserID     uuid.UUID
+	FamilyID   uuid.UUID
 	Token      string
 	ExpiresAt  time.Time
 	DeviceInfo *string
@@ -36,6 +38,7 @@ type CreateRefreshTokenParams struct {
 type GetRefreshTokensByUserIDRow struct {
 	ID         uuid.UUID
 	UserID     uuid.UUID
+	FamilyID   uuid.UUID
 	Token      string
 	ExpiresAt  time.Time
 	CreatedAt  time.Time
@@ -43,22 +46,37 @@ type GetRefreshTokensByUserIDRow struct {
 	RevokedAt  *time.Time
 	DeviceInfo *string
 	IPAddress  *string
+	// FamilyCreatedAt is when the user signed in, CreatedAt when the token
+	// was last refreshed
+	FamilyCreatedAt time.Time
+}
+
+type RevokeUserRefreshTokenFamilyParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+type RevokeOtherUserRefreshTokensParams struct {
+	UserID         uuid.UUID
+	ExceptFamilyID uuid.UUID
 }
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
 INSERT INTO refresh_tokens (
     user_id,
+    family_id,
     token,
     expires_at,
     device_info,
     ip_address
 ) VALUES (
-    $1, $2, $3, $4, $5
-) RETURNING id, user_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address`
+    $1, $2, $3, $4, $5, $6
+) RETURNING id, user_id, family_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address`
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (*RefreshToken, error) {
 	row := q.db.QueryRow(ctx, createRefreshToken,
 		arg.UserID,
+		arg.FamilyID,
 		arg.Token,
 		arg.ExpiresAt,
 		arg.DeviceInfo,
@@ -69,6 +87,7 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
+		&i.FamilyID,
 		&i.Token,
 		&i.ExpiresAt,
 		&i.CreatedAt,
@@ -84,7 +103,7 @@ func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshToken
 }
 
 const getRefreshToken = `-- name: GetRefreshToken :one
-SELECT id, user_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address 
+SELECT id, user_id, family_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address 
 FROM refresh_tokens 
 WHERE token = $1 AND expires_at > NOW() AND revoked_at IS NULL`
 
@@ -95,6 +114,7 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (*RefreshTo
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
+		&i.FamilyID,
 		&i.Token,
 		&i.ExpiresAt,
 		&i.CreatedAt,
@@ -113,7 +133,8 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (*RefreshTo
 }
 
 const getRefreshTokensByUserID = `-- name: GetRefreshTokensByUserID :many
-SELECT id, user_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address 
+SELECT id, user_id, family_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address,
+    (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = refresh_tokens.family_id) AS family_created_at
 FROM refresh_tokens 
 WHERE user_id = $1 AND expires_at > NOW() AND revoked_at IS NULL
 ORDER BY created_at DESC`
@@ -131,6 +152,7 @@ func (q *Queries) GetRefreshTokensByUserID(ctx context.Context, userID uuid.UUID
 		if err := rows.Scan(
 			&i.ID,
 			&i.UserID,
+			&i.FamilyID,
 			&i.Token,
 			&i.ExpiresAt,
 			&i.CreatedAt,
@@ -138,6 +160,7 @@ func (q *Queries) GetRefreshTokensByUserID(ctx context.Context, userID uuid.UUID
 			&i.RevokedAt,
 			&i.DeviceInfo,
 			&i.IPAddress,
+			&i.FamilyCreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -179,7 +202,7 @@ func (q *Queries) CleanupExpiredRefreshTokens(ctx context.Context) error {
 }
 
 const getRefreshTokenByID = `-- name: GetRefreshTokenByID :one
-SELECT id, user_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address 
+SELECT id, user_id, family_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address 
 FROM refresh_tokens 
 WHERE id = $1`
 
@@ -190,6 +213,7 @@ func (q *Queries) GetRefreshTokenByID(ctx context.Context, id uuid.UUID) (*Refre
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
+		&i.FamilyID,
 		&i.Token,
 		&i.ExpiresAt,
 		&i.CreatedAt,
@@ -216,3 +240,59 @@ func (q *Queries) UpdateRefreshTokenLastUsed(ctx context.Context, token string)
 	_, err := q.db.Exec(ctx, updateRefreshTokenLastUsed, token)
 	return err
 }
+
+const getRefreshTokenForUpdate = `-- name: GetRefreshTokenForUpdate :one
+SELECT id, user_id, family_id, token, expires_at, created_at, updated_at, revoked_at, device_info, ip_address
+FROM refresh_tokens
+WHERE token = $1
+FOR UPDATE`
+
+// GetRefreshTokenForUpdate locks a refresh token whether it is still valid
+// or not, so a revoked token being reused can be told apart from an unknown
+// one
+func (q *Queries) GetRefreshTokenForUpdate(ctx context.Context, token string) (*RefreshToken, error) {
+	var i RefreshToken
+	err := pgxscan.Get(ctx, q.db, &i, getRefreshTokenForUpdate, token)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE family_id = $1 AND revoked_at IS NULL`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeUserRefreshTokenFamily = `-- name: RevokeUserRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id = $2 AND revoked_at IS NULL`
+
+// RevokeUserRefreshTokenFamily reports whether the user had a valid refresh
+// token in the family
+func (q *Queries) RevokeUserRefreshTokenFamily(ctx context.Context, arg RevokeUserRefreshTokenFamilyParams) (bool, error) {
+	result, err := q.db.Exec(ctx, revokeUserRefreshTokenFamily, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const revokeOtherUserRefreshTokens = `-- name: RevokeOtherUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND revoked_at IS NULL`
+
+func (q *Queries) RevokeOtherUserRefreshTokens(ctx context.Context, arg RevokeOtherUserRefreshTokensParams) error {
+	_, err := q.db.Exec(ctx, revokeOtherUserRefreshTokens, arg.UserID, arg.ExceptFamilyID)
+	return err
+}
@@ -0,0 +1,226 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CreatePaymentChargeEntriesParams struct {
+	PaymentID          uuid.UUID `json:"paymentId" db:"payment_id"`
+	PlatformFeePercent float64   `json:"platformFeePercent" db:"platform_fee_percent"`
+	OccurredAt         time.Time `json:"occurredAt" db:"occurred_at"`
+}
+
+type CreatePaymentRefundEntriesParams struct {
+	PaymentID  uuid.UUID `json:"paymentId" db:"payment_id"`
+	OccurredAt time.Time `json:"occurredAt" db:"occurred_at"`
+}
+
+// A nil PersonalID or PlanID covers every trainer or plan. Date bounds are
+// optional and To is exclusive.
+type GetRevenueTotalsParams struct {
+	PersonalID *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	PlanID     *uuid.UUID `json:"planId,omitempty" db:"plan_id"`
+	From       *time.Time `json:"from,omitempty" db:"from"`
+	To         *time.Time `json:"to,omitempty" db:"to"`
+}
+
+// Charges, Refunds and PlatformFees are positive; Net is what the trainer
+// keeps
+type GetRevenueTotalsRow struct {
+	Charges      Money `json:"charges" db:"charges"`
+	Refunds      Money `json:"refunds" db:"refunds"`
+	PlatformFees Money `json:"platformFees" db:"platform_fees"`
+	Net          Money `json:"net" db:"net"`
+}
+
+// A nil PersonalID covers every trainer. From and To are UTC midnights and To
+// is exclusive.
+type GetDailyRevenueParams struct {
+	PersonalID *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	From       time.Time  `json:"from" db:"from"`
+	To         time.Time  `json:"to" db:"to"`
+}
+
+type GetDailyRevenueRow struct {
+	Day          time.Time `json:"day" db:"day"`
+	Charges      Money     `json:"charges" db:"charges"`
+	Refunds      Money     `json:"refunds" db:"refunds"`
+	PlatformFees Money     `json:"platformFees" db:"platform_fees"`
+}
+
+type GetPlanSubscriberCountsRow struct {
+	ActiveSubscribers int32 `json:"activeSubscribers" db:"active_subscribers"`
+	TotalSubscribers  int32 `json:"totalSubscribers" db:"total_subscribers"`
+}
+
+type GetTrainerRecurringRevenueRow struct {
+	ActiveSubscribers int32 `json:"activeSubscribers" db:"active_subscribers"`
+	MRR               Money `json:"mrr" db:"mrr"`
+}
+
+type GetTrainerChurnParams struct {
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+	From       time.Time `json:"from" db:"from"`
+	To         time.Time `json:"to" db:"to"`
+}
+
+type GetTrainerChurnRow struct {
+	SubscribersAtStart int32 `json:"subscribersAtStart" db:"subscribers_at_start"`
+	NewSubscribers     int32 `json:"newSubscribers" db:"new_subscribers"`
+	ChurnedSubscribers int32 `json:"churnedSubscribers" db:"churned_subscribers"`
+}
+
+const createPaymentChargeEntries = `-- name: CreatePaymentChargeEntries :exec
+INSERT INTO revenue_entry (personal_id, plan_id, subscription_id, payment_id, type, amount, occurred_at)
+SELECT p.personal_id, s.plan_id, s.id, pay.id, e.type, e.amount, $3::timestamptz
+FROM payment pay
+JOIN subscription s ON s.id = pay.subscription_id
+JOIN plan p ON p.id = s.plan_id
+CROSS JOIN LATERAL (VALUES
+  ('CHARGE'::revenue_entry_type, pay.amount),
+  ('PLATFORM_FEE'::revenue_entry_type, -ROUND(pay.amount * $2::numeric / 100, 2))
+) AS e(type, amount)
+WHERE pay.id = $1 AND e.amount <> 0
+ON CONFLICT (payment_id, type) DO NOTHING`
+
+// CreatePaymentChargeEntries books a completed payment for the trainer of its
+// plan, less the platform fee. Booking a payment twice does nothing.
+func (q *Queries) CreatePaymentChargeEntries(ctx context.Context, arg CreatePaymentChargeEntriesParams) error {
+	_, err := q.db.Exec(ctx, createPaymentChargeEntries, arg.PaymentID, arg.PlatformFeePercent, arg.OccurredAt)
+	return err
+}
+
+const createPaymentRefundEntries = `-- name: CreatePaymentRefundEntries :exec
+INSERT INTO revenue_entry (personal_id, plan_id, subscription_id, payment_id, type, amount, occurred_at)
+SELECT personal_id, plan_id, subscription_id, payment_id,
+  CASE type WHEN 'CHARGE' THEN 'REFUND'::revenue_entry_type ELSE 'FEE_REFUND'::revenue_entry_type END,
+  -amount, $2::timestamptz
+FROM revenue_entry
+WHERE payment_id = $1 AND type IN ('CHARGE', 'PLATFORM_FEE')
+ON CONFLICT (payment_id, type) DO NOTHING`
+
+// CreatePaymentRefundEntries reverses the charge and the platform fee booked
+// for a payment
+func (q *Queries) CreatePaymentRefundEntries(ctx context.Context, arg CreatePaymentRefundEntriesParams) error {
+	_, err := q.db.Exec(ctx, createPaymentRefundEntries, arg.PaymentID, arg.OccurredAt)
+	return err
+}
+
+const getRevenueTotals = `-- name: GetRevenueTotals :one
+SELECT
+  COALESCE(SUM(amount) FILTER (WHERE type = 'CHARGE'), 0) AS charges,
+  COALESCE(-SUM(amount) FILTER (WHERE type = 'REFUND'), 0) AS refunds,
+  COALESCE(-SUM(amount) FILTER (WHERE type IN ('PLATFORM_FEE', 'FEE_REFUND')), 0) AS platform_fees,
+  COALESCE(SUM(amount), 0) AS net
+FROM revenue_entry
+WHERE ($1::uuid IS NULL OR personal_id = $1)
+  AND ($2::uuid IS NULL OR plan_id = $2)
+  AND ($3::timestamptz IS NULL OR occurred_at >= $3)
+  AND ($4::timestamptz IS NULL OR occurred_at < $4)`
+
+func (q *Queries) GetRevenueTotals(ctx context.Context, arg GetRevenueTotalsParams) (*GetRevenueTotalsRow, error) {
+	var i GetRevenueTotalsRow
+	err := pgxscan.Get(ctx, q.db, &i, getRevenueTotals, arg.PersonalID, arg.PlanID, arg.From, arg.To)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getDailyRevenue = `-- name: GetDailyRevenue :many
+SELECT
+  d.day,
+  COALESCE(SUM(e.amount) FILTER (WHERE e.type = 'CHARGE'), 0) AS charges,
+  COALESCE(-SUM(e.amount) FILTER (WHERE e.type = 'REFUND'), 0) AS refunds,
+  COALESCE(-SUM(e.amount) FILTER (WHERE e.type IN ('PLATFORM_FEE', 'FEE_REFUND')), 0) AS platform_fees
+FROM generate_series($2::timestamptz, $3::timestamptz - INTERVAL '1 day', INTERVAL '1 day') AS d(day)
+LEFT JOIN revenue_entry e
+  ON e.occurred_at >= d.day AND e.occurred_at < d.day + INTERVAL '1 day'
+  AND ($1::uuid IS NULL OR e.personal_id = $1)
+GROUP BY d.day
+ORDER BY d.day ASC`
+
+// GetDailyRevenue buckets the ledger by day, including the days without
+// entries
+func (q *Queries) GetDailyRevenue(ctx context.Context, arg GetDailyRevenueParams) ([]GetDailyRevenueRow, error) {
+	var items []GetDailyRevenueRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getDailyRevenue, arg.PersonalID, arg.From, arg.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getPlanSubscriberCounts = `-- name: GetPlanSubscriberCounts :one
+SELECT
+  (SELECT COUNT(*) FROM subscription WHERE plan_id = $1 AND status = 'ACTIVE')::int AS active_subscribers,
+  (SELECT COUNT(DISTINCT s.user_id)
+   FROM subscription_history h
+   JOIN subscription s ON s.id = h.subscription_id
+   WHERE h.plan_id = $1 AND h.status = 'ACTIVE')::int AS total_subscribers`
+
+// GetPlanSubscriberCounts counts the users paying the plan now and those who
+// ever did
+func (q *Queries) GetPlanSubscriberCounts(ctx context.Context, planID uuid.UUID) (*GetPlanSubscriberCountsRow, error) {
+	var i GetPlanSubscriberCountsRow
+	err := pgxscan.Get(ctx, q.db, &i, getPlanSubscriberCounts, planID)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getTrainerRecurringRevenue = `-- name: GetTrainerRecurringRevenue :one
+SELECT
+  COUNT(*)::int AS active_subscribers,
+  COALESCE(SUM(p.price * 30 / p.duration), 0) AS mrr
+FROM subscription s
+JOIN plan p ON p.id = s.plan_id
+WHERE p.personal_id = $1 AND s.plan_type = 'SUBSCRIPTION' AND s.status = 'ACTIVE'`
+
+// GetTrainerRecurringRevenue sums the price of the active recurring
+// subscriptions of the trainer, scaled to a 30 day month
+func (q *Queries) GetTrainerRecurringRevenue(ctx context.Context, personalID uuid.UUID) (*GetTrainerRecurringRevenueRow, error) {
+	var i GetTrainerRecurringRevenueRow
+	err := pgxscan.Get(ctx, q.db, &i, getTrainerRecurringRevenue, personalID)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getTrainerChurn = `-- name: GetTrainerChurn :one
+WITH lifetimes AS (
+  SELECT
+    s.id,
+    MIN(h.created_at) FILTER (WHERE h.status = 'ACTIVE') AS activated_at,
+    MIN(h.created_at) FILTER (WHERE h.event IN ('CANCELLED', 'EXPIRED')) AS ended_at
+  FROM subscription s
+  JOIN plan p ON p.id = s.plan_id
+  JOIN subscription_history h ON h.subscription_id = s.id
+  WHERE p.personal_id = $1 AND s.plan_type = 'SUBSCRIPTION'
+  GROUP BY s.id
+)
+SELECT
+  COUNT(*) FILTER (WHERE activated_at < $2 AND (ended_at IS NULL OR ended_at >= $2))::int AS subscribers_at_start,
+  COUNT(*) FILTER (WHERE activated_at >= $2 AND activated_at < $3)::int AS new_subscribers,
+  COUNT(*) FILTER (WHERE activated_at IS NOT NULL AND ended_at >= $2 AND ended_at < $3)::int AS churned_subscribers
+FROM lifetimes`
+
+// GetTrainerChurn counts the recurring subscriptions of the trainer that were
+// active when the period started, those first activated during it and those
+// that ended during it after having been active
+func (q *Queries) GetTrainerChurn(ctx context.Context, arg GetTrainerChurnParams) (*GetTrainerChurnRow, error) {
+	var i GetTrainerChurnRow
+	err := pgxscan.Get(ctx, q.db, &i, getTrainerChurn, arg.PersonalID, arg.From, arg.To)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
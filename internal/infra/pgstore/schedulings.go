@@ -4,6 +4,7 @@ import (
 	"context"
 	"time"
 
+	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 )
@@ -15,10 +16,13 @@ type CreateSchedulingParams struct {
 	StudentID  uuid.UUID        `json:"studentId" db:"student_id" validate:"required"`
 	WorkoutID  *uuid.UUID       `json:"workoutId,omitempty" db:"workout_id"`
 	Date       time.Time        `json:"date" db:"date" validate:"required"`
+	EndTime    time.Time        `json:"endTime" db:"end_time" validate:"required"`
 	Type       SchedulingType   `json:"type" db:"type" validate:"required,oneof=ONLINE IN_PERSON"`
 	Status     SchedulingStatus `json:"status" db:"status" validate:"required"`
+	Notes      *string          `json:"notes,omitempty" db:"notes"`
 	CreatedAt  time.Time        `json:"createdAt" db:"created_at"`
 	UserID     *uuid.UUID       `json:"userId,omitempty" db:"user_id"`
+	SeriesID   *uuid.UUID       `json:"seriesId,omitempty" db:"series_id"`
 }
 
 type GetSchedulingByIdParams struct {
@@ -51,7 +55,7 @@ type UpdateSchedulingWithCanceledTimeParams struct {
 type CreateSchedulingHistoryParams struct {
 	ID         uuid.UUID        `json:"id" db:"id"`
 	ScheduleID uuid.UUID        `json:"scheduleId" db:"schedule_id" validate:"required"`
-	UserID     uuid.UUID        `json:"userId" db:"user_id" validate:"required"`
+	UserID     *uuid.UUID       `json:"userId,omitempty" db:"user_id"`
 	Status     SchedulingStatus `json:"status" db:"status" validate:"required"`
 	ChangedAt  *time.Time       `json:"changedAt,omitempty" db:"changed_at"`
 	ChangedBy  string           `json:"changedBy" db:"changed_by" validate:"required"`
@@ -60,7 +64,54 @@ type CreateSchedulingHistoryParams struct {
 }
 
 type CancelSchedulingRequest struct {
-	Reason string `json:"reason" validate:"required,min=5,max=500"`
+	Reason string                 `json:"reason" validate:"required,min=5,max=500"`
+	Scope  *SchedulingSeriesScope `json:"scope,omitempty"`
+}
+
+type CompleteSchedulingRequest struct {
+	Notes string `json:"notes" validate:"max=1000"`
+}
+
+type UpdateSchedulingParams struct {
+	ID      uuid.UUID        `json:"id" db:"id" validate:"required"`
+	Date    time.Time        `json:"date" db:"date" validate:"required"`
+	EndTime time.Time        `json:"endTime" db:"end_time" validate:"required"`
+	Type    SchedulingType   `json:"type" db:"type" validate:"required"`
+	Status  SchedulingStatus `json:"status" db:"status" validate:"required"`
+	Notes   *string          `json:"notes,omitempty" db:"notes"`
+}
+
+type GetOverlappingSchedulingParams struct {
+	PersonalID uuid.UUID  `json:"personalId" db:"personal_id"`
+	StudentID  uuid.UUID  `json:"studentId" db:"student_id"`
+	StartTime  time.Time  `json:"startTime" db:"start_time"`
+	EndTime    time.Time  `json:"endTime" db:"end_time"`
+	ExcludeID  *uuid.UUID `json:"excludeId,omitempty" db:"exclude_id"`
+}
+
+type CreateSchedulingSeriesParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+	StudentID  uuid.UUID `json:"studentId" db:"student_id"`
+	Recurrence string    `json:"recurrence" db:"recurrence"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+type GetSeriesSchedulingsForUpdateParams struct {
+	SeriesID uuid.UUID `json:"seriesId" db:"series_id"`
+	From     time.Time `json:"from" db:"from"`
+}
+
+type GetPersonalBusySchedulingsParams struct {
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+	StartTime  time.Time `json:"startTime" db:"start_time"`
+	EndTime    time.Time `json:"endTime" db:"end_time"`
+}
+
+type SchedulingSeriesResponse struct {
+	ID          uuid.UUID            `json:"id"`
+	Recurrence  string               `json:"recurrence"`
+	Schedulings []SchedulingResponse `json:"schedulings"`
 }
 
 type SchedulingResponse struct {
@@ -69,21 +120,24 @@ type SchedulingResponse struct {
 	StudentID   uuid.UUID        `json:"studentId"`
 	WorkoutID   *uuid.UUID       `json:"workoutId,omitempty"`
 	Date        time.Time        `json:"date"`
+	EndTime     time.Time        `json:"endTime"`
 	Type        SchedulingType   `json:"type"`
 	Status      SchedulingStatus `json:"status"`
+	Notes       *string          `json:"notes,omitempty"`
 	StartedAt   *time.Time       `json:"startedAt,omitempty"`
 	CompletedAt *time.Time       `json:"completedAt,omitempty"`
 	CreatedAt   time.Time        `json:"createdAt"`
 	UserID      *uuid.UUID       `json:"userId,omitempty"`
+	SeriesID    *uuid.UUID       `json:"seriesId,omitempty"`
 }
 
 const createScheduling = `-- name: CreateScheduling :one
 INSERT INTO scheduling (
-  id, personal_id, student_id, workout_id, date, type, status, created_at, user_id
+  id, personal_id, student_id, workout_id, date, end_time, type, status, notes, created_at, user_id, series_id
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8, $9
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 )
-RETURNING id, personal_id, student_id, workout_id, date, type, status, started_at, completed_at, stard_at, created_at, user_id`
+RETURNING id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id`
 
 func (q *Queries) CreateScheduling(ctx context.Context, arg CreateSchedulingParams) (uuid.UUID, error) {
 	row := q.db.QueryRow(ctx, createScheduling,
@@ -92,10 +146,13 @@ func (q *Queries) CreateScheduling(ctx context.Context, arg CreateSchedulingPara
 		arg.StudentID,
 		arg.WorkoutID,
 		arg.Date,
+		arg.EndTime,
 		arg.Type,
 		arg.Status,
+		arg.Notes,
 		arg.CreatedAt,
 		arg.UserID,
+		arg.SeriesID,
 	)
 
 	var i Scheduling
@@ -105,13 +162,16 @@ func (q *Queries) CreateScheduling(ctx context.Context, arg CreateSchedulingPara
 		&i.StudentID,
 		&i.WorkoutID,
 		&i.Date,
+		&i.EndTime,
 		&i.Type,
 		&i.Status,
+		&i.Notes,
 		&i.StartedAt,
 		&i.CompletedAt,
 		&i.StardAt,
 		&i.CreatedAt,
 		&i.UserID,
+		&i.SeriesID,
 	)
 	if err != nil {
 		return uuid.Nil, err
@@ -120,12 +180,14 @@ func (q *Queries) CreateScheduling(ctx context.Context, arg CreateSchedulingPara
 }
 
 const getSchedulings = `-- name: GetSchedulings :many
-SELECT id, personal_id, student_id, workout_id, date, type, status, started_at, completed_at, stard_at, created_at, user_id 
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
 FROM scheduling 
+WHERE personal_id = $1 OR student_id = $1
 ORDER BY date DESC`
 
-func (q *Queries) GetSchedulings(ctx context.Context, personalID uuid.UUID) ([]Scheduling, error) {
-	rows, err := q.db.Query(ctx, getSchedulings)
+// GetSchedulings returns the schedulings where the user is the trainer or the student
+func (q *Queries) GetSchedulings(ctx context.Context, userID uuid.UUID) ([]Scheduling, error) {
+	rows, err := q.db.Query(ctx, getSchedulings, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -140,13 +202,16 @@ func (q *Queries) GetSchedulings(ctx context.Context, personalID uuid.UUID) ([]S
 			&i.StudentID,
 			&i.WorkoutID,
 			&i.Date,
+			&i.EndTime,
 			&i.Type,
 			&i.Status,
+			&i.Notes,
 			&i.StartedAt,
 			&i.CompletedAt,
 			&i.StardAt,
 			&i.CreatedAt,
 			&i.UserID,
+			&i.SeriesID,
 		); err != nil {
 			return nil, err
 		}
@@ -159,7 +224,7 @@ func (q *Queries) GetSchedulings(ctx context.Context, personalID uuid.UUID) ([]S
 }
 
 const getSchedulingById = `-- name: GetSchedulingById :one
-SELECT id, personal_id, student_id, workout_id, date, type, status, started_at, completed_at, stard_at, created_at, user_id 
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
 FROM scheduling 
 WHERE id = $1`
 
@@ -173,13 +238,16 @@ func (q *Queries) GetSchedulingById(ctx context.Context, arg GetSchedulingByIdPa
 		&i.StudentID,
 		&i.WorkoutID,
 		&i.Date,
+		&i.EndTime,
 		&i.Type,
 		&i.Status,
+		&i.Notes,
 		&i.StartedAt,
 		&i.CompletedAt,
 		&i.StardAt,
 		&i.CreatedAt,
 		&i.UserID,
+		&i.SeriesID,
 	)
 	if err != nil {
 		if err == pgx.ErrNoRows {
@@ -190,11 +258,255 @@ func (q *Queries) GetSchedulingById(ctx context.Context, arg GetSchedulingByIdPa
 	return &i, nil
 }
 
+const getSchedulingForUpdate = `-- name: GetSchedulingForUpdate :one
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
+FROM scheduling 
+WHERE id = $1
+FOR UPDATE`
+
+// GetSchedulingForUpdate loads a scheduling and locks it for the rest of the transaction
+func (q *Queries) GetSchedulingForUpdate(ctx context.Context, id uuid.UUID) (*Scheduling, error) {
+	var i Scheduling
+	err := pgxscan.Get(ctx, q.db, &i, getSchedulingForUpdate, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getSchedulingsToMarkMissed = `-- name: GetSchedulingsToMarkMissed :many
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
+FROM scheduling 
+WHERE status IN ('PENDING_CONFIRMATION', 'SCHEDULED', 'RESCHEDULED')
+  AND end_time < $1
+ORDER BY end_time ASC
+FOR UPDATE SKIP LOCKED`
+
+// GetSchedulingsToMarkMissed locks the sessions that ended before the cutoff
+// without being started. Rows locked by another transaction are skipped.
+func (q *Queries) GetSchedulingsToMarkMissed(ctx context.Context, cutoff time.Time) ([]Scheduling, error) {
+	var items []Scheduling
+
+	err := pgxscan.Select(ctx, q.db, &items, getSchedulingsToMarkMissed, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const updateScheduling = `-- name: UpdateScheduling :one
+UPDATE scheduling 
+SET date = $2, end_time = $3, type = $4, status = $5, notes = $6
+WHERE id = $1
+RETURNING id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id`
+
+func (q *Queries) UpdateScheduling(ctx context.Context, arg UpdateSchedulingParams) (*Scheduling, error) {
+	row := q.db.QueryRow(ctx, updateScheduling,
+		arg.ID,
+		arg.Date,
+		arg.EndTime,
+		arg.Type,
+		arg.Status,
+		arg.Notes,
+	)
+
+	var i Scheduling
+	err := row.Scan(
+		&i.ID,
+		&i.PersonalID,
+		&i.StudentID,
+		&i.WorkoutID,
+		&i.Date,
+		&i.EndTime,
+		&i.Type,
+		&i.Status,
+		&i.Notes,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.StardAt,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.SeriesID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getOverlappingScheduling = `-- name: GetOverlappingScheduling :one
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
+FROM scheduling 
+WHERE (personal_id = $1 OR student_id = $2)
+  AND status <> 'CANCELED'
+  AND date < $4
+  AND end_time > $3
+  AND ($5::uuid IS NULL OR id <> $5)
+ORDER BY date ASC
+LIMIT 1`
+
+// GetOverlappingScheduling returns a non-canceled scheduling of the trainer or
+// the student that overlaps the given time range, if any
+func (q *Queries) GetOverlappingScheduling(ctx context.Context, arg GetOverlappingSchedulingParams) (*Scheduling, error) {
+	row := q.db.QueryRow(ctx, getOverlappingScheduling,
+		arg.PersonalID,
+		arg.StudentID,
+		arg.StartTime,
+		arg.EndTime,
+		arg.ExcludeID,
+	)
+
+	var i Scheduling
+	err := row.Scan(
+		&i.ID,
+		&i.PersonalID,
+		&i.StudentID,
+		&i.WorkoutID,
+		&i.Date,
+		&i.EndTime,
+		&i.Type,
+		&i.Status,
+		&i.Notes,
+		&i.StartedAt,
+		&i.CompletedAt,
+		&i.StardAt,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.SeriesID,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const createSchedulingSeries = `-- name: CreateSchedulingSeries :one
+INSERT INTO scheduling_series (id, personal_id, student_id, recurrence, created_at)
+VALUES ($1, $2, $3, $4, $5)
+RETURNING id, personal_id, student_id, recurrence, created_at`
+
+func (q *Queries) CreateSchedulingSeries(ctx context.Context, arg CreateSchedulingSeriesParams) (*SchedulingSeries, error) {
+	var i SchedulingSeries
+	err := pgxscan.Get(ctx, q.db, &i, createSchedulingSeries,
+		arg.ID,
+		arg.PersonalID,
+		arg.StudentID,
+		arg.Recurrence,
+		arg.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getSeriesSchedulingsForUpdate = `-- name: GetSeriesSchedulingsForUpdate :many
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
+FROM scheduling 
+WHERE series_id = $1
+  AND date >= $2
+ORDER BY date ASC
+FOR UPDATE`
+
+// GetSeriesSchedulingsForUpdate loads and locks the occurrences of a series
+// starting at or after the given time
+func (q *Queries) GetSeriesSchedulingsForUpdate(ctx context.Context, arg GetSeriesSchedulingsForUpdateParams) ([]Scheduling, error) {
+	var items []Scheduling
+
+	err := pgxscan.Select(ctx, q.db, &items, getSeriesSchedulingsForUpdate, arg.SeriesID, arg.From)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getPersonalBusySchedulings = `-- name: GetPersonalBusySchedulings :many
+SELECT id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id 
+FROM scheduling 
+WHERE personal_id = $1
+  AND status <> 'CANCELED'
+  AND date < $3
+  AND end_time > $2
+ORDER BY date ASC`
+
+// GetPersonalBusySchedulings returns the non-canceled schedulings of a trainer
+// that overlap the given time range
+func (q *Queries) GetPersonalBusySchedulings(ctx context.Context, arg GetPersonalBusySchedulingsParams) ([]Scheduling, error) {
+	var items []Scheduling
+
+	err := pgxscan.Select(ctx, q.db, &items, getPersonalBusySchedulings, arg.PersonalID, arg.StartTime, arg.EndTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const lockPersonal = `-- name: LockPersonal :one
+SELECT id FROM personal WHERE id = $1 FOR UPDATE`
+
+// LockPersonal locks a trainer row for the rest of the transaction so
+// concurrent bookings are checked one at a time. It reports false when the
+// trainer does not exist.
+func (q *Queries) LockPersonal(ctx context.Context, id uuid.UUID) (bool, error) {
+	var lockedID uuid.UUID
+	err := q.db.QueryRow(ctx, lockPersonal, id).Scan(&lockedID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+const lockStudent = `-- name: LockStudent :one
+SELECT id FROM student WHERE id = $1 FOR UPDATE`
+
+// LockStudent locks a student row for the rest of the transaction. It reports
+// false when the student does not exist.
+func (q *Queries) LockStudent(ctx context.Context, id uuid.UUID) (bool, error) {
+	var lockedID uuid.UUID
+	err := q.db.QueryRow(ctx, lockStudent, id).Scan(&lockedID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+const getPersonalSchedules = `-- name: GetPersonalSchedules :many
+SELECT id, week_day, time_start_in_minutes, time_end_in_minutes, personal_id 
+FROM personal_schedule 
+WHERE personal_id = $1
+ORDER BY week_day ASC, time_start_in_minutes ASC`
+
+func (q *Queries) GetPersonalSchedules(ctx context.Context, personalID uuid.UUID) ([]PersonalSchedule, error) {
+	var items []PersonalSchedule
+
+	err := pgxscan.Select(ctx, q.db, &items, getPersonalSchedules, personalID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
 const updateSchedulingStatus = `-- name: UpdateSchedulingStatus :one
 UPDATE scheduling 
 SET status = $2
 WHERE id = $1
-RETURNING id, personal_id, student_id, workout_id, date, type, status, started_at, completed_at, stard_at, created_at, user_id`
+RETURNING id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id`
 
 func (q *Queries) UpdateSchedulingStatus(ctx context.Context, arg UpdateSchedulingStatusParams) error {
 	_, err := q.db.Exec(ctx, updateSchedulingStatus, arg.ID, arg.Status)
@@ -205,7 +517,7 @@ const updateSchedulingWithStartTime = `-- name: UpdateSchedulingWithStartTime :o
 UPDATE scheduling 
 SET started_at = $2, status = $3
 WHERE id = $1
-RETURNING id, personal_id, student_id, workout_id, date, type, status, started_at, completed_at, stard_at, created_at, user_id`
+RETURNING id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id`
 
 func (q *Queries) UpdateSchedulingWithStartTime(ctx context.Context, arg UpdateSchedulingWithStartTimeParams) error {
 	_, err := q.db.Exec(ctx, updateSchedulingWithStartTime, arg.ID, arg.StartedAt, arg.Status)
@@ -216,7 +528,7 @@ const updateSchedulingWithCompletedTime = `-- name: UpdateSchedulingWithComplete
 UPDATE scheduling 
 SET completed_at = $2, status = $3
 WHERE id = $1
-RETURNING id, personal_id, student_id, workout_id, date, type, status, started_at, completed_at, stard_at, created_at, user_id`
+RETURNING id, personal_id, student_id, workout_id, date, end_time, type, status, notes, started_at, completed_at, stard_at, created_at, user_id, series_id`
 
 func (q *Queries) UpdateSchedulingWithCompletedTime(ctx context.Context, arg UpdateSchedulingWithCompletedTimeParams) error {
 	_, err := q.db.Exec(ctx, updateSchedulingWithCompletedTime, arg.ID, arg.CompletedAt, arg.Status)
@@ -264,3 +576,20 @@ func (q *Queries) CreateSchedulingHistory(ctx context.Context, arg CreateSchedul
 	}
 	return i.ID, nil
 }
+
+const getSchedulingsHistoryByScheduleId = `-- name: GetSchedulingsHistoryByScheduleId :many
+SELECT id, schedule_id, user_id, status, changed_at, changed_by, reason, notes
+FROM schedulings_history
+WHERE schedule_id = $1
+ORDER BY changed_at ASC`
+
+func (q *Queries) GetSchedulingsHistoryByScheduleId(ctx context.Context, scheduleID uuid.UUID) ([]SchedulingsHistory, error) {
+	var items []SchedulingsHistory
+
+	err := pgxscan.Select(ctx, q.db, &items, getSchedulingsHistoryByScheduleId, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
@@ -0,0 +1,214 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+)
+
+type CreateSessionCreditParams struct {
+	SubscriptionID uuid.UUID           `json:"subscriptionId" db:"subscription_id"`
+	SchedulingID   *uuid.UUID          `json:"schedulingId,omitempty" db:"scheduling_id"`
+	Delta          int32               `json:"delta" db:"delta"`
+	Reason         SessionCreditReason `json:"reason" db:"reason"`
+}
+
+type GetUsableCreditPackageIdParams struct {
+	UserID     uuid.UUID `json:"userId" db:"user_id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+	At         time.Time `json:"at" db:"at"`
+}
+
+type HasActiveTrainerSubscriptionParams struct {
+	UserID     uuid.UUID `json:"userId" db:"user_id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+// A nil PersonalID lists the packages of every trainer
+type GetCreditPackagesParams struct {
+	UserID     uuid.UUID  `json:"userId" db:"user_id"`
+	PersonalID *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	Now        time.Time  `json:"now" db:"now"`
+}
+
+type GetSessionCreditLedgerParams struct {
+	UserID     uuid.UUID `json:"userId" db:"user_id"`
+	PersonalID uuid.UUID `json:"personalId" db:"personal_id"`
+}
+
+type GetSchedulingCreditRow struct {
+	SubscriptionID uuid.UUID          `json:"subscriptionId" db:"subscription_id"`
+	Status         SubscriptionStatus `json:"status" db:"status"`
+	EndDate        time.Time          `json:"endDate" db:"end_date"`
+}
+
+type GetCreditPackagesRow struct {
+	ID               uuid.UUID          `json:"id" db:"id"`
+	PlanID           uuid.UUID          `json:"planId" db:"plan_id"`
+	PlanName         string             `json:"planName" db:"plan_name"`
+	PersonalID       uuid.UUID          `json:"personalId" db:"personal_id"`
+	PersonalName     string             `json:"personalName" db:"personal_name"`
+	Status           SubscriptionStatus `json:"status" db:"status"`
+	CreditsTotal     int32              `json:"creditsTotal" db:"credits_total"`
+	CreditsRemaining int32              `json:"creditsRemaining" db:"credits_remaining"`
+	EndDate          time.Time          `json:"endDate" db:"end_date"`
+}
+
+type GetSessionCreditLedgerRow struct {
+	ID             uuid.UUID           `json:"id" db:"id"`
+	SubscriptionID uuid.UUID           `json:"subscriptionId" db:"subscription_id"`
+	PlanName       string              `json:"planName" db:"plan_name"`
+	SchedulingID   *uuid.UUID          `json:"schedulingId,omitempty" db:"scheduling_id"`
+	Delta          int32               `json:"delta" db:"delta"`
+	Reason         SessionCreditReason `json:"reason" db:"reason"`
+	CreatedAt      time.Time           `json:"createdAt" db:"created_at"`
+}
+
+const createSessionCredit = `-- name: CreateSessionCredit :exec
+INSERT INTO session_credit (subscription_id, user_id, personal_id, scheduling_id, delta, reason)
+SELECT s.id, s.user_id, p.personal_id, $2, $3, $4
+FROM subscription s
+JOIN plan p ON p.id = s.plan_id
+WHERE s.id = $1`
+
+// CreateSessionCredit appends an entry to the ledger of a package, for the
+// package's student and trainer
+func (q *Queries) CreateSessionCredit(ctx context.Context, arg CreateSessionCreditParams) error {
+	_, err := q.db.Exec(ctx, createSessionCredit,
+		arg.SubscriptionID,
+		arg.SchedulingID,
+		arg.Delta,
+		arg.Reason,
+	)
+	return err
+}
+
+const getSessionCreditBalance = `-- name: GetSessionCreditBalance :one
+SELECT COALESCE(SUM(delta), 0)::int FROM session_credit WHERE subscription_id = $1`
+
+func (q *Queries) GetSessionCreditBalance(ctx context.Context, subscriptionID uuid.UUID) (int32, error) {
+	var balance int32
+	err := q.db.QueryRow(ctx, getSessionCreditBalance, subscriptionID).Scan(&balance)
+	return balance, err
+}
+
+const getUsableCreditPackageId = `-- name: GetUsableCreditPackageId :one
+SELECT s.id
+FROM subscription s
+JOIN plan p ON p.id = s.plan_id
+WHERE s.user_id = $1 AND p.personal_id = $2
+  AND s.plan_type = 'PACKAGE' AND s.status = 'ACTIVE' AND s.end_date > $3
+  AND (SELECT COALESCE(SUM(c.delta), 0) FROM session_credit c WHERE c.subscription_id = s.id) > 0
+ORDER BY s.end_date ASC
+LIMIT 1
+FOR UPDATE OF s`
+
+// GetUsableCreditPackageId locks the paid package of the student with the
+// trainer that still has credits at the given time, picking the one that
+// expires first, or returns nil when there is none
+func (q *Queries) GetUsableCreditPackageId(ctx context.Context, arg GetUsableCreditPackageIdParams) (*uuid.UUID, error) {
+	var id uuid.UUID
+	err := pgxscan.Get(ctx, q.db, &id, getUsableCreditPackageId, arg.UserID, arg.PersonalID, arg.At)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &id, nil
+}
+
+const hasActiveTrainerSubscription = `-- name: HasActiveTrainerSubscription :one
+SELECT EXISTS (
+  SELECT 1
+  FROM subscription s
+  JOIN plan p ON p.id = s.plan_id
+  WHERE s.user_id = $1 AND p.personal_id = $2
+    AND s.plan_type = 'SUBSCRIPTION' AND s.status = 'ACTIVE'
+)`
+
+// HasActiveTrainerSubscription reports whether the student pays a recurring
+// plan of the trainer
+func (q *Queries) HasActiveTrainerSubscription(ctx context.Context, arg HasActiveTrainerSubscriptionParams) (bool, error) {
+	var exists bool
+	err := q.db.QueryRow(ctx, hasActiveTrainerSubscription, arg.UserID, arg.PersonalID).Scan(&exists)
+	return exists, err
+}
+
+const trainerSellsPackages = `-- name: TrainerSellsPackages :one
+SELECT EXISTS (SELECT 1 FROM plan WHERE personal_id = $1 AND type = 'PACKAGE' AND is_active)`
+
+func (q *Queries) TrainerSellsPackages(ctx context.Context, personalID uuid.UUID) (bool, error) {
+	var exists bool
+	err := q.db.QueryRow(ctx, trainerSellsPackages, personalID).Scan(&exists)
+	return exists, err
+}
+
+const getSchedulingCredit = `-- name: GetSchedulingCredit :one
+SELECT c.subscription_id, s.status, s.end_date
+FROM session_credit c
+JOIN subscription s ON s.id = c.subscription_id
+WHERE c.scheduling_id = $1
+GROUP BY c.subscription_id, s.status, s.end_date
+HAVING SUM(c.delta) < 0`
+
+// GetSchedulingCredit returns the package a scheduling holds a credit of,
+// or nil when it holds none or the credit was already refunded
+func (q *Queries) GetSchedulingCredit(ctx context.Context, schedulingID uuid.UUID) (*GetSchedulingCreditRow, error) {
+	var i GetSchedulingCreditRow
+	err := pgxscan.Get(ctx, q.db, &i, getSchedulingCredit, schedulingID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getCreditPackages = `-- name: GetCreditPackages :many
+SELECT
+  s.id, s.plan_id, p.name AS plan_name, p.personal_id, u.name AS personal_name, s.status,
+  COALESCE(s.session_credits, 0) AS credits_total,
+  (SELECT COALESCE(SUM(c.delta), 0) FROM session_credit c WHERE c.subscription_id = s.id)::int AS credits_remaining,
+  s.end_date
+FROM subscription s
+JOIN plan p ON p.id = s.plan_id
+JOIN users u ON u.id = p.personal_id
+WHERE s.user_id = $1 AND ($2::uuid IS NULL OR p.personal_id = $2)
+  AND s.plan_type = 'PACKAGE' AND s.status = 'ACTIVE' AND s.end_date > $3
+ORDER BY s.end_date ASC`
+
+// GetCreditPackages lists the paid packages of the student that have not
+// expired yet
+func (q *Queries) GetCreditPackages(ctx context.Context, arg GetCreditPackagesParams) ([]GetCreditPackagesRow, error) {
+	var items []GetCreditPackagesRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getCreditPackages, arg.UserID, arg.PersonalID, arg.Now)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getSessionCreditLedger = `-- name: GetSessionCreditLedger :many
+SELECT c.id, c.subscription_id, p.name AS plan_name, c.scheduling_id, c.delta, c.reason, c.created_at
+FROM session_credit c
+JOIN subscription s ON s.id = c.subscription_id
+JOIN plan p ON p.id = s.plan_id
+WHERE c.user_id = $1 AND c.personal_id = $2
+ORDER BY c.created_at DESC`
+
+func (q *Queries) GetSessionCreditLedger(ctx context.Context, arg GetSessionCreditLedgerParams) ([]GetSessionCreditLedgerRow, error) {
+	var items []GetSessionCreditLedgerRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getSessionCreditLedger, arg.UserID, arg.PersonalID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
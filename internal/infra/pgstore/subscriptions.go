@@ -0,0 +1,323 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// SessionCredits are granted once a PACKAGE subscription is paid
+type CreateSubscriptionParams struct {
+	UserID         uuid.UUID          `json:"userId" db:"user_id"`
+	PlanID         uuid.UUID          `json:"planId" db:"plan_id"`
+	Status         SubscriptionStatus `json:"status" db:"status"`
+	StartDate      time.Time          `json:"startDate" db:"start_date"`
+	EndDate        time.Time          `json:"endDate" db:"end_date"`
+	Amount         Money              `json:"amount" db:"amount"`
+	PlanType       PlanType           `json:"planType" db:"plan_type"`
+	SessionCredits *int32             `json:"sessionCredits,omitempty" db:"session_credits"`
+}
+
+type UpdateSubscriptionStatusParams struct {
+	ID     uuid.UUID          `json:"id" db:"id"`
+	Status SubscriptionStatus `json:"status" db:"status"`
+}
+
+// UpdateSubscriptionRenewalParams sets what happens at the end of the current
+// period: a nil NextPlanID renews the current plan
+type UpdateSubscriptionRenewalParams struct {
+	ID                uuid.UUID  `json:"id" db:"id"`
+	NextPlanID        *uuid.UUID `json:"nextPlanId,omitempty" db:"next_plan_id"`
+	CancelAtPeriodEnd bool       `json:"cancelAtPeriodEnd" db:"cancel_at_period_end"`
+	CancelledAt       *time.Time `json:"cancelledAt,omitempty" db:"cancelled_at"`
+}
+
+type RenewSubscriptionParams struct {
+	ID        uuid.UUID          `json:"id" db:"id"`
+	PlanID    uuid.UUID          `json:"planId" db:"plan_id"`
+	Status    SubscriptionStatus `json:"status" db:"status"`
+	StartDate time.Time          `json:"startDate" db:"start_date"`
+	EndDate   time.Time          `json:"endDate" db:"end_date"`
+	Amount    Money              `json:"amount" db:"amount"`
+}
+
+type GetDueSubscriptionsForUpdateParams struct {
+	Now   time.Time `json:"now" db:"now"`
+	Limit int32     `json:"limit" db:"limit"`
+}
+
+type CreateSubscriptionHistoryParams struct {
+	SubscriptionID uuid.UUID          `json:"subscriptionId" db:"subscription_id"`
+	PlanID         uuid.UUID          `json:"planId" db:"plan_id"`
+	Event          SubscriptionEvent  `json:"event" db:"event"`
+	Status         SubscriptionStatus `json:"status" db:"status"`
+	StartDate      time.Time          `json:"startDate" db:"start_date"`
+	EndDate        time.Time          `json:"endDate" db:"end_date"`
+	Amount         Money              `json:"amount" db:"amount"`
+	CouponID       *uuid.UUID         `json:"couponId,omitempty" db:"coupon_id"`
+	Discount       Money              `json:"discount" db:"discount"`
+}
+
+type GetSubscriptionHistoryByUserIdRow struct {
+	ID          uuid.UUID          `json:"id" db:"id"`
+	PlanName    string             `json:"planName" db:"plan_name"`
+	TrainerName string             `json:"trainerName" db:"trainer_name"`
+	Event       SubscriptionEvent  `json:"event" db:"event"`
+	Status      SubscriptionStatus `json:"status" db:"status"`
+	StartDate   time.Time          `json:"startDate" db:"start_date"`
+	EndDate     time.Time          `json:"endDate" db:"end_date"`
+	Amount      Money              `json:"amount" db:"amount"`
+	Discount    Money              `json:"discount" db:"discount"`
+	CouponCode  *string            `json:"couponCode,omitempty" db:"coupon_code"`
+	CreatedAt   time.Time          `json:"createdAt" db:"created_at"`
+}
+
+type GetPlanSubscribersRow struct {
+	UserID       uuid.UUID          `json:"userId" db:"user_id"`
+	UserName     string             `json:"userName" db:"user_name"`
+	UserEmail    string             `json:"userEmail" db:"user_email"`
+	StartDate    time.Time          `json:"startDate" db:"start_date"`
+	EndDate      time.Time          `json:"endDate" db:"end_date"`
+	Status       SubscriptionStatus `json:"status" db:"status"`
+	SubscribedAt time.Time          `json:"subscribedAt" db:"subscribed_at"`
+}
+
+const lockUser = `-- name: LockUser :one
+SELECT id FROM users WHERE id = $1 FOR UPDATE`
+
+// LockUser locks a user row for the rest of the transaction so concurrent
+// subscription changes of the same user are applied one at a time. It
+// reports false when the user does not exist.
+func (q *Queries) LockUser(ctx context.Context, id uuid.UUID) (bool, error) {
+	var lockedID uuid.UUID
+	err := q.db.QueryRow(ctx, lockUser, id).Scan(&lockedID)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+const createSubscription = `-- name: CreateSubscription :one
+INSERT INTO subscription (user_id, plan_id, status, start_date, end_date, amount, plan_type, session_credits)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+RETURNING id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at`
+
+func (q *Queries) CreateSubscription(ctx context.Context, arg CreateSubscriptionParams) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, createSubscription,
+		arg.UserID,
+		arg.PlanID,
+		arg.Status,
+		arg.StartDate,
+		arg.EndDate,
+		arg.Amount,
+		arg.PlanType,
+		arg.SessionCredits,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getLiveSubscriptionByUserId = `-- name: GetLiveSubscriptionByUserId :one
+SELECT id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at
+FROM subscription
+WHERE user_id = $1 AND status IN ('PENDING', 'ACTIVE') AND plan_type = 'SUBSCRIPTION'`
+
+// GetLiveSubscriptionByUserId returns the pending or active recurring
+// subscription of the user, if any; packages are not included
+func (q *Queries) GetLiveSubscriptionByUserId(ctx context.Context, userID uuid.UUID) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, getLiveSubscriptionByUserId, userID)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getSubscriptionById = `-- name: GetSubscriptionById :one
+SELECT id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at
+FROM subscription
+WHERE id = $1`
+
+func (q *Queries) GetSubscriptionById(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, getSubscriptionById, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getSubscriptionForUpdate = `-- name: GetSubscriptionForUpdate :one
+SELECT id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at
+FROM subscription
+WHERE id = $1
+FOR UPDATE`
+
+func (q *Queries) GetSubscriptionForUpdate(ctx context.Context, id uuid.UUID) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, getSubscriptionForUpdate, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const updateSubscriptionStatus = `-- name: UpdateSubscriptionStatus :one
+UPDATE subscription
+SET status = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at`
+
+func (q *Queries) UpdateSubscriptionStatus(ctx context.Context, arg UpdateSubscriptionStatusParams) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, updateSubscriptionStatus, arg.ID, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const updateSubscriptionRenewal = `-- name: UpdateSubscriptionRenewal :one
+UPDATE subscription
+SET next_plan_id = $2, cancel_at_period_end = $3, cancelled_at = $4, updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at`
+
+func (q *Queries) UpdateSubscriptionRenewal(ctx context.Context, arg UpdateSubscriptionRenewalParams) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, updateSubscriptionRenewal,
+		arg.ID,
+		arg.NextPlanID,
+		arg.CancelAtPeriodEnd,
+		arg.CancelledAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const renewSubscription = `-- name: RenewSubscription :one
+UPDATE subscription
+SET plan_id = $2, next_plan_id = NULL, status = $3, start_date = $4, end_date = $5, amount = $6, updated_at = NOW()
+WHERE id = $1
+RETURNING id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at`
+
+// RenewSubscription moves the subscription to its next period
+func (q *Queries) RenewSubscription(ctx context.Context, arg RenewSubscriptionParams) (*Subscription, error) {
+	var i Subscription
+	err := pgxscan.Get(ctx, q.db, &i, renewSubscription,
+		arg.ID,
+		arg.PlanID,
+		arg.Status,
+		arg.StartDate,
+		arg.EndDate,
+		arg.Amount,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getDueSubscriptionsForUpdate = `-- name: GetDueSubscriptionsForUpdate :many
+SELECT id, user_id, plan_id, next_plan_id, status, start_date, end_date, amount, cancel_at_period_end, cancelled_at, plan_type, session_credits, created_at, updated_at
+FROM subscription
+WHERE status IN ('PENDING', 'ACTIVE') AND end_date <= $1
+ORDER BY end_date ASC
+LIMIT $2
+FOR UPDATE SKIP LOCKED`
+
+// GetDueSubscriptionsForUpdate locks live subscriptions whose period ended,
+// skipping those another transaction is already handling
+func (q *Queries) GetDueSubscriptionsForUpdate(ctx context.Context, arg GetDueSubscriptionsForUpdateParams) ([]Subscription, error) {
+	var items []Subscription
+
+	err := pgxscan.Select(ctx, q.db, &items, getDueSubscriptionsForUpdate, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const createSubscriptionHistory = `-- name: CreateSubscriptionHistory :exec
+INSERT INTO subscription_history (subscription_id, plan_id, event, status, start_date, end_date, amount, coupon_id, discount)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+func (q *Queries) CreateSubscriptionHistory(ctx context.Context, arg CreateSubscriptionHistoryParams) error {
+	_, err := q.db.Exec(ctx, createSubscriptionHistory,
+		arg.SubscriptionID,
+		arg.PlanID,
+		arg.Event,
+		arg.Status,
+		arg.StartDate,
+		arg.EndDate,
+		arg.Amount,
+		arg.CouponID,
+		arg.Discount,
+	)
+	return err
+}
+
+const getSubscriptionHistoryByUserId = `-- name: GetSubscriptionHistoryByUserId :many
+SELECT
+  h.id, p.name AS plan_name, u.name AS trainer_name, h.event, h.status,
+  h.start_date, h.end_date, h.amount, h.discount, c.code AS coupon_code, h.created_at
+FROM subscription_history h
+JOIN subscription s ON s.id = h.subscription_id
+JOIN plan p ON p.id = h.plan_id
+JOIN users u ON u.id = p.personal_id
+LEFT JOIN coupon c ON c.id = h.coupon_id
+WHERE s.user_id = $1
+ORDER BY h.created_at DESC`
+
+func (q *Queries) GetSubscriptionHistoryByUserId(ctx context.Context, userID uuid.UUID) ([]GetSubscriptionHistoryByUserIdRow, error) {
+	var items []GetSubscriptionHistoryByUserIdRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getSubscriptionHistoryByUserId, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getPlanSubscribers = `-- name: GetPlanSubscribers :many
+SELECT
+  s.user_id, u.name AS user_name, u.email AS user_email,
+  s.start_date, s.end_date, s.status, s.created_at AS subscribed_at
+FROM subscription s
+JOIN users u ON u.id = s.user_id
+WHERE s.plan_id = $1 AND s.status IN ('PENDING', 'ACTIVE')
+ORDER BY s.created_at DESC`
+
+// GetPlanSubscribers returns the users with a live subscription to the plan
+func (q *Queries) GetPlanSubscribers(ctx context.Context, planID uuid.UUID) ([]GetPlanSubscribersRow, error) {
+	var items []GetPlanSubscribersRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getPlanSubscribers, planID)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
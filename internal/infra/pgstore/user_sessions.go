@@ -0,0 +1,103 @@
+package pgstore
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+type CreateUserSessionParams struct {
+	Token  string    `json:"token" db:"token"`
+	UserID uuid.UUID `json:"userId" db:"user_id"`
+}
+
+type RenameUserSessionParams struct {
+	Token    string `json:"token" db:"token"`
+	NewToken string `json:"newToken" db:"new_token"`
+}
+
+const createUserSession = `-- name: CreateUserSession :exec
+INSERT INTO user_session (token, user_id)
+VALUES ($1, $2)
+ON CONFLICT (token) DO UPDATE SET user_id = EXCLUDED.user_id, created_at = NOW()`
+
+// CreateUserSession indexes the cookie session with the token under its user
+func (q *Queries) CreateUserSession(ctx context.Context, arg CreateUserSessionParams) error {
+	_, err := q.db.Exec(ctx, createUserSession, arg.Token, arg.UserID)
+	return err
+}
+
+const backfillUserSession = `-- name: BackfillUserSession :execrows
+INSERT INTO user_session (token, user_id)
+SELECT $1, id FROM users WHERE id = $2
+ON CONFLICT (token) DO NOTHING`
+
+// BackfillUserSession indexes a cookie session that isn't indexed yet. It
+// reports false when it already was or its user no longer exists.
+func (q *Queries) BackfillUserSession(ctx context.Context, arg CreateUserSessionParams) (bool, error) {
+	result, err := q.db.Exec(ctx, backfillUserSession, arg.Token, arg.UserID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+const getUserSessionTokens = `-- name: GetUserSessionTokens :many
+SELECT token
+FROM user_session
+WHERE user_id = $1`
+
+func (q *Queries) GetUserSessionTokens(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	rows, err := q.db.Query(ctx, getUserSessionTokens, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []string
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, err
+		}
+		items = append(items, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const renameUserSession = `-- name: RenameUserSession :exec
+UPDATE user_session
+SET token = $2, created_at = NOW()
+WHERE token = $1`
+
+// RenameUserSession follows a cookie session to the token it was renewed with
+func (q *Queries) RenameUserSession(ctx context.Context, arg RenameUserSessionParams) error {
+	_, err := q.db.Exec(ctx, renameUserSession, arg.Token, arg.NewToken)
+	return err
+}
+
+const deleteUserSession = `-- name: DeleteUserSession :exec
+DELETE FROM user_session
+WHERE token = $1`
+
+func (q *Queries) DeleteUserSession(ctx context.Context, token string) error {
+	_, err := q.db.Exec(ctx, deleteUserSession, token)
+	return err
+}
+
+const deleteStaleUserSessions = `-- name: DeleteStaleUserSessions :exec
+DELETE FROM user_session
+WHERE user_id = $1
+  AND created_at < NOW() - INTERVAL '1 hour'
+  AND NOT EXISTS (SELECT 1 FROM sessions WHERE sessions.token = user_session.token)`
+
+// DeleteStaleUserSessions forgets the sessions of the user that expired or
+// were dropped from the session store. A session is only saved once the
+// request that started it ends, so recent ones are kept.
+func (q *Queries) DeleteStaleUserSessions(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteStaleUserSessions, userID)
+	return err
+}
@@ -4,18 +4,22 @@ import (
 	"context"
 	"time"
 
+	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
+// A nil EmailVerifiedAt creates the user unverified
 type CreateUserParams struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name" validate:"required,min=2,max=100"`
-	Email     string    `json:"email" db:"email" validate:"required,email"`
-	Phone     string    `json:"phone" db:"phone" validate:"required"`
-	Password  string    `json:"password" db:"password" validate:"required,min=6"`
-	Role      Role      `json:"role" db:"role" validate:"required,oneof=PERSONAL STUDENT ADMIN"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name" validate:"required,min=2,max=100"`
+	Email           string     `json:"email" db:"email" validate:"required,email"`
+	Phone           string     `json:"phone" db:"phone" validate:"required"`
+	Password        string     `json:"password" db:"password" validate:"required,min=6"`
+	Role            Role       `json:"role" db:"role" validate:"required,oneof=PERSONAL STUDENT ADMIN"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updatedAt" db:"updated_at"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty" db:"email_verified_at"`
 }
 
 type CreateStudentParams struct {
@@ -118,15 +122,39 @@ type GetUserByIdRow struct {
 	Observations          *string    `json:"observations,omitempty" db:"observations"`
 }
 
+// Nil filters match every user
+type GetAllUsersParams struct {
+	Role          *Role   `json:"role,omitempty" db:"role"`
+	Search        *string `json:"search,omitempty" db:"search"`
+	EmailVerified *bool   `json:"emailVerified,omitempty" db:"email_verified"`
+	Limit         int32   `json:"limit" db:"limit"`
+	Offset        int32   `json:"offset" db:"offset"`
+}
+
 type GetAllUsersRow struct {
-	ID        uuid.UUID `json:"id" db:"id"`
-	Name      string    `json:"name" db:"name"`
-	Email     string    `json:"email" db:"email"`
-	Phone     string    `json:"phone" db:"phone"`
-	AvatarURL *string   `json:"avatarUrl,omitempty" db:"avatar_url"`
-	Role      Role      `json:"role" db:"role"`
-	CreatedAt time.Time `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	Phone           string     `json:"phone" db:"phone"`
+	AvatarURL       *string    `json:"avatarUrl,omitempty" db:"avatar_url"`
+	Role            Role       `json:"role" db:"role"`
+	EmailVerified   bool       `json:"emailVerified" db:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty" db:"email_verified_at"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updatedAt" db:"updated_at"`
+	TotalCount      int64      `json:"-" db:"total_count"`
+}
+
+type GetUserEmailVerificationRow struct {
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Name            string     `json:"name" db:"name"`
+	Email           string     `json:"email" db:"email"`
+	EmailVerifiedAt *time.Time `json:"emailVerifiedAt,omitempty" db:"email_verified_at"`
+}
+
+type MarkEmailVerifiedParams struct {
+	ID    uuid.UUID `json:"id" db:"id"`
+	Email string    `json:"email" db:"email"`
 }
 
 type UpdateUserProfileParams struct {
@@ -151,9 +179,9 @@ type UserResponse struct {
 
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
-  id, name, email, phone, password, role, created_at, updated_at
+  id, name, email, phone, password, role, created_at, updated_at, email_verified_at
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8
+  $1, $2, $3, $4, $5, $6, $7, $8, $9
 )
 RETURNING id, name, email, phone, avatar_url, role, created_at, updated_at`
 
@@ -200,6 +228,11 @@ SET avatar_url = $2, updated_at = $3
 WHERE id = $1
 RETURNING id, name, email, phone, avatar_url, role, created_at, updated_at`
 
+const getUserPasswordHash = `-- name: GetUserPasswordHash :one
+SELECT password
+FROM users
+WHERE id = $1`
+
 const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users 
 SET password = $2
@@ -215,6 +248,7 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (uuid.UU
 		arg.Role,
 		arg.CreatedAt,
 		arg.UpdatedAt,
+		arg.EmailVerifiedAt,
 	)
 
 	var i GetUserByEmailRow
@@ -319,9 +353,66 @@ func (q *Queries) GetUserForAuth(ctx context.Context, email string) (*GetUserFor
 	return &i, nil
 }
 
-func (q *Queries) GetAllUsers(ctx context.Context) ([]GetAllUsersRow, error) {
-	// This would need a SQL query - placeholder for now
-	return nil, nil
+const getAllUsers = `-- name: GetAllUsers :many
+SELECT
+  id, name, email, phone, avatar_url, role,
+  email_verified_at IS NOT NULL AS email_verified, email_verified_at,
+  created_at, updated_at,
+  COUNT(*) OVER () AS total_count
+FROM users
+WHERE ($1::role IS NULL OR role = $1)
+  AND ($2::text IS NULL OR name ILIKE '%' || $2 || '%' OR email ILIKE '%' || $2 || '%')
+  AND ($3::boolean IS NULL OR (email_verified_at IS NOT NULL) = $3)
+ORDER BY created_at DESC
+LIMIT $4 OFFSET $5`
+
+// GetAllUsers lists a page of the users, each row carrying the number of
+// users matching the filters
+func (q *Queries) GetAllUsers(ctx context.Context, arg GetAllUsersParams) ([]GetAllUsersRow, error) {
+	var items []GetAllUsersRow
+
+	err := pgxscan.Select(ctx, q.db, &items, getAllUsers, arg.Role, arg.Search, arg.EmailVerified, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+const getUserEmailVerification = `-- name: GetUserEmailVerification :one
+SELECT id, name, email, email_verified_at FROM users WHERE id = $1`
+
+func (q *Queries) GetUserEmailVerification(ctx context.Context, id uuid.UUID) (*GetUserEmailVerificationRow, error) {
+	var i GetUserEmailVerificationRow
+	err := pgxscan.Get(ctx, q.db, &i, getUserEmailVerification, id)
+	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const isEmailVerified = `-- name: IsEmailVerified :one
+SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND email_verified_at IS NOT NULL)`
+
+func (q *Queries) IsEmailVerified(ctx context.Context, id uuid.UUID) (bool, error) {
+	var verified bool
+	err := q.db.QueryRow(ctx, isEmailVerified, id).Scan(&verified)
+	return verified, err
+}
+
+const markEmailVerified = `-- name: MarkEmailVerified :exec
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL`
+
+// MarkEmailVerified verifies the user's email, as long as it is still the
+// one the verification link was sent to
+func (q *Queries) MarkEmailVerified(ctx context.Context, arg MarkEmailVerifiedParams) error {
+	_, err := q.db.Exec(ctx, markEmailVerified, arg.ID, arg.Email)
+	return err
 }
 
 func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) error {
@@ -334,6 +425,13 @@ func (q *Queries) UpdateUserAvatar(ctx context.Context, arg UpdateUserAvatarPara
 	return err
 }
 
+func (q *Queries) GetUserPasswordHash(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getUserPasswordHash, id)
+	var password string
+	err := row.Scan(&password)
+	return password, err
+}
+
 func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
 	_, err := q.db.Exec(ctx, updateUserPassword, arg.ID, arg.Password)
 	return err
@@ -349,6 +447,38 @@ func (q *Queries) GetUserRole(ctx context.Context, id uuid.UUID) (Role, error) {
 	return RoleStudent, nil
 }
 
+const getStudentById = `-- name: GetStudentById :one
+SELECT id, born_date, age, weight, objective, training_frequency, did_bodybuilding, medical_condition, physical_activity_level, observations, personal_id, plan_id
+FROM student
+WHERE id = $1`
+
+func (q *Queries) GetStudentById(ctx context.Context, id uuid.UUID) (*Student, error) {
+	row := q.db.QueryRow(ctx, getStudentById, id)
+
+	var i Student
+	err := row.Scan(
+		&i.ID,
+		&i.BornDate,
+		&i.Age,
+		&i.Weight,
+		&i.Objective,
+		&i.TrainingFrequency,
+		&i.DidBodybuilding,
+		&i.MedicalCondition,
+		&i.PhysicalActivityLevel,
+		&i.Observations,
+		&i.PersonalID,
+		&i.PlanID,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
 // Count queries for analytics
 
 const countUsers = `-- name: CountUsers :one
@@ -0,0 +1,351 @@
+package pgstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Workout session request/response types
+type FinishWorkoutSet struct {
+	Reps      int32    `json:"reps" validate:"min=0"`
+	LoadKg    float64  `json:"loadKg" validate:"min=0"`
+	RPE       *float64 `json:"rpe,omitempty"`
+	RIR       *int32   `json:"rir,omitempty"`
+	ToFailure bool     `json:"toFailure"`
+	IsWarmup  bool     `json:"isWarmup"`
+}
+
+type FinishWorkoutExercise struct {
+	ExerciseID    uuid.UUID          `json:"exerciseId" validate:"required"`
+	Sets          []FinishWorkoutSet `json:"sets" validate:"required"`
+	RestTime      *int32             `json:"restTime,omitempty"`
+	ExecutionTime *string            `json:"executionTime,omitempty"`
+}
+
+type FinishWorkoutRequest struct {
+	Duration  *int32                  `json:"duration,omitempty"` // in minutes, defaults to the elapsed session time
+	Notes     *string                 `json:"notes,omitempty"`
+	Exercises []FinishWorkoutExercise `json:"exercises" validate:"required"`
+}
+
+type WorkoutSessionResponse struct {
+	ID         uuid.UUID         `json:"id"`
+	StudentID  uuid.UUID         `json:"studentId"`
+	WorkoutID  uuid.UUID         `json:"workoutId"`
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt *time.Time        `json:"finishedAt,omitempty"`
+	Duration   *int32            `json:"duration,omitempty"`
+	Notes      *string           `json:"notes,omitempty"`
+	Exercises  []ExercisesSetup  `json:"exercises,omitempty"`
+	History    []WorkoutsHistory `json:"history,omitempty"`
+
+	NewRecords []PersonalRecordResponse `json:"newRecords,omitempty"`
+}
+
+type CreateWorkoutSessionParams struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	StudentID uuid.UUID `json:"studentId" db:"student_id" validate:"required"`
+	WorkoutID uuid.UUID `json:"workoutId" db:"workout_id" validate:"required"`
+	StartedAt time.Time `json:"startedAt" db:"started_at"`
+	CreatedAt time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+type GetOpenWorkoutSessionParams struct {
+	StudentID uuid.UUID `json:"studentId" db:"student_id" validate:"required"`
+	WorkoutID uuid.UUID `json:"workoutId" db:"workout_id" validate:"required"`
+}
+
+type FinishWorkoutSessionParams struct {
+	ID         uuid.UUID `json:"id" db:"id" validate:"required"`
+	FinishedAt time.Time `json:"finishedAt" db:"finished_at"`
+	Duration   int32     `json:"duration" db:"duration"`
+	Notes      *string   `json:"notes,omitempty" db:"notes"`
+}
+
+type CreateWorkoutSetParams struct {
+	ID         uuid.UUID `json:"id" db:"id"`
+	SessionID  uuid.UUID `json:"sessionId" db:"session_id"`
+	HistoryID  uuid.UUID `json:"historyId" db:"history_id"`
+	ExerciseID uuid.UUID `json:"exerciseId" db:"exercise_id"`
+	SetIndex   int32     `json:"setIndex" db:"set_index"`
+	Reps       int32     `json:"reps" db:"reps"`
+	LoadKg     float64   `json:"loadKg" db:"load_kg"`
+	RPE        *float64  `json:"rpe,omitempty" db:"rpe"`
+	RIR        *int32    `json:"rir,omitempty" db:"rir"`
+	ToFailure  bool      `json:"toFailure" db:"to_failure"`
+	IsWarmup   bool      `json:"isWarmup" db:"is_warmup"`
+	CreatedAt  time.Time `json:"createdAt" db:"created_at"`
+}
+
+type GetFinishedWorkoutSessionsRow struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	WorkoutID   uuid.UUID  `json:"workoutId" db:"workout_id"`
+	WorkoutName string     `json:"workoutName" db:"workout_name"`
+	StartedAt   time.Time  `json:"startedAt" db:"started_at"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty" db:"finished_at"`
+	Duration    *int32     `json:"duration,omitempty" db:"duration"`
+	Notes       *string    `json:"notes,omitempty" db:"notes"`
+}
+
+type CreateWorkoutHistoryParams struct {
+	ID               uuid.UUID `json:"id" db:"id"`
+	StudentID        uuid.UUID `json:"studentId" db:"student_id"`
+	WorkoutID        uuid.UUID `json:"workoutId" db:"workout_id"`
+	SessionID        uuid.UUID `json:"sessionId" db:"session_id"`
+	ExecutionTime    *string   `json:"executionTime,omitempty" db:"execution_time"`
+	RestTime         *int32    `json:"restTime,omitempty" db:"rest_time"`
+	Thumbnail        *string   `json:"thumbnail,omitempty" db:"thumbnail"`
+	TimeTotalWorkout int32     `json:"timeTotalWorkout" db:"time_total_workout"`
+	ExerciseTitle    string    `json:"exerciseTitle" db:"exercise_title"`
+	ExerciseID       uuid.UUID `json:"exerciseId" db:"exercise_id"`
+	CreatedAt        time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+const createWorkoutSession = `-- name: CreateWorkoutSession :one
+INSERT INTO workout_session (
+  id, student_id, workout_id, started_at, created_at, updated_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6
+)
+ON CONFLICT (student_id, workout_id) WHERE finished_at IS NULL DO NOTHING
+RETURNING id, student_id, workout_id, started_at, finished_at, duration, notes, created_at, updated_at`
+
+// CreateWorkoutSession returns nil when the student already has an open
+// session for the workout
+func (q *Queries) CreateWorkoutSession(ctx context.Context, arg CreateWorkoutSessionParams) (*WorkoutSession, error) {
+	row := q.db.QueryRow(ctx, createWorkoutSession,
+		arg.ID,
+		arg.StudentID,
+		arg.WorkoutID,
+		arg.StartedAt,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+
+	var i WorkoutSession
+	err := row.Scan(
+		&i.ID,
+		&i.StudentID,
+		&i.WorkoutID,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Duration,
+		&i.Notes,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getOpenWorkoutSession = `-- name: GetOpenWorkoutSession :one
+SELECT id, student_id, workout_id, started_at, finished_at, duration, notes, created_at, updated_at
+FROM workout_session
+WHERE student_id = $1 AND workout_id = $2 AND finished_at IS NULL
+FOR UPDATE`
+
+// GetOpenWorkoutSession returns the unfinished session of a student for a
+// workout, locking the row when called inside a transaction.
+func (q *Queries) GetOpenWorkoutSession(ctx context.Context, arg GetOpenWorkoutSessionParams) (*WorkoutSession, error) {
+	row := q.db.QueryRow(ctx, getOpenWorkoutSession, arg.StudentID, arg.WorkoutID)
+
+	var i WorkoutSession
+	err := row.Scan(
+		&i.ID,
+		&i.StudentID,
+		&i.WorkoutID,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Duration,
+		&i.Notes,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &i, nil
+}
+
+const finishWorkoutSession = `-- name: FinishWorkoutSession :one
+UPDATE workout_session
+SET finished_at = $2, duration = $3, notes = $4, updated_at = $2
+WHERE id = $1 AND finished_at IS NULL
+RETURNING id, student_id, workout_id, started_at, finished_at, duration, notes, created_at, updated_at`
+
+func (q *Queries) FinishWorkoutSession(ctx context.Context, arg FinishWorkoutSessionParams) (*WorkoutSession, error) {
+	row := q.db.QueryRow(ctx, finishWorkoutSession,
+		arg.ID,
+		arg.FinishedAt,
+		arg.Duration,
+		arg.Notes,
+	)
+
+	var i WorkoutSession
+	err := row.Scan(
+		&i.ID,
+		&i.StudentID,
+		&i.WorkoutID,
+		&i.StartedAt,
+		&i.FinishedAt,
+		&i.Duration,
+		&i.Notes,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const createWorkoutHistory = `-- name: CreateWorkoutHistory :one
+INSERT INTO workouts_history (
+  id, student_id, workout_id, session_id, execution_time, rest_time, thumbnail, time_total_workout, exercise_title, exercise_id, created_at, updated_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+)
+RETURNING id, student_id, workout_id, session_id, execution_time, rest_time, thumbnail, time_total_workout, exercise_title, exercise_id, created_at, updated_at`
+
+func (q *Queries) CreateWorkoutHistory(ctx context.Context, arg CreateWorkoutHistoryParams) (*WorkoutsHistory, error) {
+	row := q.db.QueryRow(ctx, createWorkoutHistory,
+		arg.ID,
+		arg.StudentID,
+		arg.WorkoutID,
+		arg.SessionID,
+		arg.ExecutionTime,
+		arg.RestTime,
+		arg.Thumbnail,
+		arg.TimeTotalWorkout,
+		arg.ExerciseTitle,
+		arg.ExerciseID,
+		arg.CreatedAt,
+		arg.UpdatedAt,
+	)
+
+	var i WorkoutsHistory
+	err := row.Scan(
+		&i.ID,
+		&i.StudentID,
+		&i.WorkoutID,
+		&i.SessionID,
+		&i.ExecutionTime,
+		&i.RestTime,
+		&i.Thumbnail,
+		&i.TimeTotalWorkout,
+		&i.ExerciseTitle,
+		&i.ExerciseID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const createWorkoutSet = `-- name: CreateWorkoutSet :one
+INSERT INTO workout_set (
+  id, session_id, history_id, exercise_id, set_index, reps, load_kg, rpe, rir, to_failure, is_warmup, created_at
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
+)
+RETURNING id, session_id, history_id, exercise_id, set_index, reps, load_kg, rpe, rir, to_failure, is_warmup, created_at`
+
+func (q *Queries) CreateWorkoutSet(ctx context.Context, arg CreateWorkoutSetParams) (*WorkoutSet, error) {
+	row := q.db.QueryRow(ctx, createWorkoutSet,
+		arg.ID,
+		arg.SessionID,
+		arg.HistoryID,
+		arg.ExerciseID,
+		arg.SetIndex,
+		arg.Reps,
+		arg.LoadKg,
+		arg.RPE,
+		arg.RIR,
+		arg.ToFailure,
+		arg.IsWarmup,
+		arg.CreatedAt,
+	)
+
+	var i WorkoutSet
+	err := row.Scan(
+		&i.ID,
+		&i.SessionID,
+		&i.HistoryID,
+		&i.ExerciseID,
+		&i.SetIndex,
+		&i.Reps,
+		&i.LoadKg,
+		&i.RPE,
+		&i.RIR,
+		&i.ToFailure,
+		&i.IsWarmup,
+		&i.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+const getFinishedWorkoutSessions = `-- name: GetFinishedWorkoutSessions :many
+SELECT ws.id, ws.workout_id, w.name AS workout_name, ws.started_at, ws.finished_at, ws.duration, ws.notes
+FROM workout_session ws
+JOIN workout w ON w.id = ws.workout_id
+WHERE ws.student_id = $1 AND ws.finished_at IS NOT NULL
+ORDER BY ws.finished_at DESC`
+
+func (q *Queries) GetFinishedWorkoutSessions(ctx context.Context, studentID uuid.UUID) ([]GetFinishedWorkoutSessionsRow, error) {
+	var sessions []GetFinishedWorkoutSessionsRow
+	err := pgxscan.Select(ctx, q.db, &sessions, getFinishedWorkoutSessions, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+const getWorkoutHistoryByStudent = `-- name: GetWorkoutHistoryByStudent :many
+SELECT id, student_id, workout_id, session_id, execution_time, rest_time, thumbnail, time_total_workout, exercise_title, exercise_id, created_at, updated_at
+FROM workouts_history
+WHERE student_id = $1
+ORDER BY created_at DESC, exercise_title`
+
+func (q *Queries) GetWorkoutHistoryByStudent(ctx context.Context, studentID uuid.UUID) ([]WorkoutsHistory, error) {
+	var history []WorkoutsHistory
+	err := pgxscan.Select(ctx, q.db, &history, getWorkoutHistoryByStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+const getWorkoutSetsByStudent = `-- name: GetWorkoutSetsByStudent :many
+SELECT s.id, s.session_id, s.history_id, s.exercise_id, s.set_index, s.reps, s.load_kg, s.rpe, s.rir, s.to_failure, s.is_warmup, s.created_at
+FROM workout_set s
+JOIN workout_session ws ON ws.id = s.session_id
+WHERE ws.student_id = $1
+ORDER BY s.history_id, s.set_index`
+
+func (q *Queries) GetWorkoutSetsByStudent(ctx context.Context, studentID uuid.UUID) ([]WorkoutSet, error) {
+	var sets []WorkoutSet
+	err := pgxscan.Select(ctx, q.db, &sets, getWorkoutSetsByStudent, studentID)
+	if err != nil {
+		return nil, err
+	}
+	return sets, nil
+}
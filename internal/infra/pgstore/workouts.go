@@ -6,7 +6,6 @@ import (
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5"
 	"github.com/lib/pq"
 )
 
@@ -45,8 +44,7 @@ type UpdateWorkoutParams struct {
 }
 
 type GetWorkoutByIdParams struct {
-	ID         uuid.UUID  `json:"id" db:"id" validate:"required"`
-	PersonalID *uuid.UUID `json:"personalId,omitempty" db:"personal_id"`
+	ID uuid.UUID `json:"id" db:"id" validate:"required"`
 }
 
 type DeleteWorkoutParams struct {
@@ -200,15 +198,18 @@ SELECT id, name, description, thumbnail, video_url, rest_time_between_exercises,
 FROM workout 
 WHERE id = $1 AND deleted_at IS NULL`
 
-func (q *Queries) GetWorkoutById(ctx context.Context, workoutID uuid.UUID) (*GetWorkoutByIdRow, error) {
-	var workout *GetWorkoutByIdRow
+func (q *Queries) GetWorkoutById(ctx context.Context, arg GetWorkoutByIdParams) (*GetWorkoutByIdRow, error) {
+	var workout GetWorkoutByIdRow
 
-	err := pgxscan.Get(ctx, q.db, &workout, getWorkouts, workoutID)
+	err := pgxscan.Get(ctx, q.db, &workout, getWorkoutById, arg.ID)
 	if err != nil {
+		if pgxscan.NotFound(err) {
+			return nil, nil
+		}
 		return nil, err
 	}
 
-	return workout, nil
+	return &workout, nil
 }
 
 const updateWorkout = `-- name: UpdateWorkout :one
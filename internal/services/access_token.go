@@ -0,0 +1,251 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// Access token signing algorithms, as named in the JWT "alg" header
+const (
+	AccessTokenHS256 = "HS256"
+	AccessTokenEdDSA = "EdDSA"
+)
+
+// AccessTokenKey is a key access tokens are signed or verified with. HS256
+// keys use Secret, EdDSA keys the Ed25519 PrivateKey.
+type AccessTokenKey struct {
+	ID         string
+	Algorithm  string
+	Secret     []byte
+	PrivateKey ed25519.PrivateKey
+}
+
+// AccessTokenConfig holds the keys of the access tokens. Tokens are signed
+// with the SigningKeyID key and verified with the key named by their "kid"
+// header, so a retired key is kept in Keys until the tokens it signed expire.
+type AccessTokenConfig struct {
+	Issuer       string
+	Lifetime     time.Duration
+	SigningKeyID string
+	Keys         []AccessTokenKey
+}
+
+// AccessTokenClaims is what an access token carries. SessionID is the refresh
+// token family the token was issued to.
+type AccessTokenClaims struct {
+	Issuer    string       `json:"iss"`
+	Subject   string       `json:"sub"`
+	Role      pgstore.Role `json:"role"`
+	SessionID string       `json:"sid,omitempty"`
+	IssuedAt  int64        `json:"iat"`
+	ExpiresAt int64        `json:"exp"`
+}
+
+// UserID returns the user the token was issued to
+func (c *AccessTokenClaims) UserID() (uuid.UUID, error) {
+	return uuid.Parse(c.Subject)
+}
+
+type accessTokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+// AccessTokens signs and verifies the short-lived JWTs bearer clients
+// authenticate with. They are stateless: revoking a session stops its refresh
+// token, and its access tokens run out within Lifetime.
+type AccessTokens struct {
+	config     AccessTokenConfig
+	keys       map[string]AccessTokenKey
+	signingKey AccessTokenKey
+}
+
+func NewAccessTokens(config AccessTokenConfig) (*AccessTokens, error) {
+	if config.Lifetime <= 0 {
+		return nil, errors.New("access token lifetime must be positive")
+	}
+
+	keys := make(map[string]AccessTokenKey, len(config.Keys))
+	for _, key := range config.Keys {
+		if key.ID == "" {
+			return nil, errors.New("access token key ID is required")
+		}
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate access token key %q", key.ID)
+		}
+
+		switch key.Algorithm {
+		case AccessTokenHS256:
+			if len(key.Secret) < 32 {
+				return nil, fmt.Errorf("access token key %q must have at least 32 bytes", key.ID)
+			}
+		case AccessTokenEdDSA:
+			if len(key.PrivateKey) != ed25519.PrivateKeySize {
+				return nil, fmt.Errorf("access token key %q is not an Ed25519 private key", key.ID)
+			}
+		default:
+			return nil, fmt.Errorf("access token key %q has unsupported algorithm %q", key.ID, key.Algorithm)
+		}
+		keys[key.ID] = key
+	}
+
+	signingKey, ok := keys[config.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("access token signing key %q is not configured", config.SigningKeyID)
+	}
+
+	return &AccessTokens{
+		config:     config,
+		keys:       keys,
+		signingKey: signingKey,
+	}, nil
+}
+
+// Lifetime is how long an access token is valid after it is issued
+func (t *AccessTokens) Lifetime() time.Duration {
+	return t.config.Lifetime
+}
+
+// Issue signs an access token for the user
+func (t *AccessTokens) Issue(userID uuid.UUID, role pgstore.Role, sessionID uuid.UUID, now time.Time) (string, error) {
+	header, err := json.Marshal(accessTokenHeader{
+		Algorithm: t.signingKey.Algorithm,
+		Type:      "JWT",
+		KeyID:     t.signingKey.ID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(AccessTokenClaims{
+		Issuer:    t.config.Issuer,
+		Subject:   userID.String(),
+		Role:      role,
+		SessionID: sessionID.String(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(t.config.Lifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signAccessToken(t.signingKey, signingInput)), nil
+}
+
+// Verify checks the signature, issuer and expiry of an access token and
+// returns its claims
+func (t *AccessTokens) Verify(token string, now time.Time) (*AccessTokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed access token", utils.ErrUnauthorized)
+	}
+
+	var header accessTokenHeader
+	if err := decodeTokenSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed access token header", utils.ErrUnauthorized)
+	}
+
+	// The algorithm is the key's, never the one the token claims
+	key, ok := t.keys[header.KeyID]
+	if !ok || header.Algorithm != key.Algorithm {
+		return nil, fmt.Errorf("%w: unknown access token key", utils.ErrUnauthorized)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !verifyAccessToken(key, parts[0]+"."+parts[1], signature) {
+		return nil, fmt.Errorf("%w: invalid access token signature", utils.ErrUnauthorized)
+	}
+
+	var claims AccessTokenClaims
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed access token claims", utils.ErrUnauthorized)
+	}
+	if claims.Issuer != t.config.Issuer {
+		return nil, fmt.Errorf("%w: access token has the wrong issuer", utils.ErrUnauthorized)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: access token expired", utils.ErrUnauthorized)
+	}
+
+	return &claims, nil
+}
+
+// ParseAccessTokenKeys reads a comma-separated list of kid:algorithm:key
+// entries, where the key is the base64 HS256 secret or Ed25519 seed
+func ParseAccessTokenKeys(spec string) ([]AccessTokenKey, error) {
+	var keys []AccessTokenKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, rest, ok := strings.Cut(entry, ":")
+		if !ok {
+			return nil, fmt.Errorf("access token key %q must be kid:algorithm:key", entry)
+		}
+		algorithm, encoded, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("access token key %q must be kid:algorithm:key", id)
+		}
+
+		material, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("access token key %q is not valid base64: %w", id, err)
+		}
+
+		key := AccessTokenKey{ID: id, Algorithm: algorithm}
+		switch algorithm {
+		case AccessTokenHS256:
+			key.Secret = material
+		case AccessTokenEdDSA:
+			if len(material) != ed25519.SeedSize {
+				return nil, fmt.Errorf("access token key %q must be a %d byte Ed25519 seed", id, ed25519.SeedSize)
+			}
+			key.PrivateKey = ed25519.NewKeyFromSeed(material)
+		default:
+			return nil, fmt.Errorf("access token key %q has unsupported algorithm %q", id, algorithm)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func signAccessToken(key AccessTokenKey, signingInput string) []byte {
+	if key.Algorithm == AccessTokenEdDSA {
+		return ed25519.Sign(key.PrivateKey, []byte(signingInput))
+	}
+
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+func verifyAccessToken(key AccessTokenKey, signingInput string, signature []byte) bool {
+	if key.Algorithm == AccessTokenEdDSA {
+		publicKey := key.PrivateKey.Public().(ed25519.PublicKey)
+		return ed25519.Verify(publicKey, []byte(signingInput), signature)
+	}
+	return hmac.Equal(signAccessToken(key, signingInput), signature)
+}
+
+func decodeTokenSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// signTestAccessToken builds a token with the header and claims, signed with
+// the key whatever the header says
+func signTestAccessToken(t *testing.T, key AccessTokenKey, header accessTokenHeader, claims AccessTokenClaims) string {
+	t.Helper()
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signAccessToken(key, signingInput))
+}
+
+func TestAccessTokensVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hsKey := AccessTokenKey{ID: "hs", Algorithm: AccessTokenHS256, Secret: []byte(strings.Repeat("h", 32))}
+	edKey := AccessTokenKey{ID: "ed", Algorithm: AccessTokenEdDSA, PrivateKey: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))}
+	otherKey := AccessTokenKey{ID: "hs", Algorithm: AccessTokenHS256, Secret: []byte(strings.Repeat("o", 32))}
+
+	tokens, err := NewAccessTokens(AccessTokenConfig{
+		Issuer:       "pandoragym",
+		Lifetime:     15 * time.Minute,
+		SigningKeyID: "hs",
+		Keys:         []AccessTokenKey{hsKey, edKey},
+	})
+	if err != nil {
+		t.Fatalf("NewAccessTokens() error = %v", err)
+	}
+
+	claims := AccessTokenClaims{
+		Issuer:    "pandoragym",
+		Subject:   uuid.NewString(),
+		Role:      pgstore.RoleStudent,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(15 * time.Minute).Unix(),
+	}
+	wrongIssuer := claims
+	wrongIssuer.Issuer = "someone-else"
+
+	issued, err := tokens.Issue(uuid.New(), pgstore.RoleStudent, uuid.New(), now)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	parts := strings.Split(issued, ".")
+	tamperedSignature := parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(make([]byte, 32))
+
+	tests := []struct {
+		name    string
+		token   string
+		now     time.Time
+		wantErr bool
+	}{
+		{"issued token", issued, now, false},
+		{"signed with other listed key", signTestAccessToken(t, edKey, accessTokenHeader{Algorithm: AccessTokenEdDSA, Type: "JWT", KeyID: "ed"}, claims), now, false},
+		{"unknown kid", signTestAccessToken(t, hsKey, accessTokenHeader{Algorithm: AccessTokenHS256, Type: "JWT", KeyID: "gone"}, claims), now, true},
+		{"missing kid", signTestAccessToken(t, hsKey, accessTokenHeader{Algorithm: AccessTokenHS256, Type: "JWT"}, claims), now, true},
+		{"alg does not match key", signTestAccessToken(t, hsKey, accessTokenHeader{Algorithm: AccessTokenHS256, Type: "JWT", KeyID: "ed"}, claims), now, true},
+		{"alg none", signTestAccessToken(t, hsKey, accessTokenHeader{Algorithm: "none", Type: "JWT", KeyID: "hs"}, claims), now, true},
+		{"bad signature", tamperedSignature, now, true},
+		{"signed with other secret", signTestAccessToken(t, otherKey, accessTokenHeader{Algorithm: AccessTokenHS256, Type: "JWT", KeyID: "hs"}, claims), now, true},
+		{"wrong issuer", signTestAccessToken(t, hsKey, accessTokenHeader{Algorithm: AccessTokenHS256, Type: "JWT", KeyID: "hs"}, wrongIssuer), now, true},
+		{"just before expiry", issued, now.Add(15*time.Minute - time.Second), false},
+		{"expired", issued, now.Add(15 * time.Minute), true},
+		{"malformed", "not-a-token", now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tokens.Verify(tt.token, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, utils.ErrUnauthorized) {
+				t.Errorf("Verify() error = %v, want %v", err, utils.ErrUnauthorized)
+			}
+		})
+	}
+}
+
+func TestAccessTokensVerifyAfterKeyRotation(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	oldKey := AccessTokenKey{ID: "2024", Algorithm: AccessTokenHS256, Secret: []byte(strings.Repeat("a", 32))}
+	newKey := AccessTokenKey{ID: "2025", Algorithm: AccessTokenEdDSA, PrivateKey: ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))}
+
+	before, err := NewAccessTokens(AccessTokenConfig{Issuer: "pandoragym", Lifetime: time.Hour, SigningKeyID: "2024", Keys: []AccessTokenKey{oldKey}})
+	if err != nil {
+		t.Fatalf("NewAccessTokens() error = %v", err)
+	}
+	userID := uuid.New()
+	oldToken, err := before.Issue(userID, pgstore.RolePersonal, uuid.New(), now)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+
+	// The new key signs, and the retired one stays listed until its tokens expire
+	after, err := NewAccessTokens(AccessTokenConfig{Issuer: "pandoragym", Lifetime: time.Hour, SigningKeyID: "2025", Keys: []AccessTokenKey{oldKey, newKey}})
+	if err != nil {
+		t.Fatalf("NewAccessTokens() error = %v", err)
+	}
+	claims, err := after.Verify(oldToken, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Verify() of a token signed with the retired key error = %v", err)
+	}
+	if claims.Subject != userID.String() || claims.Role != pgstore.RolePersonal {
+		t.Errorf("claims = %s/%s, want %s/%s", claims.Subject, claims.Role, userID, pgstore.RolePersonal)
+	}
+
+	newToken, err := after.Issue(userID, pgstore.RolePersonal, uuid.New(), now)
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	if _, err := after.Verify(newToken, now); err != nil {
+		t.Errorf("Verify() of a token signed with the new key error = %v", err)
+	}
+	if _, err := before.Verify(newToken, now); err == nil {
+		t.Error("Verify() without the new key accepted its token")
+	}
+
+	// Once the retired key is dropped its tokens stop working
+	dropped, err := NewAccessTokens(AccessTokenConfig{Issuer: "pandoragym", Lifetime: time.Hour, SigningKeyID: "2025", Keys: []AccessTokenKey{newKey}})
+	if err != nil {
+		t.Fatalf("NewAccessTokens() error = %v", err)
+	}
+	if _, err := dropped.Verify(oldToken, now.Add(time.Minute)); err == nil {
+		t.Error("Verify() accepted a token of a dropped key")
+	}
+}
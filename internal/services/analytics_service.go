@@ -3,77 +3,259 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
 type AnalyticsService struct {
 	queries *pgstore.Queries
+	// location is the timezone whose calendar days workouts are counted in
+	location *time.Location
 }
 
-func NewAnalyticsService(queries *pgstore.Queries) *AnalyticsService {
+func NewAnalyticsService(queries *pgstore.Queries, location *time.Location) *AnalyticsService {
 	return &AnalyticsService{
-		queries: queries,
+		queries:  queries,
+		location: location,
 	}
 }
 
+// analyticsDateLayout is the format of the start and end date query params
+const analyticsDateLayout = "2006-01-02"
+
+// GetWorkoutFrequency summarises the finished workout sessions of a student
+// between the optional start and end dates (both inclusive)
 func (s *AnalyticsService) GetWorkoutFrequency(ctx context.Context, userID uuid.UUID, startDate, endDate string) (*pgstore.WorkoutFrequencyResponse, error) {
-	return &pgstore.WorkoutFrequencyResponse{
-		TotalWorkouts:   15,
-		AveragePerWeek:  3.5,
-		MostActiveDay:   "Monday",
-		LongestStreak:   7,
-		CurrentStreak:   3,
-		TotalDuration:   900,
-		AverageDuration: 60.0,
-	}, nil
+	from, to, err := parseDateRange(startDate, endDate, s.location)
+	if err != nil {
+		return nil, err
+	}
+
+	days, err := s.queries.GetWorkoutDays(ctx, pgstore.GetWorkoutDaysParams{
+		StudentID: userID,
+		From:      from,
+		To:        to,
+		TimeZone:  s.location.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workout days: %w", err)
+	}
+
+	response := &pgstore.WorkoutFrequencyResponse{}
+	if len(days) == 0 {
+		return response, nil
+	}
+
+	var weekdayCounts [7]int64
+	var totalWorkouts, totalDuration int64
+	for _, day := range days {
+		totalWorkouts += day.WorkoutCount
+		totalDuration += day.TotalDuration
+		weekdayCounts[day.Day.In(s.location).Weekday()] += day.WorkoutCount
+	}
+
+	mostActive := time.Sunday
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if weekdayCounts[weekday] > weekdayCounts[mostActive] {
+			mostActive = weekday
+		}
+	}
+
+	// The week average covers the requested range, or the span between the
+	// first workout and today when no range is given
+	today := truncateToDay(time.Now(), s.location)
+	periodStart := truncateToDay(days[0].Day, s.location)
+	if from != nil {
+		periodStart = truncateToDay(*from, s.location)
+	}
+	periodEnd := today
+	if to != nil && to.Before(today) {
+		periodEnd = truncateToDay(to.AddDate(0, 0, -1), s.location)
+	}
+	weeks := (periodEnd.Sub(periodStart).Hours()/24 + 1) / 7
+	if weeks < 1 {
+		weeks = 1
+	}
+
+	longest, current := workoutStreaks(days, periodEnd, s.location)
+
+	response.TotalWorkouts = int32(totalWorkouts)
+	response.AveragePerWeek = float64(totalWorkouts) / weeks
+	response.MostActiveDay = mostActive.String()
+	response.LongestStreak = longest
+	response.CurrentStreak = current
+	response.TotalDuration = int32(totalDuration)
+	response.AverageDuration = float64(totalDuration) / float64(totalWorkouts)
+
+	return response, nil
 }
 
-func (s *AnalyticsService) GetWorkoutHistoryExercises(ctx context.Context, userID uuid.UUID) ([]pgstore.WorkoutHistoryExerciseResponse, error) {
-	return []pgstore.WorkoutHistoryExerciseResponse{
-		{
-			WorkoutHistoryID: uuid.New(),
-			WorkoutName:      "Push Day",
-			ExerciseName:     "Bench Press",
-			Sets:             3,
-			Reps:             10,
-			Weight:           &[]float64{80.0}[0],
-			Duration:         45,
-			RestTime:         &[]int32{90}[0],
-			CompletedAt:      time.Now().AddDate(0, 0, -1),
-		},
-	}, nil
+// GetWorkoutHistoryExercises lists the exercises performed by a student
+// between the optional start and end dates, most recent first
+func (s *AnalyticsService) GetWorkoutHistoryExercises(ctx context.Context, userID uuid.UUID, startDate, endDate string) ([]pgstore.WorkoutHistoryExerciseResponse, error) {
+	from, to, err := parseDateRange(startDate, endDate, s.location)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.queries.GetExerciseHistory(ctx, pgstore.GetExerciseHistoryParams{
+		StudentID: userID,
+		From:      from,
+		To:        to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exercise history: %w", err)
+	}
+
+	history := make([]pgstore.WorkoutHistoryExerciseResponse, 0, len(rows))
+	for _, row := range rows {
+		history = append(history, pgstore.WorkoutHistoryExerciseResponse{
+			WorkoutHistoryID: row.WorkoutHistoryID,
+			ExerciseID:       row.ExerciseID,
+			WorkoutName:      row.WorkoutName,
+			ExerciseName:     row.ExerciseName,
+			Sets:             int32(row.Sets),
+			Reps:             int32(row.Reps),
+			Weight:           row.MaxLoad,
+			Duration:         row.Duration,
+			RestTime:         row.RestTime,
+			CompletedAt:      row.CompletedAt,
+		})
+	}
+
+	return history, nil
 }
 
-func (s *AnalyticsService) GetExercisePerformanceComparison(ctx context.Context, userID, exerciseID uuid.UUID) (*pgstore.ExercisePerformanceResponse, error) {
-	return &pgstore.ExercisePerformanceResponse{
-		ExerciseName:      "Bench Press",
-		TotalSessions:     12,
-		MaxWeight:         &[]float64{85.0}[0],
-		MaxReps:           12,
-		MaxVolume:         1020.0,
-		AverageWeight:     &[]float64{75.0}[0],
-		AverageReps:       10.5,
-		AverageVolume:     787.5,
-		FirstRecorded:     time.Now().AddDate(0, -2, 0),
-		LastRecorded:      time.Now().AddDate(0, 0, -1),
-		ProgressData: []pgstore.ExerciseProgressPoint{
-			{
-				Date:   time.Now().AddDate(0, 0, -7),
-				Weight: &[]float64{70.0}[0],
-				Reps:   10,
-				Volume: 700.0,
-			},
-			{
-				Date:   time.Now().AddDate(0, 0, -1),
-				Weight: &[]float64{75.0}[0],
-				Reps:   10,
-				Volume: 750.0,
-			},
-		},
-	}, nil
+// GetExercisePerformanceComparison computes load, reps, volume and estimated
+// one-rep max of an exercise per session between the optional start and end
+// dates. Warmup sets are ignored.
+func (s *AnalyticsService) GetExercisePerformanceComparison(ctx context.Context, userID, exerciseID uuid.UUID, startDate, endDate, formula string) (*pgstore.ExercisePerformanceResponse, error) {
+	from, to, err := parseDateRange(startDate, endDate, s.location)
+	if err != nil {
+		return nil, err
+	}
+
+	oneRepMaxFormula, err := parseOneRepMaxFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+
+	sets, err := s.queries.GetWorkingSets(ctx, pgstore.GetWorkingSetsParams{
+		StudentID:  userID,
+		ExerciseID: &exerciseID,
+		From:       from,
+		To:         to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exercise sets: %w", err)
+	}
+
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("%w: no sets recorded for exercise %s", utils.ErrNotFound, exerciseID)
+	}
+
+	response := &pgstore.ExercisePerformanceResponse{
+		ExerciseName:  sets[len(sets)-1].ExerciseName,
+		FirstRecorded: sets[0].PerformedAt,
+		LastRecorded:  sets[len(sets)-1].PerformedAt,
+		ProgressData:  []pgstore.ExerciseProgressPoint{},
+		Formula:       oneRepMaxFormula,
+	}
+
+	var maxLoad, maxOneRepMax, totalLoad, totalVolume float64
+	var totalReps, loadedSets int64
+	var point *pgstore.ExerciseProgressPoint
+	var pointSession uuid.UUID
+	for _, set := range sets {
+		if point == nil || set.SessionID != pointSession {
+			response.ProgressData = append(response.ProgressData, pgstore.ExerciseProgressPoint{Date: set.PerformedAt})
+			point = &response.ProgressData[len(response.ProgressData)-1]
+			pointSession = set.SessionID
+		}
+
+		volume := float64(set.Reps) * set.LoadKg
+		point.Reps += set.Reps
+		point.Volume += volume
+		if set.LoadKg > 0 && (point.Weight == nil || set.LoadKg > *point.Weight) {
+			load := set.LoadKg
+			point.Weight = &load
+		}
+		if oneRepMax, ok := estimateOneRepMax(oneRepMaxFormula, set.LoadKg, set.Reps); ok {
+			if point.EstimatedOneRepMax == nil || oneRepMax > *point.EstimatedOneRepMax {
+				point.EstimatedOneRepMax = &oneRepMax
+			}
+			maxOneRepMax = max(maxOneRepMax, oneRepMax)
+		}
+
+		maxLoad = max(maxLoad, set.LoadKg)
+		response.MaxReps = max(response.MaxReps, set.Reps)
+		if set.LoadKg > 0 {
+			totalLoad += set.LoadKg
+			loadedSets++
+		}
+		totalReps += int64(set.Reps)
+		totalVolume += volume
+	}
+
+	for _, progress := range response.ProgressData {
+		response.MaxVolume = max(response.MaxVolume, progress.Volume)
+	}
+
+	// Loads are only reported for exercises performed with weight, and
+	// bodyweight sets don't count towards the average
+	if maxLoad > 0 {
+		averageLoad := totalLoad / float64(loadedSets)
+		response.MaxWeight = &maxLoad
+		response.AverageWeight = &averageLoad
+	}
+	if maxOneRepMax > 0 {
+		response.MaxEstimatedOneRepMax = &maxOneRepMax
+	}
+	response.TotalSessions = int32(len(response.ProgressData))
+	response.AverageReps = float64(totalReps) / float64(len(sets))
+	response.AverageVolume = totalVolume / float64(len(response.ProgressData))
+
+	return response, nil
+}
+
+// GetPersonalRecords lists the current personal records of a student per
+// exercise, optionally restricted to one exercise
+func (s *AnalyticsService) GetPersonalRecords(ctx context.Context, userID uuid.UUID, exerciseID *uuid.UUID, formula string) ([]pgstore.ExerciseRecordsResponse, error) {
+	oneRepMaxFormula, err := parseOneRepMaxFormula(formula)
+	if err != nil {
+		return nil, err
+	}
+
+	sets, err := s.queries.GetWorkingSets(ctx, pgstore.GetWorkingSetsParams{
+		StudentID:  userID,
+		ExerciseID: exerciseID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get working sets: %w", err)
+	}
+
+	exercises := computePersonalRecords(sets, oneRepMaxFormula)
+
+	response := make([]pgstore.ExerciseRecordsResponse, 0, len(exercises))
+	for _, exercise := range exercises {
+		response = append(response, pgstore.ExerciseRecordsResponse{
+			ExerciseID:   exercise.exerciseID,
+			ExerciseName: exercise.exerciseName,
+			Records:      exercise.list(),
+		})
+	}
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].ExerciseName < response[j].ExerciseName
+	})
+
+	return response, nil
 }
 
 func (s *AnalyticsService) GetUserStatistics(ctx context.Context, userID uuid.UUID) (*pgstore.UserStatisticsResponse, error) {
@@ -105,25 +287,32 @@ func (s *AnalyticsService) GetPlatformStatistics(ctx context.Context) (*pgstore.
 		TotalSchedulings:     3500,
 		CompletedSchedulings: 3200,
 		SchedulingsThisMonth: 280,
-		Revenue:              125000.50,
-		RevenueThisMonth:     8500.75,
+		Revenue:              pgstore.NewMoney(12500050),
+		RevenueThisMonth:     pgstore.NewMoney(850075),
 	}, nil
 }
 
+// GetReports builds a platform report between the start and end dates (both
+// inclusive), the last 30 days by default
 func (s *AnalyticsService) GetReports(ctx context.Context, reportType, startDate, endDate string) (interface{}, error) {
+	start, end, err := revenueDateRange(startDate, endDate, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	switch reportType {
 	case "users":
-		return s.getUserReport(ctx, time.Now().AddDate(0, -1, 0), time.Now())
+		return s.getUserReport(ctx, start, end)
 	case "workouts":
-		return s.getWorkoutReport(ctx, time.Now().AddDate(0, -1, 0), time.Now())
+		return s.getWorkoutReport(ctx, start, end)
 	case "schedulings":
-		return s.getSchedulingReport(ctx, time.Now().AddDate(0, -1, 0), time.Now())
+		return s.getSchedulingReport(ctx, start, end)
 	case "revenue":
-		return s.getRevenueReport(ctx, time.Now().AddDate(0, -1, 0), time.Now())
+		return s.getRevenueReport(ctx, start, end)
 	case "trainers":
-		return s.getTrainerReport(ctx, time.Now().AddDate(0, -1, 0), time.Now())
+		return s.getTrainerReport(ctx, start, end)
 	default:
-		return nil, fmt.Errorf("invalid report type: %s", reportType)
+		return nil, fmt.Errorf("%w: invalid report type: %s", utils.ErrBadRequest, reportType)
 	}
 }
 
@@ -184,22 +373,52 @@ func (s *AnalyticsService) getSchedulingReport(ctx context.Context, start, end t
 	}, nil
 }
 
+// getRevenueReport sums the revenue ledger of every trainer over [start, end)
+// with daily buckets. The average is per day and the growth compares the
+// revenue with that of the period of the same length just before.
 func (s *AnalyticsService) getRevenueReport(ctx context.Context, start, end time.Time) (*pgstore.RevenueReportResponse, error) {
-	return &pgstore.RevenueReportResponse{
-		TotalRevenue:   8500.75,
-		AverageRevenue: 283.36,
-		RevenueGrowth:  12.5,
-		DailyRevenueData: []pgstore.DailyRevenueData{
-			{
-				Date:    time.Now().AddDate(0, 0, -7),
-				Revenue: 450.25,
-			},
-			{
-				Date:    time.Now().AddDate(0, 0, -1),
-				Revenue: 320.50,
-			},
-		},
-	}, nil
+	totals, err := s.queries.GetRevenueTotals(ctx, pgstore.GetRevenueTotalsParams{
+		From: &start,
+		To:   &end,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revenue: %w", err)
+	}
+
+	previousStart := start.Add(-end.Sub(start))
+	previous, err := s.queries.GetRevenueTotals(ctx, pgstore.GetRevenueTotalsParams{
+		From: &previousStart,
+		To:   &start,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revenue: %w", err)
+	}
+
+	days, err := s.queries.GetDailyRevenue(ctx, pgstore.GetDailyRevenueParams{
+		From: start,
+		To:   end,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily revenue: %w", err)
+	}
+
+	revenue := totals.Charges.Sub(totals.Refunds)
+	response := &pgstore.RevenueReportResponse{
+		StartDate:        start,
+		EndDate:          end.AddDate(0, 0, -1),
+		TotalRevenue:     revenue,
+		Refunds:          totals.Refunds,
+		PlatformFees:     totals.PlatformFees,
+		DailyRevenueData: toDailyRevenueData(days),
+	}
+	if len(days) > 0 {
+		response.AverageRevenue = revenue.Div(int64(len(days)))
+	}
+	if previousRevenue := previous.Charges.Sub(previous.Refunds); previousRevenue.Amount > 0 {
+		response.RevenueGrowth = math.Round(float64(revenue.Amount-previousRevenue.Amount)/float64(previousRevenue.Amount)*10000) / 100
+	}
+
+	return response, nil
 }
 
 func (s *AnalyticsService) getTrainerReport(ctx context.Context, start, end time.Time) (*pgstore.TrainerReportResponse, error) {
@@ -214,14 +433,14 @@ func (s *AnalyticsService) getTrainerReport(ctx context.Context, start, end time
 				TotalSchedulings:  45,
 				CompletedSessions: 42,
 				Rating:            4.9,
-				Revenue:           2250.00,
+				Revenue:           pgstore.NewMoney(225000),
 			},
 			{
 				TrainerName:       "Sarah Johnson",
 				TotalSchedulings:  38,
 				CompletedSessions: 36,
 				Rating:            4.8,
-				Revenue:           1900.00,
+				Revenue:           pgstore.NewMoney(190000),
 			},
 		},
 	}, nil
@@ -286,3 +505,276 @@ func (s *AnalyticsService) GetMuscleGroupAnalysis(ctx context.Context, userID uu
 		},
 	}, nil
 }
+
+// parseDateRange parses the optional start and end dates of an analytics
+// query as days of loc. The end date is inclusive, so the returned upper
+// bound is the start of the following day.
+func parseDateRange(startDate, endDate string, loc *time.Location) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+
+	if startDate != "" {
+		start, err := time.ParseInLocation(analyticsDateLayout, startDate, loc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: start date must use the YYYY-MM-DD format", utils.ErrBadRequest)
+		}
+		from = &start
+	}
+
+	if endDate != "" {
+		end, err := time.ParseInLocation(analyticsDateLayout, endDate, loc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: end date must use the YYYY-MM-DD format", utils.ErrBadRequest)
+		}
+		end = end.AddDate(0, 0, 1)
+		to = &end
+	}
+
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, fmt.Errorf("%w: start date must not be after end date", utils.ErrBadRequest)
+	}
+
+	return from, to, nil
+}
+
+// workoutStreaks returns the longest run of consecutive workout days and the
+// run that ends on the reference day or the day before it
+func workoutStreaks(days []pgstore.GetWorkoutDaysRow, reference time.Time, loc *time.Location) (int32, int32) {
+	var longest, run int32
+	var previous time.Time
+
+	for i, day := range days {
+		current := truncateToDay(day.Day, loc)
+		if i > 0 && current.Equal(previous.AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		previous = current
+	}
+
+	if previous.Before(reference.AddDate(0, 0, -1)) || previous.After(reference) {
+		return longest, 0
+	}
+
+	return longest, run
+}
+
+// truncateToDay returns the start of the day of t in loc
+func truncateToDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// parseOneRepMaxFormula reads the formula query param, defaulting to Epley
+func parseOneRepMaxFormula(formula string) (pgstore.OneRepMaxFormula, error) {
+	switch pgstore.OneRepMaxFormula(strings.ToUpper(formula)) {
+	case "", pgstore.OneRepMaxFormulaEpley:
+		return pgstore.OneRepMaxFormulaEpley, nil
+	case pgstore.OneRepMaxFormulaBrzycki:
+		return pgstore.OneRepMaxFormulaBrzycki, nil
+	default:
+		return "", fmt.Errorf("%w: unknown one-rep max formula %q", utils.ErrBadRequest, formula)
+	}
+}
+
+// estimateOneRepMax returns the estimated one-rep max of a set rounded to
+// 0.01 kg. It reports false when the set has no load or the formula is not
+// defined for its reps.
+func estimateOneRepMax(formula pgstore.OneRepMaxFormula, loadKg float64, reps int32) (float64, bool) {
+	if loadKg <= 0 || reps < 1 {
+		return 0, false
+	}
+
+	var estimate float64
+	switch {
+	case reps == 1:
+		estimate = loadKg
+	case formula == pgstore.OneRepMaxFormulaBrzycki:
+		if reps >= 37 {
+			return 0, false
+		}
+		estimate = loadKg * 36 / (37 - float64(reps))
+	default:
+		estimate = loadKg * (1 + float64(reps)/30)
+	}
+
+	return math.Round(estimate*100) / 100, true
+}
+
+// exerciseRecords holds the personal records of one exercise while its sets
+// are replayed in the order they were performed
+type exerciseRecords struct {
+	exerciseID   uuid.UUID
+	exerciseName string
+	weight       *pgstore.PersonalRecordResponse
+	volume       *pgstore.PersonalRecordResponse
+	oneRepMax    *pgstore.PersonalRecordResponse
+	// repsAtWeight keeps the best reps for each load that no heavier or
+	// equal load has matched
+	repsAtWeight []*pgstore.PersonalRecordResponse
+}
+
+// computePersonalRecords replays working sets, ordered by performance date,
+// and returns the records of each exercise
+func computePersonalRecords(sets []pgstore.GetWorkingSetsRow, formula pgstore.OneRepMaxFormula) []*exerciseRecords {
+	byExercise := make(map[uuid.UUID]*exerciseRecords)
+	var exercises []*exerciseRecords
+
+	for start := 0; start < len(sets); {
+		first := sets[start]
+
+		records, ok := byExercise[first.ExerciseID]
+		if !ok {
+			records = &exerciseRecords{exerciseID: first.ExerciseID}
+			byExercise[first.ExerciseID] = records
+			exercises = append(exercises, records)
+		}
+		records.exerciseName = first.ExerciseName
+
+		var volume float64
+		end := start
+		for ; end < len(sets) && sets[end].SessionID == first.SessionID && sets[end].ExerciseID == first.ExerciseID; end++ {
+			set := sets[end]
+			volume += float64(set.Reps) * set.LoadKg
+
+			if set.LoadKg > 0 {
+				records.weight = improveRecord(records.weight, newSetRecord(pgstore.PersonalRecordWeight, set.LoadKg, set))
+			}
+			if oneRepMax, ok := estimateOneRepMax(formula, set.LoadKg, set.Reps); ok {
+				records.oneRepMax = improveRecord(records.oneRepMax, newSetRecord(pgstore.PersonalRecordEstimatedOneRepMax, oneRepMax, set))
+			}
+			if set.Reps > 0 {
+				records.improveRepsAtWeight(newSetRecord(pgstore.PersonalRecordRepsAtWeight, float64(set.Reps), set))
+			}
+		}
+
+		if volume > 0 {
+			records.volume = improveRecord(records.volume, pgstore.PersonalRecordResponse{
+				ExerciseID:   first.ExerciseID,
+				ExerciseName: first.ExerciseName,
+				Type:         pgstore.PersonalRecordVolume,
+				Value:        volume,
+				SessionID:    first.SessionID,
+				AchievedAt:   first.PerformedAt,
+			})
+		}
+
+		start = end
+	}
+
+	return exercises
+}
+
+// newPersonalRecords returns the records improved in a session. Marks set the
+// first time an exercise is performed are not reported.
+func newPersonalRecords(sets []pgstore.GetWorkingSetsRow, formula pgstore.OneRepMaxFormula, sessionID uuid.UUID) []pgstore.PersonalRecordResponse {
+	var improved []pgstore.PersonalRecordResponse
+
+	for _, exercise := range computePersonalRecords(sets, formula) {
+		for _, record := range exercise.list() {
+			if record.SessionID == sessionID && record.PreviousValue != nil {
+				improved = append(improved, record)
+			}
+		}
+	}
+
+	return improved
+}
+
+// newSetRecord builds a record candidate from a logged set
+func newSetRecord(recordType pgstore.PersonalRecordType, value float64, set pgstore.GetWorkingSetsRow) pgstore.PersonalRecordResponse {
+	load := set.LoadKg
+	reps := set.Reps
+
+	return pgstore.PersonalRecordResponse{
+		ExerciseID:   set.ExerciseID,
+		ExerciseName: set.ExerciseName,
+		Type:         recordType,
+		Value:        value,
+		LoadKg:       &load,
+		Reps:         &reps,
+		SessionID:    set.SessionID,
+		AchievedAt:   set.PerformedAt,
+	}
+}
+
+// improveRepsAtWeight records a set when it beats the reps of every set
+// performed with the same or a heavier load
+func (r *exerciseRecords) improveRepsAtWeight(candidate pgstore.PersonalRecordResponse) {
+	var best *pgstore.PersonalRecordResponse
+	for _, record := range r.repsAtWeight {
+		if *record.LoadKg >= *candidate.LoadKg && (best == nil || record.Value > best.Value) {
+			best = record
+		}
+	}
+
+	if best != nil {
+		if candidate.Value <= best.Value {
+			return
+		}
+		candidate.PreviousValue = previousRecordValue(best, candidate.SessionID)
+	}
+
+	frontier := r.repsAtWeight[:0]
+	for _, record := range r.repsAtWeight {
+		if *record.LoadKg > *candidate.LoadKg || record.Value > candidate.Value {
+			frontier = append(frontier, record)
+		}
+	}
+	r.repsAtWeight = append(frontier, &candidate)
+}
+
+// list returns the records ordered by type, reps-at-weight from the heaviest load
+func (r *exerciseRecords) list() []pgstore.PersonalRecordResponse {
+	records := []pgstore.PersonalRecordResponse{}
+
+	if r.weight != nil {
+		records = append(records, *r.weight)
+	}
+
+	repsAtWeight := make([]pgstore.PersonalRecordResponse, 0, len(r.repsAtWeight))
+	for _, record := range r.repsAtWeight {
+		repsAtWeight = append(repsAtWeight, *record)
+	}
+	sort.Slice(repsAtWeight, func(i, j int) bool {
+		return *repsAtWeight[i].LoadKg > *repsAtWeight[j].LoadKg
+	})
+	records = append(records, repsAtWeight...)
+
+	if r.volume != nil {
+		records = append(records, *r.volume)
+	}
+	if r.oneRepMax != nil {
+		records = append(records, *r.oneRepMax)
+	}
+
+	return records
+}
+
+// improveRecord returns the candidate when it beats the current record
+func improveRecord(current *pgstore.PersonalRecordResponse, candidate pgstore.PersonalRecordResponse) *pgstore.PersonalRecordResponse {
+	if current == nil {
+		return &candidate
+	}
+	if candidate.Value <= current.Value {
+		return current
+	}
+
+	candidate.PreviousValue = previousRecordValue(current, candidate.SessionID)
+	return &candidate
+}
+
+// previousRecordValue is the mark a new record improves on. Improvements made
+// within the same session keep the value from before the session, so the
+// session reports a single improvement per record.
+func previousRecordValue(current *pgstore.PersonalRecordResponse, sessionID uuid.UUID) *float64 {
+	if current.SessionID == sessionID {
+		return current.PreviousValue
+	}
+
+	previous := current.Value
+	return &previous
+}
@@ -3,19 +3,53 @@ package services
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/alexedwards/scs/v2"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// refreshTokenLifetime is how long a refresh token can be exchanged for a
+	// new token pair
+	refreshTokenLifetime = 30 * 24 * time.Hour
+
+	// passwordResetTokenLifetime is how long a password reset link works
+	passwordResetTokenLifetime = time.Hour
+)
+
 type AuthService struct {
 	queries        *pgstore.Queries
+	pool           *pgxpool.Pool
 	sessionManager *scs.SessionManager
+	accessTokens   *AccessTokens
+	mail           *MailService
+	// tokenKey signs the links that verify emails and the tokens of pending
+	// two-factor sign ins
+	tokenKey []byte
+	// mfaKey is the AES-256 key TOTP secrets are encrypted with
+	mfaKey []byte
+}
+
+type AuthConfig struct {
+	AccessTokens *AccessTokens
+	TokenKey     []byte
+	MFAKey       []byte
+}
+
+// ClientInfo describes the device a token pair is issued to
+type ClientInfo struct {
+	DeviceInfo *string
+	IPAddress  *string
 }
 
 type SessionData struct {
@@ -25,29 +59,234 @@ type SessionData struct {
 	Name   string `json:"name"`
 }
 
-func NewAuthService(queries *pgstore.Queries, sessionManager *scs.SessionManager) *AuthService {
+func NewAuthService(queries *pgstore.Queries, pool *pgxpool.Pool, sessionManager *scs.SessionManager, mail *MailService, config AuthConfig) *AuthService {
 	return &AuthService{
 		queries:        queries,
+		pool:           pool,
 		sessionManager: sessionManager,
+		accessTokens:   config.AccessTokens,
+		mail:           mail,
+		tokenKey:       config.TokenKey,
+		mfaKey:         config.MFAKey,
 	}
 }
 
-func (s *AuthService) AuthenticateWithPassword(ctx context.Context, email, password string) (*pgstore.UserResponse, error) {
-	user, err := s.queries.GetUserByEmail(ctx, email)
+// AuthenticateWithPassword signs the user in to the request's session. Users
+// with two-factor authentication get a challenge instead, and the session
+// stays signed out until CompleteMFA gets their code.
+func (s *AuthService) AuthenticateWithPassword(ctx context.Context, email, password string, client ClientInfo) (*pgstore.UserResponse, *pgstore.MFAChallengeResponse, error) {
+	user, err := s.checkPassword(ctx, email, password, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mfaEnabled, err := s.isMFAEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := s.startMFAChallenge(ctx, user.ID)
+		return nil, challenge, err
+	}
+
+	if err := s.startSession(ctx, user.ID, user.Role, user.Email, user.Name, client); err != nil {
+		return nil, nil, err
+	}
+
+	return toAuthUserResponse(user), nil, nil
+}
+
+// AuthenticateForTokens signs the user in without a session cookie, issuing
+// an access token along with a refresh token that starts a new token family.
+// Users with two-factor authentication get a challenge instead, whose MFA
+// token CompleteMFAForTokens takes along with their code.
+func (s *AuthService) AuthenticateForTokens(ctx context.Context, email, password string, client ClientInfo) (*pgstore.AuthenticateResponse, *pgstore.MFAChallengeResponse, error) {
+	user, err := s.checkPassword(ctx, email, password, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mfaEnabled, err := s.isMFAEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mfaEnabled {
+		challenge, err := s.newMFATokenChallenge(user.ID)
+		return nil, challenge, err
+	}
+
+	tokens, err := s.issueTokenPair(ctx, toAuthUserResponse(user), client)
+	return tokens, nil, err
+}
+
+// issueTokenPair starts a new refresh token family for the user
+func (s *AuthService) issueTokenPair(ctx context.Context, user *pgstore.UserResponse, client ClientInfo) (*pgstore.AuthenticateResponse, error) {
+	now := time.Now()
+	familyID := uuid.New()
+	refreshToken := s.generateSecureToken()
+
+	_, err := s.queries.CreateRefreshToken(ctx, pgstore.CreateRefreshTokenParams{
+		UserID:     user.ID,
+		FamilyID:   familyID,
+		Token:      hashAuthToken(refreshToken),
+		ExpiresAt:  now.Add(refreshTokenLifetime),
+		DeviceInfo: client.DeviceInfo,
+		IPAddress:  client.IPAddress,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	accessToken, err := s.accessTokens.Issue(user.ID, user.Role, familyID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue access token: %w", err)
+	}
+
+	return &pgstore.AuthenticateResponse{
+		User:         *user,
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTokens.Lifetime().Seconds()),
+	}, nil
+}
+
+// VerifyAccessToken returns the claims of a valid bearer access token
+func (s *AuthService) VerifyAccessToken(token string) (*AccessTokenClaims, error) {
+	return s.accessTokens.Verify(token, time.Now())
+}
+
+// RefreshTokens swaps a refresh token for a new token pair of the same
+// family. Each refresh token is good for a single swap: presenting one that
+// was already swapped or revoked means it leaked, so the whole family is
+// revoked and its holders have to sign in again.
+func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string, client ClientInfo) (*pgstore.RefreshTokenResponse, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	current, err := txQueries.GetRefreshTokenForUpdate(ctx, hashAuthToken(refreshToken))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if current == nil {
+		return nil, fmt.Errorf("%w: invalid refresh token", utils.ErrUnauthorized)
+	}
+
+	if current.RevokedAt != nil {
+		if err := txQueries.RevokeRefreshTokenFamily(ctx, current.FamilyID); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return nil, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return nil, fmt.Errorf("%w: refresh token was already used", utils.ErrUnauthorized)
+	}
+	now := time.Now()
+	if !now.Before(current.ExpiresAt) {
+		return nil, fmt.Errorf("%w: refresh token expired", utils.ErrUnauthorized)
+	}
+
+	if err := txQueries.RevokeRefreshToken(ctx, current.Token); err != nil {
+		return nil, fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	deviceInfo := client.DeviceInfo
+	if deviceInfo == nil {
+		deviceInfo = current.DeviceInfo
+	}
+
+	nextToken := s.generateSecureToken()
+	_, err = txQueries.CreateRefreshToken(ctx, pgstore.CreateRefreshTokenParams{
+		UserID:     current.UserID,
+		FamilyID:   current.FamilyID,
+		Token:      hashAuthToken(nextToken),
+		ExpiresAt:  now.Add(refreshTokenLifetime),
+		DeviceInfo: deviceInfo,
+		IPAddress:  client.IPAddress,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	user, err := txQueries.GetUserById(ctx, pgstore.GetUserByIdParams{ID: current.UserID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	accessToken, err := s.accessTokens.Issue(user.ID, user.Role, current.FamilyID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue access token: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &pgstore.RefreshTokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: nextToken,
+		ExpiresIn:    int64(s.accessTokens.Lifetime().Seconds()),
+	}, nil
+}
+
+// RevokeRefreshToken ends the token family of a refresh token. Unknown tokens
+// are ignored, as there is nothing left to revoke.
+func (s *AuthService) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	current, err := s.queries.GetRefreshToken(ctx, hashAuthToken(refreshToken))
 	if err != nil {
-		return nil, fmt.Errorf("user not found")
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	if current == nil {
+		return nil
 	}
 
-	if !s.verifyPassword(password, user.Password) {
-		return nil, fmt.Errorf("invalid credentials")
+	if err := s.queries.RevokeRefreshTokenFamily(ctx, current.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
 	}
+	return nil
+}
 
-	s.sessionManager.Put(ctx, "user_id", user.ID.String())
-	s.sessionManager.Put(ctx, "role", string(user.Role))
-	s.sessionManager.Put(ctx, "email", user.Email)
-	s.sessionManager.Put(ctx, "name", user.Name)
+// dummyPasswordHash is compared against when there is no user with the
+// email, so those sign ins take as long as the ones with a wrong password
+const dummyPasswordHash = "$2a$10$ID8sM9JnwfJueYau3hMzyOO47S11CyYicZyxi1R3z0rGMV6f5Q3Fq"
 
-	userResponse := &pgstore.UserResponse{
+// checkPassword returns the user with the email if the password is theirs.
+// Failures are throttled per client IP and per account, and all of them are
+// reported the same way, so they don't tell which emails have an account.
+func (s *AuthService) checkPassword(ctx context.Context, email, password string, client ClientInfo) (*pgstore.GetUserByEmailRow, error) {
+	if err := s.checkLoginLock(ctx, email, client); err != nil {
+		return nil, err
+	}
+
+	user, err := s.queries.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = user.Password
+	}
+	if !s.verifyPassword(password, passwordHash) || user == nil {
+		if err := s.recordLoginFailure(ctx, email, client); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: invalid credentials", utils.ErrUnauthorized)
+	}
+
+	if err := s.recordLoginSuccess(ctx, email); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func toAuthUserResponse(user *pgstore.GetUserByEmailRow) *pgstore.UserResponse {
+	return &pgstore.UserResponse{
 		ID:        user.ID,
 		Name:      user.Name,
 		Email:     user.Email,
@@ -57,8 +296,47 @@ func (s *AuthService) AuthenticateWithPassword(ctx context.Context, email, passw
 		CreatedAt: user.CreatedAt,
 		UpdatedAt: user.UpdatedAt,
 	}
+}
+
+// startSession signs the user in to the request's session under a new token,
+// so a token handed out before signing in can't be used to take it over. The
+// client is kept to tell the user's sessions apart.
+func (s *AuthService) startSession(ctx context.Context, userID uuid.UUID, role pgstore.Role, email, name string, client ClientInfo) error {
+	previousToken := s.sessionManager.Token(ctx)
+	if err := s.sessionManager.RenewToken(ctx); err != nil {
+		return fmt.Errorf("failed to renew session token: %w", err)
+	}
+
+	now := time.Now().Unix()
+	s.sessionManager.Put(ctx, "user_id", userID.String())
+	s.sessionManager.Put(ctx, "role", string(role))
+	s.sessionManager.Put(ctx, "email", email)
+	s.sessionManager.Put(ctx, "name", name)
+	s.sessionManager.Put(ctx, "created_at", now)
+	s.sessionManager.Put(ctx, "last_seen_at", now)
+	if client.DeviceInfo != nil {
+		s.sessionManager.Put(ctx, "device_info", *client.DeviceInfo)
+	}
+	if client.IPAddress != nil {
+		s.sessionManager.Put(ctx, "ip_address", *client.IPAddress)
+	}
 
-	return userResponse, nil
+	if previousToken != "" {
+		if err := s.queries.DeleteUserSession(ctx, previousToken); err != nil {
+			return fmt.Errorf("failed to delete session index: %w", err)
+		}
+	}
+	if err := s.queries.DeleteStaleUserSessions(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete stale session index: %w", err)
+	}
+	err := s.queries.CreateUserSession(ctx, pgstore.CreateUserSessionParams{
+		Token:  s.sessionManager.Token(ctx),
+		UserID: userID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to index session: %w", err)
+	}
+	return nil
 }
 
 func (s *AuthService) GetSessionData(ctx context.Context) (*SessionData, error) {
@@ -108,6 +386,11 @@ func (s *AuthService) GetUserRoleFromSession(ctx context.Context) (string, error
 }
 
 func (s *AuthService) Logout(ctx context.Context) error {
+	if token := s.sessionManager.Token(ctx); token != "" {
+		if err := s.queries.DeleteUserSession(ctx, token); err != nil {
+			return fmt.Errorf("failed to delete session index: %w", err)
+		}
+	}
 	return s.sessionManager.Destroy(ctx)
 }
 
@@ -116,7 +399,19 @@ func (s *AuthService) RefreshSession(ctx context.Context) error {
 		return fmt.Errorf("no active session to refresh")
 	}
 
-	return s.sessionManager.RenewToken(ctx)
+	previousToken := s.sessionManager.Token(ctx)
+	if err := s.sessionManager.RenewToken(ctx); err != nil {
+		return err
+	}
+
+	err := s.queries.RenameUserSession(ctx, pgstore.RenameUserSessionParams{
+		Token:    previousToken,
+		NewToken: s.sessionManager.Token(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update session index: %w", err)
+	}
+	return nil
 }
 
 func (s *AuthService) CreateStudentWithUser(ctx context.Context, req pgstore.CreateStudentWithUserRequest) (*pgstore.UserResponse, error) {
@@ -207,12 +502,102 @@ func (s *AuthService) CreatePersonalWithUser(ctx context.Context, req pgstore.Cr
 	}, nil
 }
 
+// InitiatePasswordRecovery emails a password reset link to the user with the
+// email. Unknown emails are ignored silently, so the endpoint doesn't tell
+// which emails have an account.
 func (s *AuthService) InitiatePasswordRecovery(ctx context.Context, email string) error {
-	return fmt.Errorf("password recovery not implemented yet")
+	user, err := s.queries.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token := s.generateSecureToken()
+	err = s.queries.CreatePasswordResetToken(ctx, pgstore.CreatePasswordResetTokenParams{
+		UserID:    user.ID,
+		Token:     hashAuthToken(token),
+		ExpiresAt: time.Now().Add(passwordResetTokenLifetime),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return s.mail.SendPasswordReset(ctx, user.Email, user.Name, token, passwordResetTokenLifetime)
 }
 
+// ResetPassword sets a new password with a reset token, which can only be
+// used once. Every session and refresh token of the user is revoked, so
+// whoever knew the old password is signed out.
 func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
-	return fmt.Errorf("password reset not implemented yet")
+	tokenHash := hashAuthToken(token)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	resetToken, err := txQueries.GetPasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to get password reset token: %w", err)
+	}
+	if resetToken == nil || resetToken.UsedAt != nil || !time.Now().Before(resetToken.ExpiresAt) {
+		return fmt.Errorf("%w: invalid or expired reset token", utils.ErrBadRequest)
+	}
+
+	used, err := txQueries.MarkPasswordResetTokenAsUsed(ctx, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to mark password reset token as used: %w", err)
+	}
+	if !used {
+		return fmt.Errorf("%w: invalid or expired reset token", utils.ErrBadRequest)
+	}
+
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err = txQueries.UpdateUserPassword(ctx, pgstore.UpdateUserPasswordParams{
+		ID:       resetToken.UserID,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := txQueries.RevokeAllUserRefreshTokens(ctx, resetToken.UserID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.destroyUserSessions(ctx, resetToken.UserID, "")
+}
+
+// destroyUserSessions signs the user out of every cookie session but the one
+// with exceptSessionID, if any
+func (s *AuthService) destroyUserSessions(ctx context.Context, userID uuid.UUID, exceptSessionID string) error {
+	sessions, err := s.userCookieSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if exceptSessionID != "" && cookieSessionID(session.token) == exceptSessionID {
+			continue
+		}
+		if err := s.destroyCookieSession(ctx, session.token); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (s *AuthService) hashPassword(password string) (string, error) {
@@ -230,3 +615,10 @@ func (s *AuthService) generateSecureToken() string {
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
+
+// hashAuthToken is what the database keeps of refresh and password reset
+// tokens
+func hashAuthToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// newTestAccessTokens returns HS256 access tokens signed with key "test"
+func newTestAccessTokens(t *testing.T) *AccessTokens {
+	t.Helper()
+
+	tokens, err := NewAccessTokens(AccessTokenConfig{
+		Issuer:       "pandoragym-test",
+		Lifetime:     15 * time.Minute,
+		SigningKeyID: "test",
+		Keys: []AccessTokenKey{
+			{ID: "test", Algorithm: AccessTokenHS256, Secret: []byte(strings.Repeat("k", 32))},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewAccessTokens() error = %v", err)
+	}
+	return tokens
+}
+
+func newTestAuthService(t *testing.T, pool *pgxpool.Pool) *AuthService {
+	t.Helper()
+	return NewAuthService(pgstore.New(pool), pool, nil, nil, AuthConfig{AccessTokens: newTestAccessTokens(t)})
+}
+
+// signInForTokens starts a new refresh token family for a new student
+func signInForTokens(t *testing.T, pool *pgxpool.Pool, service *AuthService) *pgstore.AuthenticateResponse {
+	t.Helper()
+
+	userID := createTestUser(t, pool, pgstore.RoleStudent)
+	tokens, err := service.issueTokenPair(context.Background(), &pgstore.UserResponse{ID: userID, Role: pgstore.RoleStudent}, ClientInfo{})
+	if err != nil {
+		t.Fatalf("issueTokenPair() error = %v", err)
+	}
+	return tokens
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := newTestAuthService(t, pool)
+
+	signIn := signInForTokens(t, pool, service)
+	first, err := service.VerifyAccessToken(signIn.Token)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken() error = %v", err)
+	}
+
+	refreshed, err := service.RefreshTokens(ctx, signIn.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+	if refreshed.RefreshToken == signIn.RefreshToken {
+		t.Error("RefreshTokens() returned the same refresh token")
+	}
+
+	claims, err := service.VerifyAccessToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("VerifyAccessToken() error = %v", err)
+	}
+	if claims.Subject != first.Subject || claims.SessionID != first.SessionID {
+		t.Errorf("refreshed claims = %s/%s, want %s/%s", claims.Subject, claims.SessionID, first.Subject, first.SessionID)
+	}
+
+	// The new token rotates again
+	if _, err := service.RefreshTokens(ctx, refreshed.RefreshToken, ClientInfo{}); err != nil {
+		t.Fatalf("second RefreshTokens() error = %v", err)
+	}
+}
+
+func TestRefreshTokensReuseRevokesFamily(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := newTestAuthService(t, pool)
+
+	signIn := signInForTokens(t, pool, service)
+	refreshed, err := service.RefreshTokens(ctx, signIn.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+
+	// Presenting the rotated token again means it leaked
+	if _, err := service.RefreshTokens(ctx, signIn.RefreshToken, ClientInfo{}); !errors.Is(err, utils.ErrUnauthorized) {
+		t.Fatalf("reusing a rotated token error = %v, want %v", err, utils.ErrUnauthorized)
+	}
+
+	// and the token it was rotated into goes with the family
+	if _, err := service.RefreshTokens(ctx, refreshed.RefreshToken, ClientInfo{}); !errors.Is(err, utils.ErrUnauthorized) {
+		t.Errorf("refreshing after reuse error = %v, want %v", err, utils.ErrUnauthorized)
+	}
+}
+
+func TestRefreshTokensRejectsExpiredToken(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := newTestAuthService(t, pool)
+
+	userID := createTestUser(t, pool, pgstore.RoleStudent)
+	token := service.generateSecureToken()
+	_, err := service.queries.CreateRefreshToken(ctx, pgstore.CreateRefreshTokenParams{
+		UserID:    userID,
+		FamilyID:  uuid.New(),
+		Token:     hashAuthToken(token),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	if _, err := service.RefreshTokens(ctx, token, ClientInfo{}); !errors.Is(err, utils.ErrUnauthorized) {
+		t.Errorf("RefreshTokens() error = %v, want %v", err, utils.ErrUnauthorized)
+	}
+}
+
+func TestRevokeRefreshTokenEndsFamily(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := newTestAuthService(t, pool)
+
+	signIn := signInForTokens(t, pool, service)
+	refreshed, err := service.RefreshTokens(ctx, signIn.RefreshToken, ClientInfo{})
+	if err != nil {
+		t.Fatalf("RefreshTokens() error = %v", err)
+	}
+
+	if err := service.RevokeRefreshToken(ctx, refreshed.RefreshToken); err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v", err)
+	}
+	if _, err := service.RefreshTokens(ctx, refreshed.RefreshToken, ClientInfo{}); !errors.Is(err, utils.ErrUnauthorized) {
+		t.Errorf("RefreshTokens() after revoke error = %v, want %v", err, utils.ErrUnauthorized)
+	}
+
+	// Unknown tokens have nothing left to revoke
+	if err := service.RevokeRefreshToken(ctx, service.generateSecureToken()); err != nil {
+		t.Errorf("RevokeRefreshToken() of an unknown token error = %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+const (
+	// calendarFeedHistory is how far back the feed lists past sessions
+	calendarFeedHistory = 90 * 24 * time.Hour
+
+	calendarProductID      = "-//PandoraGym//Schedulings//EN"
+	calendarDateTimeLayout = "20060102T150405Z"
+	calendarLineLimit      = 75
+)
+
+type CalendarService struct {
+	queries *pgstore.Queries
+	pool    *pgxpool.Pool
+}
+
+func NewCalendarService(queries *pgstore.Queries, pool *pgxpool.Pool) *CalendarService {
+	return &CalendarService{
+		queries: queries,
+		pool:    pool,
+	}
+}
+
+// CreateFeedToken issues a calendar feed token for the user, revoking the
+// previous one. The token is only returned here; the database keeps its hash.
+func (s *CalendarService) CreateFeedToken(ctx context.Context, userID uuid.UUID) (*pgstore.CalendarFeedTokenResponse, error) {
+	token, err := generateCalendarFeedToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate calendar feed token: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	if _, err := txQueries.RevokeCalendarFeedTokens(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to revoke calendar feed tokens: %w", err)
+	}
+
+	feedToken, err := txQueries.CreateCalendarFeedToken(ctx, pgstore.CreateCalendarFeedTokenParams{
+		UserID:    userID,
+		TokenHash: hashCalendarFeedToken(token),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create calendar feed token: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &pgstore.CalendarFeedTokenResponse{
+		Token:     token,
+		CreatedAt: feedToken.CreatedAt,
+	}, nil
+}
+
+// RevokeFeedToken disables the user's calendar feed
+func (s *CalendarService) RevokeFeedToken(ctx context.Context, userID uuid.UUID) error {
+	revoked, err := s.queries.RevokeCalendarFeedTokens(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke calendar feed tokens: %w", err)
+	}
+	if !revoked {
+		return fmt.Errorf("%w: no active calendar feed", utils.ErrNotFound)
+	}
+
+	return nil
+}
+
+// GetFeed renders the schedulings of the token's owner as an RFC 5545
+// calendar, from calendarFeedHistory ago on
+func (s *CalendarService) GetFeed(ctx context.Context, token string) ([]byte, error) {
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing calendar feed token", utils.ErrUnauthorized)
+	}
+
+	feedToken, err := s.queries.GetActiveCalendarFeedToken(ctx, hashCalendarFeedToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar feed token: %w", err)
+	}
+	if feedToken == nil {
+		return nil, fmt.Errorf("%w: invalid calendar feed token", utils.ErrUnauthorized)
+	}
+
+	now := time.Now()
+	schedulings, err := s.queries.GetCalendarSchedulings(ctx, pgstore.GetCalendarSchedulingsParams{
+		UserID: feedToken.UserID,
+		From:   now.Add(-calendarFeedHistory),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get calendar schedulings: %w", err)
+	}
+
+	if err := s.queries.TouchCalendarFeedToken(ctx, feedToken.ID); err != nil {
+		return nil, fmt.Errorf("failed to update calendar feed token: %w", err)
+	}
+
+	return buildCalendar(feedToken.UserID, schedulings, now), nil
+}
+
+func generateCalendarFeedToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+func hashCalendarFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// buildCalendar writes one VEVENT per scheduling, seen from the user's side
+func buildCalendar(userID uuid.UUID, schedulings []pgstore.GetCalendarSchedulingsRow, now time.Time) []byte {
+	var b strings.Builder
+
+	writeCalendarLine(&b, "BEGIN", "VCALENDAR")
+	writeCalendarLine(&b, "VERSION", "2.0")
+	writeCalendarLine(&b, "PRODID", calendarProductID)
+	writeCalendarLine(&b, "CALSCALE", "GREGORIAN")
+	writeCalendarLine(&b, "METHOD", "PUBLISH")
+	writeCalendarLine(&b, "X-WR-CALNAME", escapeCalendarText("PandoraGym"))
+
+	for _, scheduling := range schedulings {
+		otherParty := scheduling.PersonalName
+		if scheduling.PersonalID == userID {
+			otherParty = scheduling.StudentName
+		}
+
+		summary := "Training session with " + otherParty
+		if scheduling.WorkoutName != nil {
+			summary = *scheduling.WorkoutName + " with " + otherParty
+		}
+
+		description := []string{
+			"Type: " + calendarSchedulingType(scheduling.Type),
+			"Status: " + string(scheduling.Status),
+		}
+		if scheduling.WorkoutName != nil {
+			description = append(description, "Workout: "+*scheduling.WorkoutName)
+		}
+		if scheduling.PersonalID == userID {
+			description = append(description, "Student: "+otherParty)
+		} else {
+			description = append(description, "Trainer: "+otherParty)
+		}
+		if scheduling.Notes != nil && *scheduling.Notes != "" {
+			description = append(description, "Notes: "+*scheduling.Notes)
+		}
+
+		writeCalendarLine(&b, "BEGIN", "VEVENT")
+		writeCalendarLine(&b, "UID", scheduling.ID.String()+"@pandoragym")
+		writeCalendarLine(&b, "DTSTAMP", now.UTC().Format(calendarDateTimeLayout))
+		writeCalendarLine(&b, "CREATED", scheduling.CreatedAt.UTC().Format(calendarDateTimeLayout))
+		writeCalendarLine(&b, "DTSTART", scheduling.Date.UTC().Format(calendarDateTimeLayout))
+		writeCalendarLine(&b, "DTEND", scheduling.EndTime.UTC().Format(calendarDateTimeLayout))
+		writeCalendarLine(&b, "SUMMARY", escapeCalendarText(summary))
+		writeCalendarLine(&b, "DESCRIPTION", escapeCalendarText(strings.Join(description, "\n")))
+		writeCalendarLine(&b, "LOCATION", escapeCalendarText(calendarSchedulingType(scheduling.Type)))
+		writeCalendarLine(&b, "CATEGORIES", string(scheduling.Type))
+		writeCalendarLine(&b, "STATUS", calendarEventStatus(scheduling.Status))
+		writeCalendarLine(&b, "X-PANDORAGYM-TYPE", string(scheduling.Type))
+		writeCalendarLine(&b, "X-PANDORAGYM-STATUS", string(scheduling.Status))
+		writeCalendarLine(&b, "END", "VEVENT")
+	}
+
+	writeCalendarLine(&b, "END", "VCALENDAR")
+
+	return []byte(b.String())
+}
+
+// calendarEventStatus maps a scheduling status to a VEVENT STATUS: sessions
+// waiting for the trainer are tentative and canceled ones are removed from
+// the subscriber's calendar
+func calendarEventStatus(status pgstore.SchedulingStatus) string {
+	switch status {
+	case pgstore.SchedulingStatusPendingConfirmation, pgstore.SchedulingStatusRescheduled:
+		return "TENTATIVE"
+	case pgstore.SchedulingStatusCanceled:
+		return "CANCELLED"
+	default:
+		return "CONFIRMED"
+	}
+}
+
+func calendarSchedulingType(schedulingType pgstore.SchedulingType) string {
+	if schedulingType == pgstore.SchedulingTypeOnline {
+		return "Online"
+	}
+	return "In person"
+}
+
+// escapeCalendarText escapes a TEXT value as required by RFC 5545 section 3.3.11
+func escapeCalendarText(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	return replacer.Replace(value)
+}
+
+// writeCalendarLine writes a content line ending in CRLF, folding it so no
+// line is longer than 75 octets without splitting UTF-8 characters
+func writeCalendarLine(b *strings.Builder, name, value string) {
+	line := name + ":" + value
+
+	limit := calendarLineLimit
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isUTF8Boundary(line, cut) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// Continuation lines start with a space
+		limit = calendarLineLimit - 1
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
+
+func isUTF8Boundary(s string, i int) bool {
+	return i >= len(s) || s[i]&0xC0 != 0x80
+}
@@ -0,0 +1,399 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// couponCodeLimit matches the size of coupon.code
+const couponCodeLimit = 32
+
+// GetTrainerCoupons lists every coupon of the trainer, including deactivated
+// ones
+func (s *PlanService) GetTrainerCoupons(ctx context.Context, trainerID uuid.UUID) ([]pgstore.CouponResponse, error) {
+	coupons, err := s.queries.GetCoupons(ctx, trainerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupons: %w", err)
+	}
+
+	responses := make([]pgstore.CouponResponse, 0, len(coupons))
+	for _, coupon := range coupons {
+		responses = append(responses, toCouponResponse(coupon))
+	}
+	return responses, nil
+}
+
+func (s *PlanService) CreateCoupon(ctx context.Context, trainerID uuid.UUID, req pgstore.CouponRequest) (*pgstore.CouponResponse, error) {
+	planIDs, err := validateCouponRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	coupon, err := txQueries.CreateCoupon(ctx, pgstore.CreateCouponParams{
+		PersonalID:            trainerID,
+		Code:                  req.Code,
+		DiscountType:          req.DiscountType,
+		DiscountPercent:       req.DiscountPercent,
+		DiscountAmount:        req.DiscountAmount,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		ValidFrom:             req.ValidFrom,
+		ValidUntil:            req.ValidUntil,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: a coupon with this code already exists", utils.ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to create coupon: %w", err)
+	}
+
+	if err := setCouponPlans(ctx, txQueries, coupon, planIDs); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getCouponResponse(ctx, trainerID, coupon.ID)
+}
+
+// UpdateCoupon replaces a coupon of the trainer. Redemptions made so far
+// still count against the new limits.
+func (s *PlanService) UpdateCoupon(ctx context.Context, trainerID uuid.UUID, couponID string, req pgstore.CouponRequest) (*pgstore.CouponResponse, error) {
+	couponUUID, err := uuid.Parse(couponID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid coupon ID", utils.ErrBadRequest)
+	}
+
+	planIDs, err := validateCouponRequest(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	current, err := txQueries.GetCouponForUpdate(ctx, pgstore.GetCouponForUpdateParams{
+		ID:         couponUUID,
+		PersonalID: trainerID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	if current == nil {
+		return nil, fmt.Errorf("%w: coupon not found", utils.ErrNotFound)
+	}
+	if req.MaxRedemptions != nil && *req.MaxRedemptions < current.RedemptionCount {
+		return nil, fmt.Errorf("%w: coupon was already redeemed %d times", utils.ErrBadRequest, current.RedemptionCount)
+	}
+
+	coupon, err := txQueries.UpdateCoupon(ctx, pgstore.UpdateCouponParams{
+		ID:                    current.ID,
+		PersonalID:            trainerID,
+		Code:                  req.Code,
+		DiscountType:          req.DiscountType,
+		DiscountPercent:       req.DiscountPercent,
+		DiscountAmount:        req.DiscountAmount,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		ValidFrom:             req.ValidFrom,
+		ValidUntil:            req.ValidUntil,
+		IsActive:              req.IsActive,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, fmt.Errorf("%w: a coupon with this code already exists", utils.ErrConflict)
+		}
+		return nil, fmt.Errorf("failed to update coupon: %w", err)
+	}
+
+	if err := txQueries.DeleteCouponPlans(ctx, coupon.ID); err != nil {
+		return nil, fmt.Errorf("failed to update coupon plans: %w", err)
+	}
+	if err := setCouponPlans(ctx, txQueries, coupon, planIDs); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getCouponResponse(ctx, trainerID, coupon.ID)
+}
+
+// DeleteCoupon removes a coupon of the trainer. A coupon that was redeemed is
+// only deactivated, so the subscriptions it discounted keep their record; the
+// returned flag reports whether that happened.
+func (s *PlanService) DeleteCoupon(ctx context.Context, trainerID uuid.UUID, couponID string) (bool, error) {
+	couponUUID, err := uuid.Parse(couponID)
+	if err != nil {
+		return false, fmt.Errorf("%w: invalid coupon ID", utils.ErrBadRequest)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	coupon, err := txQueries.GetCouponForUpdate(ctx, pgstore.GetCouponForUpdateParams{
+		ID:         couponUUID,
+		PersonalID: trainerID,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	if coupon == nil {
+		return false, fmt.Errorf("%w: coupon not found", utils.ErrNotFound)
+	}
+
+	deactivated := coupon.RedemptionCount > 0
+	if deactivated {
+		err = txQueries.DeactivateCoupon(ctx, coupon.ID)
+	} else {
+		_, err = txQueries.DeleteCoupon(ctx, pgstore.DeleteCouponParams{
+			ID:         coupon.ID,
+			PersonalID: trainerID,
+		})
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete coupon: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return deactivated, nil
+}
+
+func (s *PlanService) getCouponResponse(ctx context.Context, trainerID, couponID uuid.UUID) (*pgstore.CouponResponse, error) {
+	coupon, err := s.queries.GetCouponById(ctx, pgstore.GetCouponByIdParams{
+		ID:         couponID,
+		PersonalID: trainerID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	if coupon == nil {
+		return nil, fmt.Errorf("%w: coupon not found", utils.ErrNotFound)
+	}
+
+	response := toCouponResponse(*coupon)
+	return &response, nil
+}
+
+// redeemCoupon checks the plan trainer's coupon with the code against its
+// validity window, plans and limits, and counts the redemption. The coupon
+// row stays locked until the transaction of queries ends, so concurrent
+// subscriptions cannot redeem past the limits. It returns the coupon and the
+// amount it takes off the plan price.
+func redeemCoupon(ctx context.Context, queries *pgstore.Queries, code string, plan *pgstore.GetPlansRow, userID uuid.UUID, now time.Time) (*pgstore.Coupon, pgstore.Money, error) {
+	coupon, err := queries.GetCouponByCodeForUpdate(ctx, pgstore.GetCouponByCodeForUpdateParams{
+		PersonalID: plan.PersonalID,
+		Code:       normalizeCouponCode(code),
+	})
+	if err != nil {
+		return nil, pgstore.Money{}, fmt.Errorf("failed to get coupon: %w", err)
+	}
+	if coupon == nil || !coupon.IsActive {
+		return nil, pgstore.Money{}, fmt.Errorf("%w: invalid coupon code", utils.ErrBadRequest)
+	}
+	if coupon.ValidFrom != nil && now.Before(*coupon.ValidFrom) {
+		return nil, pgstore.Money{}, fmt.Errorf("%w: coupon is not valid yet", utils.ErrBadRequest)
+	}
+	if coupon.ValidUntil != nil && !now.Before(*coupon.ValidUntil) {
+		return nil, pgstore.Money{}, fmt.Errorf("%w: coupon has expired", utils.ErrBadRequest)
+	}
+	if plan.Price.IsZero() {
+		return nil, pgstore.Money{}, fmt.Errorf("%w: coupons do not apply to free plans", utils.ErrBadRequest)
+	}
+
+	applies, err := queries.CouponAppliesToPlan(ctx, pgstore.CouponAppliesToPlanParams{
+		CouponID: coupon.ID,
+		PlanID:   plan.ID,
+	})
+	if err != nil {
+		return nil, pgstore.Money{}, fmt.Errorf("failed to check coupon plans: %w", err)
+	}
+	if !applies {
+		return nil, pgstore.Money{}, fmt.Errorf("%w: coupon does not apply to this plan", utils.ErrBadRequest)
+	}
+
+	if coupon.MaxRedemptionsPerUser != nil {
+		used, err := queries.CountCouponRedemptionsByUser(ctx, pgstore.CountCouponRedemptionsByUserParams{
+			CouponID: coupon.ID,
+			UserID:   userID,
+		})
+		if err != nil {
+			return nil, pgstore.Money{}, fmt.Errorf("failed to count coupon redemptions: %w", err)
+		}
+		if used >= *coupon.MaxRedemptionsPerUser {
+			return nil, pgstore.Money{}, fmt.Errorf("%w: coupon was already used", utils.ErrConflict)
+		}
+	}
+
+	redeemed, err := queries.RedeemCoupon(ctx, coupon.ID)
+	if err != nil {
+		return nil, pgstore.Money{}, fmt.Errorf("failed to redeem coupon: %w", err)
+	}
+	if !redeemed {
+		return nil, pgstore.Money{}, fmt.Errorf("%w: coupon has no redemptions left", utils.ErrConflict)
+	}
+
+	return coupon, couponDiscount(coupon, plan.Price), nil
+}
+
+// couponDiscount is the amount the coupon takes off price, rounded to the
+// cent and never more than the price
+func couponDiscount(coupon *pgstore.Coupon, price pgstore.Money) pgstore.Money {
+	var discount pgstore.Money
+	switch {
+	case coupon.DiscountType == pgstore.CouponDiscountPercent && coupon.DiscountPercent != nil:
+		discount = price.Percent(*coupon.DiscountPercent)
+	case coupon.DiscountType == pgstore.CouponDiscountFixed && coupon.DiscountAmount != nil:
+		discount = *coupon.DiscountAmount
+	}
+	if discount.Cmp(price) > 0 {
+		return price
+	}
+	return discount
+}
+
+// setCouponPlans restricts the coupon to the plans, which must all belong to
+// its trainer
+func setCouponPlans(ctx context.Context, queries *pgstore.Queries, coupon *pgstore.Coupon, planIDs []uuid.UUID) error {
+	if len(planIDs) == 0 {
+		return nil
+	}
+
+	added, err := queries.AddCouponPlans(ctx, pgstore.AddCouponPlansParams{
+		CouponID:   coupon.ID,
+		PersonalID: coupon.PersonalID,
+		PlanIDs:    planIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set coupon plans: %w", err)
+	}
+	if added != int64(len(planIDs)) {
+		return fmt.Errorf("%w: plan not found", utils.ErrBadRequest)
+	}
+	return nil
+}
+
+// validateCouponRequest normalizes the request in place and returns its
+// distinct plan IDs
+func validateCouponRequest(req *pgstore.CouponRequest) ([]uuid.UUID, error) {
+	req.Code = normalizeCouponCode(req.Code)
+	if req.Code == "" || len(req.Code) > couponCodeLimit {
+		return nil, fmt.Errorf("%w: code must have 1 to %d characters", utils.ErrBadRequest, couponCodeLimit)
+	}
+	for _, r := range req.Code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return nil, fmt.Errorf("%w: code may only contain letters, digits, '-' and '_'", utils.ErrBadRequest)
+		}
+	}
+
+	switch req.DiscountType {
+	case pgstore.CouponDiscountPercent:
+		if req.DiscountPercent == nil || req.DiscountAmount != nil {
+			return nil, fmt.Errorf("%w: percent coupons take a discount_percent only", utils.ErrBadRequest)
+		}
+		percent := *req.DiscountPercent
+		if percent <= 0 || percent > 100 {
+			return nil, fmt.Errorf("%w: discount percent must be between 0 and 100", utils.ErrBadRequest)
+		}
+		if math.Round(percent*100) != percent*100 {
+			return nil, fmt.Errorf("%w: discount percent has more than 2 decimal places", utils.ErrBadRequest)
+		}
+	case pgstore.CouponDiscountFixed:
+		if req.DiscountAmount == nil || req.DiscountPercent != nil {
+			return nil, fmt.Errorf("%w: fixed coupons take a discount_amount only", utils.ErrBadRequest)
+		}
+		if req.DiscountAmount.Amount <= 0 {
+			return nil, fmt.Errorf("%w: discount amount must be positive", utils.ErrBadRequest)
+		}
+	}
+	if req.MaxRedemptions != nil && *req.MaxRedemptions <= 0 {
+		return nil, fmt.Errorf("%w: max redemptions must be positive", utils.ErrBadRequest)
+	}
+	if req.MaxRedemptionsPerUser != nil && *req.MaxRedemptionsPerUser <= 0 {
+		return nil, fmt.Errorf("%w: max redemptions per user must be positive", utils.ErrBadRequest)
+	}
+	if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidFrom.Before(*req.ValidUntil) {
+		return nil, fmt.Errorf("%w: valid_until must be after valid_from", utils.ErrBadRequest)
+	}
+
+	planIDs := make([]uuid.UUID, 0, len(req.PlanIDs))
+	seen := make(map[uuid.UUID]bool, len(req.PlanIDs))
+	for _, id := range req.PlanIDs {
+		planID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
+		}
+		if !seen[planID] {
+			seen[planID] = true
+			planIDs = append(planIDs, planID)
+		}
+	}
+	return planIDs, nil
+}
+
+// normalizeCouponCode makes codes case-insensitive
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func toCouponResponse(coupon pgstore.GetCouponsRow) pgstore.CouponResponse {
+	planIDs := coupon.PlanIDs
+	if planIDs == nil {
+		planIDs = []uuid.UUID{}
+	}
+
+	return pgstore.CouponResponse{
+		ID:                    coupon.ID,
+		Code:                  coupon.Code,
+		DiscountType:          coupon.DiscountType,
+		DiscountPercent:       coupon.DiscountPercent,
+		DiscountAmount:        coupon.DiscountAmount,
+		MaxRedemptions:        coupon.MaxRedemptions,
+		MaxRedemptionsPerUser: coupon.MaxRedemptionsPerUser,
+		RedemptionCount:       coupon.RedemptionCount,
+		ValidFrom:             coupon.ValidFrom,
+		ValidUntil:            coupon.ValidUntil,
+		PlanIDs:               planIDs,
+		IsActive:              coupon.IsActive,
+		CreatedAt:             coupon.CreatedAt,
+		UpdatedAt:             coupon.UpdatedAt,
+	}
+}
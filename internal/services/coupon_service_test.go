@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+)
+
+// testPool connects to the migrated database named by TEST_DATABASE_URL,
+// skipping the test when it is unset
+func testPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	databaseURL := os.Getenv("TEST_DATABASE_URL")
+	if databaseURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgstore.InitDB(databaseURL)
+	if err != nil {
+		t.Fatalf("InitDB() error = %v", err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// createTestUser adds a user with the role, and its trainer profile for
+// PERSONAL users, deleting both when the test ends
+func createTestUser(t *testing.T, pool *pgxpool.Pool, role pgstore.Role) uuid.UUID {
+	t.Helper()
+	ctx := context.Background()
+	queries := pgstore.New(pool)
+
+	now := time.Now()
+	userID, err := queries.CreateUser(ctx, pgstore.CreateUserParams{
+		ID:              uuid.New(),
+		Name:            "Test " + string(role),
+		Email:           uuid.NewString() + "@example.com",
+		Phone:           "11999999999",
+		Password:        "not a hash",
+		Role:            role,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		EmailVerifiedAt: &now,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	t.Cleanup(func() {
+		// Plans and coupons of a trainer are not removed with the user
+		ctx := context.Background()
+		for _, query := range []string{
+			"DELETE FROM coupon_redemption WHERE user_id = $1 OR coupon_id IN (SELECT id FROM coupon WHERE personal_id = $1)",
+			"DELETE FROM subscription WHERE user_id = $1 OR plan_id IN (SELECT id FROM plan WHERE personal_id = $1)",
+			"DELETE FROM coupon WHERE personal_id = $1",
+			"DELETE FROM plan WHERE personal_id = $1",
+			"DELETE FROM users WHERE id = $1",
+		} {
+			if _, err := pool.Exec(ctx, query, userID); err != nil {
+				t.Errorf("cleanup %q: %v", query, err)
+			}
+		}
+	})
+
+	if role == pgstore.RolePersonal {
+		if err := queries.CreatePersonal(ctx, pgstore.CreatePersonalParams{ID: userID}); err != nil {
+			t.Fatalf("CreatePersonal() error = %v", err)
+		}
+	}
+	return userID
+}
+
+func TestCancelledSubscriptionGivesCouponBack(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := NewPlanService(pgstore.New(pool), pool, NewFakePaymentGateway(), PaymentConfig{})
+
+	trainerID := createTestUser(t, pool, pgstore.RolePersonal)
+	studentID := createTestUser(t, pool, pgstore.RoleStudent)
+
+	plan, err := service.CreatePlan(ctx, trainerID, pgstore.PlanRequest{
+		Name:     "Monthly",
+		Price:    pgstore.NewMoney(10000),
+		Duration: 30,
+	})
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+
+	percent := 50.0
+	perUser := int32(1)
+	coupon, err := service.CreateCoupon(ctx, trainerID, pgstore.CouponRequest{
+		Code:                  "HALF-" + uuid.NewString()[:8],
+		DiscountType:          pgstore.CouponDiscountPercent,
+		DiscountPercent:       &percent,
+		MaxRedemptionsPerUser: &perUser,
+	})
+	if err != nil {
+		t.Fatalf("CreateCoupon() error = %v", err)
+	}
+
+	request := pgstore.SubscriptionRequest{PlanID: plan.ID.String(), CouponCode: coupon.Code}
+
+	subscription, err := service.SubscribeToPlan(ctx, studentID, request)
+	if err != nil {
+		t.Fatalf("SubscribeToPlan() error = %v", err)
+	}
+	if subscription.Status != pgstore.SubscriptionStatusPending {
+		t.Fatalf("status = %s, want %s", subscription.Status, pgstore.SubscriptionStatusPending)
+	}
+
+	cancelled, err := service.CancelSubscription(ctx, studentID)
+	if err != nil {
+		t.Fatalf("CancelSubscription() error = %v", err)
+	}
+	if cancelled.Status != pgstore.SubscriptionStatusCancelled {
+		t.Fatalf("status = %s, want %s", cancelled.Status, pgstore.SubscriptionStatusCancelled)
+	}
+
+	resubscribed, err := service.SubscribeToPlan(ctx, studentID, request)
+	if err != nil {
+		t.Fatalf("SubscribeToPlan() again error = %v", err)
+	}
+	if resubscribed.Discount == nil || resubscribed.Discount.Amount != 5000 {
+		t.Errorf("discount = %v, want 50.00", resubscribed.Discount)
+	}
+
+	stored, err := service.queries.GetCouponById(ctx, pgstore.GetCouponByIdParams{ID: coupon.ID, PersonalID: trainerID})
+	if err != nil {
+		t.Fatalf("GetCouponById() error = %v", err)
+	}
+	if stored.RedemptionCount != 1 {
+		t.Errorf("redemption count = %d, want 1", stored.RedemptionCount)
+	}
+}
@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// schedulingCreditRefundWindow is how long before a session the student may
+// cancel it and get its credit back. Sessions cancelled by the trainer are
+// always refunded.
+const schedulingCreditRefundWindow = 24 * time.Hour
+
+// GetUserCredits lists the usable packages of the student and the credits
+// left in them
+func (s *PlanService) GetUserCredits(ctx context.Context, userID uuid.UUID) (*pgstore.CreditsResponse, error) {
+	packages, err := s.queries.GetCreditPackages(ctx, pgstore.GetCreditPackagesParams{
+		UserID: userID,
+		Now:    time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit packages: %w", err)
+	}
+
+	return toCreditsResponse(packages), nil
+}
+
+// GetStudentCredits returns the usable packages a student bought from the
+// trainer together with every credit movement between them, newest first
+func (s *PlanService) GetStudentCredits(ctx context.Context, trainerID uuid.UUID, studentID string) (*pgstore.CreditsResponse, error) {
+	studentUUID, err := uuid.Parse(studentID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid student ID", utils.ErrBadRequest)
+	}
+
+	packages, err := s.queries.GetCreditPackages(ctx, pgstore.GetCreditPackagesParams{
+		UserID:     studentUUID,
+		PersonalID: &trainerID,
+		Now:        time.Now(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit packages: %w", err)
+	}
+
+	entries, err := s.queries.GetSessionCreditLedger(ctx, pgstore.GetSessionCreditLedgerParams{
+		UserID:     studentUUID,
+		PersonalID: trainerID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit ledger: %w", err)
+	}
+
+	response := toCreditsResponse(packages)
+	response.Ledger = make([]pgstore.SessionCreditResponse, 0, len(entries))
+	for _, entry := range entries {
+		response.Ledger = append(response.Ledger, pgstore.SessionCreditResponse{
+			ID:           entry.ID,
+			PackageID:    entry.SubscriptionID,
+			PlanName:     entry.PlanName,
+			SchedulingID: entry.SchedulingID,
+			Delta:        entry.Delta,
+			Reason:       entry.Reason,
+			CreatedAt:    entry.CreatedAt,
+		})
+	}
+
+	return response, nil
+}
+
+// grantPackageCredits credits a package that was just paid for
+func grantPackageCredits(ctx context.Context, queries *pgstore.Queries, subscription *pgstore.Subscription) error {
+	if subscription.PlanType != pgstore.PlanTypePackage || subscription.SessionCredits == nil {
+		return nil
+	}
+
+	err := queries.CreateSessionCredit(ctx, pgstore.CreateSessionCreditParams{
+		SubscriptionID: subscription.ID,
+		Delta:          *subscription.SessionCredits,
+		Reason:         pgstore.SessionCreditGranted,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to grant session credits: %w", err)
+	}
+	return nil
+}
+
+// forfeitPackageCredits zeroes the balance of a package that ended, as
+// EXPIRED credits at the end of its validity or REVOKED ones when it was
+// cancelled, e.g. by a refund
+func forfeitPackageCredits(ctx context.Context, queries *pgstore.Queries, subscription *pgstore.Subscription) error {
+	if subscription.PlanType != pgstore.PlanTypePackage {
+		return nil
+	}
+
+	balance, err := queries.GetSessionCreditBalance(ctx, subscription.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get session credit balance: %w", err)
+	}
+	if balance <= 0 {
+		return nil
+	}
+
+	reason := pgstore.SessionCreditExpired
+	if subscription.Status == pgstore.SubscriptionStatusCancelled {
+		reason = pgstore.SessionCreditRevoked
+	}
+
+	err = queries.CreateSessionCredit(ctx, pgstore.CreateSessionCreditParams{
+		SubscriptionID: subscription.ID,
+		Delta:          -balance,
+		Reason:         reason,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to expire session credits: %w", err)
+	}
+	return nil
+}
+
+// consumeSessionCredit pays a session booked by a student with a credit from
+// the package of the trainer that expires first and is still valid when the
+// session starts. Students on an active recurring plan of the trainer book
+// without credits, as do the students of trainers that sell no packages.
+func consumeSessionCredit(ctx context.Context, queries *pgstore.Queries, personalID, studentID, schedulingID uuid.UUID, startTime time.Time) error {
+	subscribed, err := queries.HasActiveTrainerSubscription(ctx, pgstore.HasActiveTrainerSubscriptionParams{
+		UserID:     studentID,
+		PersonalID: personalID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check trainer subscription: %w", err)
+	}
+	if subscribed {
+		return nil
+	}
+
+	packageID, err := queries.GetUsableCreditPackageId(ctx, pgstore.GetUsableCreditPackageIdParams{
+		UserID:     studentID,
+		PersonalID: personalID,
+		At:         startTime,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get credit package: %w", err)
+	}
+	if packageID == nil {
+		sellsPackages, err := queries.TrainerSellsPackages(ctx, personalID)
+		if err != nil {
+			return fmt.Errorf("failed to check trainer packages: %w", err)
+		}
+		if sellsPackages {
+			return fmt.Errorf("%w: no session credits left with this trainer", utils.ErrBadRequest)
+		}
+		return nil
+	}
+
+	// The package is locked now, so a booking that spent its last credit
+	// meanwhile is visible here
+	balance, err := queries.GetSessionCreditBalance(ctx, *packageID)
+	if err != nil {
+		return fmt.Errorf("failed to get session credit balance: %w", err)
+	}
+	if balance <= 0 {
+		return fmt.Errorf("%w: no session credits left with this trainer", utils.ErrBadRequest)
+	}
+
+	err = queries.CreateSessionCredit(ctx, pgstore.CreateSessionCreditParams{
+		SubscriptionID: *packageID,
+		SchedulingID:   &schedulingID,
+		Delta:          -1,
+		Reason:         pgstore.SessionCreditConsumed,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to consume session credit: %w", err)
+	}
+	return nil
+}
+
+// refundSessionCredit gives back the credit a session was booked with, as
+// long as its package can still be used
+func refundSessionCredit(ctx context.Context, queries *pgstore.Queries, schedulingID uuid.UUID, now time.Time) error {
+	credit, err := queries.GetSchedulingCredit(ctx, schedulingID)
+	if err != nil {
+		return fmt.Errorf("failed to get scheduling credit: %w", err)
+	}
+	if credit == nil || credit.Status != pgstore.SubscriptionStatusActive || !now.Before(credit.EndDate) {
+		return nil
+	}
+
+	err = queries.CreateSessionCredit(ctx, pgstore.CreateSessionCreditParams{
+		SubscriptionID: credit.SubscriptionID,
+		SchedulingID:   &schedulingID,
+		Delta:          1,
+		Reason:         pgstore.SessionCreditRefunded,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to refund session credit: %w", err)
+	}
+	return nil
+}
+
+// refundsSessionCredit tells whether a session leaving the from status for
+// to gives its credit back: cancellations by the trainer or made at least
+// schedulingCreditRefundWindow ahead, and sessions the trainer never
+// confirmed
+func refundsSessionCredit(scheduling *pgstore.Scheduling, from, to pgstore.SchedulingStatus, actor schedulingActor, now time.Time) bool {
+	switch to {
+	case pgstore.SchedulingStatusCanceled:
+		return actor != schedulingActorStudent || scheduling.Date.Sub(now) >= schedulingCreditRefundWindow
+	case pgstore.SchedulingStatusMissed:
+		return from == pgstore.SchedulingStatusPendingConfirmation
+	default:
+		return false
+	}
+}
+
+func toCreditsResponse(packages []pgstore.GetCreditPackagesRow) *pgstore.CreditsResponse {
+	response := &pgstore.CreditsResponse{
+		Packages: make([]pgstore.CreditPackageResponse, 0, len(packages)),
+	}
+	for _, p := range packages {
+		response.Credits += p.CreditsRemaining
+		response.Packages = append(response.Packages, pgstore.CreditPackageResponse{
+			ID:               p.ID,
+			PlanID:           p.PlanID,
+			PlanName:         p.PlanName,
+			TrainerID:        p.PersonalID,
+			TrainerName:      p.PersonalName,
+			Status:           p.Status,
+			CreditsTotal:     p.CreditsTotal,
+			CreditsRemaining: p.CreditsRemaining,
+			ExpiresAt:        p.EndDate,
+		})
+	}
+	return response
+}
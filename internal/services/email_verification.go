@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+const (
+	// emailVerificationTokenLifetime is how long a verification link works
+	emailVerificationTokenLifetime = 48 * time.Hour
+
+	emailVerificationTokenPurpose = "email-verification"
+)
+
+// emailVerificationClaims is what a verification link vouches for: that the
+// user received mail at Email. Links are signed instead of stored, and stop
+// working once the user changes their email.
+type emailVerificationClaims struct {
+	Subject   string `json:"sub"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SendEmailVerification emails the user a link that verifies their email
+func (s *AuthService) SendEmailVerification(ctx context.Context, userID uuid.UUID) error {
+	user, err := s.queries.GetUserEmailVerification(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("%w: user not found", utils.ErrNotFound)
+	}
+	if user.EmailVerifiedAt != nil {
+		return fmt.Errorf("%w: email is already verified", utils.ErrConflict)
+	}
+
+	token, err := s.signEmailVerificationToken(emailVerificationClaims{
+		Subject:   user.ID.String(),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(emailVerificationTokenLifetime).Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign email verification token: %w", err)
+	}
+
+	return s.mail.SendEmailVerification(ctx, user.Email, user.Name, token, emailVerificationTokenLifetime)
+}
+
+// VerifyEmail marks the email of a verification link as verified. Opening a
+// link again after that is a no-op.
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := s.parseEmailVerificationToken(token, time.Now())
+	if err != nil {
+		return err
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return fmt.Errorf("%w: invalid verification token", utils.ErrBadRequest)
+	}
+
+	user, err := s.queries.GetUserEmailVerification(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.Email != claims.Email {
+		return fmt.Errorf("%w: invalid verification token", utils.ErrBadRequest)
+	}
+
+	err = s.queries.MarkEmailVerified(ctx, pgstore.MarkEmailVerifiedParams{
+		ID:    user.ID,
+		Email: claims.Email,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) IsEmailVerified(ctx context.Context, userID uuid.UUID) (bool, error) {
+	verified, err := s.queries.IsEmailVerified(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check email verification: %w", err)
+	}
+	return verified, nil
+}
+
+func (s *AuthService) signEmailVerificationToken(claims emailVerificationClaims) (string, error) {
+	return signToken(s.tokenKey, emailVerificationTokenPurpose, claims)
+}
+
+func (s *AuthService) parseEmailVerificationToken(token string, now time.Time) (*emailVerificationClaims, error) {
+	var claims emailVerificationClaims
+	if err := parseSignedToken(s.tokenKey, emailVerificationTokenPurpose, token, &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid verification token", utils.ErrBadRequest)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: verification link expired", utils.ErrBadRequest)
+	}
+
+	return &claims, nil
+}
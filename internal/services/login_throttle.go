@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// loginThrottlePolicy is how many failed sign ins a client IP or an account
+// gets before being locked out. Every further failure doubles the lockout, up
+// to maxLockout.
+type loginThrottlePolicy struct {
+	freeAttempts int32
+	baseLockout  time.Duration
+	maxLockout   time.Duration
+}
+
+var (
+	// An IP is allowed more failures than an account, as many users can sign
+	// in from behind the same NAT
+	ipLoginThrottle = loginThrottlePolicy{
+		freeAttempts: 20,
+		baseLockout:  time.Minute,
+		maxLockout:   time.Hour,
+	}
+	accountLoginThrottle = loginThrottlePolicy{
+		freeAttempts: 5,
+		baseLockout:  time.Minute,
+		maxLockout:   time.Hour,
+	}
+)
+
+// loginAttemptWindow is how long failed sign ins count for after the last one
+const loginAttemptWindow = 24 * time.Hour
+
+// lockout is how long sign ins are refused after the given failures
+func (p loginThrottlePolicy) lockout(failedAttempts int32) time.Duration {
+	if failedAttempts < p.freeAttempts {
+		return 0
+	}
+
+	lockout := p.baseLockout
+	for i := p.freeAttempts; i < failedAttempts && lockout < p.maxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, p.maxLockout)
+}
+
+// loginAccountKey is the key an email is throttled under. Emails without an
+// account are throttled as well, so a lockout doesn't tell they have none.
+func loginAccountKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// checkLoginLock refuses sign ins while the client IP or the account is
+// locked out
+func (s *AuthService) checkLoginLock(ctx context.Context, email string, client ClientInfo) error {
+	lockedUntil, err := s.queries.GetLoginLock(ctx, pgstore.GetLoginLockParams{
+		IPAddress: client.IPAddress,
+		Account:   loginAccountKey(email),
+		Now:       time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get login lock: %w", err)
+	}
+	if lockedUntil != nil {
+		return fmt.Errorf("%w: too many failed sign ins, try again later", utils.ErrTooManyRequests)
+	}
+	return nil
+}
+
+// recordLoginFailure counts a failed sign in against the client IP and the
+// account, locking them out once they run out of attempts
+func (s *AuthService) recordLoginFailure(ctx context.Context, email string, client ClientInfo) error {
+	now := time.Now()
+	windowStart := now.Add(-loginAttemptWindow)
+
+	if client.IPAddress != nil {
+		if err := s.throttleLogin(ctx, pgstore.LoginThrottleIP, *client.IPAddress, ipLoginThrottle, now, windowStart); err != nil {
+			return err
+		}
+	}
+	if err := s.throttleLogin(ctx, pgstore.LoginThrottleAccount, loginAccountKey(email), accountLoginThrottle, now, windowStart); err != nil {
+		return err
+	}
+
+	err := s.queries.DeleteStaleLoginThrottles(ctx, pgstore.DeleteStaleLoginThrottlesParams{
+		Now:         now,
+		WindowStart: windowStart,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete stale login throttles: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthService) throttleLogin(ctx context.Context, scope pgstore.LoginThrottleScope, key string, policy loginThrottlePolicy, now, windowStart time.Time) error {
+	failedAttempts, err := s.queries.RecordLoginFailure(ctx, pgstore.RecordLoginFailureParams{
+		Scope:       scope,
+		Key:         key,
+		Now:         now,
+		WindowStart: windowStart,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	lockout := policy.lockout(failedAttempts)
+	if lockout == 0 {
+		return nil
+	}
+
+	err = s.queries.LockLogin(ctx, pgstore.LockLoginParams{
+		Scope:       scope,
+		Key:         key,
+		LockedUntil: now.Add(lockout),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to lock login: %w", err)
+	}
+	return nil
+}
+
+// recordLoginSuccess forgets the failed sign ins of the account. Those of
+// the IP still count, or signing in to an account of one's own would let a
+// client guess the passwords of others indefinitely.
+func (s *AuthService) recordLoginSuccess(ctx context.Context, email string) error {
+	err := s.queries.DeleteLoginThrottle(ctx, pgstore.DeleteLoginThrottleParams{
+		Scope: pgstore.LoginThrottleAccount,
+		Key:   loginAccountKey(email),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+	return nil
+}
+
+// GetLoginLockouts lists the client IPs and accounts that are locked out
+func (s *AuthService) GetLoginLockouts(ctx context.Context, page, limit string) ([]pgstore.LoginThrottle, error) {
+	pageInt := 1
+	limitInt := 20
+
+	if page != "" {
+		if p, err := strconv.Atoi(page); err == nil && p > 0 {
+			pageInt = p
+		}
+	}
+
+	if limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 && l <= 100 {
+			limitInt = l
+		}
+	}
+
+	lockouts, err := s.queries.GetLoginLockouts(ctx, pgstore.GetLoginLockoutsParams{
+		Now:    time.Now(),
+		Limit:  int32(limitInt),
+		Offset: int32((pageInt - 1) * limitInt),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login lockouts: %w", err)
+	}
+	return lockouts, nil
+}
+
+// ClearLoginLockout lifts a lockout and forgets its failed sign ins
+func (s *AuthService) ClearLoginLockout(ctx context.Context, id uuid.UUID) error {
+	deleted, err := s.queries.DeleteLoginThrottleByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to clear login lockout: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: lockout not found", utils.ErrNotFound)
+	}
+	return nil
+}
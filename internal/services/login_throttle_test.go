@@ -0,0 +1,37 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginThrottleLockout(t *testing.T) {
+	policy := loginThrottlePolicy{
+		freeAttempts: 5,
+		baseLockout:  time.Minute,
+		maxLockout:   time.Hour,
+	}
+
+	tests := []struct {
+		name           string
+		failedAttempts int32
+		want           time.Duration
+	}{
+		{"no failures", 0, 0},
+		{"last free attempt", 4, 0},
+		{"first lockout", 5, time.Minute},
+		{"doubles", 6, 2 * time.Minute},
+		{"doubles again", 7, 4 * time.Minute},
+		{"below the cap", 10, 32 * time.Minute},
+		{"reaches the cap", 11, time.Hour},
+		{"stays at the cap", 1000, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.lockout(tt.failedAttempts); got != tt.want {
+				t.Errorf("lockout(%d) = %v, want %v", tt.failedAttempts, got, tt.want)
+			}
+		})
+	}
+}
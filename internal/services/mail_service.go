@@ -1,15 +1,84 @@
 package services
 
 import (
-	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"context"
+	"fmt"
+	"net/url"
+	"time"
 )
 
+type MailConfig struct {
+	From string
+	// FrontendURL is the web app the links in the emails open
+	FrontendURL string
+}
+
 type MailService struct {
-	queries *pgstore.Queries
+	mailer Mailer
+	config MailConfig
 }
 
-func NewMailService(queries *pgstore.Queries) *MailService {
+func NewMailService(mailer Mailer, config MailConfig) *MailService {
 	return &MailService{
-		queries: queries,
+		mailer: mailer,
+		config: config,
+	}
+}
+
+// SendPasswordReset emails the user a link to choose a new password with the
+// reset token
+func (s *MailService) SendPasswordReset(ctx context.Context, email, name, token string, expiresIn time.Duration) error {
+	link := s.link("/reset-password", token)
+
+	err := s.mailer.Send(ctx, MailMessage{
+		From:    s.config.From,
+		To:      email,
+		Subject: "Reset your PandoraGym password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"We received a request to reset your PandoraGym password. Open the link below to choose a new one:\n\n"+
+			"%s\n\n"+
+			"The link expires in %s and can be used once. If you did not ask for it, you can ignore this email.\n",
+			name, link, formatMailDuration(expiresIn)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+	return nil
+}
+
+// SendEmailVerification emails the user a link that proves they own the
+// email
+func (s *MailService) SendEmailVerification(ctx context.Context, email, name, token string, expiresIn time.Duration) error {
+	link := s.link("/verify-email", token)
+
+	err := s.mailer.Send(ctx, MailMessage{
+		From:    s.config.From,
+		To:      email,
+		Subject: "Verify your PandoraGym email",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Welcome to PandoraGym! Open the link below to verify your email:\n\n"+
+			"%s\n\n"+
+			"The link expires in %s. If you did not create an account, you can ignore this email.\n",
+			name, link, formatMailDuration(expiresIn)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email verification email: %w", err)
+	}
+	return nil
+}
+
+// link points to a page of the web app with the token in its query string
+func (s *MailService) link(path, token string) string {
+	return s.config.FrontendURL + path + "?" + url.Values{"token": {token}}.Encode()
+}
+
+func formatMailDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		hours := int(d / time.Hour)
+		if hours == 1 {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", hours)
 	}
+	return fmt.Sprintf("%d minutes", int(d/time.Minute))
 }
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogMailerBody(t *testing.T) {
+	message := MailMessage{
+		From:    "PandoraGym <no-reply@pandoragym.com>",
+		To:      "student@example.com",
+		Subject: "Reset your password",
+		Body:    "https://pandoragym.com/reset-password?token=secret-token",
+	}
+
+	tests := []struct {
+		name        string
+		includeBody bool
+	}{
+		{"body left out by default", false},
+		{"body logged when asked", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			mailer := &LogMailer{Logger: slog.New(slog.NewTextHandler(&out, nil)), IncludeBody: tt.includeBody}
+			if err := mailer.Send(context.Background(), message); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			logged := out.String()
+			if !strings.Contains(logged, message.To) || !strings.Contains(logged, message.Subject) {
+				t.Errorf("log = %q, want the recipient and subject", logged)
+			}
+			if got := strings.Contains(logged, "secret-token"); got != tt.includeBody {
+				t.Errorf("log contains the body = %t, want %t", got, tt.includeBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,526 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+const (
+	// mfaChallengeLifetime is how long a user who got the password right has
+	// to enter their code
+	mfaChallengeLifetime = 5 * time.Minute
+
+	// After mfaMaxFailedAttempts wrong codes in a row, codes are refused for
+	// mfaLockoutDuration
+	mfaMaxFailedAttempts = 5
+	mfaLockoutDuration   = 15 * time.Minute
+
+	recoveryCodeCount = 10
+
+	mfaTokenPurpose = "mfa"
+)
+
+// mfaChallengeClaims is what an MFA token vouches for: that the holder knew
+// the password of the user, and may finish signing in with a code
+type mfaChallengeClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// GetMFAStatus tells whether the user has two-factor authentication enabled
+// and whether their role requires it
+func (s *AuthService) GetMFAStatus(ctx context.Context, userID uuid.UUID, role pgstore.Role) (*pgstore.MFAStatusResponse, error) {
+	totp, err := s.queries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor authentication: %w", err)
+	}
+
+	required, err := s.queries.IsMFARequiredForRole(ctx, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor authentication policy: %w", err)
+	}
+
+	status := &pgstore.MFAStatusResponse{Required: required}
+	if totp != nil && totp.EnabledAt != nil {
+		status.Enabled = true
+		status.EnabledAt = totp.EnabledAt
+
+		status.RecoveryCodesLeft, err = s.queries.CountUnusedRecoveryCodes(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+		}
+	}
+
+	return status, nil
+}
+
+// StartTOTPEnrollment creates the TOTP secret for the user's authenticator
+// app. It is not used to sign in until ConfirmTOTPEnrollment gets a code
+// produced from it, and starting over replaces it.
+func (s *AuthService) StartTOTPEnrollment(ctx context.Context, userID uuid.UUID) (*pgstore.TOTPEnrollmentResponse, error) {
+	user, err := s.queries.GetUserEmailVerification(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: user not found", utils.ErrNotFound)
+	}
+
+	secret := generateTOTPSecret()
+	encrypted, err := s.encryptTOTPSecret(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+
+	created, err := s.queries.CreatePendingTOTP(ctx, pgstore.CreatePendingTOTPParams{
+		UserID: userID,
+		Secret: encrypted,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create TOTP: %w", err)
+	}
+	if !created {
+		return nil, fmt.Errorf("%w: two-factor authentication is already enabled", utils.ErrConflict)
+	}
+
+	uri := totpURI(secret, user.Email)
+	qrCode, err := totpQRCodeDataURI(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render TOTP QR code: %w", err)
+	}
+
+	return &pgstore.TOTPEnrollmentResponse{
+		Secret:     totpSecretEncoding.EncodeToString(secret),
+		OTPAuthURI: uri,
+		QRCode:     qrCode,
+	}, nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication once the user
+// enters a code from their authenticator app, and returns their recovery
+// codes. They are only ever shown here.
+func (s *AuthService) ConfirmTOTPEnrollment(ctx context.Context, userID uuid.UUID, code string) (*pgstore.RecoveryCodesResponse, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	totp, err := txQueries.GetUserTOTPForUpdate(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor authentication: %w", err)
+	}
+	if totp == nil {
+		return nil, fmt.Errorf("%w: two-factor authentication setup was not started", utils.ErrBadRequest)
+	}
+	if totp.EnabledAt != nil {
+		return nil, fmt.Errorf("%w: two-factor authentication is already enabled", utils.ErrConflict)
+	}
+
+	secret, err := s.decryptTOTPSecret(totp.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+
+	step, ok := matchTOTPCode(secret, normalizeMFACode(code), time.Now(), nil)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid code", utils.ErrBadRequest)
+	}
+
+	err = txQueries.EnableTOTP(ctx, pgstore.UseTOTPStepParams{
+		UserID: userID,
+		Step:   step,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, txQueries, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &pgstore.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP turns two-factor authentication off, which takes a valid code.
+// Users whose role requires it can't turn it off.
+func (s *AuthService) DisableTOTP(ctx context.Context, userID uuid.UUID, role pgstore.Role, code string) error {
+	required, err := s.queries.IsMFARequiredForRole(ctx, role)
+	if err != nil {
+		return fmt.Errorf("failed to get two-factor authentication policy: %w", err)
+	}
+	if required {
+		return fmt.Errorf("%w: two-factor authentication is required for your role", utils.ErrForbidden)
+	}
+
+	if err := s.verifyMFACode(ctx, userID, code); err != nil {
+		return err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	if err := txQueries.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if err := txQueries.DeleteUserTOTP(ctx, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user, which
+// takes a valid code
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) (*pgstore.RecoveryCodesResponse, error) {
+	if err := s.verifyMFACode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	codes, err := s.replaceRecoveryCodes(ctx, s.queries.WithTx(tx), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &pgstore.RecoveryCodesResponse{RecoveryCodes: codes}, nil
+}
+
+// CompleteMFA finishes a session sign in that AuthenticateWithPassword left
+// waiting for a code
+func (s *AuthService) CompleteMFA(ctx context.Context, code string, client ClientInfo) (*pgstore.UserResponse, error) {
+	userIDStr := s.sessionManager.GetString(ctx, "mfa_user_id")
+	expiresAt := s.sessionManager.GetInt64(ctx, "mfa_expires_at")
+	if userIDStr == "" || time.Now().Unix() >= expiresAt {
+		return nil, fmt.Errorf("%w: no two-factor sign in pending", utils.ErrUnauthorized)
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID in session: %w", err)
+	}
+
+	if err := s.verifyMFACode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	user, err := s.queries.GetUserById(ctx, pgstore.GetUserByIdParams{ID: userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	s.sessionManager.Remove(ctx, "mfa_user_id")
+	s.sessionManager.Remove(ctx, "mfa_expires_at")
+	if err := s.startSession(ctx, user.ID, user.Role, user.Email, user.Name, client); err != nil {
+		return nil, err
+	}
+
+	return &pgstore.UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Phone:     user.Phone,
+		AvatarURL: user.AvatarURL,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}, nil
+}
+
+// CompleteMFAForTokens finishes a token sign in with the MFA token that
+// AuthenticateForTokens returned
+func (s *AuthService) CompleteMFAForTokens(ctx context.Context, mfaToken, code string, client ClientInfo) (*pgstore.AuthenticateResponse, error) {
+	var claims mfaChallengeClaims
+	if err := parseSignedToken(s.tokenKey, mfaTokenPurpose, mfaToken, &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid MFA token", utils.ErrUnauthorized)
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: MFA token expired", utils.ErrUnauthorized)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid MFA token", utils.ErrUnauthorized)
+	}
+
+	if err := s.verifyMFACode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	user, err := s.queries.GetUserById(ctx, pgstore.GetUserByIdParams{ID: userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.issueTokenPair(ctx, &pgstore.UserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Phone:     user.Phone,
+		AvatarURL: user.AvatarURL,
+		Role:      user.Role,
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}, client)
+}
+
+// IsMFASetupRequired reports whether the user's role requires two-factor
+// authentication that the user hasn't enabled yet
+func (s *AuthService) IsMFASetupRequired(ctx context.Context, userID uuid.UUID, role pgstore.Role) (bool, error) {
+	required, err := s.queries.IsMFASetupRequired(ctx, pgstore.IsMFASetupRequiredParams{
+		UserID: userID,
+		Role:   role,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to check two-factor authentication: %w", err)
+	}
+	return required, nil
+}
+
+func (s *AuthService) GetMFARolePolicies(ctx context.Context) ([]pgstore.MFARolePolicy, error) {
+	policies, err := s.queries.GetMFARolePolicies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor authentication policies: %w", err)
+	}
+	return policies, nil
+}
+
+// SetMFARolePolicy sets whether users of a role must enable two-factor
+// authentication. Only trainers and admins can be required to.
+func (s *AuthService) SetMFARolePolicy(ctx context.Context, role pgstore.Role, required bool) (*pgstore.MFARolePolicy, error) {
+	if role != pgstore.RolePersonal && role != pgstore.RoleAdmin {
+		return nil, fmt.Errorf("%w: two-factor authentication can only be required for PERSONAL and ADMIN", utils.ErrBadRequest)
+	}
+
+	policy, err := s.queries.SetMFARolePolicy(ctx, pgstore.SetMFARolePolicyParams{
+		Role:     role,
+		Required: required,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set two-factor authentication policy: %w", err)
+	}
+	return policy, nil
+}
+
+// startMFAChallenge leaves the session signed out but waiting for a code,
+// under a new token as the user proved they know the password
+func (s *AuthService) startMFAChallenge(ctx context.Context, userID uuid.UUID) (*pgstore.MFAChallengeResponse, error) {
+	if token := s.sessionManager.Token(ctx); token != "" {
+		if err := s.queries.DeleteUserSession(ctx, token); err != nil {
+			return nil, fmt.Errorf("failed to delete session index: %w", err)
+		}
+	}
+	if err := s.sessionManager.Clear(ctx); err != nil {
+		return nil, fmt.Errorf("failed to clear session: %w", err)
+	}
+	if err := s.sessionManager.RenewToken(ctx); err != nil {
+		return nil, fmt.Errorf("failed to renew session token: %w", err)
+	}
+
+	s.sessionManager.Put(ctx, "mfa_user_id", userID.String())
+	s.sessionManager.Put(ctx, "mfa_expires_at", time.Now().Add(mfaChallengeLifetime).Unix())
+
+	return &pgstore.MFAChallengeResponse{
+		MFARequired: true,
+		ExpiresIn:   int64(mfaChallengeLifetime.Seconds()),
+	}, nil
+}
+
+// newMFATokenChallenge hands token clients an MFA token to send back with
+// their code
+func (s *AuthService) newMFATokenChallenge(userID uuid.UUID) (*pgstore.MFAChallengeResponse, error) {
+	token, err := signToken(s.tokenKey, mfaTokenPurpose, mfaChallengeClaims{
+		Subject:   userID.String(),
+		ExpiresAt: time.Now().Add(mfaChallengeLifetime).Unix(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign MFA token: %w", err)
+	}
+
+	return &pgstore.MFAChallengeResponse{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(mfaChallengeLifetime.Seconds()),
+	}, nil
+}
+
+// isMFAEnabled reports whether signing in as the user takes a code
+func (s *AuthService) isMFAEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	totp, err := s.queries.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get two-factor authentication: %w", err)
+	}
+	return totp != nil && totp.EnabledAt != nil, nil
+}
+
+// verifyMFACode accepts a TOTP code or an unused recovery code of the user,
+// using it up. Wrong codes count towards locking the user's codes out for a
+// while, so they can't be guessed.
+func (s *AuthService) verifyMFACode(ctx context.Context, userID uuid.UUID, code string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	totp, err := txQueries.GetUserTOTPForUpdate(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get two-factor authentication: %w", err)
+	}
+	if totp == nil || totp.EnabledAt == nil {
+		return fmt.Errorf("%w: two-factor authentication is not enabled", utils.ErrUnauthorized)
+	}
+
+	now := time.Now()
+	if totp.LockedUntil != nil && now.Before(*totp.LockedUntil) {
+		return fmt.Errorf("%w: too many invalid codes, try again later", utils.ErrUnauthorized)
+	}
+
+	code = normalizeMFACode(code)
+	accepted := false
+	if isTOTPCode(code) {
+		secret, err := s.decryptTOTPSecret(totp.Secret)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+		}
+
+		var step int64
+		if step, accepted = matchTOTPCode(secret, code, now, totp.LastUsedStep); accepted {
+			err = txQueries.UseTOTPStep(ctx, pgstore.UseTOTPStepParams{
+				UserID: userID,
+				Step:   step,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to record TOTP use: %w", err)
+			}
+		}
+	} else {
+		accepted, err = txQueries.UseRecoveryCode(ctx, pgstore.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: hashAuthToken(code),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to use recovery code: %w", err)
+		}
+		if accepted {
+			if err := txQueries.ResetTOTPFailures(ctx, userID); err != nil {
+				return fmt.Errorf("failed to reset failed attempts: %w", err)
+			}
+		}
+	}
+
+	if !accepted {
+		err = txQueries.RecordTOTPFailure(ctx, pgstore.RecordTOTPFailureParams{
+			UserID:      userID,
+			MaxAttempts: mfaMaxFailedAttempts,
+			LockedUntil: now.Add(mfaLockoutDuration),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record failed attempt: %w", err)
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if !accepted {
+		return fmt.Errorf("%w: invalid code", utils.ErrUnauthorized)
+	}
+	return nil
+}
+
+// replaceRecoveryCodes swaps the recovery codes of the user for new ones, and
+// returns them in the xxxx-xxxx form they are shown in
+func (s *AuthService) replaceRecoveryCodes(ctx context.Context, queries *pgstore.Queries, userID uuid.UUID) ([]string, error) {
+	if err := queries.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code := s.generateSecureToken()[:8]
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashAuthToken(code)
+	}
+
+	err := queries.CreateRecoveryCodes(ctx, pgstore.CreateRecoveryCodesParams{
+		UserID:     userID,
+		CodeHashes: hashes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// encryptTOTPSecret seals a TOTP secret with AES-GCM under the MFA key, so a
+// database dump alone doesn't give away codes. The nonce comes first.
+func (s *AuthService) encryptTOTPSecret(secret []byte) ([]byte, error) {
+	aead, err := s.mfaAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, secret, nil), nil
+}
+
+func (s *AuthService) decryptTOTPSecret(encrypted []byte) ([]byte, error) {
+	aead, err := s.mfaAEAD()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encrypted) < aead.NonceSize() {
+		return nil, errors.New("encrypted TOTP secret is too short")
+	}
+	nonce, sealed := encrypted[:aead.NonceSize()], encrypted[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+func (s *AuthService) mfaAEAD() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.mfaKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+)
+
+// ErrPaymentGatewayUnavailable is returned when the gateway could not be
+// reached; the outcome of the charge is unknown
+var ErrPaymentGatewayUnavailable = errors.New("payment gateway unavailable")
+
+type ChargeRequest struct {
+	// IdempotencyKey identifies the charge to the provider, so retrying a
+	// request never charges twice
+	IdempotencyKey string
+	Amount         pgstore.Money
+	Method         pgstore.PaymentMethod
+	Token          string
+	Description    string
+}
+
+type ChargeResult struct {
+	ProviderPaymentID string
+	Status            pgstore.PaymentStatus
+	FailureReason     string
+}
+
+// PaymentGateway is a payment provider able to charge tokenized payment
+// methods. Charges may complete asynchronously, in which case they are
+// returned as PENDING and Status reports their outcome later.
+type PaymentGateway interface {
+	Name() string
+	Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error)
+	Refund(ctx context.Context, providerPaymentID string, amount pgstore.Money) (pgstore.PaymentStatus, error)
+	Status(ctx context.Context, providerPaymentID string) (pgstore.PaymentStatus, error)
+}
+
+// Tokens understood by the fake gateway. Any other token is charged
+// successfully.
+const (
+	FakeTokenDeclined          = "tok_declined"
+	FakeTokenInsufficientFunds = "tok_insufficient_funds"
+	FakeTokenPending           = "tok_pending"
+	FakeTokenUnavailable       = "tok_unavailable"
+)
+
+type fakePaymentGateway struct {
+	mu       sync.Mutex
+	payments map[string]pgstore.PaymentStatus
+}
+
+// NewFakePaymentGateway returns an in-memory gateway for development and
+// tests. The outcome of a charge depends only on the token prefix:
+// tok_declined and tok_insufficient_funds fail, tok_pending stays pending,
+// tok_unavailable behaves as a network error and anything else completes.
+func NewFakePaymentGateway() PaymentGateway {
+	return &fakePaymentGateway{
+		payments: make(map[string]pgstore.PaymentStatus),
+	}
+}
+
+func (g *fakePaymentGateway) Name() string {
+	return "fake"
+}
+
+func (g *fakePaymentGateway) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	if strings.HasPrefix(req.Token, FakeTokenUnavailable) {
+		return nil, ErrPaymentGatewayUnavailable
+	}
+
+	sum := sha256.Sum256([]byte(req.IdempotencyKey))
+	result := &ChargeResult{
+		ProviderPaymentID: "fake_" + hex.EncodeToString(sum[:12]),
+		Status:            pgstore.PaymentStatusCompleted,
+	}
+
+	switch {
+	case strings.HasPrefix(req.Token, FakeTokenDeclined):
+		result.Status = pgstore.PaymentStatusFailed
+		result.FailureReason = "card declined"
+	case strings.HasPrefix(req.Token, FakeTokenInsufficientFunds):
+		result.Status = pgstore.PaymentStatusFailed
+		result.FailureReason = "insufficient funds"
+	case strings.HasPrefix(req.Token, FakeTokenPending):
+		result.Status = pgstore.PaymentStatusPending
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Replaying an idempotency key returns the original outcome
+	if status, ok := g.payments[result.ProviderPaymentID]; ok {
+		result.Status = status
+		return result, nil
+	}
+	g.payments[result.ProviderPaymentID] = result.Status
+
+	return result, nil
+}
+
+func (g *fakePaymentGateway) Refund(ctx context.Context, providerPaymentID string, amount pgstore.Money) (pgstore.PaymentStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status, ok := g.payments[providerPaymentID]
+	if !ok {
+		return "", fmt.Errorf("unknown payment %s", providerPaymentID)
+	}
+	if status != pgstore.PaymentStatusCompleted {
+		return "", fmt.Errorf("payment %s is %s and cannot be refunded", providerPaymentID, status)
+	}
+
+	g.payments[providerPaymentID] = pgstore.PaymentStatusRefunded
+	return pgstore.PaymentStatusRefunded, nil
+}
+
+func (g *fakePaymentGateway) Status(ctx context.Context, providerPaymentID string) (pgstore.PaymentStatus, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status, ok := g.payments[providerPaymentID]
+	if !ok {
+		return "", fmt.Errorf("unknown payment %s", providerPaymentID)
+	}
+	return status, nil
+}
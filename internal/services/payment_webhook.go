@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// PaymentWebhookSignatureHeader carries "t=<unix seconds>,v1=<hex>", where v1
+// is the HMAC-SHA256 of "<t>.<body>" with the webhook secret
+const PaymentWebhookSignatureHeader = "X-Webhook-Signature"
+
+// paymentWebhookTolerance bounds how old a signed notification may be, so a
+// captured request cannot be replayed later
+const paymentWebhookTolerance = 5 * time.Minute
+
+// Notification types sent by payment providers
+const (
+	PaymentWebhookCompleted  = "payment.completed"
+	PaymentWebhookFailed     = "payment.failed"
+	PaymentWebhookRefunded   = "payment.refunded"
+	PaymentWebhookChargeback = "payment.chargeback"
+)
+
+// Outcomes of a notification
+const (
+	paymentWebhookProcessed = "processed"
+	paymentWebhookDuplicate = "duplicate"
+	paymentWebhookIgnored   = "ignored"
+)
+
+// HandlePaymentWebhook verifies and applies a notification from a payment
+// provider. Each event is applied once; redeliveries report "duplicate".
+// Events about unknown payments, or that no longer apply to the payment's
+// status, are recorded as "ignored" so the provider stops retrying them.
+func (s *PlanService) HandlePaymentWebhook(ctx context.Context, provider, signature string, payload []byte) (*pgstore.PaymentWebhookResponse, error) {
+	if provider != s.gateway.Name() && (provider != PixProvider || !s.config.Pix.Enabled()) {
+		return nil, fmt.Errorf("%w: unknown payment provider", utils.ErrNotFound)
+	}
+	if s.config.WebhookSecret == "" {
+		return nil, fmt.Errorf("%w: payment webhooks are not configured", utils.ErrUnauthorized)
+	}
+	if err := verifyPaymentWebhookSignature(s.config.WebhookSecret, signature, payload, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrUnauthorized, err)
+	}
+
+	var event pgstore.PaymentWebhookRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("%w: invalid payload", utils.ErrBadRequest)
+	}
+	if err := utils.ValidateStruct(event); err != nil {
+		return nil, fmt.Errorf("%w: %v", utils.ErrBadRequest, err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	outcome := paymentWebhookIgnored
+	var paymentID *uuid.UUID
+
+	payment, err := txQueries.GetPaymentByProviderIdForUpdate(ctx, pgstore.GetPaymentByProviderIdParams{
+		Provider:          provider,
+		ProviderPaymentID: event.PaymentID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	status, reason, known := paymentWebhookStatus(event)
+	if payment != nil && known {
+		paymentID = &payment.ID
+
+		_, _, err := s.transitionPayment(ctx, txQueries, payment, status, nil, reason)
+		switch {
+		case err == nil:
+			outcome = paymentWebhookProcessed
+		case errors.Is(err, utils.ErrConflict):
+			// e.g. a failure reported after the payment completed
+		default:
+			return nil, err
+		}
+	}
+
+	recorded, err := txQueries.CreatePaymentWebhookEvent(ctx, pgstore.CreatePaymentWebhookEventParams{
+		Provider:  provider,
+		EventID:   event.ID,
+		EventType: event.Type,
+		PaymentID: paymentID,
+		Payload:   payload,
+		Outcome:   outcome,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record webhook event: %w", err)
+	}
+	if !recorded {
+		// Already applied by an earlier delivery; drop this one's changes
+		return &pgstore.PaymentWebhookResponse{Outcome: paymentWebhookDuplicate}, nil
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &pgstore.PaymentWebhookResponse{Outcome: outcome}, nil
+}
+
+// paymentWebhookStatus maps a notification to the payment status it reports.
+// A chargeback is a refund forced by the payer's bank.
+func paymentWebhookStatus(event pgstore.PaymentWebhookRequest) (pgstore.PaymentStatus, *string, bool) {
+	switch event.Type {
+	case PaymentWebhookCompleted:
+		return pgstore.PaymentStatusCompleted, nil, true
+	case PaymentWebhookFailed:
+		return pgstore.PaymentStatusFailed, event.Reason, true
+	case PaymentWebhookRefunded:
+		return pgstore.PaymentStatusRefunded, event.Reason, true
+	case PaymentWebhookChargeback:
+		reason := "chargeback"
+		if event.Reason != nil && *event.Reason != "" {
+			reason += ": " + *event.Reason
+		}
+		return pgstore.PaymentStatusRefunded, &reason, true
+	default:
+		return "", nil, false
+	}
+}
+
+// SignPaymentWebhook returns the signature header value for a payload, as a
+// provider would send it
+func SignPaymentWebhook(secret string, payload []byte, timestamp time.Time) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + t + ",v1=" + paymentWebhookMAC(secret, t, payload)
+}
+
+func verifyPaymentWebhookSignature(secret, header string, payload []byte, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return errors.New("missing webhook signature")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid webhook signature timestamp")
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > paymentWebhookTolerance || age < -paymentWebhookTolerance {
+		return errors.New("webhook signature timestamp outside the tolerance")
+	}
+
+	expected := paymentWebhookMAC(secret, timestamp, payload)
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.New("invalid webhook signature")
+}
+
+func paymentWebhookMAC(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// startPendingCardPayment subscribes a new student to a new trainer plan and
+// starts a card payment the fake gateway leaves PENDING. It returns the
+// student and the stored payment.
+func startPendingCardPayment(t *testing.T, pool *pgxpool.Pool, service *PlanService) (uuid.UUID, *pgstore.Payment) {
+	t.Helper()
+	ctx := context.Background()
+
+	trainerID := createTestUser(t, pool, pgstore.RolePersonal)
+	studentID := createTestUser(t, pool, pgstore.RoleStudent)
+
+	plan, err := service.CreatePlan(ctx, trainerID, pgstore.PlanRequest{
+		Name:     "Monthly",
+		Price:    pgstore.NewMoney(10000),
+		Duration: 30,
+	})
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+
+	subscription, err := service.SubscribeToPlan(ctx, studentID, pgstore.SubscriptionRequest{PlanID: plan.ID.String()})
+	if err != nil {
+		t.Fatalf("SubscribeToPlan() error = %v", err)
+	}
+
+	response, err := service.ProcessPayment(ctx, studentID, subscription.ID, pgstore.PaymentMethodCreditCard, FakeTokenPending)
+	if err != nil {
+		t.Fatalf("ProcessPayment() error = %v", err)
+	}
+	if response.Status != pgstore.PaymentStatusPending {
+		t.Fatalf("payment status = %s, want %s", response.Status, pgstore.PaymentStatusPending)
+	}
+
+	payment, err := service.queries.GetPaymentById(ctx, response.ID)
+	if err != nil {
+		t.Fatalf("GetPaymentById() error = %v", err)
+	}
+	return studentID, payment
+}
+
+// sendPaymentWebhook delivers a signed notification about the payment
+func sendPaymentWebhook(t *testing.T, service *PlanService, eventID, eventType string, payment *pgstore.Payment) string {
+	t.Helper()
+
+	payload, err := json.Marshal(pgstore.PaymentWebhookRequest{
+		ID:        eventID,
+		Type:      eventType,
+		PaymentID: *payment.ProviderPaymentID,
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	signature := SignPaymentWebhook(testWebhookSecret, payload, time.Now())
+	response, err := service.HandlePaymentWebhook(context.Background(), service.gateway.Name(), signature, payload)
+	if err != nil {
+		t.Fatalf("HandlePaymentWebhook() error = %v", err)
+	}
+	return response.Outcome
+}
+
+// countRevenueEntries counts the ledger entries of the payment of the type
+func countRevenueEntries(t *testing.T, pool *pgxpool.Pool, paymentID uuid.UUID, entryType string) int {
+	t.Helper()
+
+	var count int
+	err := pool.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM revenue_entry WHERE payment_id = $1 AND type = $2", paymentID, entryType,
+	).Scan(&count)
+	if err != nil {
+		t.Fatalf("count revenue entries: %v", err)
+	}
+	return count
+}
+
+func TestPaymentWebhookAppliesEachEventOnce(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := NewPlanService(pgstore.New(pool), pool, NewFakePaymentGateway(), PaymentConfig{WebhookSecret: testWebhookSecret})
+
+	_, payment := startPendingCardPayment(t, pool, service)
+	eventID := "evt_" + uuid.NewString()
+
+	if outcome := sendPaymentWebhook(t, service, eventID, PaymentWebhookCompleted, payment); outcome != paymentWebhookProcessed {
+		t.Fatalf("first delivery outcome = %s, want %s", outcome, paymentWebhookProcessed)
+	}
+	if outcome := sendPaymentWebhook(t, service, eventID, PaymentWebhookCompleted, payment); outcome != paymentWebhookDuplicate {
+		t.Fatalf("second delivery outcome = %s, want %s", outcome, paymentWebhookDuplicate)
+	}
+
+	subscription, err := service.queries.GetSubscriptionById(ctx, payment.SubscriptionID)
+	if err != nil {
+		t.Fatalf("GetSubscriptionById() error = %v", err)
+	}
+	if subscription.Status != pgstore.SubscriptionStatusActive {
+		t.Errorf("subscription status = %s, want %s", subscription.Status, pgstore.SubscriptionStatusActive)
+	}
+	if count := countRevenueEntries(t, pool, payment.ID, "CHARGE"); count != 1 {
+		t.Errorf("charge entries = %d, want 1", count)
+	}
+}
+
+func TestPaymentWebhookFlagsLatePaymentForRefund(t *testing.T) {
+	pool := testPool(t)
+	ctx := context.Background()
+	service := NewPlanService(pgstore.New(pool), pool, NewFakePaymentGateway(), PaymentConfig{WebhookSecret: testWebhookSecret})
+
+	studentID, payment := startPendingCardPayment(t, pool, service)
+
+	if _, err := service.CancelSubscription(ctx, studentID); err != nil {
+		t.Fatalf("CancelSubscription() error = %v", err)
+	}
+
+	outcome := sendPaymentWebhook(t, service, "evt_"+uuid.NewString(), PaymentWebhookCompleted, payment)
+	if outcome != paymentWebhookProcessed {
+		t.Fatalf("outcome = %s, want %s", outcome, paymentWebhookProcessed)
+	}
+
+	stored, err := service.queries.GetPaymentById(ctx, payment.ID)
+	if err != nil {
+		t.Fatalf("GetPaymentById() error = %v", err)
+	}
+	if stored.Status != pgstore.PaymentStatusCompleted || !stored.RefundDue {
+		t.Errorf("payment status = %s, refund due = %t; want %s, true", stored.Status, stored.RefundDue, pgstore.PaymentStatusCompleted)
+	}
+
+	subscription, err := service.queries.GetSubscriptionById(ctx, payment.SubscriptionID)
+	if err != nil {
+		t.Fatalf("GetSubscriptionById() error = %v", err)
+	}
+	if subscription.Status != pgstore.SubscriptionStatusCancelled {
+		t.Errorf("subscription status = %s, want %s", subscription.Status, pgstore.SubscriptionStatusCancelled)
+	}
+	if count := countRevenueEntries(t, pool, payment.ID, "CHARGE"); count != 0 {
+		t.Errorf("charge entries = %d, want 0", count)
+	}
+
+	// The refund pays the student back without touching the ledger
+	outcome = sendPaymentWebhook(t, service, "evt_"+uuid.NewString(), PaymentWebhookRefunded, payment)
+	if outcome != paymentWebhookProcessed {
+		t.Fatalf("refund outcome = %s, want %s", outcome, paymentWebhookProcessed)
+	}
+
+	stored, err = service.queries.GetPaymentById(ctx, payment.ID)
+	if err != nil {
+		t.Fatalf("GetPaymentById() error = %v", err)
+	}
+	if stored.Status != pgstore.PaymentStatusRefunded || stored.RefundDue {
+		t.Errorf("payment status = %s, refund due = %t; want %s, false", stored.Status, stored.RefundDue, pgstore.PaymentStatusRefunded)
+	}
+	if count := countRevenueEntries(t, pool, payment.ID, "REFUND"); count != 0 {
+		t.Errorf("refund entries = %d, want 0", count)
+	}
+}
+
+func TestVerifyPaymentWebhookSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment.completed","payment_id":"pay_1"}`)
+	now := time.Unix(1700000000, 0)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	valid := paymentWebhookMAC(testWebhookSecret, timestamp, payload)
+
+	tests := []struct {
+		name    string
+		header  string
+		payload []byte
+		now     time.Time
+		wantErr bool
+	}{
+		{"valid", SignPaymentWebhook(testWebhookSecret, payload, now), payload, now, false},
+		{"missing t", "v1=" + valid, payload, now, true},
+		{"missing v1", "t=" + timestamp, payload, now, true},
+		{"empty header", "", payload, now, true},
+		{"non numeric t", "t=soon,v1=" + valid, payload, now, true},
+		{"within tolerance", "t=" + timestamp + ",v1=" + valid, payload, now.Add(paymentWebhookTolerance), false},
+		{"too old", "t=" + timestamp + ",v1=" + valid, payload, now.Add(paymentWebhookTolerance + time.Second), true},
+		{"too far ahead", "t=" + timestamp + ",v1=" + valid, payload, now.Add(-paymentWebhookTolerance - time.Second), true},
+		{"valid among several v1", "t=" + timestamp + ",v1=" + strings.Repeat("0", 64) + ",v1=" + valid, payload, now, false},
+		{"no valid v1 among several", "t=" + timestamp + ",v1=" + strings.Repeat("0", 64) + ",v1=" + strings.Repeat("f", 64), payload, now, true},
+		{"other secret", SignPaymentWebhook("whsec_other", payload, now), payload, now, true},
+		{"tampered body", "t=" + timestamp + ",v1=" + valid, []byte(`{"id":"evt_1","type":"payment.completed","payment_id":"pay_2"}`), now, true},
+		{"tampered timestamp", "t=" + strconv.FormatInt(now.Unix()+1, 10) + ",v1=" + valid, payload, now, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyPaymentWebhookSignature(testWebhookSecret, tt.header, tt.payload, tt.now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyPaymentWebhookSignature(%q) error = %v, wantErr %t", tt.header, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/skip2/go-qrcode"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// PixProvider is the provider recorded for PIX payments; the receiving bank
+// confirms them through the payment webhook
+const PixProvider = "pix"
+
+// Field limits of the BR Code specification
+const (
+	pixMerchantNameLimit = 25
+	pixMerchantCityLimit = 15
+	pixTxIDLimit         = 25
+	pixDescriptionLimit  = 72
+	// pixFieldLimit is the longest value the two-digit length of a field can
+	// describe
+	pixFieldLimit = 99
+	pixQRCodeSize = 320
+)
+
+// PixConfig holds the receiving account of PIX payments. PIX is disabled
+// while Key is empty.
+type PixConfig struct {
+	Key          string
+	MerchantName string
+	MerchantCity string
+	// PaymentExpiration is how long a PIX code can be paid before the
+	// pending payment is expired
+	PaymentExpiration time.Duration
+}
+
+func (c PixConfig) Enabled() bool {
+	return c.Key != ""
+}
+
+// Validate checks that an enabled config has the merchant name and city the
+// BR Code requires, which must keep at least one character once reduced to
+// the characters banking apps accept
+func (c PixConfig) Validate() error {
+	if !c.Enabled() {
+		return nil
+	}
+	if pixText(c.MerchantName, pixMerchantNameLimit) == "" {
+		return fmt.Errorf("pix merchant name is required")
+	}
+	if pixText(c.MerchantCity, pixMerchantCityLimit) == "" {
+		return fmt.Errorf("pix merchant city is required")
+	}
+	return nil
+}
+
+// BuildPixBRCode builds the copy-and-paste payload of a single-use PIX
+// charge, following the EMV QR Code Merchant Presented Mode layout of the
+// Banco Central do Brasil BR Code manual, with the CRC16 checksum as the
+// last field
+func BuildPixBRCode(config PixConfig, amount pgstore.Money, txID, description string) (string, error) {
+	if !config.Enabled() {
+		return "", fmt.Errorf("pix key is not configured")
+	}
+	if err := config.Validate(); err != nil {
+		return "", err
+	}
+	if amount.Amount <= 0 {
+		return "", fmt.Errorf("pix amount must be positive")
+	}
+
+	// The key and the description share the 99 characters of field 26, so
+	// the description gets whatever room the key leaves
+	merchantAccount := pixField("00", "br.gov.bcb.pix") + pixField("01", config.Key)
+	if len(merchantAccount) > pixFieldLimit {
+		return "", fmt.Errorf("pix key is too long")
+	}
+	if room := pixFieldLimit - len(merchantAccount) - 4; description != "" && room > 0 {
+		if description = pixText(description, min(room, pixDescriptionLimit)); description != "" {
+			merchantAccount += pixField("02", description)
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(pixField("00", "01"))
+	// Point of initiation 12: the code is for a single payment
+	b.WriteString(pixField("01", "12"))
+	b.WriteString(pixField("26", merchantAccount))
+	b.WriteString(pixField("52", "0000"))
+	// ISO 4217 code of the Brazilian real
+	b.WriteString(pixField("53", "986"))
+	b.WriteString(pixField("54", amount.String()))
+	b.WriteString(pixField("58", "BR"))
+	b.WriteString(pixField("59", pixText(config.MerchantName, pixMerchantNameLimit)))
+	b.WriteString(pixField("60", pixText(config.MerchantCity, pixMerchantCityLimit)))
+	b.WriteString(pixField("62", pixField("05", pixTxID(txID))))
+	b.WriteString("6304")
+
+	payload := b.String()
+	return payload + fmt.Sprintf("%04X", crc16CCITT([]byte(payload))), nil
+}
+
+// PixQRCodePNG renders a BR Code payload as a PNG QR code
+func PixQRCodePNG(payload string) ([]byte, error) {
+	return qrcode.Encode(payload, qrcode.Medium, pixQRCodeSize)
+}
+
+// pixField encodes an EMV field as ID, two-digit length and value
+func pixField(id, value string) string {
+	return fmt.Sprintf("%s%02d%s", id, len(value), value)
+}
+
+// pixText reduces a value to the uppercase ASCII characters accepted by
+// banking apps, dropping accents, and cuts it to limit characters
+func pixText(value string, limit int) string {
+	stripped, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), value)
+	if err != nil {
+		stripped = value
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToUpper(strings.TrimSpace(stripped)) {
+		if r < 0x20 || r > 0x7E {
+			continue
+		}
+		b.WriteRune(r)
+		if b.Len() == limit {
+			break
+		}
+	}
+	return b.String()
+}
+
+// pixTxID keeps the alphanumeric characters of a transaction ID, up to the
+// 25 allowed; "***" means no ID
+func pixTxID(txID string) string {
+	var b strings.Builder
+	for _, r := range txID {
+		if r < 128 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			if b.Len() == pixTxIDLimit {
+				break
+			}
+		}
+	}
+	if b.Len() == 0 {
+		return "***"
+	}
+	return b.String()
+}
+
+// crc16CCITT is CRC-16/CCITT-FALSE (polynomial 0x1021, initial value 0xFFFF)
+// as required for field 63
+func crc16CCITT(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+)
+
+func TestCRC16CCITT(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want uint16
+	}{
+		{"check value", "123456789", 0x29B1},
+		{
+			"BR Code manual example",
+			"00020126580014br.gov.bcb.pix0136123e4567-e12b-12d1-a456-426655440000" +
+				"5204000053039865802BR5913Fulano de Tal6008BRASILIA62070503***6304",
+			0x1D3D,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := crc16CCITT([]byte(tt.data)); got != tt.want {
+				t.Errorf("crc16CCITT(%q) = %04X, want %04X", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+// parsePixFields splits an EMV payload into its fields, failing on lengths
+// that don't add up
+func parsePixFields(t *testing.T, payload string) map[string]string {
+	t.Helper()
+
+	fields := map[string]string{}
+	for len(payload) > 0 {
+		if len(payload) < 4 {
+			t.Fatalf("truncated field %q", payload)
+		}
+		length, err := strconv.Atoi(payload[2:4])
+		if err != nil || len(payload) < 4+length {
+			t.Fatalf("invalid field length in %q", payload)
+		}
+		fields[payload[:2]] = payload[4 : 4+length]
+		payload = payload[4+length:]
+	}
+	return fields
+}
+
+func TestBuildPixBRCode(t *testing.T) {
+	config := PixConfig{
+		Key:          "123e4567-e12b-12d1-a456-426655440000",
+		MerchantName: "Fulano de Tal",
+		MerchantCity: "Brasília",
+	}
+
+	code, err := BuildPixBRCode(config, pgstore.NewMoney(7999), "sub-42", "PandoraGym")
+	if err != nil {
+		t.Fatalf("BuildPixBRCode() error = %v", err)
+	}
+
+	payload, checksum := code[:len(code)-4], code[len(code)-4:]
+	if want := fmt.Sprintf("%04X", crc16CCITT([]byte(payload))); checksum != want {
+		t.Errorf("checksum = %s, want %s", checksum, want)
+	}
+
+	fields := parsePixFields(t, code)
+	want := map[string]string{
+		"00": "01",
+		"01": "12",
+		"52": "0000",
+		"53": "986",
+		"54": "79.99",
+		"58": "BR",
+		"59": "FULANO DE TAL",
+		"60": "BRASILIA",
+		"62": "0505sub42",
+		"63": checksum,
+	}
+	for id, value := range want {
+		if fields[id] != value {
+			t.Errorf("field %s = %q, want %q", id, fields[id], value)
+		}
+	}
+
+	account := parsePixFields(t, fields["26"])
+	if account["00"] != "br.gov.bcb.pix" || account["01"] != config.Key || account["02"] != "PANDORAGYM" {
+		t.Errorf("merchant account = %v", account)
+	}
+}
+
+func TestBuildPixBRCodeKeyLength(t *testing.T) {
+	// Field 26 holds 22 characters besides the key, so a key of 73 characters
+	// or more leaves no room for a description and one over 77 can't fit
+	domain := "@example.com"
+	tests := []struct {
+		name            string
+		key             string
+		wantErr         bool
+		wantDescription string
+	}{
+		{"short key keeps the description", "a" + domain, false, "PANDORAGYM"},
+		{"long key trims the description", strings.Repeat("a", 64-len(domain)) + domain, false, "PANDORAGY"},
+		{"longest key drops the description", strings.Repeat("a", 77-len(domain)) + domain, false, ""},
+		{"key too long for field 26", strings.Repeat("a", 78-len(domain)) + domain, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := PixConfig{Key: tt.key, MerchantName: "PandoraGym", MerchantCity: "Sao Paulo"}
+			code, err := BuildPixBRCode(config, pgstore.NewMoney(100), "tx", "PandoraGym")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("BuildPixBRCode() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPixBRCode() error = %v", err)
+			}
+
+			fields := parsePixFields(t, code)
+			if len(fields["26"]) > pixFieldLimit {
+				t.Errorf("field 26 is %d characters long", len(fields["26"]))
+			}
+			if got := parsePixFields(t, fields["26"])["02"]; got != tt.wantDescription {
+				t.Errorf("description = %q, want %q", got, tt.wantDescription)
+			}
+		})
+	}
+}
+
+func TestBuildPixBRCodeMerchant(t *testing.T) {
+	tests := []struct {
+		name     string
+		merchant string
+		city     string
+		wantErr  bool
+	}{
+		{"name and city", "PandoraGym", "Sao Paulo", false},
+		{"accents are dropped", "Ação Fitness", "São Paulo", false},
+		{"empty name", "", "Sao Paulo", true},
+		{"empty city", "PandoraGym", "", true},
+		{"blank name", "   ", "Sao Paulo", true},
+		{"name without printable ASCII", "健身房", "Sao Paulo", true},
+		{"city without printable ASCII", "PandoraGym", "北京", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := PixConfig{Key: "pix@example.com", MerchantName: tt.merchant, MerchantCity: tt.city}
+			if err := config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %t", err, tt.wantErr)
+			}
+
+			code, err := BuildPixBRCode(config, pgstore.NewMoney(100), "tx", "PandoraGym")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildPixBRCode() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if err == nil {
+				fields := parsePixFields(t, code)
+				if fields["59"] == "" || fields["60"] == "" {
+					t.Errorf("merchant name = %q, city = %q, want both set", fields["59"], fields["60"])
+				}
+			}
+		})
+	}
+}
@@ -3,257 +3,263 @@ package services
 import (
 	"context"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
+type PaymentConfig struct {
+	// WebhookSecret signs the notifications of payment providers; webhooks
+	// are rejected while it is empty
+	WebhookSecret string
+	Pix           PixConfig
+	// PlatformFeePercent is the share of every payment kept by the platform
+	PlatformFeePercent float64
+}
+
 type PlanService struct {
 	queries *pgstore.Queries
+	pool    *pgxpool.Pool
+	gateway PaymentGateway
+	config  PaymentConfig
 }
 
-func NewPlanService(queries *pgstore.Queries) *PlanService {
+func NewPlanService(queries *pgstore.Queries, pool *pgxpool.Pool, gateway PaymentGateway, config PaymentConfig) *PlanService {
 	return &PlanService{
 		queries: queries,
+		pool:    pool,
+		gateway: gateway,
+		config:  config,
 	}
 }
 
+// GetTrainerPlans lists every plan of the trainer, including deactivated ones
 func (s *PlanService) GetTrainerPlans(ctx context.Context, trainerID uuid.UUID) ([]pgstore.PlanResponse, error) {
-	return []pgstore.PlanResponse{
-		{
-			ID:              uuid.New(),
-			TrainerID:       trainerID,
-			Name:            "Basic Training Plan",
-			Description:     "A comprehensive training plan for beginners",
-			Price:           99.99,
-			Duration:        30,
-			Features:        []string{"3 workouts per week", "Nutrition guidance", "Progress tracking"},
-			IsActive:        true,
-			SubscriberCount: 15,
-			CreatedAt:       time.Now().AddDate(0, -1, 0),
-			UpdatedAt:       time.Now(),
-		},
-		{
-			ID:              uuid.New(),
-			TrainerID:       trainerID,
-			Name:            "Advanced Training Plan",
-			Description:     "Intensive training for experienced athletes",
-			Price:           149.99,
-			Duration:        30,
-			Features:        []string{"5 workouts per week", "Custom meal plans", "1-on-1 sessions", "24/7 support"},
-			IsActive:        true,
-			SubscriberCount: 8,
-			CreatedAt:       time.Now().AddDate(0, -2, 0),
-			UpdatedAt:       time.Now(),
-		},
-	}, nil
+	plans, err := s.queries.GetPlans(ctx, pgstore.GetPlansParams{
+		PersonalID: &trainerID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer plans: %w", err)
+	}
+
+	return toPlanResponses(plans), nil
 }
 
-func (s *PlanService) CreatePlan(ctx context.Context, trainerID uuid.UUID, name, description string, price float64, duration int, features []string) (*pgstore.PlanResponse, error) {
-	planID := uuid.New()
+func (s *PlanService) CreatePlan(ctx context.Context, trainerID uuid.UUID, req pgstore.PlanRequest) (*pgstore.PlanResponse, error) {
+	planType := pgstore.PlanTypeSubscription
+	if req.Type != nil {
+		planType = *req.Type
+	}
+	if err := validatePlanRequest(&req, planType); err != nil {
+		return nil, err
+	}
+	if planType == pgstore.PlanTypePackage && req.SessionCredits == nil {
+		return nil, fmt.Errorf("%w: session credits are required for package plans", utils.ErrBadRequest)
+	}
+
+	plan, err := s.queries.CreatePlan(ctx, pgstore.CreatePlanParams{
+		PersonalID:     trainerID,
+		Name:           req.Name,
+		Description:    req.Description,
+		Features:       req.Features,
+		Price:          req.Price,
+		Duration:       req.Duration,
+		Type:           planType,
+		SessionCredits: req.SessionCredits,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan: %w", err)
+	}
 
-	return &pgstore.PlanResponse{
-		ID:              planID,
-		TrainerID:       trainerID,
-		Name:            name,
-		Description:     description,
-		Price:           price,
-		Duration:        int32(duration),
-		Features:        features,
-		IsActive:        true,
-		SubscriberCount: 0,
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}, nil
+	return s.getPlanResponse(ctx, plan.ID)
 }
 
-func (s *PlanService) UpdatePlan(ctx context.Context, trainerID uuid.UUID, planID, name, description string, price float64, duration int, features []string) (*pgstore.PlanResponse, error) {
+func (s *PlanService) UpdatePlan(ctx context.Context, trainerID uuid.UUID, planID string, req pgstore.PlanRequest) (*pgstore.PlanResponse, error) {
 	planUUID, err := uuid.Parse(planID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid plan ID: %w", err)
+		return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
 	}
 
-	return &pgstore.PlanResponse{
-		ID:              planUUID,
-		TrainerID:       trainerID,
-		Name:            name,
-		Description:     description,
-		Price:           price,
-		Duration:        int32(duration),
-		Features:        features,
-		IsActive:        true,
-		SubscriberCount: 5,
-		CreatedAt:       time.Now().AddDate(0, -1, 0),
-		UpdatedAt:       time.Now(),
-	}, nil
-}
+	current, err := s.queries.GetPlanById(ctx, planUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if current == nil || current.PersonalID != trainerID {
+		return nil, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
+	}
+	if req.Type != nil && *req.Type != current.Type {
+		return nil, fmt.Errorf("%w: plan type cannot be changed", utils.ErrBadRequest)
+	}
+	if err := validatePlanRequest(&req, current.Type); err != nil {
+		return nil, err
+	}
 
-func (s *PlanService) DeletePlan(ctx context.Context, trainerID uuid.UUID, planID string) error {
-	return nil
-}
+	plan, err := s.queries.UpdatePlan(ctx, pgstore.UpdatePlanParams{
+		ID:             planUUID,
+		PersonalID:     trainerID,
+		Name:           req.Name,
+		Description:    req.Description,
+		Features:       req.Features,
+		Price:          req.Price,
+		Duration:       req.Duration,
+		SessionCredits: req.SessionCredits,
+		IsActive:       req.IsActive,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update plan: %w", err)
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
+	}
 
-func (s *PlanService) GetAllPlans(ctx context.Context) ([]pgstore.PlanResponse, error) {
-	return []pgstore.PlanResponse{
-		{
-			ID:              uuid.New(),
-			TrainerID:       uuid.New(),
-			TrainerName:     "John Smith",
-			Name:            "Weight Loss Program",
-			Description:     "Effective weight loss program with cardio and strength training",
-			Price:           79.99,
-			Duration:        30,
-			Features:        []string{"4 workouts per week", "Meal planning", "Progress tracking"},
-			IsActive:        true,
-			SubscriberCount: 25,
-			CreatedAt:       time.Now().AddDate(0, -2, 0),
-			UpdatedAt:       time.Now(),
-		},
-		{
-			ID:              uuid.New(),
-			TrainerID:       uuid.New(),
-			TrainerName:     "Sarah Johnson",
-			Name:            "Muscle Building Plan",
-			Description:     "Comprehensive muscle building program for all levels",
-			Price:           119.99,
-			Duration:        60,
-			Features:        []string{"5 workouts per week", "Supplement guidance", "Form coaching", "Monthly check-ins"},
-			IsActive:        true,
-			SubscriberCount: 18,
-			CreatedAt:       time.Now().AddDate(0, -3, 0),
-			UpdatedAt:       time.Now(),
-		},
-	}, nil
+	return s.getPlanResponse(ctx, plan.ID)
 }
 
-func (s *PlanService) GetPlanByID(ctx context.Context, planID string) (*pgstore.PlanResponse, error) {
+// DeletePlan removes a plan of the trainer. A plan that has subscribers is
+// only deactivated, so it stops accepting new ones; the returned flag reports
+// whether that happened.
+func (s *PlanService) DeletePlan(ctx context.Context, trainerID uuid.UUID, planID string) (bool, error) {
 	planUUID, err := uuid.Parse(planID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid plan ID: %w", err)
+		return false, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
 	}
 
-	return &pgstore.PlanResponse{
-		ID:              planUUID,
-		TrainerID:       uuid.New(),
-		TrainerName:     "John Smith",
-		Name:            "Weight Loss Program",
-		Description:     "Effective weight loss program with cardio and strength training",
-		Price:           79.99,
-		Duration:        30,
-		Features:        []string{"4 workouts per week", "Meal planning", "Progress tracking"},
-		IsActive:        true,
-		SubscriberCount: 25,
-		CreatedAt:       time.Now().AddDate(0, -2, 0),
-		UpdatedAt:       time.Now(),
-	}, nil
-}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-func (s *PlanService) SubscribeToPlan(ctx context.Context, userID uuid.UUID, planID string) (*pgstore.SubscriptionResponse, error) {
-	planUUID, err := uuid.Parse(planID)
+	txQueries := s.queries.WithTx(tx)
+
+	plan, err := txQueries.GetPlanForUpdate(ctx, pgstore.GetPlanForUpdateParams{
+		ID:         planUUID,
+		PersonalID: trainerID,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("invalid plan ID: %w", err)
+		return false, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan == nil {
+		return false, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
 	}
 
-	subscriptionID := uuid.New()
-	startDate := time.Now()
-	endDate := startDate.AddDate(0, 0, 30)
+	// Past subscriptions keep pointing at the plan, so it is only removed when
+	// nobody ever subscribed to it
+	deactivated, err := txQueries.PlanHasSubscriptions(ctx, plan.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check plan subscriptions: %w", err)
+	}
+
+	if deactivated {
+		err = txQueries.DeactivatePlan(ctx, plan.ID)
+	} else {
+		_, err = txQueries.DeletePlan(ctx, pgstore.DeletePlanParams{
+			ID:         plan.ID,
+			PersonalID: trainerID,
+		})
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to delete plan: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 
-	return &pgstore.SubscriptionResponse{
-		ID:        subscriptionID,
-		UserID:    userID,
-		PlanID:    planUUID,
-		PlanName:  "Weight Loss Program",
-		StartDate: startDate,
-		EndDate:   endDate,
-		Status:    pgstore.SubscriptionStatusActive,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
-	}, nil
+	return deactivated, nil
 }
 
-func (s *PlanService) CancelSubscription(ctx context.Context, userID uuid.UUID) error {
-	return nil
+// GetAllPlans lists the active plans of every trainer
+func (s *PlanService) GetAllPlans(ctx context.Context) ([]pgstore.PlanResponse, error) {
+	plans, err := s.queries.GetPlans(ctx, pgstore.GetPlansParams{
+		ActiveOnly: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plans: %w", err)
+	}
+
+	return toPlanResponses(plans), nil
 }
 
-func (s *PlanService) GetUserSubscription(ctx context.Context, userID uuid.UUID) (*pgstore.SubscriptionResponse, error) {
-	return &pgstore.SubscriptionResponse{
-		ID:        uuid.New(),
-		UserID:    userID,
-		PlanID:    uuid.New(),
-		PlanName:  "Weight Loss Program",
-		StartDate: time.Now().AddDate(0, 0, -15),
-		EndDate:   time.Now().AddDate(0, 0, 15),
-		Status:    pgstore.SubscriptionStatusActive,
-		CreatedAt: time.Now().AddDate(0, 0, -15),
-		UpdatedAt: time.Now(),
-	}, nil
+func (s *PlanService) GetPlanByID(ctx context.Context, planID string) (*pgstore.PlanResponse, error) {
+	planUUID, err := uuid.Parse(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
+	}
+
+	return s.getPlanResponse(ctx, planUUID)
 }
 
-func (s *PlanService) GetSubscriptionHistory(ctx context.Context, userID uuid.UUID) ([]pgstore.SubscriptionHistoryResponse, error) {
-	return []pgstore.SubscriptionHistoryResponse{
-		{
-			ID:          uuid.New(),
-			PlanName:    "Basic Training Plan",
-			TrainerName: "John Smith",
-			StartDate:   time.Now().AddDate(0, -2, 0),
-			EndDate:     time.Now().AddDate(0, -1, 0),
-			Status:      pgstore.SubscriptionStatusExpired,
-			Amount:      99.99,
-			CreatedAt:   time.Now().AddDate(0, -2, 0),
-		},
-		{
-			ID:          uuid.New(),
-			PlanName:    "Weight Loss Program",
-			TrainerName: "Sarah Johnson",
-			StartDate:   time.Now().AddDate(0, 0, -15),
-			EndDate:     time.Now().AddDate(0, 0, 15),
-			Status:      pgstore.SubscriptionStatusActive,
-			Amount:      79.99,
-			CreatedAt:   time.Now().AddDate(0, 0, -15),
-		},
-	}, nil
+func (s *PlanService) getPlanResponse(ctx context.Context, planID uuid.UUID) (*pgstore.PlanResponse, error) {
+	plan, err := s.queries.GetPlanById(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
+	}
+
+	response := toPlanResponse(*plan)
+	return &response, nil
 }
 
-func (s *PlanService) ProcessPayment(ctx context.Context, subscriptionID uuid.UUID, paymentMethod, paymentToken string) error {
+// validatePlanRequest normalizes the request for a plan of the given type in
+// place
+func validatePlanRequest(req *pgstore.PlanRequest, planType pgstore.PlanType) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("%w: name is required", utils.ErrBadRequest)
+	}
+	if req.Price.IsNegative() {
+		return fmt.Errorf("%w: price cannot be negative", utils.ErrBadRequest)
+	}
+	if req.Duration <= 0 {
+		return fmt.Errorf("%w: duration must be a positive number of days", utils.ErrBadRequest)
+	}
+	switch planType {
+	case pgstore.PlanTypeSubscription:
+		if req.SessionCredits != nil {
+			return fmt.Errorf("%w: only package plans grant session credits", utils.ErrBadRequest)
+		}
+	case pgstore.PlanTypePackage:
+		if req.SessionCredits != nil && *req.SessionCredits <= 0 {
+			return fmt.Errorf("%w: session credits must be positive", utils.ErrBadRequest)
+		}
+	default:
+		return fmt.Errorf("%w: invalid plan type %q", utils.ErrBadRequest, planType)
+	}
+	if req.Features == nil {
+		req.Features = []string{}
+	}
 	return nil
 }
 
-func (s *PlanService) GetPlanSubscribers(ctx context.Context, trainerID uuid.UUID, planID string) ([]pgstore.SubscriberResponse, error) {
-	return []pgstore.SubscriberResponse{
-		{
-			UserID:       uuid.New(),
-			UserName:     "Alice Johnson",
-			UserEmail:    "alice@example.com",
-			StartDate:    time.Now().AddDate(0, 0, -10),
-			EndDate:      time.Now().AddDate(0, 0, 20),
-			Status:       pgstore.SubscriptionStatusActive,
-			SubscribedAt: time.Now().AddDate(0, 0, -10),
-		},
-		{
-			UserID:       uuid.New(),
-			UserName:     "Bob Wilson",
-			UserEmail:    "bob@example.com",
-			StartDate:    time.Now().AddDate(0, 0, -5),
-			EndDate:      time.Now().AddDate(0, 0, 25),
-			Status:       pgstore.SubscriptionStatusActive,
-			SubscribedAt: time.Now().AddDate(0, 0, -5),
-		},
-	}, nil
+func toPlanResponse(plan pgstore.GetPlansRow) pgstore.PlanResponse {
+	return pgstore.PlanResponse{
+		ID:              plan.ID,
+		TrainerID:       plan.PersonalID,
+		TrainerName:     plan.PersonalName,
+		Name:            plan.Name,
+		Description:     plan.Description,
+		Price:           plan.Price,
+		Duration:        plan.Duration,
+		Features:        plan.Features,
+		Type:            plan.Type,
+		SessionCredits:  plan.SessionCredits,
+		IsActive:        plan.IsActive,
+		SubscriberCount: plan.SubscriberCount,
+		CreatedAt:       plan.CreatedAt,
+		UpdatedAt:       plan.UpdatedAt,
+	}
 }
 
-func (s *PlanService) GetPlanRevenue(ctx context.Context, trainerID uuid.UUID, planID string) (*pgstore.PlanRevenueResponse, error) {
-	planUUID, err := uuid.Parse(planID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid plan ID: %w", err)
+func toPlanResponses(plans []pgstore.GetPlansRow) []pgstore.PlanResponse {
+	responses := make([]pgstore.PlanResponse, 0, len(plans))
+	for _, plan := range plans {
+		responses = append(responses, toPlanResponse(plan))
 	}
-
-	return &pgstore.PlanRevenueResponse{
-		PlanID:            planUUID,
-		PlanName:          "Weight Loss Program",
-		TotalRevenue:      1599.80,
-		MonthlyRevenue:    479.94,
-		ActiveSubscribers: 6,
-		TotalSubscribers:  20,
-		AverageRevenue:    79.99,
-	}, nil
+	return responses
 }
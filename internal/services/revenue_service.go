@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// defaultRevenuePeriod is the range of revenue reports requested without
+// dates, ending today
+const defaultRevenuePeriod = 30 * 24 * time.Hour
+
+// maxRevenuePeriod bounds the daily buckets of a revenue report
+const maxRevenuePeriod = 366 * 24 * time.Hour
+
+// GetPlanRevenue sums what a plan of the trainer earned between the optional
+// start and end dates (both inclusive), all time by default. The monthly
+// revenue covers the last 30 days and the average is per subscriber.
+func (s *PlanService) GetPlanRevenue(ctx context.Context, trainerID uuid.UUID, planID, startDate, endDate string) (*pgstore.PlanRevenueResponse, error) {
+	planUUID, err := uuid.Parse(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
+	}
+
+	from, to, err := parseDateRange(startDate, endDate, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.queries.GetPlanById(ctx, planUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan == nil || plan.PersonalID != trainerID {
+		return nil, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
+	}
+
+	totals, err := s.queries.GetRevenueTotals(ctx, pgstore.GetRevenueTotalsParams{
+		PlanID: &plan.ID,
+		From:   from,
+		To:     to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan revenue: %w", err)
+	}
+
+	monthStart := time.Now().Add(-defaultRevenuePeriod)
+	monthly, err := s.queries.GetRevenueTotals(ctx, pgstore.GetRevenueTotalsParams{
+		PlanID: &plan.ID,
+		From:   &monthStart,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan revenue: %w", err)
+	}
+
+	counts, err := s.queries.GetPlanSubscriberCounts(ctx, plan.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count plan subscribers: %w", err)
+	}
+
+	response := &pgstore.PlanRevenueResponse{
+		PlanID:            plan.ID,
+		PlanName:          plan.Name,
+		StartDate:         from,
+		TotalRevenue:      totals.Charges.Sub(totals.Refunds),
+		Refunds:           totals.Refunds,
+		PlatformFees:      totals.PlatformFees,
+		NetRevenue:        totals.Net,
+		MonthlyRevenue:    monthly.Charges.Sub(monthly.Refunds),
+		ActiveSubscribers: counts.ActiveSubscribers,
+		TotalSubscribers:  counts.TotalSubscribers,
+	}
+	if to != nil {
+		// The range is reported with its inclusive end date
+		end := to.AddDate(0, 0, -1)
+		response.EndDate = &end
+	}
+	if counts.TotalSubscribers > 0 {
+		response.AverageRevenue = response.TotalRevenue.Div(int64(counts.TotalSubscribers))
+	}
+
+	return response, nil
+}
+
+// GetTrainerRevenue summarises the earnings of the trainer between the start
+// and end dates (both inclusive), the last 30 days by default: the ledger
+// totals with daily buckets, the monthly recurring revenue of the active
+// subscriptions and the share of subscribers lost during the period.
+func (s *PlanService) GetTrainerRevenue(ctx context.Context, trainerID uuid.UUID, startDate, endDate string) (*pgstore.TrainerRevenueResponse, error) {
+	from, to, err := revenueDateRange(startDate, endDate, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := s.queries.GetRevenueTotals(ctx, pgstore.GetRevenueTotalsParams{
+		PersonalID: &trainerID,
+		From:       &from,
+		To:         &to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer revenue: %w", err)
+	}
+
+	days, err := s.queries.GetDailyRevenue(ctx, pgstore.GetDailyRevenueParams{
+		PersonalID: &trainerID,
+		From:       from,
+		To:         to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get daily revenue: %w", err)
+	}
+
+	recurring, err := s.queries.GetTrainerRecurringRevenue(ctx, trainerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring revenue: %w", err)
+	}
+
+	churn, err := s.queries.GetTrainerChurn(ctx, pgstore.GetTrainerChurnParams{
+		PersonalID: trainerID,
+		From:       from,
+		To:         to,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscriber churn: %w", err)
+	}
+
+	response := &pgstore.TrainerRevenueResponse{
+		StartDate:          from,
+		EndDate:            to.AddDate(0, 0, -1),
+		TotalRevenue:       totals.Charges.Sub(totals.Refunds),
+		Refunds:            totals.Refunds,
+		PlatformFees:       totals.PlatformFees,
+		NetRevenue:         totals.Net,
+		MRR:                recurring.MRR,
+		ActiveSubscribers:  recurring.ActiveSubscribers,
+		NewSubscribers:     churn.NewSubscribers,
+		ChurnedSubscribers: churn.ChurnedSubscribers,
+		DailyRevenueData:   toDailyRevenueData(days),
+	}
+	if churn.SubscribersAtStart > 0 {
+		response.ChurnRate = math.Round(float64(churn.ChurnedSubscribers)/float64(churn.SubscribersAtStart)*10000) / 100
+	}
+
+	return response, nil
+}
+
+// recordPaymentRevenue books a payment that just completed or was refunded
+// in the revenue ledger
+func (s *PlanService) recordPaymentRevenue(ctx context.Context, queries *pgstore.Queries, payment *pgstore.Payment) error {
+	now := time.Now()
+
+	switch payment.Status {
+	case pgstore.PaymentStatusCompleted:
+		err := queries.CreatePaymentChargeEntries(ctx, pgstore.CreatePaymentChargeEntriesParams{
+			PaymentID:          payment.ID,
+			PlatformFeePercent: s.config.PlatformFeePercent,
+			OccurredAt:         now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record payment revenue: %w", err)
+		}
+	case pgstore.PaymentStatusRefunded:
+		err := queries.CreatePaymentRefundEntries(ctx, pgstore.CreatePaymentRefundEntriesParams{
+			PaymentID:  payment.ID,
+			OccurredAt: now,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record payment refund: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// revenueDateRange resolves the start and end dates of a revenue report to
+// [from, to) UTC midnights, defaulting to the defaultRevenuePeriod ending
+// today
+func revenueDateRange(startDate, endDate string, now time.Time) (time.Time, time.Time, error) {
+	start, end, err := parseDateRange(startDate, endDate, time.UTC)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	to := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+	if end != nil {
+		to = *end
+	}
+	from := to.Add(-defaultRevenuePeriod)
+	if start != nil {
+		from = *start
+	}
+
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: start date must not be after end date", utils.ErrBadRequest)
+	}
+	if to.Sub(from) > maxRevenuePeriod {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: revenue reports cover at most %d days", utils.ErrBadRequest, int(maxRevenuePeriod.Hours()/24))
+	}
+
+	return from, to, nil
+}
+
+func toDailyRevenueData(days []pgstore.GetDailyRevenueRow) []pgstore.DailyRevenueData {
+	data := make([]pgstore.DailyRevenueData, 0, len(days))
+	for _, day := range days {
+		data = append(data, pgstore.DailyRevenueData{
+			Date:         day.Day,
+			Revenue:      day.Charges.Sub(day.Refunds),
+			Refunds:      day.Refunds,
+			PlatformFees: day.PlatformFees,
+		})
+	}
+	return data
+}
@@ -3,129 +3,684 @@ package services
 import (
 	"context"
 	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+const (
+	scheduleDateLayout = "2006-01-02"
+	minutesPerDay      = 24 * 60
+
+	// Trainer availability is listed in slots of the requested duration
+	defaultSlotMinutes  = 60
+	minSlotMinutes      = 15
+	maxSlotMinutes      = 8 * 60
+	maxAvailabilityDays = 31
 )
 
 type SchedulingService struct {
 	queries *pgstore.Queries
+	pool    *pgxpool.Pool
+	// location is the timezone trainer hours and schedule dates are read in
+	location *time.Location
 }
 
-func NewSchedulingService(queries *pgstore.Queries) *SchedulingService {
+func NewSchedulingService(queries *pgstore.Queries, pool *pgxpool.Pool, location *time.Location) *SchedulingService {
 	return &SchedulingService{
-		queries: queries,
+		queries:  queries,
+		pool:     pool,
+		location: location,
 	}
 }
 
+// GetSchedulings lists the schedulings where the user is the trainer or the student
 func (s *SchedulingService) GetSchedulings(ctx context.Context, userID uuid.UUID) ([]pgstore.SchedulingResponse, error) {
-	return []pgstore.SchedulingResponse{
-		{
-			ID:         uuid.New(),
-			PersonalID: uuid.New(),
-			StudentID:  userID,
-			Date:       time.Now().Add(24 * time.Hour),
-			Type:       pgstore.SchedulingTypeInPerson,
-			Status:     pgstore.SchedulingStatusScheduled,
-			WorkoutID:  &[]uuid.UUID{uuid.New()}[0],
-			CreatedAt:  time.Now().AddDate(0, 0, -1),
-		},
-		{
-			ID:         uuid.New(),
-			PersonalID: uuid.New(),
-			StudentID:  userID,
-			Date:       time.Now().Add(72 * time.Hour),
-			Type:       pgstore.SchedulingTypeOnline,
-			Status:     pgstore.SchedulingStatusPendingConfirmation,
-			CreatedAt:  time.Now(),
-		},
-	}, nil
+	schedulings, err := s.queries.GetSchedulings(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedulings: %w", err)
+	}
+
+	response := make([]pgstore.SchedulingResponse, 0, len(schedulings))
+	for i := range schedulings {
+		response = append(response, *newSchedulingResponse(&schedulings[i]))
+	}
+
+	return response, nil
 }
 
+// GetSchedulingByID returns a scheduling the user takes part in, or nil
 func (s *SchedulingService) GetSchedulingByID(ctx context.Context, schedulingID, userID uuid.UUID) (*pgstore.SchedulingResponse, error) {
-	return &pgstore.SchedulingResponse{
-		ID:         schedulingID,
-		PersonalID: uuid.New(),
-		StudentID:  userID,
-		Date:       time.Now().Add(24 * time.Hour),
-		Type:       pgstore.SchedulingTypeInPerson,
-		Status:     pgstore.SchedulingStatusScheduled,
-		WorkoutID:  &[]uuid.UUID{uuid.New()}[0],
-		CreatedAt:  time.Now().AddDate(0, 0, -1),
-	}, nil
+	scheduling, err := s.queries.GetSchedulingById(ctx, pgstore.GetSchedulingByIdParams{ID: schedulingID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduling: %w", err)
+	}
+	if scheduling == nil || !isSchedulingParticipant(scheduling, userID) {
+		return nil, nil
+	}
+
+	return newSchedulingResponse(scheduling), nil
 }
 
+// CreateScheduling books a session of the student with a trainer. The session
+// must fit the trainer's hours and must not overlap another non-canceled
+// session of the trainer or the student. Students without a recurring plan of
+// the trainer pay the session with a credit of one of the trainer's packages.
 func (s *SchedulingService) CreateScheduling(ctx context.Context, req pgstore.CreateSchedulingRequest, userID uuid.UUID) (*pgstore.SchedulingResponse, error) {
-	if req.Date.Before(time.Now()) {
-		return nil, fmt.Errorf("cannot schedule in the past")
+	if err := validateSchedulingRange(req.Date, req.StartTime, req.EndTime, s.location); err != nil {
+		return nil, err
+	}
+	if err := validateSchedulingType(req.Type); err != nil {
+		return nil, err
 	}
 
-	schedulingID := uuid.New()
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	return &pgstore.SchedulingResponse{
-		ID:         schedulingID,
+	txQueries := s.queries.WithTx(tx)
+
+	if err := lockSchedulingParticipants(ctx, txQueries, req.PersonalID, userID); err != nil {
+		return nil, err
+	}
+
+	scheduling, err := createSchedulingOccurrence(ctx, txQueries, s.location, req, userID, req.StartTime, req.EndTime, nil, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return scheduling, nil
+}
+
+// CreateSchedulingSeries books every occurrence of a weekly recurrence rule
+// starting at the requested session. Each occurrence goes through the same
+// checks as CreateScheduling and the series is only created if all pass.
+func (s *SchedulingService) CreateSchedulingSeries(ctx context.Context, req pgstore.CreateSchedulingRequest, userID uuid.UUID) (*pgstore.SchedulingSeriesResponse, error) {
+	if req.Recurrence == nil {
+		return nil, fmt.Errorf("%w: recurrence is required", utils.ErrBadRequest)
+	}
+	if err := validateSchedulingRange(req.Date, req.StartTime, req.EndTime, s.location); err != nil {
+		return nil, err
+	}
+	if err := validateSchedulingType(req.Type); err != nil {
+		return nil, err
+	}
+
+	// Occurrences repeat on the wall clock of the app timezone
+	rule, err := parseRecurrenceRule(*req.Recurrence, s.location)
+	if err != nil {
+		return nil, err
+	}
+	starts, err := rule.occurrences(req.StartTime.In(s.location))
+	if err != nil {
+		return nil, err
+	}
+	if len(starts) == 0 {
+		return nil, fmt.Errorf("%w: the recurrence ends before the first session", utils.ErrBadRequest)
+	}
+	duration := req.EndTime.Sub(req.StartTime)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	if err := lockSchedulingParticipants(ctx, txQueries, req.PersonalID, userID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	series, err := txQueries.CreateSchedulingSeries(ctx, pgstore.CreateSchedulingSeriesParams{
+		ID:         uuid.New(),
 		PersonalID: req.PersonalID,
 		StudentID:  userID,
-		Date:       req.Date,
-		Type:       req.Type,
-		Status:     pgstore.SchedulingStatusPendingConfirmation,
-		CreatedAt:  time.Now(),
+		Recurrence: rule.String(),
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduling series: %w", err)
+	}
+
+	schedulings := make([]pgstore.SchedulingResponse, 0, len(starts))
+	for _, start := range starts {
+		scheduling, err := createSchedulingOccurrence(ctx, txQueries, s.location, req, userID, start, start.Add(duration), &series.ID, now)
+		if err != nil {
+			return nil, fmt.Errorf("occurrence on %s: %w", start.Format(scheduleDateLayout), err)
+		}
+		schedulings = append(schedulings, *scheduling)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &pgstore.SchedulingSeriesResponse{
+		ID:          series.ID,
+		Recurrence:  series.Recurrence,
+		Schedulings: schedulings,
 	}, nil
 }
 
+// UpdateScheduling changes a scheduling the user takes part in. Moving it to
+// another time runs the same checks as CreateScheduling, and status changes
+// follow the scheduling transition table. With a FOLLOWING or ALL scope the
+// change is applied to the occurrences of the series that have not started
+// yet, moving each one by the same number of days and to the same time.
 func (s *SchedulingService) UpdateScheduling(ctx context.Context, schedulingID uuid.UUID, req pgstore.UpdateSchedulingRequest, userID uuid.UUID) (*pgstore.SchedulingResponse, error) {
-	if req.Date != nil && req.Date.Before(time.Now()) {
-		return nil, fmt.Errorf("cannot reschedule to the past")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return &pgstore.SchedulingResponse{
-		ID:         schedulingID,
-		PersonalID: uuid.New(),
-		StudentID:  userID,
-		Date:       *req.Date,
-		Type:       *req.Type,
-		Status:     *req.Status,
-		CreatedAt:  time.Now().AddDate(0, 0, -1),
+	txQueries := s.queries.WithTx(tx)
+
+	current, actor, err := getSchedulingForActor(ctx, txQueries, schedulingID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	targets, series, err := schedulingScopeTargets(ctx, txQueries, current, req.Scope, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Type != nil {
+		if err := validateSchedulingType(*req.Type); err != nil {
+			return nil, err
+		}
+	}
+
+	// The new time is given for the selected occurrence, and occurrences are
+	// moved on the wall clock of the app timezone
+	var newStart, newEnd time.Time
+	rescheduled := req.Date != nil || req.StartTime != nil || req.EndTime != nil
+	if rescheduled {
+		newStart = current.Date.In(s.location)
+		if req.StartTime != nil {
+			newStart = req.StartTime.In(s.location)
+		} else if req.Date != nil {
+			// A new date alone moves the session to that day keeping its time
+			newStart = time.Date(req.Date.Year(), req.Date.Month(), req.Date.Day(),
+				newStart.Hour(), newStart.Minute(), newStart.Second(), 0, s.location)
+		}
+
+		newEnd = newStart.Add(current.EndTime.Sub(current.Date))
+		if req.EndTime != nil {
+			newEnd = *req.EndTime
+		}
+
+		date := newStart
+		if req.Date != nil {
+			date = *req.Date
+		}
+		if err := validateSchedulingRange(date, newStart, newEnd, s.location); err != nil {
+			return nil, err
+		}
+
+		if err := lockSchedulingParticipants(ctx, txQueries, current.PersonalID, current.StudentID); err != nil {
+			return nil, err
+		}
+	}
+
+	selected := targets[0]
+	for _, occurrence := range targets {
+		change := schedulingChange{
+			Type:   req.Type,
+			Notes:  req.Notes,
+			Status: req.Status,
+		}
+		if rescheduled {
+			start := shiftOccurrence(occurrence.Date, current.Date, newStart)
+			end := start.Add(newEnd.Sub(newStart))
+			change.StartTime = &start
+			change.EndTime = &end
+		}
+
+		if err := applySchedulingChange(ctx, txQueries, s.location, occurrence, change, actor, userID, now, series); err != nil {
+			if series {
+				return nil, fmt.Errorf("occurrence on %s: %w", occurrence.Date.Format(scheduleDateLayout), err)
+			}
+			return nil, err
+		}
+
+		if occurrence.ID == current.ID {
+			selected = occurrence
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return newSchedulingResponse(selected), nil
+}
+
+// CancelScheduling cancels a session before it starts. Either participant may
+// cancel. For occurrences of a series, the scope also cancels the following
+// occurrences or the whole series that has not started yet.
+func (s *SchedulingService) CancelScheduling(ctx context.Context, schedulingID uuid.UUID, reason string, scope *pgstore.SchedulingSeriesScope, userID uuid.UUID) (*pgstore.SchedulingResponse, error) {
+	return s.transitionScheduling(ctx, schedulingID, userID, pgstore.SchedulingStatusCanceled, scope, &reason, nil)
+}
+
+// ConfirmScheduling lets the trainer accept a pending or rescheduled session
+func (s *SchedulingService) ConfirmScheduling(ctx context.Context, schedulingID, userID uuid.UUID) (*pgstore.SchedulingResponse, error) {
+	return s.transitionScheduling(ctx, schedulingID, userID, pgstore.SchedulingStatusScheduled, nil, nil, nil)
+}
+
+// StartScheduling lets the trainer start a confirmed session
+func (s *SchedulingService) StartScheduling(ctx context.Context, schedulingID, userID uuid.UUID) (*pgstore.SchedulingResponse, error) {
+	return s.transitionScheduling(ctx, schedulingID, userID, pgstore.SchedulingStatusInProgress, nil, nil, nil)
+}
+
+// CompleteScheduling lets the trainer finish a session in progress
+func (s *SchedulingService) CompleteScheduling(ctx context.Context, schedulingID, userID uuid.UUID, notes string) (*pgstore.SchedulingResponse, error) {
+	var completionNotes *string
+	if notes != "" {
+		completionNotes = &notes
+	}
+	return s.transitionScheduling(ctx, schedulingID, userID, pgstore.SchedulingStatusCompleted, nil, nil, completionNotes)
+}
+
+// GetSchedulingStatusHistory lists the status changes of a scheduling the
+// user takes part in, oldest first
+func (s *SchedulingService) GetSchedulingStatusHistory(ctx context.Context, schedulingID, userID uuid.UUID) ([]pgstore.SchedulingsHistory, error) {
+	scheduling, err := s.queries.GetSchedulingById(ctx, pgstore.GetSchedulingByIdParams{ID: schedulingID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduling: %w", err)
+	}
+	if scheduling == nil || !isSchedulingParticipant(scheduling, userID) {
+		return nil, fmt.Errorf("%w: scheduling %s", utils.ErrNotFound, schedulingID)
+	}
+
+	history, err := s.queries.GetSchedulingsHistoryByScheduleId(ctx, schedulingID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get scheduling history: %w", err)
+	}
+	if history == nil {
+		history = []pgstore.SchedulingsHistory{}
+	}
+
+	return history, nil
+}
+
+// MarkMissedSchedulings moves the sessions that ended more than
+// schedulingMissedGracePeriod ago without being started to MISSED, and
+// returns how many were marked
+func (s *SchedulingService) MarkMissedSchedulings(ctx context.Context) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	now := time.Now()
+	schedulings, err := txQueries.GetSchedulingsToMarkMissed(ctx, now.Add(-schedulingMissedGracePeriod))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schedulings to mark as missed: %w", err)
+	}
+
+	reason := "Session ended without being started"
+	for i := range schedulings {
+		if err := applySchedulingTransition(ctx, txQueries, &schedulings[i], pgstore.SchedulingStatusMissed, schedulingActorSystem, nil, &reason, nil, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(schedulings), nil
+}
+
+// transitionScheduling applies a status change requested by a participant to
+// the scheduling, or to the occurrences of its series selected by scope
+func (s *SchedulingService) transitionScheduling(ctx context.Context, schedulingID, userID uuid.UUID, to pgstore.SchedulingStatus, scope *pgstore.SchedulingSeriesScope, reason, notes *string) (*pgstore.SchedulingResponse, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	scheduling, actor, err := getSchedulingForActor(ctx, txQueries, schedulingID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	targets, series, err := schedulingScopeTargets(ctx, txQueries, scheduling, scope, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, occurrence := range targets {
+		if series && occurrence.Status == to {
+			continue
+		}
+		if err := applySchedulingTransition(ctx, txQueries, occurrence, to, actor, &userID, reason, notes, now); err != nil {
+			if series {
+				return nil, fmt.Errorf("occurrence on %s: %w", occurrence.Date.Format(scheduleDateLayout), err)
+			}
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return newSchedulingResponse(scheduling), nil
+}
+
+// GetTrainerSchedule returns the trainer's weekly windows and the exceptions
+// from today on
+func (s *SchedulingService) GetTrainerSchedule(ctx context.Context, personalID uuid.UUID) (*pgstore.TrainerScheduleResponse, error) {
+	windows, err := s.queries.GetPersonalSchedules(ctx, personalID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer schedule: %w", err)
+	}
+
+	today := scheduleDate(time.Now(), s.location)
+	exceptions, err := s.queries.GetPersonalScheduleExceptions(ctx, pgstore.GetPersonalScheduleExceptionsParams{
+		PersonalID: personalID,
+		From:       &today,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer schedule exceptions: %w", err)
+	}
+
+	if windows == nil {
+		windows = []pgstore.PersonalSchedule{}
+	}
+	if exceptions == nil {
+		exceptions = []pgstore.PersonalScheduleException{}
+	}
+
+	return &pgstore.TrainerScheduleResponse{
+		Windows:    windows,
+		Exceptions: exceptions,
 	}, nil
 }
 
-func (s *SchedulingService) CancelScheduling(ctx context.Context, schedulingID uuid.UUID, reason string, userID uuid.UUID) error {
-	return nil
+// CreateTrainerScheduleWindow adds a weekly window. Windows of the same week
+// day must not overlap.
+func (s *SchedulingService) CreateTrainerScheduleWindow(ctx context.Context, personalID uuid.UUID, req pgstore.PersonalScheduleRequest) (*pgstore.PersonalSchedule, error) {
+	if err := validateScheduleWindow(req.WeekDay, req.TimeStartInMinutes, req.TimeEndInMinutes); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	if err := lockScheduleOwner(ctx, txQueries, personalID); err != nil {
+		return nil, err
+	}
+
+	if err := checkScheduleWindowOverlap(ctx, txQueries, personalID, req, nil); err != nil {
+		return nil, err
+	}
+
+	window, err := txQueries.CreatePersonalSchedule(ctx, pgstore.CreatePersonalScheduleParams{
+		PersonalID:         personalID,
+		WeekDay:            req.WeekDay,
+		TimeStartInMinutes: req.TimeStartInMinutes,
+		TimeEndInMinutes:   req.TimeEndInMinutes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule window: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return window, nil
 }
 
-func (s *SchedulingService) ConfirmScheduling(ctx context.Context, schedulingID, userID uuid.UUID) error {
-	return nil
+// UpdateTrainerScheduleWindow replaces a weekly window of the trainer
+func (s *SchedulingService) UpdateTrainerScheduleWindow(ctx context.Context, personalID, windowID uuid.UUID, req pgstore.PersonalScheduleRequest) (*pgstore.PersonalSchedule, error) {
+	if err := validateScheduleWindow(req.WeekDay, req.TimeStartInMinutes, req.TimeEndInMinutes); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	if err := lockScheduleOwner(ctx, txQueries, personalID); err != nil {
+		return nil, err
+	}
+
+	if err := checkScheduleWindowOverlap(ctx, txQueries, personalID, req, &windowID); err != nil {
+		return nil, err
+	}
+
+	window, err := txQueries.UpdatePersonalSchedule(ctx, pgstore.UpdatePersonalScheduleParams{
+		ID:                 windowID,
+		PersonalID:         personalID,
+		WeekDay:            req.WeekDay,
+		TimeStartInMinutes: req.TimeStartInMinutes,
+		TimeEndInMinutes:   req.TimeEndInMinutes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update schedule window: %w", err)
+	}
+	if window == nil {
+		return nil, fmt.Errorf("%w: schedule window %s", utils.ErrNotFound, windowID)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return window, nil
 }
 
-func (s *SchedulingService) CompleteScheduling(ctx context.Context, schedulingID, userID uuid.UUID, notes string) error {
+// DeleteTrainerScheduleWindow removes a weekly window. Sessions already booked
+// in it are kept.
+func (s *SchedulingService) DeleteTrainerScheduleWindow(ctx context.Context, personalID, windowID uuid.UUID) error {
+	deleted, err := s.queries.DeletePersonalSchedule(ctx, pgstore.DeletePersonalScheduleParams{
+		ID:         windowID,
+		PersonalID: personalID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule window: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: schedule window %s", utils.ErrNotFound, windowID)
+	}
+
 	return nil
 }
 
-func (s *SchedulingService) GetTrainerAvailability(ctx context.Context, trainerID uuid.UUID, date time.Time) ([]pgstore.AvailabilitySlot, error) {
-	return []pgstore.AvailabilitySlot{
-		{
-			StartTime: time.Date(date.Year(), date.Month(), date.Day(), 9, 0, 0, 0, date.Location()),
-			EndTime:   time.Date(date.Year(), date.Month(), date.Day(), 10, 0, 0, 0, date.Location()),
-			Available: true,
-		},
-		{
-			StartTime: time.Date(date.Year(), date.Month(), date.Day(), 10, 0, 0, 0, date.Location()),
-			EndTime:   time.Date(date.Year(), date.Month(), date.Day(), 11, 0, 0, 0, date.Location()),
-			Available: false,
-		},
-		{
-			StartTime: time.Date(date.Year(), date.Month(), date.Day(), 14, 0, 0, 0, date.Location()),
-			EndTime:   time.Date(date.Year(), date.Month(), date.Day(), 15, 0, 0, 0, date.Location()),
-			Available: true,
-		},
-	}, nil
+// CreateTrainerScheduleException adds a date-specific change to the weekly
+// schedule. An UNAVAILABLE exception without a time range blocks the whole day.
+func (s *SchedulingService) CreateTrainerScheduleException(ctx context.Context, personalID uuid.UUID, req pgstore.CreateScheduleExceptionRequest) (*pgstore.PersonalScheduleException, error) {
+	date, err := time.Parse(scheduleDateLayout, req.Date)
+	if err != nil {
+		return nil, fmt.Errorf("%w: date must use the YYYY-MM-DD format", utils.ErrBadRequest)
+	}
+
+	switch req.Type {
+	case pgstore.ScheduleExceptionTypeUnavailable, pgstore.ScheduleExceptionTypeAvailable:
+	default:
+		return nil, fmt.Errorf("%w: invalid exception type %q", utils.ErrBadRequest, req.Type)
+	}
+
+	if (req.TimeStartInMinutes == nil) != (req.TimeEndInMinutes == nil) {
+		return nil, fmt.Errorf("%w: start and end times must be given together", utils.ErrBadRequest)
+	}
+	if req.TimeStartInMinutes == nil && req.Type == pgstore.ScheduleExceptionTypeAvailable {
+		return nil, fmt.Errorf("%w: extra hours need a start and end time", utils.ErrBadRequest)
+	}
+	if req.TimeStartInMinutes != nil {
+		if err := validateMinuteRange(*req.TimeStartInMinutes, *req.TimeEndInMinutes); err != nil {
+			return nil, err
+		}
+	}
+
+	if date.Before(scheduleDate(time.Now(), s.location)) {
+		return nil, fmt.Errorf("%w: exceptions cannot be added to past dates", utils.ErrBadRequest)
+	}
+
+	exception, err := s.queries.CreatePersonalScheduleException(ctx, pgstore.CreatePersonalScheduleExceptionParams{
+		PersonalID:         personalID,
+		Date:               date,
+		Type:               req.Type,
+		TimeStartInMinutes: req.TimeStartInMinutes,
+		TimeEndInMinutes:   req.TimeEndInMinutes,
+		Reason:             req.Reason,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schedule exception: %w", err)
+	}
+
+	return exception, nil
 }
 
-func (s *SchedulingService) SetTrainerAvailability(ctx context.Context, trainerID uuid.UUID, date time.Time, slots []pgstore.AvailabilitySlot) error {
+// DeleteTrainerScheduleException removes a date-specific exception
+func (s *SchedulingService) DeleteTrainerScheduleException(ctx context.Context, personalID, exceptionID uuid.UUID) error {
+	deleted, err := s.queries.DeletePersonalScheduleException(ctx, pgstore.DeletePersonalScheduleExceptionParams{
+		ID:         exceptionID,
+		PersonalID: personalID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule exception: %w", err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: schedule exception %s", utils.ErrNotFound, exceptionID)
+	}
+
 	return nil
 }
 
+// GetTrainerAvailability returns the free slots of the given duration (in
+// minutes, 60 by default) between two dates, both inclusive. Days and the
+// trainer's hours are read in the app timezone; from defaults to today and to
+// to a week after from. The optional IANA timezone only changes the offset the
+// slot times are written with.
+func (s *SchedulingService) GetTrainerAvailability(ctx context.Context, trainerID uuid.UUID, from, to, duration, timezone string) ([]pgstore.AvailabilitySlot, error) {
+	location := s.location
+	output := s.location
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown timezone %q", utils.ErrBadRequest, timezone)
+		}
+		output = loc
+	}
+
+	now := time.Now()
+	year, month, today := now.In(location).Date()
+	firstDay := time.Date(year, month, today, 0, 0, 0, 0, location)
+	if from != "" {
+		day, err := time.ParseInLocation(scheduleDateLayout, from, location)
+		if err != nil {
+			return nil, fmt.Errorf("%w: from must use the YYYY-MM-DD format", utils.ErrBadRequest)
+		}
+		firstDay = day
+	}
+
+	lastDay := firstDay.AddDate(0, 0, 6)
+	if to != "" {
+		day, err := time.ParseInLocation(scheduleDateLayout, to, location)
+		if err != nil {
+			return nil, fmt.Errorf("%w: to must use the YYYY-MM-DD format", utils.ErrBadRequest)
+		}
+		lastDay = day
+	}
+
+	if lastDay.Before(firstDay) {
+		return nil, fmt.Errorf("%w: from must not be after to", utils.ErrBadRequest)
+	}
+	if lastDay.After(firstDay.AddDate(0, 0, maxAvailabilityDays-1)) {
+		return nil, fmt.Errorf("%w: availability can be listed for at most %d days", utils.ErrBadRequest, maxAvailabilityDays)
+	}
+
+	slotMinutes := defaultSlotMinutes
+	if duration != "" {
+		minutes, err := strconv.Atoi(duration)
+		if err != nil || minutes < minSlotMinutes || minutes > maxSlotMinutes {
+			return nil, fmt.Errorf("%w: duration must be between %d and %d minutes", utils.ErrBadRequest, minSlotMinutes, maxSlotMinutes)
+		}
+		slotMinutes = minutes
+	}
+	slotDuration := time.Duration(slotMinutes) * time.Minute
+
+	windows, err := s.queries.GetPersonalSchedules(ctx, trainerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer schedule: %w", err)
+	}
+
+	exceptionsFrom, exceptionsTo := scheduleDate(firstDay, location), scheduleDate(lastDay, location)
+	exceptions, err := s.queries.GetPersonalScheduleExceptions(ctx, pgstore.GetPersonalScheduleExceptionsParams{
+		PersonalID: trainerID,
+		From:       &exceptionsFrom,
+		To:         &exceptionsTo,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer schedule exceptions: %w", err)
+	}
+
+	busy, err := s.queries.GetPersonalBusySchedulings(ctx, pgstore.GetPersonalBusySchedulingsParams{
+		PersonalID: trainerID,
+		StartTime:  firstDay,
+		EndTime:    lastDay.AddDate(0, 0, 1),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trainer schedulings: %w", err)
+	}
+
+	slots := []pgstore.AvailabilitySlot{}
+	for day := firstDay; !day.After(lastDay); day = day.AddDate(0, 0, 1) {
+		for _, free := range freeTimeRanges(day, scheduleDayRanges(windows, exceptions, day), busy) {
+			for start := free.start; !start.Add(slotDuration).After(free.end); start = start.Add(slotDuration) {
+				if start.Before(now) {
+					continue
+				}
+				slots = append(slots, pgstore.AvailabilitySlot{
+					StartTime: start.In(output),
+					EndTime:   start.Add(slotDuration).In(output),
+					Available: true,
+				})
+			}
+		}
+	}
+
+	return slots, nil
+}
+
 func (s *SchedulingService) GetSchedulingHistory(ctx context.Context, userID uuid.UUID) ([]pgstore.SchedulingHistoryResponse, error) {
 	return []pgstore.SchedulingHistoryResponse{
 		{
@@ -157,3 +712,847 @@ func (s *SchedulingService) GetSchedulingHistory(ctx context.Context, userID uui
 		},
 	}, nil
 }
+
+// validateSchedulingRange checks that a session starts in the future on the
+// given date, taken as written, and ends after it starts. The start is read in
+// the given location.
+func validateSchedulingRange(date, startTime, endTime time.Time, location *time.Location) error {
+	if !endTime.After(startTime) {
+		return fmt.Errorf("%w: end time must be after start time", utils.ErrBadRequest)
+	}
+	if startTime.Before(time.Now()) {
+		return fmt.Errorf("%w: cannot schedule in the past", utils.ErrBadRequest)
+	}
+
+	dateYear, dateMonth, dateDay := date.Date()
+	startYear, startMonth, startDay := startTime.In(location).Date()
+	if dateYear != startYear || dateMonth != startMonth || dateDay != startDay {
+		return fmt.Errorf("%w: start time must be on the scheduling date", utils.ErrBadRequest)
+	}
+
+	return nil
+}
+
+func validateSchedulingType(schedulingType pgstore.SchedulingType) error {
+	switch schedulingType {
+	case pgstore.SchedulingTypeOnline, pgstore.SchedulingTypeInPerson:
+		return nil
+	default:
+		return fmt.Errorf("%w: invalid scheduling type %q", utils.ErrBadRequest, schedulingType)
+	}
+}
+
+// lockSchedulingParticipants locks the trainer and the student, always in
+// that order, so overlapping bookings of either are checked one at a time
+func lockSchedulingParticipants(ctx context.Context, queries *pgstore.Queries, personalID, studentID uuid.UUID) error {
+	found, err := queries.LockPersonal(ctx, personalID)
+	if err != nil {
+		return fmt.Errorf("failed to lock trainer: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: trainer %s", utils.ErrNotFound, personalID)
+	}
+
+	found, err = queries.LockStudent(ctx, studentID)
+	if err != nil {
+		return fmt.Errorf("failed to lock student: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: only students can book sessions", utils.ErrForbidden)
+	}
+
+	return nil
+}
+
+// checkSchedulingAvailability rejects a session outside the trainer's weekly
+// windows, read in the given location, or overlapping another non-canceled
+// session of either participant
+func checkSchedulingAvailability(ctx context.Context, queries *pgstore.Queries, location *time.Location, personalID, studentID uuid.UUID, startTime, endTime time.Time, excludeID *uuid.UUID) error {
+	windows, err := queries.GetPersonalSchedules(ctx, personalID)
+	if err != nil {
+		return fmt.Errorf("failed to get trainer schedule: %w", err)
+	}
+
+	day := scheduleDate(startTime, location)
+	exceptions, err := queries.GetPersonalScheduleExceptions(ctx, pgstore.GetPersonalScheduleExceptionsParams{
+		PersonalID: personalID,
+		From:       &day,
+		To:         &day,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get trainer schedule exceptions: %w", err)
+	}
+
+	if !fitsPersonalSchedule(windows, exceptions, startTime, endTime, location) {
+		return fmt.Errorf("%w: session is outside the trainer's working hours", utils.ErrBadRequest)
+	}
+
+	conflict, err := queries.GetOverlappingScheduling(ctx, pgstore.GetOverlappingSchedulingParams{
+		PersonalID: personalID,
+		StudentID:  studentID,
+		StartTime:  startTime,
+		EndTime:    endTime,
+		ExcludeID:  excludeID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check overlapping schedulings: %w", err)
+	}
+	if conflict != nil {
+		if conflict.PersonalID == personalID {
+			return fmt.Errorf("%w: the trainer already has a session at this time", utils.ErrConflict)
+		}
+		return fmt.Errorf("%w: the student already has a session at this time", utils.ErrConflict)
+	}
+
+	return nil
+}
+
+// createSchedulingOccurrence checks and books one session pending the
+// trainer's confirmation, recording it in the scheduling history
+func createSchedulingOccurrence(ctx context.Context, queries *pgstore.Queries, location *time.Location, req pgstore.CreateSchedulingRequest, userID uuid.UUID, startTime, endTime time.Time, seriesID *uuid.UUID, now time.Time) (*pgstore.SchedulingResponse, error) {
+	if err := checkSchedulingAvailability(ctx, queries, location, req.PersonalID, userID, startTime, endTime, nil); err != nil {
+		return nil, err
+	}
+
+	params := pgstore.CreateSchedulingParams{
+		ID:         uuid.New(),
+		PersonalID: req.PersonalID,
+		StudentID:  userID,
+		Date:       startTime,
+		EndTime:    endTime,
+		Type:       req.Type,
+		Status:     pgstore.SchedulingStatusPendingConfirmation,
+		Notes:      req.Notes,
+		CreatedAt:  now,
+		UserID:     &userID,
+		SeriesID:   seriesID,
+	}
+
+	schedulingID, err := queries.CreateScheduling(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scheduling: %w", err)
+	}
+
+	if err := consumeSessionCredit(ctx, queries, req.PersonalID, userID, schedulingID, startTime); err != nil {
+		return nil, err
+	}
+
+	_, err = queries.CreateSchedulingHistory(ctx, pgstore.CreateSchedulingHistoryParams{
+		ID:         uuid.New(),
+		ScheduleID: schedulingID,
+		UserID:     &userID,
+		Status:     params.Status,
+		ChangedAt:  &params.CreatedAt,
+		ChangedBy:  string(schedulingActorStudent),
+		Notes:      req.Notes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to record scheduling history: %w", err)
+	}
+
+	return &pgstore.SchedulingResponse{
+		ID:         schedulingID,
+		PersonalID: params.PersonalID,
+		StudentID:  params.StudentID,
+		Date:       params.Date,
+		EndTime:    params.EndTime,
+		Type:       params.Type,
+		Status:     params.Status,
+		Notes:      params.Notes,
+		CreatedAt:  params.CreatedAt,
+		UserID:     params.UserID,
+		SeriesID:   params.SeriesID,
+	}, nil
+}
+
+// schedulingChange holds the fields of an update applied to one occurrence
+type schedulingChange struct {
+	StartTime *time.Time
+	EndTime   *time.Time
+	Type      *pgstore.SchedulingType
+	Notes     *string
+	Status    *pgstore.SchedulingStatus
+}
+
+// applySchedulingChange updates one scheduling in place. A confirmed session
+// moved to another time goes back to RESCHEDULED; in a series update,
+// occurrences already in the requested status are left as they are.
+func applySchedulingChange(ctx context.Context, queries *pgstore.Queries, location *time.Location, scheduling *pgstore.Scheduling, change schedulingChange, actor schedulingActor, userID uuid.UUID, now time.Time, series bool) error {
+	params := pgstore.UpdateSchedulingParams{
+		ID:      scheduling.ID,
+		Date:    scheduling.Date,
+		EndTime: scheduling.EndTime,
+		Type:    scheduling.Type,
+		Status:  scheduling.Status,
+		Notes:   scheduling.Notes,
+	}
+
+	if change.StartTime != nil && change.EndTime != nil {
+		if !isReschedulable(scheduling, now) {
+			return fmt.Errorf("%w: a %s session can no longer be rescheduled", utils.ErrBadRequest, scheduling.Status)
+		}
+		if err := validateSchedulingRange(change.StartTime.In(location), *change.StartTime, *change.EndTime, location); err != nil {
+			return err
+		}
+		if err := checkSchedulingAvailability(ctx, queries, location, scheduling.PersonalID, scheduling.StudentID, *change.StartTime, *change.EndTime, &scheduling.ID); err != nil {
+			return err
+		}
+		params.Date = *change.StartTime
+		params.EndTime = *change.EndTime
+	}
+	if change.Type != nil {
+		params.Type = *change.Type
+	}
+	if change.Notes != nil {
+		params.Notes = change.Notes
+	}
+
+	updated, err := queries.UpdateScheduling(ctx, params)
+	if err != nil {
+		return fmt.Errorf("failed to update scheduling: %w", err)
+	}
+	*scheduling = *updated
+
+	// Confirmed sessions moved to another time wait for the trainer again
+	if change.StartTime != nil && scheduling.Status != pgstore.SchedulingStatusPendingConfirmation {
+		if err := applySchedulingTransition(ctx, queries, scheduling, pgstore.SchedulingStatusRescheduled, actor, &userID, nil, nil, now); err != nil {
+			return err
+		}
+	}
+
+	if change.Status != nil && *change.Status != scheduling.Status {
+		if err := applySchedulingTransition(ctx, queries, scheduling, *change.Status, actor, &userID, nil, change.Notes, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// schedulingScopeTargets returns the schedulings a change applies to and
+// whether they are taken from the series. THIS, or a session outside a
+// series, selects the scheduling itself; FOLLOWING and ALL select the
+// occurrences from this one on, or all of them, that have not started yet.
+func schedulingScopeTargets(ctx context.Context, queries *pgstore.Queries, scheduling *pgstore.Scheduling, scope *pgstore.SchedulingSeriesScope, now time.Time) ([]*pgstore.Scheduling, bool, error) {
+	if scope == nil || *scope == pgstore.SchedulingSeriesScopeThis || scheduling.SeriesID == nil {
+		if scope != nil && !isValidSeriesScope(*scope) {
+			return nil, false, fmt.Errorf("%w: invalid scope %q", utils.ErrBadRequest, *scope)
+		}
+		return []*pgstore.Scheduling{scheduling}, false, nil
+	}
+	if !isValidSeriesScope(*scope) {
+		return nil, false, fmt.Errorf("%w: invalid scope %q", utils.ErrBadRequest, *scope)
+	}
+
+	var from time.Time
+	if *scope == pgstore.SchedulingSeriesScopeFollowing {
+		from = scheduling.Date
+	}
+
+	occurrences, err := queries.GetSeriesSchedulingsForUpdate(ctx, pgstore.GetSeriesSchedulingsForUpdateParams{
+		SeriesID: *scheduling.SeriesID,
+		From:     from,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get series schedulings: %w", err)
+	}
+
+	var targets []*pgstore.Scheduling
+	for i := range occurrences {
+		occurrence := &occurrences[i]
+		if occurrence.ID == scheduling.ID {
+			occurrence = scheduling
+		}
+		if isReschedulable(occurrence, now) {
+			targets = append(targets, occurrence)
+		}
+	}
+	if len(targets) == 0 {
+		return nil, false, fmt.Errorf("%w: no upcoming occurrences left in the series", utils.ErrBadRequest)
+	}
+
+	return targets, true, nil
+}
+
+func isValidSeriesScope(scope pgstore.SchedulingSeriesScope) bool {
+	switch scope {
+	case pgstore.SchedulingSeriesScopeThis, pgstore.SchedulingSeriesScopeFollowing, pgstore.SchedulingSeriesScopeAll:
+		return true
+	default:
+		return false
+	}
+}
+
+// shiftOccurrence moves an occurrence the way the selected occurrence moved
+// from "from" to "to": by the same number of calendar days and to the same
+// wall clock time
+func shiftOccurrence(occurrence, from, to time.Time) time.Time {
+	location := to.Location()
+	fromYear, fromMonth, fromDay := from.In(location).Date()
+	toYear, toMonth, toDay := to.Date()
+	days := int(time.Date(toYear, toMonth, toDay, 0, 0, 0, 0, time.UTC).
+		Sub(time.Date(fromYear, fromMonth, fromDay, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+
+	year, month, day := occurrence.In(location).Date()
+	return time.Date(year, month, day+days, to.Hour(), to.Minute(), to.Second(), 0, location)
+}
+
+// fitsPersonalSchedule reports whether a session lies within the trainer's
+// hours on the day it starts. Windows are read on the wall clock of the given
+// location (week_day 0 is Sunday, times in minutes from midnight), whatever
+// offset the session times were sent with.
+func fitsPersonalSchedule(windows []pgstore.PersonalSchedule, exceptions []pgstore.PersonalScheduleException, startTime, endTime time.Time, location *time.Location) bool {
+	startTime = startTime.In(location)
+	midnight := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, location)
+	startMinutes := int32(startTime.Sub(midnight).Minutes())
+	endMinutes := int32(math.Ceil(endTime.Sub(midnight).Minutes()))
+
+	for _, r := range scheduleDayRanges(windows, exceptions, midnight) {
+		if startMinutes >= r.start && endMinutes <= r.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// minuteRange is a time range within a day, in minutes from midnight
+type minuteRange struct {
+	start int32
+	end   int32
+}
+
+// timeRange is a half-open range between two instants
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// scheduleDayRanges returns the trainer's working hours on a day, sorted and
+// merged: the weekly windows of its week day plus the AVAILABLE exceptions of
+// that date, minus the UNAVAILABLE ones
+func scheduleDayRanges(windows []pgstore.PersonalSchedule, exceptions []pgstore.PersonalScheduleException, day time.Time) []minuteRange {
+	date := day.Format(scheduleDateLayout)
+
+	var ranges []minuteRange
+	for _, window := range windows {
+		if window.WeekDay == int32(day.Weekday()) {
+			ranges = append(ranges, minuteRange{start: window.TimeStartInMinutes, end: window.TimeEndInMinutes})
+		}
+	}
+	for _, exception := range exceptions {
+		if exception.Type == pgstore.ScheduleExceptionTypeAvailable && exception.Date.Format(scheduleDateLayout) == date &&
+			exception.TimeStartInMinutes != nil && exception.TimeEndInMinutes != nil {
+			ranges = append(ranges, minuteRange{start: *exception.TimeStartInMinutes, end: *exception.TimeEndInMinutes})
+		}
+	}
+
+	slices.SortFunc(ranges, func(a, b minuteRange) int { return int(a.start - b.start) })
+
+	var merged []minuteRange
+	for _, r := range ranges {
+		if len(merged) > 0 && r.start <= merged[len(merged)-1].end {
+			merged[len(merged)-1].end = max(merged[len(merged)-1].end, r.end)
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	for _, exception := range exceptions {
+		if exception.Type != pgstore.ScheduleExceptionTypeUnavailable || exception.Date.Format(scheduleDateLayout) != date {
+			continue
+		}
+		if exception.TimeStartInMinutes == nil || exception.TimeEndInMinutes == nil {
+			return nil
+		}
+
+		var remaining []minuteRange
+		for _, r := range merged {
+			if *exception.TimeStartInMinutes > r.start {
+				remaining = append(remaining, minuteRange{start: r.start, end: min(r.end, *exception.TimeStartInMinutes)})
+			}
+			if *exception.TimeEndInMinutes < r.end {
+				remaining = append(remaining, minuteRange{start: max(r.start, *exception.TimeEndInMinutes), end: r.end})
+			}
+		}
+		merged = remaining
+	}
+
+	return merged
+}
+
+// freeTimeRanges turns the working hours of a day into instants and removes
+// the time taken by the given schedulings, which must be sorted by date
+func freeTimeRanges(day time.Time, ranges []minuteRange, busy []pgstore.Scheduling) []timeRange {
+	var free []timeRange
+	for _, r := range ranges {
+		start := day.Add(time.Duration(r.start) * time.Minute)
+		end := day.Add(time.Duration(r.end) * time.Minute)
+
+		for _, scheduling := range busy {
+			if !scheduling.Date.Before(end) {
+				break
+			}
+			if !scheduling.EndTime.After(start) {
+				continue
+			}
+			if scheduling.Date.After(start) {
+				free = append(free, timeRange{start: start, end: scheduling.Date})
+			}
+			start = scheduling.EndTime
+		}
+
+		if start.Before(end) {
+			free = append(free, timeRange{start: start, end: end})
+		}
+	}
+
+	return free
+}
+
+// scheduleDate returns the calendar date of t in the given location, as UTC
+// midnight, the way DATE columns are read back
+func scheduleDate(t time.Time, location *time.Location) time.Time {
+	year, month, day := t.In(location).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func validateScheduleWindow(weekDay, startMinutes, endMinutes int32) error {
+	if weekDay < 0 || weekDay > 6 {
+		return fmt.Errorf("%w: week day must be between 0 (Sunday) and 6 (Saturday)", utils.ErrBadRequest)
+	}
+	return validateMinuteRange(startMinutes, endMinutes)
+}
+
+func validateMinuteRange(startMinutes, endMinutes int32) error {
+	if startMinutes < 0 || endMinutes > minutesPerDay {
+		return fmt.Errorf("%w: times must be between 0 and %d minutes", utils.ErrBadRequest, minutesPerDay)
+	}
+	if startMinutes >= endMinutes {
+		return fmt.Errorf("%w: start time must be before end time", utils.ErrBadRequest)
+	}
+	return nil
+}
+
+// lockScheduleOwner locks the trainer row so concurrent changes to the same
+// schedule are checked one at a time
+func lockScheduleOwner(ctx context.Context, queries *pgstore.Queries, personalID uuid.UUID) error {
+	found, err := queries.LockPersonal(ctx, personalID)
+	if err != nil {
+		return fmt.Errorf("failed to lock trainer: %w", err)
+	}
+	if !found {
+		return fmt.Errorf("%w: trainer %s", utils.ErrNotFound, personalID)
+	}
+	return nil
+}
+
+func checkScheduleWindowOverlap(ctx context.Context, queries *pgstore.Queries, personalID uuid.UUID, req pgstore.PersonalScheduleRequest, excludeID *uuid.UUID) error {
+	overlapping, err := queries.GetOverlappingPersonalSchedule(ctx, pgstore.GetOverlappingPersonalScheduleParams{
+		PersonalID:         personalID,
+		WeekDay:            req.WeekDay,
+		TimeStartInMinutes: req.TimeStartInMinutes,
+		TimeEndInMinutes:   req.TimeEndInMinutes,
+		ExcludeID:          excludeID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check overlapping schedule windows: %w", err)
+	}
+	if overlapping != nil {
+		return fmt.Errorf("%w: the window overlaps another one on the same week day", utils.ErrConflict)
+	}
+	return nil
+}
+
+func isSchedulingParticipant(scheduling *pgstore.Scheduling, userID uuid.UUID) bool {
+	return scheduling.PersonalID == userID || scheduling.StudentID == userID
+}
+
+func newSchedulingResponse(scheduling *pgstore.Scheduling) *pgstore.SchedulingResponse {
+	return &pgstore.SchedulingResponse{
+		ID:          scheduling.ID,
+		PersonalID:  scheduling.PersonalID,
+		StudentID:   scheduling.StudentID,
+		WorkoutID:   scheduling.WorkoutID,
+		Date:        scheduling.Date,
+		EndTime:     scheduling.EndTime,
+		Type:        scheduling.Type,
+		Status:      scheduling.Status,
+		Notes:       scheduling.Notes,
+		StartedAt:   scheduling.StartedAt,
+		CompletedAt: scheduling.CompletedAt,
+		CreatedAt:   scheduling.CreatedAt,
+		UserID:      scheduling.UserID,
+		SeriesID:    scheduling.SeriesID,
+	}
+}
+
+// schedulingActor identifies who changes the status of a scheduling. It is
+// stored in schedulings_history.changed_by.
+type schedulingActor string
+
+const (
+	schedulingActorPersonal schedulingActor = "PERSONAL"
+	schedulingActorStudent  schedulingActor = "STUDENT"
+	schedulingActorSystem   schedulingActor = "SYSTEM"
+)
+
+const (
+	// schedulingStartWindow is how early a trainer may start a session
+	schedulingStartWindow = 15 * time.Minute
+	// schedulingMissedGracePeriod is how long after its end a session that
+	// was never started is marked as missed
+	schedulingMissedGracePeriod = 15 * time.Minute
+)
+
+type schedulingTransitionKey struct {
+	from pgstore.SchedulingStatus
+	to   pgstore.SchedulingStatus
+}
+
+// schedulingTransitionRule lists who may make a transition and when
+type schedulingTransitionRule struct {
+	actors []schedulingActor
+	when   func(scheduling *pgstore.Scheduling, now time.Time) error
+}
+
+// schedulingTransitions is the scheduling state machine. Any transition not
+// listed here is rejected; CANCELED, COMPLETED and MISSED are final.
+var schedulingTransitions = map[schedulingTransitionKey]schedulingTransitionRule{
+	{pgstore.SchedulingStatusPendingConfirmation, pgstore.SchedulingStatusScheduled}: {
+		actors: []schedulingActor{schedulingActorPersonal},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusPendingConfirmation, pgstore.SchedulingStatusCanceled}: {
+		actors: []schedulingActor{schedulingActorPersonal, schedulingActorStudent},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusPendingConfirmation, pgstore.SchedulingStatusMissed}: {
+		actors: []schedulingActor{schedulingActorSystem},
+		when:   afterSchedulingEnd,
+	},
+	{pgstore.SchedulingStatusScheduled, pgstore.SchedulingStatusInProgress}: {
+		actors: []schedulingActor{schedulingActorPersonal},
+		when:   withinSchedulingStartWindow,
+	},
+	{pgstore.SchedulingStatusScheduled, pgstore.SchedulingStatusRescheduled}: {
+		actors: []schedulingActor{schedulingActorPersonal, schedulingActorStudent},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusScheduled, pgstore.SchedulingStatusCanceled}: {
+		actors: []schedulingActor{schedulingActorPersonal, schedulingActorStudent},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusScheduled, pgstore.SchedulingStatusMissed}: {
+		actors: []schedulingActor{schedulingActorSystem},
+		when:   afterSchedulingEnd,
+	},
+	{pgstore.SchedulingStatusRescheduled, pgstore.SchedulingStatusScheduled}: {
+		actors: []schedulingActor{schedulingActorPersonal},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusRescheduled, pgstore.SchedulingStatusRescheduled}: {
+		actors: []schedulingActor{schedulingActorPersonal, schedulingActorStudent},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusRescheduled, pgstore.SchedulingStatusCanceled}: {
+		actors: []schedulingActor{schedulingActorPersonal, schedulingActorStudent},
+		when:   beforeSchedulingStart,
+	},
+	{pgstore.SchedulingStatusRescheduled, pgstore.SchedulingStatusMissed}: {
+		actors: []schedulingActor{schedulingActorSystem},
+		when:   afterSchedulingEnd,
+	},
+	{pgstore.SchedulingStatusInProgress, pgstore.SchedulingStatusCompleted}: {
+		actors: []schedulingActor{schedulingActorPersonal},
+	},
+}
+
+func beforeSchedulingStart(scheduling *pgstore.Scheduling, now time.Time) error {
+	if !now.Before(scheduling.Date) {
+		return fmt.Errorf("%w: the session has already started", utils.ErrBadRequest)
+	}
+	return nil
+}
+
+func withinSchedulingStartWindow(scheduling *pgstore.Scheduling, now time.Time) error {
+	if now.Before(scheduling.Date.Add(-schedulingStartWindow)) {
+		return fmt.Errorf("%w: the session can only start %s before its start time", utils.ErrBadRequest, schedulingStartWindow)
+	}
+	if !now.Before(scheduling.EndTime) {
+		return fmt.Errorf("%w: the session has already ended", utils.ErrBadRequest)
+	}
+	return nil
+}
+
+func afterSchedulingEnd(scheduling *pgstore.Scheduling, now time.Time) error {
+	if now.Before(scheduling.EndTime) {
+		return fmt.Errorf("%w: the session has not ended yet", utils.ErrBadRequest)
+	}
+	return nil
+}
+
+// applySchedulingTransition moves a scheduling to a new status when the
+// transition table allows it and records the change in schedulings_history.
+// Sessions cancelled in time or never confirmed get their credit back. The
+// scheduling is updated in place.
+func applySchedulingTransition(ctx context.Context, queries *pgstore.Queries, scheduling *pgstore.Scheduling, to pgstore.SchedulingStatus, actor schedulingActor, userID *uuid.UUID, reason, notes *string, now time.Time) error {
+	rule, ok := schedulingTransitions[schedulingTransitionKey{from: scheduling.Status, to: to}]
+	if !ok {
+		return fmt.Errorf("%w: cannot move a %s session to %s", utils.ErrBadRequest, scheduling.Status, to)
+	}
+	if !slices.Contains(rule.actors, actor) {
+		return fmt.Errorf("%w: %s cannot move a %s session to %s", utils.ErrForbidden, strings.ToLower(string(actor)), scheduling.Status, to)
+	}
+	if rule.when != nil {
+		if err := rule.when(scheduling, now); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	switch to {
+	case pgstore.SchedulingStatusInProgress:
+		err = queries.UpdateSchedulingWithStartTime(ctx, pgstore.UpdateSchedulingWithStartTimeParams{
+			ID:        scheduling.ID,
+			StartedAt: &now,
+			Status:    to,
+		})
+		scheduling.StartedAt = &now
+	case pgstore.SchedulingStatusCompleted:
+		err = queries.UpdateSchedulingWithCompletedTime(ctx, pgstore.UpdateSchedulingWithCompletedTimeParams{
+			ID:          scheduling.ID,
+			CompletedAt: &now,
+			Status:      to,
+		})
+		scheduling.CompletedAt = &now
+	case pgstore.SchedulingStatusCanceled:
+		err = queries.UpdateSchedulingWithCanceledTime(ctx, pgstore.UpdateSchedulingWithCanceledTimeParams{
+			ID:     scheduling.ID,
+			Status: to,
+		})
+	default:
+		err = queries.UpdateSchedulingStatus(ctx, pgstore.UpdateSchedulingStatusParams{
+			ID:     scheduling.ID,
+			Status: to,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update scheduling status: %w", err)
+	}
+	from := scheduling.Status
+	scheduling.Status = to
+
+	if refundsSessionCredit(scheduling, from, to, actor, now) {
+		if err := refundSessionCredit(ctx, queries, scheduling.ID, now); err != nil {
+			return err
+		}
+	}
+
+	_, err = queries.CreateSchedulingHistory(ctx, pgstore.CreateSchedulingHistoryParams{
+		ID:         uuid.New(),
+		ScheduleID: scheduling.ID,
+		UserID:     userID,
+		Status:     to,
+		ChangedAt:  &now,
+		ChangedBy:  string(actor),
+		Reason:     reason,
+		Notes:      notes,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record scheduling history: %w", err)
+	}
+
+	return nil
+}
+
+// getSchedulingForActor locks a scheduling and tells whether the user acts on
+// it as the trainer or as the student
+func getSchedulingForActor(ctx context.Context, queries *pgstore.Queries, schedulingID, userID uuid.UUID) (*pgstore.Scheduling, schedulingActor, error) {
+	scheduling, err := queries.GetSchedulingForUpdate(ctx, schedulingID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get scheduling: %w", err)
+	}
+	if scheduling == nil || !isSchedulingParticipant(scheduling, userID) {
+		return nil, "", fmt.Errorf("%w: scheduling %s", utils.ErrNotFound, schedulingID)
+	}
+
+	if scheduling.PersonalID == userID {
+		return scheduling, schedulingActorPersonal, nil
+	}
+	return scheduling, schedulingActorStudent, nil
+}
+
+// isReschedulable reports whether a session may still be moved to another time
+func isReschedulable(scheduling *pgstore.Scheduling, now time.Time) bool {
+	switch scheduling.Status {
+	case pgstore.SchedulingStatusPendingConfirmation, pgstore.SchedulingStatusScheduled, pgstore.SchedulingStatusRescheduled:
+		return now.Before(scheduling.Date)
+	default:
+		return false
+	}
+}
+
+// maxSeriesOccurrences caps how many sessions a recurrence rule may book
+const maxSeriesOccurrences = 104
+
+var recurrenceWeekDays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// recurrenceRule is the supported subset of an iCalendar RRULE: weekly
+// occurrences on some week days, every interval weeks, bounded by a count of
+// occurrences or by an end date
+type recurrenceRule struct {
+	interval int
+	weekDays []time.Weekday
+	count    int
+	until    *time.Time
+}
+
+// parseRecurrenceRule parses rules such as "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=12"
+// or "RRULE:FREQ=WEEKLY;INTERVAL=2;UNTIL=20261231". Dates without a UTC
+// suffix are read in the given location.
+func parseRecurrenceRule(value string, location *time.Location) (*recurrenceRule, error) {
+	rule := &recurrenceRule{interval: 1}
+
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+	var frequency string
+	for _, part := range strings.Split(value, ";") {
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: invalid recurrence part %q", utils.ErrBadRequest, part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			frequency = strings.ToUpper(val)
+		case "INTERVAL":
+			interval, err := strconv.Atoi(val)
+			if err != nil || interval < 1 {
+				return nil, fmt.Errorf("%w: recurrence interval must be a positive number", utils.ErrBadRequest)
+			}
+			rule.interval = interval
+		case "BYDAY":
+			for _, day := range strings.Split(strings.ToUpper(val), ",") {
+				weekDay, ok := recurrenceWeekDays[day]
+				if !ok {
+					return nil, fmt.Errorf("%w: invalid recurrence week day %q", utils.ErrBadRequest, day)
+				}
+				if !slices.Contains(rule.weekDays, weekDay) {
+					rule.weekDays = append(rule.weekDays, weekDay)
+				}
+			}
+		case "COUNT":
+			count, err := strconv.Atoi(val)
+			if err != nil || count < 1 {
+				return nil, fmt.Errorf("%w: recurrence count must be a positive number", utils.ErrBadRequest)
+			}
+			rule.count = count
+		case "UNTIL":
+			until, err := parseRecurrenceUntil(val, location)
+			if err != nil {
+				return nil, err
+			}
+			rule.until = &until
+		default:
+			return nil, fmt.Errorf("%w: unsupported recurrence part %q", utils.ErrBadRequest, key)
+		}
+	}
+
+	if frequency != "WEEKLY" {
+		return nil, fmt.Errorf("%w: only weekly recurrences are supported", utils.ErrBadRequest)
+	}
+	if (rule.count == 0) == (rule.until == nil) {
+		return nil, fmt.Errorf("%w: recurrence needs either a count or an end date", utils.ErrBadRequest)
+	}
+	if rule.count > maxSeriesOccurrences {
+		return nil, fmt.Errorf("%w: a series can have at most %d occurrences", utils.ErrBadRequest, maxSeriesOccurrences)
+	}
+
+	return rule, nil
+}
+
+// parseRecurrenceUntil reads an UNTIL value. A date alone includes that whole day.
+func parseRecurrenceUntil(value string, location *time.Location) (time.Time, error) {
+	if until, err := time.Parse("20060102T150405Z", value); err == nil {
+		return until, nil
+	}
+	if until, err := time.ParseInLocation("20060102T150405", value, location); err == nil {
+		return until, nil
+	}
+	if until, err := time.ParseInLocation("20060102", value, location); err == nil {
+		return until.AddDate(0, 0, 1).Add(-time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: recurrence end date must use the YYYYMMDD format", utils.ErrBadRequest)
+}
+
+// occurrences expands the rule from the first session. The first session must
+// fall on one of the rule's week days, which default to its own.
+func (r *recurrenceRule) occurrences(start time.Time) ([]time.Time, error) {
+	weekDays := r.weekDays
+	if len(weekDays) == 0 {
+		weekDays = []time.Weekday{start.Weekday()}
+	}
+	if !slices.Contains(weekDays, start.Weekday()) {
+		return nil, fmt.Errorf("%w: the first session must fall on one of the recurrence week days", utils.ErrBadRequest)
+	}
+
+	// Weeks start on Monday, as RRULE's default WKST
+	offsets := make([]int, 0, len(weekDays))
+	for _, weekDay := range weekDays {
+		offsets = append(offsets, (int(weekDay)+6)%7)
+	}
+	slices.Sort(offsets)
+
+	weekStart := start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	var starts []time.Time
+	for week := 0; ; week += r.interval {
+		for _, offset := range offsets {
+			occurrence := time.Date(weekStart.Year(), weekStart.Month(), weekStart.Day()+week*7+offset,
+				start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+			if occurrence.Before(start) {
+				continue
+			}
+			if r.until != nil && occurrence.After(*r.until) {
+				return starts, nil
+			}
+			if len(starts) == maxSeriesOccurrences {
+				return nil, fmt.Errorf("%w: a series can have at most %d occurrences", utils.ErrBadRequest, maxSeriesOccurrences)
+			}
+
+			starts = append(starts, occurrence)
+			if r.count > 0 && len(starts) == r.count {
+				return starts, nil
+			}
+		}
+	}
+}
+
+// String formats the rule back as an RRULE value
+func (r *recurrenceRule) String() string {
+	parts := []string{"FREQ=WEEKLY"}
+	if r.interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.interval))
+	}
+	if len(r.weekDays) > 0 {
+		days := make([]string, 0, len(r.weekDays))
+		for _, weekDay := range r.weekDays {
+			days = append(days, strings.ToUpper(weekDay.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.count))
+	}
+	if r.until != nil {
+		parts = append(parts, "UNTIL="+r.until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
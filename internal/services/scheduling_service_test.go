@@ -0,0 +1,179 @@
+package services
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+)
+
+func TestFitsPersonalScheduleIgnoresOffset(t *testing.T) {
+	location := time.FixedZone("BRT", -3*60*60)
+	windows := []pgstore.PersonalSchedule{
+		{WeekDay: int32(time.Monday), TimeStartInMinutes: 9 * 60, TimeEndInMinutes: 18 * 60},
+		{WeekDay: int32(time.Tuesday), TimeStartInMinutes: 9 * 60, TimeEndInMinutes: 18 * 60},
+		{WeekDay: int32(time.Wednesday), TimeStartInMinutes: 9 * 60, TimeEndInMinutes: 18 * 60},
+	}
+	extraStart, extraEnd := int32(19*60), int32(22*60)
+	exceptions := []pgstore.PersonalScheduleException{
+		{
+			Date:               time.Date(2024, 5, 7, 0, 0, 0, 0, time.UTC),
+			Type:               pgstore.ScheduleExceptionTypeAvailable,
+			TimeStartInMinutes: &extraStart,
+			TimeEndInMinutes:   &extraEnd,
+		},
+		{
+			Date: time.Date(2024, 5, 8, 0, 0, 0, 0, time.UTC),
+			Type: pgstore.ScheduleExceptionTypeUnavailable,
+		},
+	}
+
+	// The same instant is booked with each of these offsets
+	offsets := []*time.Location{
+		location,
+		time.UTC,
+		time.FixedZone("", 9*60*60),
+		time.FixedZone("", -10*60*60),
+	}
+
+	tests := []struct {
+		name  string
+		start time.Time
+		want  bool
+	}{
+		{"inside the window", time.Date(2024, 5, 6, 10, 0, 0, 0, location), true},
+		{"ending with the window", time.Date(2024, 5, 6, 17, 0, 0, 0, location), true},
+		{"before the window", time.Date(2024, 5, 6, 5, 0, 0, 0, location), false},
+		{"after the window", time.Date(2024, 5, 6, 20, 0, 0, 0, location), false},
+		{"extra hours of an exception", time.Date(2024, 5, 7, 20, 0, 0, 0, location), true},
+		{"day blocked by an exception", time.Date(2024, 5, 8, 10, 0, 0, 0, location), false},
+		{"day without windows", time.Date(2024, 5, 9, 10, 0, 0, 0, location), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, offset := range offsets {
+				start := tt.start.In(offset)
+				end := start.Add(time.Hour)
+				if got := fitsPersonalSchedule(windows, exceptions, start, end, location); got != tt.want {
+					t.Errorf("fitsPersonalSchedule(%s) = %v, want %v", start.Format(time.RFC3339), got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleDate(t *testing.T) {
+	location := time.FixedZone("BRT", -3*60*60)
+	want := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+
+	// 23:30 in the location is already the next day in UTC and further east
+	instant := time.Date(2024, 5, 6, 23, 30, 0, 0, location)
+	for _, offset := range []*time.Location{location, time.UTC, time.FixedZone("", 9*60*60)} {
+		if got := scheduleDate(instant.In(offset), location); !got.Equal(want) {
+			t.Errorf("scheduleDate(%s) = %s, want %s", instant.In(offset).Format(time.RFC3339), got, want)
+		}
+	}
+}
+
+func TestParseRecurrenceRule(t *testing.T) {
+	location := time.FixedZone("BRT", -3*60*60)
+	endOfDay := time.Date(2024, 6, 30, 23, 59, 59, 0, location)
+	endOfDayUTC := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    recurrenceRule
+		wantErr bool
+	}{
+		{"count", "FREQ=WEEKLY;COUNT=4", recurrenceRule{interval: 1, count: 4}, false},
+		{"by day", "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=12", recurrenceRule{interval: 1, weekDays: []time.Weekday{time.Monday, time.Wednesday, time.Friday}, count: 12}, false},
+		{"repeated day", "FREQ=WEEKLY;BYDAY=mo,MO;COUNT=2", recurrenceRule{interval: 1, weekDays: []time.Weekday{time.Monday}, count: 2}, false},
+		{"interval", "RRULE:FREQ=WEEKLY;INTERVAL=2;COUNT=3", recurrenceRule{interval: 2, count: 3}, false},
+		{"date only until", "FREQ=WEEKLY;UNTIL=20240630", recurrenceRule{interval: 1, until: &endOfDay}, false},
+		{"UTC until", "FREQ=WEEKLY;UNTIL=20240630T120000Z", recurrenceRule{interval: 1, until: &endOfDayUTC}, false},
+		{"count cap", "FREQ=WEEKLY;COUNT=104", recurrenceRule{interval: 1, count: maxSeriesOccurrences}, false},
+		{"count over the cap", "FREQ=WEEKLY;COUNT=105", recurrenceRule{}, true},
+		{"daily", "FREQ=DAILY;COUNT=4", recurrenceRule{}, true},
+		{"no frequency", "BYDAY=MO;COUNT=4", recurrenceRule{}, true},
+		{"unbounded", "FREQ=WEEKLY;BYDAY=MO", recurrenceRule{}, true},
+		{"count and until", "FREQ=WEEKLY;COUNT=4;UNTIL=20240630", recurrenceRule{}, true},
+		{"zero interval", "FREQ=WEEKLY;INTERVAL=0;COUNT=4", recurrenceRule{}, true},
+		{"unknown day", "FREQ=WEEKLY;BYDAY=XX;COUNT=4", recurrenceRule{}, true},
+		{"invalid until", "FREQ=WEEKLY;UNTIL=2024-06-30", recurrenceRule{}, true},
+		{"unsupported part", "FREQ=WEEKLY;COUNT=4;BYMONTH=1", recurrenceRule{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecurrenceRule(tt.value, location)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRecurrenceRule(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.interval != tt.want.interval || got.count != tt.want.count || !slices.Equal(got.weekDays, tt.want.weekDays) {
+				t.Errorf("parseRecurrenceRule(%q) = %+v, want %+v", tt.value, *got, tt.want)
+			}
+			if (got.until == nil) != (tt.want.until == nil) || (got.until != nil && !got.until.Equal(*tt.want.until)) {
+				t.Errorf("parseRecurrenceRule(%q) until = %v, want %v", tt.value, got.until, tt.want.until)
+			}
+		})
+	}
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	location := time.FixedZone("BRT", -3*60*60)
+	// A Monday at 7am
+	monday := time.Date(2024, 5, 6, 7, 0, 0, 0, location)
+	day := func(offset int) time.Time {
+		return monday.AddDate(0, 0, offset)
+	}
+
+	tests := []struct {
+		name    string
+		rule    string
+		start   time.Time
+		want    []time.Time
+		wantErr bool
+	}{
+		{"count on the start's day", "FREQ=WEEKLY;COUNT=3", monday, []time.Time{day(0), day(7), day(14)}, false},
+		{"by day", "FREQ=WEEKLY;BYDAY=MO,WE,FR;COUNT=5", monday, []time.Time{day(0), day(2), day(4), day(7), day(9)}, false},
+		{"by day from mid week", "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3", day(2), []time.Time{day(2), day(7), day(9)}, false},
+		{"interval", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=4", monday, []time.Time{day(0), day(3), day(14), day(17)}, false},
+		{"date only until includes the day", "FREQ=WEEKLY;UNTIL=20240520", monday, []time.Time{day(0), day(7), day(14)}, false},
+		{"until before the start", "FREQ=WEEKLY;UNTIL=20240501", monday, nil, false},
+		{"start off the week days", "FREQ=WEEKLY;BYDAY=TU;COUNT=2", monday, nil, true},
+		{"over the cap", "FREQ=WEEKLY;BYDAY=MO,TU,WE;UNTIL=20261231", monday, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRecurrenceRule(tt.rule, location)
+			if err != nil {
+				t.Fatalf("parseRecurrenceRule(%q) error = %v", tt.rule, err)
+			}
+
+			got, err := rule.occurrences(tt.start)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("occurrences(%q) error = %v, wantErr %v", tt.rule, err, tt.wantErr)
+			}
+			if !slices.EqualFunc(got, tt.want, time.Time.Equal) {
+				t.Errorf("occurrences(%q) = %v, want %v", tt.rule, got, tt.want)
+			}
+		})
+	}
+
+	// The cap itself can be booked
+	rule, err := parseRecurrenceRule("FREQ=WEEKLY;COUNT=104", location)
+	if err != nil {
+		t.Fatalf("parseRecurrenceRule() error = %v", err)
+	}
+	got, err := rule.occurrences(monday)
+	if err != nil || len(got) != maxSeriesOccurrences {
+		t.Errorf("occurrences(COUNT=104) = %d occurrences, %v; want %d", len(got), err, maxSeriesOccurrences)
+	}
+}
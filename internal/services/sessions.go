@@ -0,0 +1,296 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// sessionActivityInterval is how often the last use of a session is
+// recorded, so not every request writes to the session store
+const sessionActivityInterval = 5 * time.Minute
+
+// cookieSessionID identifies a session without giving away its token, which
+// is as good as a password
+func cookieSessionID(token string) string {
+	return hashAuthToken(token)
+}
+
+// CurrentSessionID identifies the session of the request
+func (s *AuthService) CurrentSessionID(ctx context.Context) string {
+	return cookieSessionID(s.sessionManager.Token(ctx))
+}
+
+// TouchSession records that the session of the request is in use
+func (s *AuthService) TouchSession(ctx context.Context) {
+	now := time.Now()
+	lastSeenAt := s.sessionManager.GetInt64(ctx, "last_seen_at")
+	if now.Sub(time.Unix(lastSeenAt, 0)) >= sessionActivityInterval {
+		s.sessionManager.Put(ctx, "last_seen_at", now.Unix())
+	}
+}
+
+// ListSessions returns the browser sessions and app refresh token families
+// the user is signed in with, most recently used first. currentSessionID
+// marks the one of the request.
+func (s *AuthService) ListSessions(ctx context.Context, userID uuid.UUID, currentSessionID string) ([]pgstore.ActiveSession, error) {
+	cookieSessions, err := s.userCookieSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []pgstore.ActiveSession
+	for _, cookie := range cookieSessions {
+		session := pgstore.ActiveSession{
+			ID:         cookieSessionID(cookie.token),
+			Type:       pgstore.ActiveSessionCookie,
+			DeviceInfo: cookie.stringValue("device_info"),
+			IPAddress:  cookie.stringValue("ip_address"),
+			CreatedAt:  cookie.timeValue("created_at"),
+			LastUsedAt: cookie.timeValue("last_seen_at"),
+			ExpiresAt:  cookie.deadline,
+		}
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	tokens, err := s.queries.GetRefreshTokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh tokens: %w", err)
+	}
+	for _, token := range tokens {
+		session := pgstore.ActiveSession{
+			ID:         token.FamilyID.String(),
+			Type:       pgstore.ActiveSessionToken,
+			DeviceInfo: token.DeviceInfo,
+			IPAddress:  token.IPAddress,
+			CreatedAt:  &token.FamilyCreatedAt,
+			LastUsedAt: &token.CreatedAt,
+			ExpiresAt:  token.ExpiresAt,
+		}
+		session.Current = session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return lastUsed(sessions[i]).After(lastUsed(sessions[j]))
+	})
+
+	return sessions, nil
+}
+
+func lastUsed(session pgstore.ActiveSession) time.Time {
+	if session.LastUsedAt != nil {
+		return *session.LastUsedAt
+	}
+	if session.CreatedAt != nil {
+		return *session.CreatedAt
+	}
+	return time.Time{}
+}
+
+// RevokeSession signs the user out of one of their sessions
+func (s *AuthService) RevokeSession(ctx context.Context, userID uuid.UUID, sessionID, currentSessionID string) error {
+	if familyID, err := uuid.Parse(sessionID); err == nil {
+		revoked, err := s.queries.RevokeUserRefreshTokenFamily(ctx, pgstore.RevokeUserRefreshTokenFamilyParams{
+			UserID:   userID,
+			FamilyID: familyID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+		if revoked {
+			return nil
+		}
+	}
+
+	// The session of the request is saved again once the request ends, so it
+	// has to be destroyed through the request
+	if sessionID == currentSessionID && s.IsAuthenticated(ctx) {
+		return s.Logout(ctx)
+	}
+
+	cookieSessions, err := s.userCookieSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, cookie := range cookieSessions {
+		if cookieSessionID(cookie.token) == sessionID {
+			return s.destroyCookieSession(ctx, cookie.token)
+		}
+	}
+	return fmt.Errorf("%w: session not found", utils.ErrNotFound)
+}
+
+// RevokeOtherSessions signs the user out everywhere but the session of the
+// request
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID uuid.UUID, currentSessionID string) error {
+	if err := s.revokeOtherRefreshTokens(ctx, s.queries, userID, currentSessionID); err != nil {
+		return err
+	}
+	return s.destroyUserSessions(ctx, userID, currentSessionID)
+}
+
+// ChangePassword sets a new password once the current one is confirmed, and
+// signs the user out everywhere but the session of the request
+func (s *AuthService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword, currentSessionID string) error {
+	passwordHash, err := s.queries.GetUserPasswordHash(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !s.verifyPassword(currentPassword, passwordHash) {
+		return fmt.Errorf("%w: current password is incorrect", utils.ErrBadRequest)
+	}
+
+	hashedPassword, err := s.hashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	err = txQueries.UpdateUserPassword(ctx, pgstore.UpdateUserPasswordParams{
+		ID:       userID,
+		Password: hashedPassword,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	if err := s.revokeOtherRefreshTokens(ctx, txQueries, userID, currentSessionID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.destroyUserSessions(ctx, userID, currentSessionID)
+}
+
+// revokeOtherRefreshTokens revokes every refresh token family of the user
+// but the one of the current session, if it is one
+func (s *AuthService) revokeOtherRefreshTokens(ctx context.Context, queries *pgstore.Queries, userID uuid.UUID, currentSessionID string) error {
+	exceptFamilyID, err := uuid.Parse(currentSessionID)
+	if err != nil {
+		exceptFamilyID = uuid.Nil
+	}
+
+	err = queries.RevokeOtherUserRefreshTokens(ctx, pgstore.RevokeOtherUserRefreshTokensParams{
+		UserID:         userID,
+		ExceptFamilyID: exceptFamilyID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+// cookieSession is a cookie session of a user as kept in the session store
+type cookieSession struct {
+	token    string
+	deadline time.Time
+	values   map[string]interface{}
+}
+
+// userCookieSessions reads the cookie sessions of the user found through the
+// user_session index. Index rows of sessions that are gone are skipped; they
+// are pruned the next time the user signs in.
+func (s *AuthService) userCookieSessions(ctx context.Context, userID uuid.UUID) ([]cookieSession, error) {
+	tokens, err := s.queries.GetUserSessionTokens(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session tokens: %w", err)
+	}
+
+	var sessions []cookieSession
+	for _, token := range tokens {
+		b, found, err := s.sessionManager.Store.Find(token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find session: %w", err)
+		}
+		if !found {
+			continue
+		}
+
+		deadline, values, err := s.sessionManager.Codec.Decode(b)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode session: %w", err)
+		}
+		if sessionUserID, _ := values["user_id"].(string); sessionUserID != userID.String() {
+			continue
+		}
+
+		sessions = append(sessions, cookieSession{token: token, deadline: deadline, values: values})
+	}
+	return sessions, nil
+}
+
+// IndexCookieSessions adds the signed in cookie sessions missing from the
+// user_session index, such as those started before it existed, so they can be
+// listed and revoked. It scans the whole session store and returns how many
+// sessions it indexed.
+func (s *AuthService) IndexCookieSessions(ctx context.Context) (int, error) {
+	indexed := 0
+	err := s.sessionManager.Iterate(ctx, func(ctx context.Context) error {
+		userID, err := uuid.Parse(s.sessionManager.GetString(ctx, "user_id"))
+		if err != nil {
+			// Not signed in
+			return nil
+		}
+
+		added, err := s.queries.BackfillUserSession(ctx, pgstore.CreateUserSessionParams{
+			Token:  s.sessionManager.Token(ctx),
+			UserID: userID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to index session: %w", err)
+		}
+		if added {
+			indexed++
+		}
+		return nil
+	})
+	if err != nil {
+		return indexed, fmt.Errorf("failed to index sessions: %w", err)
+	}
+	return indexed, nil
+}
+
+// destroyCookieSession signs out the cookie session with the token. It must
+// not be the session of the request, which is saved again once the request
+// ends.
+func (s *AuthService) destroyCookieSession(ctx context.Context, token string) error {
+	if err := s.sessionManager.Store.Delete(token); err != nil {
+		return fmt.Errorf("failed to destroy session: %w", err)
+	}
+	if err := s.queries.DeleteUserSession(ctx, token); err != nil {
+		return fmt.Errorf("failed to delete session index: %w", err)
+	}
+	return nil
+}
+
+func (c cookieSession) stringValue(key string) *string {
+	if value, _ := c.values[key].(string); value != "" {
+		return &value
+	}
+	return nil
+}
+
+func (c cookieSession) timeValue(key string) *time.Time {
+	if value, _ := c.values[key].(int64); value != 0 {
+		t := time.Unix(value, 0)
+		return &t
+	}
+	return nil
+}
@@ -1 +1,1058 @@
 package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
+)
+
+// paymentTransitions lists the statuses a payment can move to. A failed
+// payment can still complete when the provider confirms it late, and
+// completed payments are only undone by a refund or chargeback.
+var paymentTransitions = map[pgstore.PaymentStatus][]pgstore.PaymentStatus{
+	pgstore.PaymentStatusPending:   {pgstore.PaymentStatusCompleted, pgstore.PaymentStatusFailed},
+	pgstore.PaymentStatusFailed:    {pgstore.PaymentStatusCompleted},
+	pgstore.PaymentStatusCompleted: {pgstore.PaymentStatusRefunded},
+}
+
+// subscriptionRenewalBatch bounds how many due subscriptions a single
+// ProcessDueSubscriptions run handles
+const subscriptionRenewalBatch = 100
+
+// SubscribeToPlan starts a subscription of the user to an active plan, with a
+// first period of the plan's duration from now. A user holds at most one
+// pending or active recurring subscription; package plans are bought the same
+// way, any number of times, and grant their session credits once paid. A
+// coupon discounts the first period only; renewals charge the plan price. Paid
+// plans stay PENDING until their payment completes; when the request names a
+// payment method the payment is started here, otherwise through
+// ProcessPayment. A payment that fails here does not undo the subscription:
+// it is returned PENDING with the payment error so it can be paid again.
+func (s *PlanService) SubscribeToPlan(ctx context.Context, userID uuid.UUID, req pgstore.SubscriptionRequest) (*pgstore.SubscriptionResponse, error) {
+	planUUID, err := uuid.Parse(req.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
+	}
+	if req.PaymentMethod != nil {
+		if err := s.validatePaymentMethod(*req.PaymentMethod, req.PaymentToken); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	found, err := txQueries.LockUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: user not found", utils.ErrNotFound)
+	}
+
+	plan, err := getSubscribablePlan(ctx, txQueries, planUUID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.Type == pgstore.PlanTypeSubscription {
+		existing, err := txQueries.GetLiveSubscriptionByUserId(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get subscription: %w", err)
+		}
+		if existing != nil {
+			return nil, fmt.Errorf("%w: user already has an active subscription", utils.ErrConflict)
+		}
+	}
+
+	now := time.Now()
+
+	var coupon *pgstore.Coupon
+	var discount pgstore.Money
+	if req.CouponCode != "" {
+		coupon, discount, err = redeemCoupon(ctx, txQueries, req.CouponCode, plan, userID, now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	amount := plan.Price.Sub(discount)
+
+	subscription, err := txQueries.CreateSubscription(ctx, pgstore.CreateSubscriptionParams{
+		UserID:         userID,
+		PlanID:         plan.ID,
+		Status:         subscriptionPeriodStatus(amount),
+		StartDate:      now,
+		EndDate:        subscriptionPeriodEnd(now, plan.Duration),
+		Amount:         amount,
+		PlanType:       plan.Type,
+		SessionCredits: plan.SessionCredits,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	history := pgstore.CreateSubscriptionHistoryParams{
+		SubscriptionID: subscription.ID,
+		PlanID:         subscription.PlanID,
+		Event:          pgstore.SubscriptionEventCreated,
+		Status:         subscription.Status,
+		StartDate:      subscription.StartDate,
+		EndDate:        subscription.EndDate,
+		Amount:         subscription.Amount,
+		Discount:       discount,
+	}
+	if coupon != nil {
+		history.CouponID = &coupon.ID
+
+		err = txQueries.CreateCouponRedemption(ctx, pgstore.CreateCouponRedemptionParams{
+			CouponID:       coupon.ID,
+			UserID:         userID,
+			SubscriptionID: subscription.ID,
+			Discount:       discount,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to record coupon redemption: %w", err)
+		}
+	}
+	if err := txQueries.CreateSubscriptionHistory(ctx, history); err != nil {
+		return nil, fmt.Errorf("failed to create subscription history: %w", err)
+	}
+	if subscription.Status == pgstore.SubscriptionStatusActive {
+		if err := grantPackageCredits(ctx, txQueries, subscription); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	response := toSubscriptionResponse(subscription, plan.Name)
+	if !discount.IsZero() {
+		response.Discount = &discount
+	}
+	if req.PaymentMethod == nil || subscription.Status != pgstore.SubscriptionStatusPending {
+		return response, nil
+	}
+
+	payment, err := s.ProcessPayment(ctx, userID, subscription.ID, *req.PaymentMethod, req.PaymentToken)
+	if err != nil {
+		response.Payment = payment
+		response.PaymentError = paymentErrorMessage(err)
+		return response, nil
+	}
+	response.Status = payment.Subscription
+	response.Payment = payment
+
+	return response, nil
+}
+
+// UpdateSubscription sets the plan the user's subscription renews into at the
+// end of the current period. Choosing the current plan keeps it and undoes a
+// pending cancellation.
+func (s *PlanService) UpdateSubscription(ctx context.Context, userID uuid.UUID, planID string) (*pgstore.SubscriptionResponse, error) {
+	planUUID, err := uuid.Parse(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	subscription, err := getLiveSubscriptionForUpdate(ctx, txQueries, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var nextPlanID *uuid.UUID
+	event := pgstore.SubscriptionEventResumed
+	if planUUID != subscription.PlanID {
+		nextPlan, err := getSubscribablePlan(ctx, txQueries, planUUID, userID)
+		if err != nil {
+			return nil, err
+		}
+		if nextPlan.Type != pgstore.PlanTypeSubscription {
+			return nil, fmt.Errorf("%w: packages are bought separately, not subscribed to", utils.ErrBadRequest)
+		}
+		nextPlanID = &nextPlan.ID
+		event = pgstore.SubscriptionEventPlanChanged
+	} else if !subscription.CancelAtPeriodEnd && subscription.NextPlanID == nil {
+		return nil, fmt.Errorf("%w: subscription is already on this plan", utils.ErrConflict)
+	}
+
+	subscription, err = txQueries.UpdateSubscriptionRenewal(ctx, pgstore.UpdateSubscriptionRenewalParams{
+		ID:         subscription.ID,
+		NextPlanID: nextPlanID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	if err := recordSubscriptionEvent(ctx, txQueries, subscription, planUUID, event); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getSubscriptionResponse(ctx, subscription)
+}
+
+// CancelSubscription cancels the user's subscription at the end of the paid
+// period; until then it stays active. A subscription that was never activated
+// is cancelled right away and gives its coupon back.
+func (s *PlanService) CancelSubscription(ctx context.Context, userID uuid.UUID) (*pgstore.SubscriptionResponse, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	subscription, err := getLiveSubscriptionForUpdate(ctx, txQueries, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription.Status == pgstore.SubscriptionStatusPending {
+		if err := endSubscription(ctx, txQueries, subscription, pgstore.SubscriptionStatusCancelled, pgstore.SubscriptionEventCancelled); err != nil {
+			return nil, err
+		}
+	} else {
+		if subscription.CancelAtPeriodEnd {
+			return nil, fmt.Errorf("%w: subscription is already set to cancel at the end of the period", utils.ErrConflict)
+		}
+		now := time.Now()
+		subscription, err = txQueries.UpdateSubscriptionRenewal(ctx, pgstore.UpdateSubscriptionRenewalParams{
+			ID:                subscription.ID,
+			CancelAtPeriodEnd: true,
+			CancelledAt:       &now,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to cancel subscription: %w", err)
+		}
+
+		if err := recordSubscriptionEvent(ctx, txQueries, subscription, subscription.PlanID, pgstore.SubscriptionEventCancelRequested); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return s.getSubscriptionResponse(ctx, subscription)
+}
+
+// GetUserSubscription returns the user's pending or active subscription
+func (s *PlanService) GetUserSubscription(ctx context.Context, userID uuid.UUID) (*pgstore.SubscriptionResponse, error) {
+	subscription, err := s.queries.GetLiveSubscriptionByUserId(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, fmt.Errorf("%w: no active subscription", utils.ErrNotFound)
+	}
+
+	return s.getSubscriptionResponse(ctx, subscription)
+}
+
+// GetSubscriptionHistory lists every status change and renewal of the user's
+// subscriptions, newest first
+func (s *PlanService) GetSubscriptionHistory(ctx context.Context, userID uuid.UUID) ([]pgstore.SubscriptionHistoryResponse, error) {
+	rows, err := s.queries.GetSubscriptionHistoryByUserId(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription history: %w", err)
+	}
+
+	history := make([]pgstore.SubscriptionHistoryResponse, 0, len(rows))
+	for _, row := range rows {
+		history = append(history, pgstore.SubscriptionHistoryResponse{
+			ID:          row.ID,
+			PlanName:    row.PlanName,
+			TrainerName: row.TrainerName,
+			Event:       row.Event,
+			StartDate:   row.StartDate,
+			EndDate:     row.EndDate,
+			Status:      row.Status,
+			Amount:      row.Amount,
+			Discount:    row.Discount,
+			CouponCode:  row.CouponCode,
+			CreatedAt:   row.CreatedAt,
+		})
+	}
+
+	return history, nil
+}
+
+// GetPlanSubscribers lists the users with a live subscription to a plan of
+// the trainer
+func (s *PlanService) GetPlanSubscribers(ctx context.Context, trainerID uuid.UUID, planID string) ([]pgstore.SubscriberResponse, error) {
+	planUUID, err := uuid.Parse(planID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid plan ID", utils.ErrBadRequest)
+	}
+
+	plan, err := s.queries.GetPlanById(ctx, planUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan == nil || plan.PersonalID != trainerID {
+		return nil, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
+	}
+
+	rows, err := s.queries.GetPlanSubscribers(ctx, plan.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan subscribers: %w", err)
+	}
+
+	subscribers := make([]pgstore.SubscriberResponse, 0, len(rows))
+	for _, row := range rows {
+		subscribers = append(subscribers, pgstore.SubscriberResponse{
+			UserID:       row.UserID,
+			UserName:     row.UserName,
+			UserEmail:    row.UserEmail,
+			StartDate:    row.StartDate,
+			EndDate:      row.EndDate,
+			Status:       row.Status,
+			SubscribedAt: row.SubscribedAt,
+		})
+	}
+
+	return subscribers, nil
+}
+
+// ProcessDueSubscriptions closes the live subscriptions whose period ended:
+// unpaid ones, packages and those whose next plan is no longer offered become
+// EXPIRED, those set to cancel become CANCELLED and the rest are renewed for
+// another period. A paid period has to be paid again, so its PENDING payment
+// is opened along with the renewal. It returns how many were renewed and how
+// many ended.
+func (s *PlanService) ProcessDueSubscriptions(ctx context.Context) (int, int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	now := time.Now()
+	due, err := txQueries.GetDueSubscriptionsForUpdate(ctx, pgstore.GetDueSubscriptionsForUpdateParams{
+		Now:   now,
+		Limit: subscriptionRenewalBatch,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get due subscriptions: %w", err)
+	}
+
+	renewed, ended := 0, 0
+	for i := range due {
+		subscription := &due[i]
+
+		// The period ended without being paid for
+		if subscription.Status == pgstore.SubscriptionStatusPending {
+			if err := endSubscription(ctx, txQueries, subscription, pgstore.SubscriptionStatusExpired, pgstore.SubscriptionEventExpired); err != nil {
+				return 0, 0, err
+			}
+			ended++
+			continue
+		}
+
+		// Packages are never renewed; their unused credits expire
+		if subscription.PlanType == pgstore.PlanTypePackage {
+			if err := endSubscription(ctx, txQueries, subscription, pgstore.SubscriptionStatusExpired, pgstore.SubscriptionEventExpired); err != nil {
+				return 0, 0, err
+			}
+			ended++
+			continue
+		}
+
+		if subscription.CancelAtPeriodEnd {
+			if err := endSubscription(ctx, txQueries, subscription, pgstore.SubscriptionStatusCancelled, pgstore.SubscriptionEventCancelled); err != nil {
+				return 0, 0, err
+			}
+			ended++
+			continue
+		}
+
+		planID := subscription.PlanID
+		if subscription.NextPlanID != nil {
+			planID = *subscription.NextPlanID
+		}
+
+		plan, err := txQueries.GetPlanById(ctx, planID)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to get plan: %w", err)
+		}
+		if plan == nil || !plan.IsActive {
+			if err := endSubscription(ctx, txQueries, subscription, pgstore.SubscriptionStatusExpired, pgstore.SubscriptionEventExpired); err != nil {
+				return 0, 0, err
+			}
+			ended++
+			continue
+		}
+
+		// A subscription left unprocessed for longer than a whole period starts
+		// its new period now instead of renewing periods nobody could use
+		start := subscription.EndDate
+		if !subscriptionPeriodEnd(start, plan.Duration).After(now) {
+			start = now
+		}
+
+		renewedSubscription, err := txQueries.RenewSubscription(ctx, pgstore.RenewSubscriptionParams{
+			ID:        subscription.ID,
+			PlanID:    plan.ID,
+			Status:    subscriptionPeriodStatus(plan.Price),
+			StartDate: start,
+			EndDate:   subscriptionPeriodEnd(start, plan.Duration),
+			Amount:    plan.Price,
+		})
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to renew subscription: %w", err)
+		}
+
+		if err := recordSubscriptionEvent(ctx, txQueries, renewedSubscription, renewedSubscription.PlanID, pgstore.SubscriptionEventRenewed); err != nil {
+			return 0, 0, err
+		}
+		if renewedSubscription.Status == pgstore.SubscriptionStatusPending {
+			if err := s.openRenewalPayment(ctx, txQueries, renewedSubscription); err != nil {
+				return 0, 0, err
+			}
+		}
+		renewed++
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return renewed, ended, nil
+}
+
+// ProcessPayment pays the amount of the user's pending subscription. Cards
+// are charged through the payment gateway; the subscription becomes ACTIVE as
+// soon as the payment completes, and a payment the gateway leaves PENDING
+// completes later, see GetPayment. PIX payments return a BR Code to pay and
+// complete when the bank notifies the payment webhook. When the gateway call
+// itself fails, the failed payment is returned along with the error.
+func (s *PlanService) ProcessPayment(ctx context.Context, userID, subscriptionID uuid.UUID, paymentMethod pgstore.PaymentMethod, paymentToken string) (*pgstore.PaymentResponse, error) {
+	if err := s.validatePaymentMethod(paymentMethod, paymentToken); err != nil {
+		return nil, err
+	}
+
+	payment, err := s.createSubscriptionPayment(ctx, userID, subscriptionID, paymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Method == pgstore.PaymentMethodPix {
+		return toPaymentResponse(payment, pgstore.SubscriptionStatusPending), nil
+	}
+
+	result, chargeErr := s.gateway.Charge(ctx, ChargeRequest{
+		IdempotencyKey: payment.ID.String(),
+		Amount:         payment.Amount,
+		Method:         payment.Method,
+		Token:          paymentToken,
+		Description:    "PandoraGym subscription " + subscriptionID.String(),
+	})
+	if chargeErr != nil {
+		result = &ChargeResult{
+			Status:        pgstore.PaymentStatusFailed,
+			FailureReason: chargeErr.Error(),
+		}
+	}
+
+	var providerPaymentID, failureReason *string
+	if result.ProviderPaymentID != "" {
+		providerPaymentID = &result.ProviderPaymentID
+	}
+	if result.FailureReason != "" {
+		failureReason = &result.FailureReason
+	}
+
+	response, err := s.applyPaymentStatus(ctx, payment.ID, result.Status, providerPaymentID, failureReason)
+	if err != nil {
+		return nil, err
+	}
+	if chargeErr != nil {
+		return response, fmt.Errorf("failed to charge payment: %w", chargeErr)
+	}
+
+	return response, nil
+}
+
+// GetPayment returns a payment of the user. A payment still PENDING is first
+// checked with the gateway and updated if it has an outcome.
+func (s *PlanService) GetPayment(ctx context.Context, userID, paymentID uuid.UUID) (*pgstore.PaymentResponse, error) {
+	payment, err := s.queries.GetPaymentById(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if payment == nil || payment.UserID != userID {
+		return nil, fmt.Errorf("%w: payment not found", utils.ErrNotFound)
+	}
+
+	if payment.Status == pgstore.PaymentStatusPending && payment.ProviderPaymentID != nil && payment.Provider == s.gateway.Name() {
+		status, err := s.gateway.Status(ctx, *payment.ProviderPaymentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get payment status: %w", err)
+		}
+		if status != payment.Status {
+			return s.applyPaymentStatus(ctx, payment.ID, status, nil, nil)
+		}
+	}
+
+	return s.getPaymentResponse(ctx, payment)
+}
+
+// GetUserPayments lists the payments of the user, newest first
+func (s *PlanService) GetUserPayments(ctx context.Context, userID uuid.UUID) ([]pgstore.PaymentResponse, error) {
+	payments, err := s.queries.GetPaymentsByUserId(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+
+	responses := make([]pgstore.PaymentResponse, 0, len(payments))
+	for i := range payments {
+		response, err := s.getPaymentResponse(ctx, &payments[i])
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, *response)
+	}
+
+	return responses, nil
+}
+
+// RefundPayment refunds a completed payment through the gateway. The
+// subscription it paid for ends right away.
+func (s *PlanService) RefundPayment(ctx context.Context, paymentID uuid.UUID) (*pgstore.PaymentResponse, error) {
+	payment, err := s.queries.GetPaymentById(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if payment == nil {
+		return nil, fmt.Errorf("%w: payment not found", utils.ErrNotFound)
+	}
+	if payment.Status != pgstore.PaymentStatusCompleted || payment.ProviderPaymentID == nil {
+		return nil, fmt.Errorf("%w: only completed payments can be refunded", utils.ErrConflict)
+	}
+	if payment.Provider != s.gateway.Name() {
+		return nil, fmt.Errorf("%w: payment was made through %s", utils.ErrConflict, payment.Provider)
+	}
+
+	status, err := s.gateway.Refund(ctx, *payment.ProviderPaymentID, payment.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refund payment: %w", err)
+	}
+
+	return s.applyPaymentStatus(ctx, payment.ID, status, nil, nil)
+}
+
+// GetRefundDuePayments lists the payments flagged as refund due, oldest
+// first, so they can be paid back
+func (s *PlanService) GetRefundDuePayments(ctx context.Context) ([]pgstore.PaymentResponse, error) {
+	payments, err := s.queries.GetRefundDuePayments(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payments: %w", err)
+	}
+
+	responses := make([]pgstore.PaymentResponse, 0, len(payments))
+	for i := range payments {
+		response, err := s.getPaymentResponse(ctx, &payments[i])
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, *response)
+	}
+
+	return responses, nil
+}
+
+// GetPaymentPixQRCode renders the BR Code of a PIX payment of the user as a
+// PNG QR code
+func (s *PlanService) GetPaymentPixQRCode(ctx context.Context, userID, paymentID uuid.UUID) ([]byte, error) {
+	payment, err := s.queries.GetPaymentById(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if payment == nil || payment.UserID != userID || payment.PixCode == nil {
+		return nil, fmt.Errorf("%w: pix payment not found", utils.ErrNotFound)
+	}
+
+	png, err := PixQRCodePNG(*payment.PixCode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render pix qr code: %w", err)
+	}
+	return png, nil
+}
+
+// ExpirePendingPayments fails the pending payments left unpaid past their
+// expiration. Their subscriptions stay PENDING so the user can pay again.
+func (s *PlanService) ExpirePendingPayments(ctx context.Context) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	expired, err := txQueries.GetExpiredPaymentsForUpdate(ctx, pgstore.GetExpiredPaymentsForUpdateParams{
+		Now:   time.Now(),
+		Limit: subscriptionRenewalBatch,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get expired payments: %w", err)
+	}
+
+	reason := "expired"
+	for i := range expired {
+		if _, _, err := s.transitionPayment(ctx, txQueries, &expired[i], pgstore.PaymentStatusFailed, nil, &reason); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(expired), nil
+}
+
+// validatePaymentMethod checks that a payment can be made with the method
+func (s *PlanService) validatePaymentMethod(method pgstore.PaymentMethod, token string) error {
+	switch method {
+	case pgstore.PaymentMethodCreditCard, pgstore.PaymentMethodDebitCard:
+		if token == "" {
+			return fmt.Errorf("%w: payment token is required for card payments", utils.ErrBadRequest)
+		}
+	case pgstore.PaymentMethodPix:
+		if !s.config.Pix.Enabled() {
+			return fmt.Errorf("%w: pix payments are not available", utils.ErrBadRequest)
+		}
+	default:
+		return fmt.Errorf("%w: unsupported payment method %q", utils.ErrBadRequest, method)
+	}
+	return nil
+}
+
+// createSubscriptionPayment records a PENDING payment for the subscription's
+// current period before the gateway is called, so every attempt is kept. A
+// pending payment nobody started paying yet, like the one opened by a
+// renewal, is taken over when the method matches and replaced otherwise.
+func (s *PlanService) createSubscriptionPayment(ctx context.Context, userID, subscriptionID uuid.UUID, method pgstore.PaymentMethod) (*pgstore.Payment, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	subscription, err := txQueries.GetSubscriptionForUpdate(ctx, subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if subscription == nil || subscription.UserID != userID {
+		return nil, fmt.Errorf("%w: subscription not found", utils.ErrNotFound)
+	}
+	if subscription.Status != pgstore.SubscriptionStatusPending {
+		return nil, fmt.Errorf("%w: subscription is %s and has nothing to pay", utils.ErrConflict, subscription.Status)
+	}
+
+	pending, err := txQueries.GetPendingPaymentBySubscriptionId(ctx, subscription.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending payment: %w", err)
+	}
+	if pending != nil {
+		if !isAwaitingPayment(pending) {
+			return nil, fmt.Errorf("%w: a payment for this subscription is already being processed", utils.ErrConflict)
+		}
+		if pending.Method == method && (pending.ExpiresAt == nil || pending.ExpiresAt.After(time.Now())) {
+			return pending, nil
+		}
+
+		reason := "replaced"
+		if _, _, err := s.transitionPayment(ctx, txQueries, pending, pgstore.PaymentStatusFailed, nil, &reason); err != nil {
+			return nil, err
+		}
+	}
+
+	params, err := s.pendingPaymentParams(subscription, method)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := txQueries.CreatePayment(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return payment, nil
+}
+
+// openRenewalPayment records the PENDING payment of a renewed period with the
+// method the subscription was last paid with, or a card when there is none.
+// A PIX payment gets its code right away; a card payment waits for the user to
+// pay it through ProcessPayment and expires with the period.
+func (s *PlanService) openRenewalPayment(ctx context.Context, queries *pgstore.Queries, subscription *pgstore.Subscription) error {
+	last, err := queries.GetLastCompletedPaymentBySubscriptionId(ctx, subscription.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get last payment: %w", err)
+	}
+
+	method := pgstore.PaymentMethodCreditCard
+	if last != nil && (last.Method != pgstore.PaymentMethodPix || s.config.Pix.Enabled()) {
+		method = last.Method
+	}
+
+	params, err := s.pendingPaymentParams(subscription, method)
+	if err != nil {
+		return err
+	}
+	if params.ExpiresAt == nil {
+		params.ExpiresAt = &subscription.EndDate
+	}
+
+	if _, err := queries.CreatePayment(ctx, params); err != nil {
+		return fmt.Errorf("failed to create renewal payment: %w", err)
+	}
+	return nil
+}
+
+// pendingPaymentParams describes a payment of the subscription's amount with
+// the method. PIX payments carry a new BR Code that expires.
+func (s *PlanService) pendingPaymentParams(subscription *pgstore.Subscription, method pgstore.PaymentMethod) (pgstore.CreatePaymentParams, error) {
+	params := pgstore.CreatePaymentParams{
+		SubscriptionID: subscription.ID,
+		UserID:         subscription.UserID,
+		Amount:         subscription.Amount,
+		Method:         method,
+		Provider:       s.gateway.Name(),
+	}
+
+	if method == pgstore.PaymentMethodPix {
+		// The transaction ID identifies the payment in the bank's notification
+		txID := strings.ToUpper(strings.ReplaceAll(uuid.NewString(), "-", ""))[:pixTxIDLimit]
+		code, err := BuildPixBRCode(s.config.Pix, subscription.Amount, txID, "PandoraGym")
+		if err != nil {
+			return pgstore.CreatePaymentParams{}, fmt.Errorf("failed to build pix code: %w", err)
+		}
+		expiresAt := time.Now().Add(s.config.Pix.PaymentExpiration)
+
+		params.Provider = PixProvider
+		params.ProviderPaymentID = &txID
+		params.PixCode = &code
+		params.ExpiresAt = &expiresAt
+	}
+
+	return params, nil
+}
+
+// applyPaymentStatus records the outcome of a payment and carries it over to
+// its subscription
+func (s *PlanService) applyPaymentStatus(ctx context.Context, paymentID uuid.UUID, status pgstore.PaymentStatus, providerPaymentID, failureReason *string) (*pgstore.PaymentResponse, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	payment, err := txQueries.GetPaymentForUpdate(ctx, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if payment == nil {
+		return nil, fmt.Errorf("%w: payment not found", utils.ErrNotFound)
+	}
+
+	payment, subscriptionStatus, err := s.transitionPayment(ctx, txQueries, payment, status, providerPaymentID, failureReason)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return toPaymentResponse(payment, subscriptionStatus), nil
+}
+
+// transitionPayment moves a locked payment to a new status, following
+// paymentTransitions, books it in the revenue ledger and updates its
+// subscription: a completed payment activates a pending subscription and a
+// refunded one ends a live subscription. A payment completing once its
+// subscription is no longer pending, because another payment already paid the
+// period or the subscription ended, is not booked but flagged as refund due,
+// and its refund leaves the subscription alone. Setting the current status
+// again only stores the provider details. It returns the updated payment and
+// the subscription status.
+func (s *PlanService) transitionPayment(ctx context.Context, queries *pgstore.Queries, payment *pgstore.Payment, status pgstore.PaymentStatus, providerPaymentID, failureReason *string) (*pgstore.Payment, pgstore.SubscriptionStatus, error) {
+	if status != payment.Status && !canTransitionPayment(payment.Status, status) {
+		return nil, "", fmt.Errorf("%w: payment is %s and cannot become %s", utils.ErrConflict, payment.Status, status)
+	}
+
+	changed := status != payment.Status
+	refundDue := payment.RefundDue
+	payment, err := queries.UpdatePaymentStatus(ctx, pgstore.UpdatePaymentStatusParams{
+		ID:                payment.ID,
+		Status:            status,
+		ProviderPaymentID: providerPaymentID,
+		FailureReason:     failureReason,
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to update payment: %w", err)
+	}
+
+	subscription, err := queries.GetSubscriptionForUpdate(ctx, payment.SubscriptionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if !changed || refundDue {
+		return payment, subscription.Status, nil
+	}
+
+	if status == pgstore.PaymentStatusCompleted && subscription.Status != pgstore.SubscriptionStatusPending {
+		payment, err = queries.MarkPaymentRefundDue(ctx, payment.ID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to flag payment for refund: %w", err)
+		}
+		return payment, subscription.Status, nil
+	}
+
+	if err := s.recordPaymentRevenue(ctx, queries, payment); err != nil {
+		return nil, "", err
+	}
+
+	switch {
+	case status == pgstore.PaymentStatusCompleted && subscription.Status == pgstore.SubscriptionStatusPending:
+		activated, err := queries.UpdateSubscriptionStatus(ctx, pgstore.UpdateSubscriptionStatusParams{
+			ID:     subscription.ID,
+			Status: pgstore.SubscriptionStatusActive,
+		})
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to activate subscription: %w", err)
+		}
+		if err := recordSubscriptionEvent(ctx, queries, activated, activated.PlanID, pgstore.SubscriptionEventActivated); err != nil {
+			return nil, "", err
+		}
+		if err := grantPackageCredits(ctx, queries, activated); err != nil {
+			return nil, "", err
+		}
+		return payment, activated.Status, nil
+
+	case status == pgstore.PaymentStatusRefunded && isLiveSubscription(subscription.Status):
+		if err := endSubscription(ctx, queries, subscription, pgstore.SubscriptionStatusCancelled, pgstore.SubscriptionEventCancelled); err != nil {
+			return nil, "", err
+		}
+		return payment, pgstore.SubscriptionStatusCancelled, nil
+	}
+
+	return payment, subscription.Status, nil
+}
+
+func (s *PlanService) getPaymentResponse(ctx context.Context, payment *pgstore.Payment) (*pgstore.PaymentResponse, error) {
+	subscription, err := s.queries.GetSubscriptionById(ctx, payment.SubscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	var status pgstore.SubscriptionStatus
+	if subscription != nil {
+		status = subscription.Status
+	}
+
+	return toPaymentResponse(payment, status), nil
+}
+
+func (s *PlanService) getSubscriptionResponse(ctx context.Context, subscription *pgstore.Subscription) (*pgstore.SubscriptionResponse, error) {
+	plan, err := s.queries.GetPlanById(ctx, subscription.PlanID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+
+	planName := ""
+	if plan != nil {
+		planName = plan.Name
+	}
+
+	return toSubscriptionResponse(subscription, planName), nil
+}
+
+func getLiveSubscriptionForUpdate(ctx context.Context, queries *pgstore.Queries, userID uuid.UUID) (*pgstore.Subscription, error) {
+	if _, err := queries.LockUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	subscription, err := queries.GetLiveSubscriptionByUserId(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscription: %w", err)
+	}
+	if subscription == nil {
+		return nil, fmt.Errorf("%w: no active subscription", utils.ErrNotFound)
+	}
+
+	return subscription, nil
+}
+
+// getSubscribablePlan returns a plan the user can subscribe to: an active
+// plan of another user
+func getSubscribablePlan(ctx context.Context, queries *pgstore.Queries, planID, userID uuid.UUID) (*pgstore.GetPlansRow, error) {
+	plan, err := queries.GetPlanById(ctx, planID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get plan: %w", err)
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("%w: plan not found", utils.ErrNotFound)
+	}
+	if !plan.IsActive {
+		return nil, fmt.Errorf("%w: plan is no longer available", utils.ErrBadRequest)
+	}
+	if plan.PersonalID == userID {
+		return nil, fmt.Errorf("%w: cannot subscribe to your own plan", utils.ErrBadRequest)
+	}
+	return plan, nil
+}
+
+// endSubscription closes a live subscription. Package credits left are
+// forfeited, and a subscription that was never active gives its coupon back
+// so the user can redeem it again.
+func endSubscription(ctx context.Context, queries *pgstore.Queries, subscription *pgstore.Subscription, status pgstore.SubscriptionStatus, event pgstore.SubscriptionEvent) error {
+	ended, err := queries.UpdateSubscriptionStatus(ctx, pgstore.UpdateSubscriptionStatusParams{
+		ID:     subscription.ID,
+		Status: status,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update subscription status: %w", err)
+	}
+	*subscription = *ended
+
+	if err := forfeitPackageCredits(ctx, queries, ended); err != nil {
+		return err
+	}
+	if _, err := queries.ReleaseCouponRedemption(ctx, ended.ID); err != nil {
+		return fmt.Errorf("failed to release coupon redemption: %w", err)
+	}
+
+	return recordSubscriptionEvent(ctx, queries, ended, ended.PlanID, event)
+}
+
+func recordSubscriptionEvent(ctx context.Context, queries *pgstore.Queries, subscription *pgstore.Subscription, planID uuid.UUID, event pgstore.SubscriptionEvent) error {
+	err := queries.CreateSubscriptionHistory(ctx, pgstore.CreateSubscriptionHistoryParams{
+		SubscriptionID: subscription.ID,
+		PlanID:         planID,
+		Event:          event,
+		Status:         subscription.Status,
+		StartDate:      subscription.StartDate,
+		EndDate:        subscription.EndDate,
+		Amount:         subscription.Amount,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create subscription history: %w", err)
+	}
+	return nil
+}
+
+// paymentErrorMessage is what the client is told about a failed payment:
+// the message of a client error, or a generic one for anything unexpected
+func paymentErrorMessage(err error) string {
+	if utils.HTTPStatusFromError(err) == http.StatusInternalServerError {
+		return "payment could not be processed, please try again"
+	}
+	return err.Error()
+}
+
+func canTransitionPayment(from, to pgstore.PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// isAwaitingPayment reports whether nobody started paying a pending payment
+// yet: a PIX code not paid so far or a card payment never sent to the gateway
+func isAwaitingPayment(payment *pgstore.Payment) bool {
+	return payment.Method == pgstore.PaymentMethodPix || payment.ProviderPaymentID == nil
+}
+
+func isLiveSubscription(status pgstore.SubscriptionStatus) bool {
+	return status == pgstore.SubscriptionStatusPending || status == pgstore.SubscriptionStatusActive
+}
+
+// subscriptionPeriodStatus is the status a period starts in: free periods
+// are active right away, paid ones once their payment completes
+func subscriptionPeriodStatus(amount pgstore.Money) pgstore.SubscriptionStatus {
+	if amount.Amount > 0 {
+		return pgstore.SubscriptionStatusPending
+	}
+	return pgstore.SubscriptionStatusActive
+}
+
+// subscriptionPeriodEnd returns the end of a period of the given number of days
+func subscriptionPeriodEnd(start time.Time, durationDays int32) time.Time {
+	return start.AddDate(0, 0, int(durationDays))
+}
+
+func toSubscriptionResponse(subscription *pgstore.Subscription, planName string) *pgstore.SubscriptionResponse {
+	return &pgstore.SubscriptionResponse{
+		ID:                subscription.ID,
+		UserID:            subscription.UserID,
+		PlanID:            subscription.PlanID,
+		PlanName:          planName,
+		NextPlanID:        subscription.NextPlanID,
+		StartDate:         subscription.StartDate,
+		EndDate:           subscription.EndDate,
+		Status:            subscription.Status,
+		Amount:            subscription.Amount,
+		CancelAtPeriodEnd: subscription.CancelAtPeriodEnd,
+		CancelledAt:       subscription.CancelledAt,
+		CreatedAt:         subscription.CreatedAt,
+		UpdatedAt:         subscription.UpdatedAt,
+	}
+}
+
+func toPaymentResponse(payment *pgstore.Payment, subscriptionStatus pgstore.SubscriptionStatus) *pgstore.PaymentResponse {
+	return &pgstore.PaymentResponse{
+		ID:             payment.ID,
+		SubscriptionID: payment.SubscriptionID,
+		Amount:         payment.Amount,
+		Method:         payment.Method,
+		Provider:       payment.Provider,
+		Status:         payment.Status,
+		FailureReason:  payment.FailureReason,
+		PixCode:        payment.PixCode,
+		ExpiresAt:      payment.ExpiresAt,
+		RefundDue:      payment.RefundDue,
+		Subscription:   subscriptionStatus,
+		CreatedAt:      payment.CreatedAt,
+		UpdatedAt:      payment.UpdatedAt,
+	}
+}
@@ -0,0 +1,116 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// TOTP parameters (RFC 6238). They are the defaults of authenticator apps,
+// which ignore anything else in the otpauth URI.
+const (
+	totpPeriod     = 30 * time.Second
+	totpDigits     = 6
+	totpSecretSize = 20
+	// totpSkew is how many steps before and after the current one are
+	// accepted, for phones whose clock drifted
+	totpSkew = 1
+
+	totpIssuer     = "PandoraGym"
+	totpQRCodeSize = 256
+)
+
+var totpSecretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func generateTOTPSecret() []byte {
+	secret := make([]byte, totpSecretSize)
+	rand.Read(secret)
+	return secret
+}
+
+// totpStep is the counter of the time window t falls in
+func totpStep(t time.Time) int64 {
+	return t.Unix() / int64(totpPeriod/time.Second)
+}
+
+// totpCode is the HOTP value (RFC 4226) of the secret at a step
+func totpCode(secret []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%uint32(math.Pow10(totpDigits)))
+}
+
+// matchTOTPCode returns the step of the window around now the code belongs
+// to. Steps up to lastUsedStep are skipped, so each code works once.
+func matchTOTPCode(secret []byte, code string, now time.Time, lastUsedStep *int64) (int64, bool) {
+	current := totpStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if lastUsedStep != nil && step <= *lastUsedStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(secret, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// isTOTPCode reports whether a code has the shape of a TOTP code rather than
+// a recovery code
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// totpURI is the otpauth URI authenticator apps import the secret from
+func totpURI(secret []byte, accountName string) string {
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	query := url.Values{
+		"secret":    {totpSecretEncoding.EncodeToString(secret)},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(int(totpPeriod / time.Second))},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// totpQRCodeDataURI renders the otpauth URI as a PNG data URI, ready to be
+// shown in an img tag
+func totpQRCodeDataURI(uri string) (string, error) {
+	png, err := qrcode.Encode(uri, qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		return "", err
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(png), nil
+}
+
+// normalizeMFACode drops the spaces and hyphens people type codes with
+func normalizeMFACode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 secret of the RFC 6238 Appendix B test vectors
+var rfc6238Secret = []byte("12345678901234567890")
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// The RFC lists 8 digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(rfc6238Secret, totpStep(time.Unix(tt.unix, 0))); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTOTPCode(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+	previous := current - 1
+
+	tests := []struct {
+		name         string
+		code         string
+		lastUsedStep *int64
+		wantStep     int64
+		wantOK       bool
+	}{
+		{"current step", totpCode(rfc6238Secret, current), nil, current, true},
+		{"previous step within skew", totpCode(rfc6238Secret, current-1), nil, current - 1, true},
+		{"next step within skew", totpCode(rfc6238Secret, current+1), nil, current + 1, true},
+		{"outside skew", totpCode(rfc6238Secret, current-2), nil, 0, false},
+		{"replayed code", totpCode(rfc6238Secret, current), &current, 0, false},
+		{"code after the last used one", totpCode(rfc6238Secret, current), &previous, current, true},
+		{"wrong code", "000000", nil, 0, false},
+		{"empty code", "", nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTPCode(rfc6238Secret, tt.code, now, tt.lastUsedStep)
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("matchTOTPCode() = (%d, %v), want (%d, %v)", step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestIsTOTPCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"123456", true},
+		{"12345", false},
+		{"1234567", false},
+		{"12345a", false},
+		{"abcd1234", false},
+	}
+
+	for _, tt := range tests {
+		if got := isTOTPCode(tt.code); got != tt.want {
+			t.Errorf("isTOTPCode(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeMFACode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"123 456", "123456"},
+		{"ABCD-1234", "abcd1234"},
+		{" abcd - 1234 ", "abcd1234"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeMFACode(tt.code); got != tt.want {
+			t.Errorf("normalizeMFACode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(totpURI(rfc6238Secret, "ana@example.com"))
+	if err != nil {
+		t.Fatalf("totpURI() is not a URL: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/PandoraGym:ana@example.com" {
+		t.Errorf("totpURI() = %s", uri)
+	}
+
+	query := uri.Query()
+	want := map[string]string{
+		"secret":    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"issuer":    "PandoraGym",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if query.Get(key) != value {
+			t.Errorf("%s = %q, want %q", key, query.Get(key), value)
+		}
+	}
+}
@@ -3,22 +3,24 @@ package services
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/alexedwards/scs/v2"
 	"github.com/google/uuid"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
 type UserService struct {
 	queries *pgstore.Queries
-	session *scs.SessionManager
+	auth    *AuthService
 }
 
-func NewUserService(queries *pgstore.Queries, sessionManager *scs.SessionManager) *UserService {
+func NewUserService(queries *pgstore.Queries, authService *AuthService) *UserService {
 	return &UserService{
 		queries: queries,
-		session: sessionManager,
+		auth:    authService,
 	}
 }
 
@@ -45,13 +47,11 @@ func (s *UserService) GetUserByID(ctx context.Context, userID uuid.UUID) (*pgsto
 }
 
 func (s *UserService) CreateStudentWithUser(ctx context.Context, req pgstore.CreateStudentWithUserRequest) (*pgstore.UserResponse, error) {
-	authService := NewAuthService(s.queries, s.session)
-	return authService.CreateStudentWithUser(ctx, req)
+	return s.auth.CreateStudentWithUser(ctx, req)
 }
 
 func (s *UserService) CreatePersonalWithUser(ctx context.Context, req pgstore.CreatePersonalWithUserRequest) (*pgstore.UserResponse, error) {
-	authService := NewAuthService(s.queries, s.session)
-	return authService.CreatePersonalWithUser(ctx, req)
+	return s.auth.CreatePersonalWithUser(ctx, req)
 }
 
 func (s *UserService) UpdateUserProfile(ctx context.Context, userID uuid.UUID, req *pgstore.UpdateProfileRequest) error {
@@ -80,44 +80,64 @@ func (s *UserService) UpdateUserAvatar(ctx context.Context, userID uuid.UUID, av
 	return nil
 }
 
-func (s *UserService) GetAllUsers(page, limit, role, search string) (interface{}, interface{}, error) {
-	// pageInt := 1
-	// limitInt := 20
-	//
-	// if page != "" {
-	// 	if p, err := strconv.Atoi(page); err == nil && p > 0 {
-	// 		pageInt = p
-	// 	}
-	// }
-	//
-	// if limit != "" {
-	// 	if l, err := strconv.Atoi(limit); err == nil && l > 0 && l <= 100 {
-	// 		limitInt = l
-	// 	}
-	// }
-
-	mockUsers := []map[string]interface{}{
-		{
-			"id":         uuid.New().String(),
-			"name":       "John Doe",
-			"email":      "john@example.com",
-			"phone":      "+1234567890",
-			"role":       "STUDENT",
-			"created_at": time.Now().AddDate(0, -2, 0),
-			"updated_at": time.Now(),
-		},
-		{
-			"id":         uuid.New().String(),
-			"name":       "Jane Smith",
-			"email":      "jane@example.com",
-			"phone":      "+1234567891",
-			"role":       "PERSONAL",
-			"created_at": time.Now().AddDate(0, -1, 0),
-			"updated_at": time.Now(),
-		},
+// GetAllUsers lists a page of the users, newest first, along with how many
+// match the filters. Empty filters are ignored.
+func (s *UserService) GetAllUsers(ctx context.Context, page, limit, role, search, emailVerified string) ([]pgstore.GetAllUsersRow, int64, error) {
+	pageInt := 1
+	limitInt := 20
+
+	if page != "" {
+		if p, err := strconv.Atoi(page); err == nil && p > 0 {
+			pageInt = p
+		}
+	}
+
+	if limit != "" {
+		if l, err := strconv.Atoi(limit); err == nil && l > 0 && l <= 100 {
+			limitInt = l
+		}
+	}
+
+	params := pgstore.GetAllUsersParams{
+		Limit:  int32(limitInt),
+		Offset: int32((pageInt - 1) * limitInt),
+	}
+
+	if role != "" {
+		userRole := pgstore.Role(strings.ToUpper(role))
+		if userRole != pgstore.RoleStudent && userRole != pgstore.RolePersonal && userRole != pgstore.RoleAdmin {
+			return nil, 0, fmt.Errorf("%w: invalid role", utils.ErrBadRequest)
+		}
+		params.Role = &userRole
+	}
+
+	if search = strings.TrimSpace(search); search != "" {
+		params.Search = &search
+	}
+
+	if emailVerified != "" {
+		verified, err := strconv.ParseBool(emailVerified)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: invalid email_verified filter", utils.ErrBadRequest)
+		}
+		params.EmailVerified = &verified
+	}
+
+	users, err := s.queries.GetAllUsers(ctx, params)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	var total int64
+	if len(users) > 0 {
+		total = users[0].TotalCount
+	}
+
+	if users == nil {
+		users = []pgstore.GetAllUsersRow{}
 	}
 
-	return mockUsers, len(mockUsers), nil
+	return users, total, nil
 }
 
 func (s *UserService) UpdateUserStatus(userID, status, reason string) error {
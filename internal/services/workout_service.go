@@ -3,22 +3,26 @@ package services
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/othavioBF/pandoragym-go-api/internal/infra/pgstore"
+	"github.com/othavioBF/pandoragym-go-api/internal/utils"
 )
 
 type WorkoutService struct {
 	queries *pgstore.Queries
 	pool    *pgxpool.Pool
+	logger  *slog.Logger
 }
 
-func NewWorkoutService(queries *pgstore.Queries, pool *pgxpool.Pool) *WorkoutService {
+func NewWorkoutService(queries *pgstore.Queries, pool *pgxpool.Pool, logger *slog.Logger) *WorkoutService {
 	return &WorkoutService{
 		queries: queries,
 		pool:    pool,
+		logger:  logger,
 	}
 }
 
@@ -32,7 +36,7 @@ func (s *WorkoutService) GetWorkouts(ctx context.Context, userID uuid.UUID) ([]p
 }
 
 func (s *WorkoutService) GetWorkoutByID(ctx context.Context, workoutID uuid.UUID) (*pgstore.GetWorkoutByIdRow, []pgstore.ExercisesSetup, error) {
-	workout, err := s.queries.GetWorkoutById(ctx, workoutID)
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get workout: %w", err)
 	}
@@ -156,19 +160,13 @@ func (s *WorkoutService) UpdateWorkout(ctx context.Context, workoutID uuid.UUID,
 		return nil, fmt.Errorf("failed to get user role: %w", err)
 	}
 
-	// Check if user has permission to update this workout
-	var personalID *uuid.UUID
-	if role == pgstore.RolePersonal {
-		personalID = &userID
-	}
-
-	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{
-		ID:         workoutID,
-		PersonalID: personalID,
-	})
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workout for update: %w", err)
 	}
+	if workout == nil {
+		return nil, fmt.Errorf("%w: workout not found", utils.ErrNotFound)
+	}
 
 	// Access control
 	if role == pgstore.RolePersonal && workout.PersonalID != nil && *workout.PersonalID != userID {
@@ -212,13 +210,13 @@ func (s *WorkoutService) UpdateWorkout(ctx context.Context, workoutID uuid.UUID,
 	}
 
 	// Get updated workout to return
-	updatedWorkout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{
-		ID:         workoutID,
-		PersonalID: personalID,
-	})
+	updatedWorkout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get updated workout: %w", err)
 	}
+	if updatedWorkout == nil {
+		return nil, fmt.Errorf("%w: workout not found", utils.ErrNotFound)
+	}
 
 	return &pgstore.WorkoutResponse{
 		ID:                       updatedWorkout.ID,
@@ -246,19 +244,13 @@ func (s *WorkoutService) DeleteWorkout(ctx context.Context, workoutID, userID uu
 		return fmt.Errorf("failed to get user role: %w", err)
 	}
 
-	// Check if user has permission to delete this workout
-	var personalID *uuid.UUID
-	if role == pgstore.RolePersonal {
-		personalID = &userID
-	}
-
-	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{
-		ID:         workoutID,
-		PersonalID: personalID,
-	})
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return fmt.Errorf("failed to get workout for deletion: %w", err)
 	}
+	if workout == nil {
+		return fmt.Errorf("%w: workout not found", utils.ErrNotFound)
+	}
 
 	// Access control
 	if role == pgstore.RolePersonal && workout.PersonalID != nil && *workout.PersonalID != userID {
@@ -448,19 +440,13 @@ func (s *WorkoutService) AddExerciseToWorkout(ctx context.Context, workoutID, ex
 		return fmt.Errorf("failed to get user role: %w", err)
 	}
 
-	// Check if user has permission to modify this workout
-	var personalID *uuid.UUID
-	if role == pgstore.RolePersonal {
-		personalID = &userID
-	}
-
-	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{
-		ID:         workoutID,
-		PersonalID: personalID,
-	})
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return fmt.Errorf("failed to get workout: %w", err)
 	}
+	if workout == nil {
+		return fmt.Errorf("%w: workout not found", utils.ErrNotFound)
+	}
 
 	// Access control
 	if role == pgstore.RolePersonal && workout.PersonalID != nil && *workout.PersonalID != userID {
@@ -506,19 +492,13 @@ func (s *WorkoutService) RemoveExerciseFromWorkout(ctx context.Context, workoutI
 		return fmt.Errorf("failed to get user role: %w", err)
 	}
 
-	// Check if user has permission to modify this workout
-	var personalID *uuid.UUID
-	if role == pgstore.RolePersonal {
-		personalID = &userID
-	}
-
-	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{
-		ID:         workoutID,
-		PersonalID: personalID,
-	})
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return fmt.Errorf("failed to get workout: %w", err)
 	}
+	if workout == nil {
+		return fmt.Errorf("%w: workout not found", utils.ErrNotFound)
+	}
 
 	// Access control
 	if role == pgstore.RolePersonal && workout.PersonalID != nil && *workout.PersonalID != userID {
@@ -543,19 +523,13 @@ func (s *WorkoutService) GetWorkoutExercises(ctx context.Context, workoutID, use
 		return nil, fmt.Errorf("failed to get user role: %w", err)
 	}
 
-	// Check if user has permission to view this workout
-	var personalID *uuid.UUID
-	if role == pgstore.RolePersonal {
-		personalID = &userID
-	}
-
-	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{
-		ID:         workoutID,
-		PersonalID: personalID,
-	})
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get workout: %w", err)
 	}
+	if workout == nil {
+		return nil, fmt.Errorf("%w: workout not found", utils.ErrNotFound)
+	}
 
 	// Access control
 	if role == pgstore.RolePersonal && workout.PersonalID != nil && *workout.PersonalID != userID {
@@ -572,17 +546,266 @@ func (s *WorkoutService) GetWorkoutExercises(ctx context.Context, workoutID, use
 
 // Workout execution and history methods
 
-// FinishWorkout records a completed workout session
-func (s *WorkoutService) FinishWorkout(ctx context.Context, userID, workoutID string, duration int, exercises []map[string]interface{}, notes string) error {
-	// Implementation for recording workout completion
-	// This would typically create a workout history record
-	return fmt.Errorf("finish workout not implemented yet")
+// ExecuteWorkout starts a workout session for a student, returning the
+// already open session when the student resumes the same workout
+func (s *WorkoutService) ExecuteWorkout(ctx context.Context, userID, workoutID uuid.UUID) (*pgstore.WorkoutSessionResponse, error) {
+	if _, err := s.getWorkoutForStudent(ctx, workoutID, userID); err != nil {
+		return nil, err
+	}
+
+	exercises, err := s.queries.GetExercisesByWorkoutId(ctx, workoutID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exercises for workout: %w", err)
+	}
+
+	session, err := s.queries.GetOpenWorkoutSession(ctx, pgstore.GetOpenWorkoutSessionParams{
+		StudentID: userID,
+		WorkoutID: workoutID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open workout session: %w", err)
+	}
+
+	if session == nil {
+		now := time.Now()
+		session, err = s.queries.CreateWorkoutSession(ctx, pgstore.CreateWorkoutSessionParams{
+			ID:        uuid.New(),
+			StudentID: userID,
+			WorkoutID: workoutID,
+			StartedAt: now,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create workout session: %w", err)
+		}
+	}
+
+	// A concurrent execute opened the session first
+	if session == nil {
+		session, err = s.queries.GetOpenWorkoutSession(ctx, pgstore.GetOpenWorkoutSessionParams{
+			StudentID: userID,
+			WorkoutID: workoutID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get open workout session: %w", err)
+		}
+		if session == nil {
+			return nil, fmt.Errorf("%w: workout session was finished while starting it", utils.ErrConflict)
+		}
+	}
+
+	response := newWorkoutSessionResponse(session)
+	response.Exercises = exercises
+
+	return response, nil
 }
 
-// ExecuteWorkout starts a workout session
-func (s *WorkoutService) ExecuteWorkout(ctx context.Context, userID, workoutID string) (interface{}, error) {
-	// Implementation for starting a workout session
-	return nil, fmt.Errorf("execute workout not implemented yet")
+// FinishWorkout closes the open session of a workout and records the
+// performed exercises and their sets in a single transaction
+func (s *WorkoutService) FinishWorkout(ctx context.Context, userID, workoutID uuid.UUID, req pgstore.FinishWorkoutRequest) (*pgstore.WorkoutSessionResponse, error) {
+	if _, err := s.getWorkoutForStudent(ctx, workoutID, userID); err != nil {
+		return nil, err
+	}
+
+	if len(req.Exercises) == 0 {
+		return nil, fmt.Errorf("%w: at least one exercise is required", utils.ErrBadRequest)
+	}
+
+	exercises, err := s.queries.GetExercisesByWorkoutId(ctx, workoutID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exercises for workout: %w", err)
+	}
+
+	exercisesByID := make(map[uuid.UUID]pgstore.ExercisesSetup, len(exercises))
+	for _, exercise := range exercises {
+		exercisesByID[exercise.ID] = exercise
+	}
+
+	for i, performed := range req.Exercises {
+		if _, ok := exercisesByID[performed.ExerciseID]; !ok {
+			return nil, fmt.Errorf("%w: exercise %d does not belong to this workout", utils.ErrBadRequest, i+1)
+		}
+		if len(performed.Sets) == 0 {
+			return nil, fmt.Errorf("%w: exercise %d has no sets", utils.ErrBadRequest, i+1)
+		}
+		for j, set := range performed.Sets {
+			if err := validateFinishWorkoutSet(set); err != nil {
+				return nil, fmt.Errorf("%w: exercise %d set %d %s", utils.ErrBadRequest, i+1, j+1, err.Error())
+			}
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := s.queries.WithTx(tx)
+
+	session, err := txQueries.GetOpenWorkoutSession(ctx, pgstore.GetOpenWorkoutSessionParams{
+		StudentID: userID,
+		WorkoutID: workoutID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open workout session: %w", err)
+	}
+	if session == nil {
+		return nil, fmt.Errorf("%w: no workout session in progress", utils.ErrBadRequest)
+	}
+
+	now := time.Now()
+
+	duration := int32(now.Sub(session.StartedAt).Minutes())
+	if req.Duration != nil {
+		duration = *req.Duration
+	}
+
+	history := make([]pgstore.WorkoutsHistory, 0, len(req.Exercises))
+	for i, performed := range req.Exercises {
+		exercise := exercisesByID[performed.ExerciseID]
+
+		restTime := performed.RestTime
+		if restTime == nil {
+			restTime = &exercise.RestTimeBetweenSets
+		}
+
+		row, err := txQueries.CreateWorkoutHistory(ctx, pgstore.CreateWorkoutHistoryParams{
+			ID:               uuid.New(),
+			StudentID:        userID,
+			WorkoutID:        workoutID,
+			SessionID:        session.ID,
+			ExecutionTime:    performed.ExecutionTime,
+			RestTime:         restTime,
+			Thumbnail:        &exercise.Thumbnail,
+			TimeTotalWorkout: duration,
+			ExerciseTitle:    exercise.Name,
+			ExerciseID:       exercise.ID,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to record exercise %d: %w", i+1, err)
+		}
+
+		row.Sets = make([]pgstore.WorkoutSet, 0, len(performed.Sets))
+		for j, set := range performed.Sets {
+			created, err := txQueries.CreateWorkoutSet(ctx, pgstore.CreateWorkoutSetParams{
+				ID:         uuid.New(),
+				SessionID:  session.ID,
+				HistoryID:  row.ID,
+				ExerciseID: exercise.ID,
+				SetIndex:   int32(j + 1),
+				Reps:       set.Reps,
+				LoadKg:     set.LoadKg,
+				RPE:        set.RPE,
+				RIR:        set.RIR,
+				ToFailure:  set.ToFailure,
+				IsWarmup:   set.IsWarmup,
+				CreatedAt:  now,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to record set %d of exercise %d: %w", j+1, i+1, err)
+			}
+			row.Sets = append(row.Sets, *created)
+		}
+
+		history = append(history, *row)
+	}
+
+	finished, err := txQueries.FinishWorkoutSession(ctx, pgstore.FinishWorkoutSessionParams{
+		ID:         session.ID,
+		FinishedAt: now,
+		Duration:   duration,
+		Notes:      req.Notes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to finish workout session: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	response := newWorkoutSessionResponse(finished)
+	response.History = history
+
+	// Replay the sets of the exercises just logged to find the records this
+	// session improved. The session is already finished by now, so failing to
+	// do so only leaves the records out; they are still listed by analytics.
+	exerciseIDs := make([]uuid.UUID, 0, len(req.Exercises))
+	for _, performed := range req.Exercises {
+		exerciseIDs = append(exerciseIDs, performed.ExerciseID)
+	}
+	sets, err := s.queries.GetWorkingSets(ctx, pgstore.GetWorkingSetsParams{
+		StudentID:   userID,
+		ExerciseIDs: exerciseIDs,
+	})
+	if err != nil {
+		s.logger.Error("Failed to get working sets for personal records", "error", err, "session_id", finished.ID, "user_id", userID)
+		return response, nil
+	}
+	response.NewRecords = newPersonalRecords(sets, pgstore.OneRepMaxFormulaEpley, finished.ID)
+
+	return response, nil
+}
+
+// getWorkoutForStudent loads a workout and checks that it was assigned to the
+// student or created by the student's trainer
+func (s *WorkoutService) getWorkoutForStudent(ctx context.Context, workoutID, studentID uuid.UUID) (*pgstore.GetWorkoutByIdRow, error) {
+	student, err := s.queries.GetStudentById(ctx, studentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get student: %w", err)
+	}
+	if student == nil {
+		return nil, fmt.Errorf("%w: only students can execute workouts", utils.ErrForbidden)
+	}
+
+	workout, err := s.queries.GetWorkoutById(ctx, pgstore.GetWorkoutByIdParams{ID: workoutID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workout: %w", err)
+	}
+	if workout == nil {
+		return nil, fmt.Errorf("%w: workout %s", utils.ErrNotFound, workoutID)
+	}
+
+	ownedByStudent := workout.StudentID != nil && *workout.StudentID == studentID
+	ownedByTrainer := workout.PersonalID != nil && student.PersonalID != nil && *workout.PersonalID == *student.PersonalID
+	if !ownedByStudent && !ownedByTrainer {
+		return nil, fmt.Errorf("%w: workout does not belong to the student or their trainer", utils.ErrForbidden)
+	}
+
+	return workout, nil
+}
+
+// validateFinishWorkoutSet checks the values of a logged set
+func validateFinishWorkoutSet(set pgstore.FinishWorkoutSet) error {
+	if set.Reps < 0 {
+		return fmt.Errorf("has negative reps")
+	}
+	if set.LoadKg < 0 {
+		return fmt.Errorf("has negative load")
+	}
+	if set.RPE != nil && (*set.RPE < 1 || *set.RPE > 10) {
+		return fmt.Errorf("has an rpe outside 1-10")
+	}
+	if set.RIR != nil && *set.RIR < 0 {
+		return fmt.Errorf("has negative rir")
+	}
+	return nil
+}
+
+func newWorkoutSessionResponse(session *pgstore.WorkoutSession) *pgstore.WorkoutSessionResponse {
+	return &pgstore.WorkoutSessionResponse{
+		ID:         session.ID,
+		StudentID:  session.StudentID,
+		WorkoutID:  session.WorkoutID,
+		StartedAt:  session.StartedAt,
+		FinishedAt: session.FinishedAt,
+		Duration:   session.Duration,
+		Notes:      session.Notes,
+	}
 }
 
 // RateWorkout allows users to rate completed workouts
@@ -591,10 +814,82 @@ func (s *WorkoutService) RateWorkout(ctx context.Context, userID, workoutID stri
 	return fmt.Errorf("rate workout not implemented yet")
 }
 
-// GetWorkoutHistory retrieves user's workout history
-func (s *WorkoutService) GetWorkoutHistory(ctx context.Context, userID string) ([]pgstore.WorkoutHistoryResponse, error) {
-	// Implementation for getting workout history
-	return []pgstore.WorkoutHistoryResponse{}, nil
+// GetWorkoutHistory retrieves the finished sessions of a student with the
+// sets logged for each exercise
+func (s *WorkoutService) GetWorkoutHistory(ctx context.Context, userID uuid.UUID) ([]pgstore.WorkoutHistoryResponse, error) {
+	sessions, err := s.queries.GetFinishedWorkoutSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workout sessions: %w", err)
+	}
+
+	history, err := s.queries.GetWorkoutHistoryByStudent(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workout history: %w", err)
+	}
+
+	sets, err := s.queries.GetWorkoutSetsByStudent(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workout sets: %w", err)
+	}
+
+	setsByHistory := make(map[uuid.UUID][]pgstore.WorkoutHistorySetResponse)
+	for _, set := range sets {
+		setsByHistory[set.HistoryID] = append(setsByHistory[set.HistoryID], pgstore.WorkoutHistorySetResponse{
+			SetIndex:  set.SetIndex,
+			Reps:      set.Reps,
+			LoadKg:    set.LoadKg,
+			RPE:       set.RPE,
+			RIR:       set.RIR,
+			ToFailure: set.ToFailure,
+			IsWarmup:  set.IsWarmup,
+		})
+	}
+
+	exercisesBySession := make(map[uuid.UUID][]pgstore.WorkoutHistoryExerciseSetsResponse)
+	for _, entry := range history {
+		exerciseSets := setsByHistory[entry.ID]
+		if exerciseSets == nil {
+			exerciseSets = []pgstore.WorkoutHistorySetResponse{}
+		}
+		exercisesBySession[entry.SessionID] = append(exercisesBySession[entry.SessionID], pgstore.WorkoutHistoryExerciseSetsResponse{
+			ExerciseID:    entry.ExerciseID,
+			ExerciseName:  entry.ExerciseTitle,
+			Thumbnail:     entry.Thumbnail,
+			RestTime:      entry.RestTime,
+			ExecutionTime: entry.ExecutionTime,
+			Sets:          exerciseSets,
+		})
+	}
+
+	response := make([]pgstore.WorkoutHistoryResponse, 0, len(sessions))
+	for _, session := range sessions {
+		var duration int32
+		if session.Duration != nil {
+			duration = *session.Duration
+		}
+
+		createdAt := session.StartedAt
+		if session.FinishedAt != nil {
+			createdAt = *session.FinishedAt
+		}
+
+		exercises := exercisesBySession[session.ID]
+		if exercises == nil {
+			exercises = []pgstore.WorkoutHistoryExerciseSetsResponse{}
+		}
+
+		response = append(response, pgstore.WorkoutHistoryResponse{
+			ID:          session.ID,
+			WorkoutID:   session.WorkoutID,
+			WorkoutName: session.WorkoutName,
+			Duration:    duration,
+			Notes:       session.Notes,
+			Exercises:   exercises,
+			CreatedAt:   createdAt,
+		})
+	}
+
+	return response, nil
 }
 
 // Template and program methods (simplified implementations)
@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"errors"
+	"net/http"
 
 	"github.com/google/uuid"
 )
@@ -13,6 +14,9 @@ var (
 	ErrForbidden    = errors.New("forbidden")
 	ErrNotFound     = errors.New("not found")
 	ErrBadRequest   = errors.New("bad request")
+	ErrConflict     = errors.New("conflict")
+	// ErrTooManyRequests is returned while a client is throttled
+	ErrTooManyRequests = errors.New("too many requests")
 )
 
 // Context keys
@@ -22,6 +26,8 @@ const (
 	UserIDKey   contextKey = "user_id"
 	UserRoleKey contextKey = "user_role"
 	UserKey     contextKey = "user"
+	// SessionIDKey identifies the session or refresh token family of the request
+	SessionIDKey contextKey = "session_id"
 )
 
 // GetUserIDFromContext extracts user ID from context
@@ -32,3 +38,24 @@ func GetUserIDFromContext(ctx context.Context) (uuid.UUID, error) {
 	}
 	return userID, nil
 }
+
+// HTTPStatusFromError maps the common errors to their HTTP status code,
+// falling back to 500 for anything unexpected
+func HTTPStatusFromError(err error) int {
+	switch {
+	case errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrTooManyRequests):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
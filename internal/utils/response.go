@@ -38,6 +38,17 @@ func WriteErrorResponse(w http.ResponseWriter, statusCode int, message string) {
 	WriteJSONResponse(w, statusCode, response)
 }
 
+// WriteServiceErrorResponse writes an error returned by a service. Client
+// errors carry the service message, anything else the fallback message.
+func WriteServiceErrorResponse(w http.ResponseWriter, err error, fallback string) {
+	statusCode := HTTPStatusFromError(err)
+	if statusCode == http.StatusInternalServerError {
+		WriteErrorResponse(w, statusCode, fallback)
+		return
+	}
+	WriteErrorResponse(w, statusCode, err.Error())
+}
+
 func WriteSuccessResponse[T any](w http.ResponseWriter, statusCode int, data T) {
 	WriteJSONResponse(w, statusCode, data)
 }
@@ -2,7 +2,9 @@ package utils
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"reflect"
 	"regexp"
@@ -29,6 +31,25 @@ func DecodeValidJSON[T any](r *http.Request) (T, error) {
 	return data, nil
 }
 
+// DecodeOptionalValidJSON is DecodeValidJSON for endpoints whose body may be
+// left out, in which case the zero value is returned without validation
+func DecodeOptionalValidJSON[T any](r *http.Request) (T, bool, error) {
+	var data T
+
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		if errors.Is(err, io.EOF) {
+			return data, false, nil
+		}
+		return data, false, fmt.Errorf("decode json: %w", err)
+	}
+
+	if err := ValidateStruct(data); err != nil {
+		return data, true, fmt.Errorf("validation failed: %w", err)
+	}
+
+	return data, true, nil
+}
+
 // DecodeValidJSONWithDetails decodes JSON and returns detailed validation errors
 func DecodeValidJSONWithDetails[T any](r *http.Request) (T, map[string]string, error) {
 	var data T